@@ -1,7 +1,12 @@
 package main
 
 import (
+	"context"
 	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/sappy5678/cryptocom/pkg/service"
 	"github.com/sappy5678/cryptocom/pkg/utl/config"
@@ -15,11 +20,37 @@ func main() {
 	cfg, err := config.Load(*cfgPath)
 	checkErr(err)
 
-	checkErr(service.Start(cfg))
+	if flag.Arg(0) == "migrate" {
+		checkErr(runMigrate(cfg, flag.Args()[1:]))
+
+		return
+	}
+	if flag.Arg(0) == "shards" {
+		checkErr(runShards(cfg, flag.Args()[1:]))
+
+		return
+	}
+
+	// Kubernetes stops pods with SIGTERM, a second signal kills the process at once
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	if flag.Arg(0) == "worker" {
+		checkErr(service.StartWorker(ctx, cfg))
+
+		return
+	}
+
+	checkErr(service.Start(ctx, cfg))
 }
 
+// checkErr logs err and exits non-zero, like when the shutdown timed out
 func checkErr(err error) {
 	if err != nil {
-		panic(err.Error())
+		log.Println(err)
+		os.Exit(1)
 	}
 }
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/sappy5678/cryptocom/deploy/db/migrations"
+	sqlitemigrations "github.com/sappy5678/cryptocom/deploy/db/sqlite/migrations"
+	"github.com/sappy5678/cryptocom/pkg/utl/config"
+	"github.com/sappy5678/cryptocom/pkg/utl/migration"
+	"github.com/sappy5678/cryptocom/pkg/utl/postgres"
+	"github.com/sappy5678/cryptocom/pkg/utl/sqlite"
+)
+
+const migrateUsage = "usage: api [-p config] migrate up|down|status|goto VERSION"
+
+// runMigrate runs the migrate subcommand with the embedded migrations of the database driver
+func runMigrate(cfg *config.Configuration, args []string) error {
+	if len(args) == 0 {
+
+		return errors.New(migrateUsage)
+	}
+
+	ctx := context.Background()
+	var db *sqlx.DB
+	var migrator *migration.Migrator
+	var err error
+	switch {
+	case cfg.Database.Memory():
+
+		return errors.New("the memory database driver has nothing to migrate")
+	case cfg.Database.Postgres():
+		db, err = postgres.NewWithConfig(&postgres.Config{
+			DSN:            cfg.Database.DSN,
+			ConnectTimeout: time.Duration(cfg.Database.ConnectTimeoutSeconds) * time.Second,
+		})
+		if err != nil {
+
+			return err
+		}
+		migrator = migration.New(db, migrations.FS)
+	default:
+		db, err = sqlite.New(&sqlite.Config{DSN: cfg.Database.DSN})
+		if err != nil {
+
+			return err
+		}
+		migrator = migration.NewSQLite(db, sqlitemigrations.FS)
+	}
+	defer db.Close()
+
+	switch {
+	case args[0] == "up" && len(args) == 1:
+		err = migrator.Up(ctx)
+	case args[0] == "down" && len(args) == 1:
+		err = migrator.Down(ctx)
+	case args[0] == "goto" && len(args) == 2:
+		version, parseErr := strconv.ParseUint(args[1], 10, 0)
+		if parseErr != nil {
+
+			return fmt.Errorf("invalid version %q, %s", args[1], migrateUsage)
+		}
+		err = migrator.Goto(ctx, uint(version))
+	case args[0] == "status" && len(args) == 1:
+	default:
+
+		return errors.New(migrateUsage)
+	}
+	if err != nil {
+
+		return err
+	}
+
+	status, err := migrator.Status(ctx)
+	if err != nil {
+
+		return err
+	}
+	fmt.Printf("version %d, dirty %t, latest %d, pending %v\n", status.Version, status.Dirty, status.Latest, status.Pending)
+
+	return nil
+}
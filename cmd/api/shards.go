@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/sappy5678/cryptocom/pkg/domain"
+	"github.com/sappy5678/cryptocom/pkg/service/wallet/repository"
+	"github.com/sappy5678/cryptocom/pkg/utl/config"
+	"github.com/sappy5678/cryptocom/pkg/utl/postgres"
+)
+
+const shardsUsage = "usage: api [-p config] shards USERID N"
+
+// runShards runs the shards subcommand, it sets the number of balance shards of a wallet
+func runShards(cfg *config.Configuration, args []string) error {
+	if len(args) != 2 {
+
+		return errors.New(shardsUsage)
+	}
+	if !cfg.Database.Postgres() {
+
+		return errors.New("sharded balances require the postgres database driver")
+	}
+	shards, err := strconv.Atoi(args[1])
+	if err != nil {
+
+		return fmt.Errorf("invalid shards %q, %s", args[1], shardsUsage)
+	}
+
+	db, err := postgres.NewWithConfig(&postgres.Config{
+		DSN:            cfg.Database.DSN,
+		ConnectTimeout: time.Duration(cfg.Database.ConnectTimeoutSeconds) * time.Second,
+	})
+	if err != nil {
+
+		return err
+	}
+	defer db.Close()
+
+	wallet, err := (&repository.Wallet{}).SetShards(context.Background(), db, domain.User{ID: args[0]}, shards)
+	if err != nil {
+
+		return err
+	}
+	fmt.Printf("wallet %s, shards %d, balance %d\n", wallet.UserID, shards, wallet.Balance)
+
+	return nil
+}
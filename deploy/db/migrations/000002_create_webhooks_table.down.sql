@@ -0,0 +1,4 @@
+BEGIN;
+DROP TABLE WebhookDelivery;
+DROP TABLE WebhookEndpoint;
+COMMIT;
@@ -0,0 +1,30 @@
+BEGIN;
+CREATE TABLE IF NOT EXISTS WebhookEndpoint (
+    ID BIGSERIAL PRIMARY KEY,
+    userID VARCHAR(36) NOT NULL,
+    url TEXT NOT NULL,
+    -- HMAC-SHA256 key used to sign every delivery
+    secret VARCHAR(64) NOT NULL,
+    -- operation types to deliver, empty means all
+    eventTypes INT[] NOT NULL DEFAULT '{}',
+    createdAt TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS WebhookDelivery (
+    ID BIGSERIAL PRIMARY KEY,
+    endpointID BIGINT NOT NULL REFERENCES WebhookEndpoint(ID) ON DELETE CASCADE,
+    transactionID VARCHAR(60) NOT NULL,
+    eventType INT NOT NULL,
+    payload JSONB NOT NULL,
+    -- 0: pending, 1: delivered, 2: dead
+    status INT NOT NULL DEFAULT 0,
+    attempts INT NOT NULL DEFAULT 0,
+    nextAttemptAt TIMESTAMP NOT NULL,
+    lastError TEXT NOT NULL DEFAULT '',
+    createdAt TIMESTAMP NOT NULL,
+    UNIQUE (endpointID, transactionID)
+);
+
+CREATE INDEX idxWebhookEndpointUserID ON WebhookEndpoint(userID);
+CREATE INDEX idxWebhookDeliveryStatusNextAttemptAt ON WebhookDelivery(status, nextAttemptAt);
+COMMIT;
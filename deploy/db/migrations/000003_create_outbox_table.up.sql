@@ -0,0 +1,13 @@
+BEGIN;
+CREATE TABLE IF NOT EXISTS Outbox (
+    ID BIGSERIAL PRIMARY KEY,
+    -- the wallet owner, events of the same wallet are published in ID order
+    aggregateID VARCHAR(36) NOT NULL,
+    eventType VARCHAR(60) NOT NULL,
+    payload JSONB NOT NULL,
+    createdAt TIMESTAMP NOT NULL,
+    publishedAt TIMESTAMP
+);
+
+CREATE INDEX idxOutboxUnpublished ON Outbox(ID) WHERE publishedAt IS NULL;
+COMMIT;
@@ -0,0 +1,6 @@
+BEGIN;
+DROP FUNCTION IF EXISTS walletTransfer(VARCHAR, VARCHAR, VARCHAR, VARCHAR, BIGINT, TIMESTAMP, INT, VARCHAR, INT, VARCHAR);
+DROP FUNCTION IF EXISTS walletWithdraw(VARCHAR, VARCHAR, BIGINT, TIMESTAMP, INT, VARCHAR);
+DROP FUNCTION IF EXISTS walletDeposit(VARCHAR, VARCHAR, BIGINT, TIMESTAMP, INT, VARCHAR);
+DROP FUNCTION IF EXISTS walletRecordEvents(VARCHAR, VARCHAR);
+COMMIT;
@@ -0,0 +1,147 @@
+BEGIN;
+DROP FUNCTION IF EXISTS walletSetShards(VARCHAR, INT);
+DROP FUNCTION IF EXISTS walletDebit(VARCHAR, BIGINT);
+DROP FUNCTION IF EXISTS walletCredit(VARCHAR, BIGINT);
+
+-- restore the unsharded functions of 000004
+-- walletRecordEvents enqueues the webhook deliveries and the outbox event of a transaction,
+-- the payload reads the wallet after the balance change
+CREATE OR REPLACE FUNCTION walletRecordEvents(pTransactionID VARCHAR, pEventType VARCHAR) RETURNS VOID AS $$
+DECLARE
+    vPayload JSONB;
+    vUserID VARCHAR;
+    vOperationType INT;
+    vCreatedAt TIMESTAMP;
+BEGIN
+    SELECT t.userID, t.operationType, t.createdAt, jsonb_build_object(
+        'eventType', t.operationType,
+        'transaction', jsonb_build_object(
+            'ID', t.ID,
+            'transactionID', t.transactionID,
+            'userID', t.userID,
+            'amount', t.amount,
+            'operationType', t.operationType,
+            'passiveUserID', t.passiveUserID,
+            'createdAt', to_char(t.createdAt, 'YYYY-MM-DD"T"HH24:MI:SS.US"Z"')),
+        'wallet', jsonb_build_object('userID', w.userID, 'balance', w.balance))
+    INTO vUserID, vOperationType, vCreatedAt, vPayload
+    FROM UserWalletTransaction t
+    JOIN UserWallet w ON w.userID = t.userID
+    WHERE t.transactionID = pTransactionID;
+
+    INSERT INTO WebhookDelivery (endpointID, transactionID, eventType, payload, status, attempts, nextAttemptAt, createdAt)
+    SELECT e.ID, pTransactionID, vOperationType, vPayload, 0, 0, vCreatedAt, vCreatedAt
+    FROM WebhookEndpoint e
+    WHERE e.userID = vUserID AND (cardinality(e.eventTypes) = 0 OR vOperationType = ANY(e.eventTypes));
+
+    INSERT INTO Outbox (aggregateID, eventType, payload, createdAt) VALUES (vUserID, pEventType, vPayload, vCreatedAt);
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION walletDeposit(pUserID VARCHAR, pTransactionID VARCHAR, pAmount BIGINT, pNow TIMESTAMP,
+    pOperationType INT, pEventType VARCHAR)
+RETURNS TABLE (status VARCHAR, userID VARCHAR, balance BIGINT) AS $$
+#variable_conflict use_column
+DECLARE
+    vBalance BIGINT;
+BEGIN
+    -- the row lock serializes requests of the wallet, so a retried transactionID sees the committed one
+    SELECT w.balance INTO vBalance FROM UserWallet w WHERE w.userID = pUserID FOR UPDATE;
+    IF NOT FOUND THEN
+        RETURN QUERY SELECT 'wallet_not_found'::VARCHAR, pUserID, 0::BIGINT;
+        RETURN;
+    END IF;
+    IF EXISTS (SELECT 1 FROM UserWalletTransaction t WHERE t.transactionID = pTransactionID) THEN
+        RETURN QUERY SELECT 'replayed'::VARCHAR, pUserID, vBalance;
+        RETURN;
+    END IF;
+
+    UPDATE UserWallet w SET balance = w.balance + pAmount WHERE w.userID = pUserID RETURNING w.balance INTO vBalance;
+    INSERT INTO UserWalletTransaction (userID, transactionID, operationType, amount, passiveUserID, createdAt)
+    VALUES (pUserID, pTransactionID, pOperationType, pAmount, '', pNow);
+    PERFORM walletRecordEvents(pTransactionID, pEventType);
+    -- wallet_events is repository.WalletEventsChannel, delivered when the transaction commits
+    PERFORM pg_notify('wallet_events', pUserID);
+
+    RETURN QUERY SELECT 'ok'::VARCHAR, pUserID, vBalance;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION walletWithdraw(pUserID VARCHAR, pTransactionID VARCHAR, pAmount BIGINT, pNow TIMESTAMP,
+    pOperationType INT, pEventType VARCHAR)
+RETURNS TABLE (status VARCHAR, userID VARCHAR, balance BIGINT) AS $$
+#variable_conflict use_column
+DECLARE
+    vBalance BIGINT;
+BEGIN
+    SELECT w.balance INTO vBalance FROM UserWallet w WHERE w.userID = pUserID FOR UPDATE;
+    IF NOT FOUND THEN
+        RETURN QUERY SELECT 'wallet_not_found'::VARCHAR, pUserID, 0::BIGINT;
+        RETURN;
+    END IF;
+    IF EXISTS (SELECT 1 FROM UserWalletTransaction t WHERE t.transactionID = pTransactionID) THEN
+        RETURN QUERY SELECT 'replayed'::VARCHAR, pUserID, vBalance;
+        RETURN;
+    END IF;
+    IF vBalance < pAmount THEN
+        RETURN QUERY SELECT 'not_enough_balance'::VARCHAR, pUserID, vBalance;
+        RETURN;
+    END IF;
+
+    UPDATE UserWallet w SET balance = w.balance - pAmount WHERE w.userID = pUserID RETURNING w.balance INTO vBalance;
+    INSERT INTO UserWalletTransaction (userID, transactionID, operationType, amount, passiveUserID, createdAt)
+    VALUES (pUserID, pTransactionID, pOperationType, pAmount, '', pNow);
+    PERFORM walletRecordEvents(pTransactionID, pEventType);
+    PERFORM pg_notify('wallet_events', pUserID);
+
+    RETURN QUERY SELECT 'ok'::VARCHAR, pUserID, vBalance;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION walletTransfer(pUserID VARCHAR, pPassiveUserID VARCHAR, pTransactionID VARCHAR,
+    pPassiveTransactionID VARCHAR, pAmount BIGINT, pNow TIMESTAMP,
+    pOperationType INT, pEventType VARCHAR, pPassiveOperationType INT, pPassiveEventType VARCHAR)
+RETURNS TABLE (status VARCHAR, userID VARCHAR, balance BIGINT) AS $$
+#variable_conflict use_column
+DECLARE
+    vBalance BIGINT;
+BEGIN
+    -- lock both wallets in userID order, so concurrent A to B and B to A transfers cannot deadlock
+    PERFORM 1 FROM UserWallet w WHERE w.userID IN (pUserID, pPassiveUserID) ORDER BY w.userID FOR UPDATE;
+
+    SELECT w.balance INTO vBalance FROM UserWallet w WHERE w.userID = pUserID;
+    IF NOT FOUND THEN
+        RETURN QUERY SELECT 'wallet_not_found'::VARCHAR, pUserID, 0::BIGINT;
+        RETURN;
+    END IF;
+    IF NOT EXISTS (SELECT 1 FROM UserWallet w WHERE w.userID = pPassiveUserID) THEN
+        RETURN QUERY SELECT 'passive_wallet_not_found'::VARCHAR, pPassiveUserID, 0::BIGINT;
+        RETURN;
+    END IF;
+    IF EXISTS (SELECT 1 FROM UserWalletTransaction t WHERE t.transactionID = pTransactionID) THEN
+        RETURN QUERY SELECT 'replayed'::VARCHAR, pUserID, vBalance;
+        RETURN;
+    END IF;
+    IF vBalance < pAmount THEN
+        RETURN QUERY SELECT 'not_enough_balance'::VARCHAR, pUserID, vBalance;
+        RETURN;
+    END IF;
+
+    UPDATE UserWallet w SET balance = w.balance - pAmount WHERE w.userID = pUserID RETURNING w.balance INTO vBalance;
+    UPDATE UserWallet w SET balance = w.balance + pAmount WHERE w.userID = pPassiveUserID;
+    INSERT INTO UserWalletTransaction (userID, transactionID, operationType, amount, passiveUserID, createdAt)
+    VALUES (pUserID, pTransactionID, pOperationType, pAmount, pPassiveUserID, pNow),
+           (pPassiveUserID, pPassiveTransactionID, pPassiveOperationType, pAmount, pUserID, pNow);
+    PERFORM walletRecordEvents(pTransactionID, pEventType);
+    PERFORM walletRecordEvents(pPassiveTransactionID, pPassiveEventType);
+    PERFORM pg_notify('wallet_events', pUserID);
+    PERFORM pg_notify('wallet_events', pPassiveUserID);
+
+    RETURN QUERY SELECT 'ok'::VARCHAR, pUserID, vBalance;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP FUNCTION IF EXISTS walletBalance(VARCHAR);
+DROP TABLE IF EXISTS UserWalletShard;
+ALTER TABLE UserWallet DROP COLUMN IF EXISTS shards;
+COMMIT;
@@ -0,0 +1,232 @@
+BEGIN;
+-- sharded balances spread the credits of a hot wallet over shards sub-rows, so concurrent deposits
+-- and incoming transfers do not serialize on its UserWallet row
+-- the balance of a wallet is its UserWallet balance plus the balances of its shards,
+-- every row is non-negative so the sum is too
+ALTER TABLE UserWallet ADD COLUMN IF NOT EXISTS shards INT NOT NULL DEFAULT 0
+    constraint shardsNonnegative check (shards >= 0);
+
+CREATE TABLE IF NOT EXISTS UserWalletShard (
+    userID VARCHAR(36) NOT NULL REFERENCES UserWallet(userID),
+    shard INT NOT NULL,
+    balance BIGINT NOT NULL DEFAULT 0
+    constraint shardBalanceNonnegative check (balance >= 0),
+    PRIMARY KEY (userID, shard)
+);
+
+-- walletBalance returns the balance of the wallet summed over its shards
+CREATE OR REPLACE FUNCTION walletBalance(pUserID VARCHAR) RETURNS BIGINT AS $$
+    SELECT w.balance + COALESCE((SELECT SUM(s.balance) FROM UserWalletShard s WHERE s.userID = w.userID), 0)::BIGINT
+    FROM UserWallet w WHERE w.userID = pUserID;
+$$ LANGUAGE sql STABLE;
+
+-- walletCredit adds pAmount to a random shard of a sharded wallet, or to its UserWallet row otherwise
+CREATE OR REPLACE FUNCTION walletCredit(pUserID VARCHAR, pAmount BIGINT) RETURNS VOID AS $$
+DECLARE
+    vShards INT;
+BEGIN
+    SELECT w.shards INTO vShards FROM UserWallet w WHERE w.userID = pUserID;
+    IF vShards = 0 THEN
+        UPDATE UserWallet w SET balance = w.balance + pAmount WHERE w.userID = pUserID;
+    ELSE
+        UPDATE UserWalletShard s SET balance = s.balance + pAmount
+        WHERE s.userID = pUserID AND s.shard = floor(random() * vShards)::INT;
+        -- the shard was removed by a concurrent walletSetShards
+        IF NOT FOUND THEN
+            UPDATE UserWallet w SET balance = w.balance + pAmount WHERE w.userID = pUserID;
+        END IF;
+    END IF;
+END;
+$$ LANGUAGE plpgsql;
+
+-- walletDebit takes pAmount from the UserWallet row first and borrows the rest from the shards,
+-- it returns false without any change when the balance is not enough
+-- the caller holds the UserWallet row lock, so debits of a wallet are serialized and only credits run concurrently,
+-- which can only raise the shard balances read here
+CREATE OR REPLACE FUNCTION walletDebit(pUserID VARCHAR, pAmount BIGINT) RETURNS BOOLEAN AS $$
+DECLARE
+    vRemaining BIGINT := pAmount;
+    vTake BIGINT;
+    vShard RECORD;
+BEGIN
+    IF walletBalance(pUserID) < pAmount THEN
+        RETURN FALSE;
+    END IF;
+
+    SELECT LEAST(w.balance, vRemaining) INTO vTake FROM UserWallet w WHERE w.userID = pUserID;
+    UPDATE UserWallet w SET balance = w.balance - vTake WHERE w.userID = pUserID;
+    vRemaining := vRemaining - vTake;
+
+    FOR vShard IN SELECT s.shard, s.balance FROM UserWalletShard s
+        WHERE s.userID = pUserID AND s.balance > 0 ORDER BY s.shard FOR UPDATE
+    LOOP
+        EXIT WHEN vRemaining = 0;
+        vTake := LEAST(vShard.balance, vRemaining);
+        UPDATE UserWalletShard s SET balance = s.balance - vTake WHERE s.userID = pUserID AND s.shard = vShard.shard;
+        vRemaining := vRemaining - vTake;
+    END LOOP;
+
+    RETURN TRUE;
+END;
+$$ LANGUAGE plpgsql;
+
+-- walletSetShards changes the number of shards of the wallet, 0 turns sharding off,
+-- the balances of removed shards are folded back into the UserWallet row
+CREATE OR REPLACE FUNCTION walletSetShards(pUserID VARCHAR, pShards INT)
+RETURNS TABLE (status VARCHAR, userID VARCHAR, balance BIGINT) AS $$
+#variable_conflict use_column
+BEGIN
+    PERFORM 1 FROM UserWallet w WHERE w.userID = pUserID FOR UPDATE;
+    IF NOT FOUND THEN
+        RETURN QUERY SELECT 'wallet_not_found'::VARCHAR, pUserID, 0::BIGINT;
+        RETURN;
+    END IF;
+
+    -- the removed shards are locked before they are summed, so no credit lands on them between the sum and the delete
+    PERFORM 1 FROM UserWalletShard s WHERE s.userID = pUserID AND s.shard >= pShards FOR UPDATE;
+    UPDATE UserWallet w SET balance = w.balance + COALESCE((SELECT SUM(s.balance) FROM UserWalletShard s
+        WHERE s.userID = pUserID AND s.shard >= pShards), 0), shards = pShards
+    WHERE w.userID = pUserID;
+    DELETE FROM UserWalletShard s WHERE s.userID = pUserID AND s.shard >= pShards;
+    INSERT INTO UserWalletShard (userID, shard) SELECT pUserID, generate_series(0, pShards - 1)
+    ON CONFLICT DO NOTHING;
+
+    RETURN QUERY SELECT 'ok'::VARCHAR, pUserID, walletBalance(pUserID);
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION walletRecordEvents(pTransactionID VARCHAR, pEventType VARCHAR) RETURNS VOID AS $$
+DECLARE
+    vPayload JSONB;
+    vUserID VARCHAR;
+    vOperationType INT;
+    vCreatedAt TIMESTAMP;
+BEGIN
+    SELECT t.userID, t.operationType, t.createdAt, jsonb_build_object(
+        'eventType', t.operationType,
+        'transaction', jsonb_build_object(
+            'ID', t.ID,
+            'transactionID', t.transactionID,
+            'userID', t.userID,
+            'amount', t.amount,
+            'operationType', t.operationType,
+            'passiveUserID', t.passiveUserID,
+            'createdAt', to_char(t.createdAt, 'YYYY-MM-DD"T"HH24:MI:SS.US"Z"')),
+        'wallet', jsonb_build_object('userID', t.userID, 'balance', walletBalance(t.userID)))
+    INTO vUserID, vOperationType, vCreatedAt, vPayload
+    FROM UserWalletTransaction t
+    WHERE t.transactionID = pTransactionID;
+
+    INSERT INTO WebhookDelivery (endpointID, transactionID, eventType, payload, status, attempts, nextAttemptAt, createdAt)
+    SELECT e.ID, pTransactionID, vOperationType, vPayload, 0, 0, vCreatedAt, vCreatedAt
+    FROM WebhookEndpoint e
+    WHERE e.userID = vUserID AND (cardinality(e.eventTypes) = 0 OR vOperationType = ANY(e.eventTypes));
+
+    INSERT INTO Outbox (aggregateID, eventType, payload, createdAt) VALUES (vUserID, pEventType, vPayload, vCreatedAt);
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION walletDeposit(pUserID VARCHAR, pTransactionID VARCHAR, pAmount BIGINT, pNow TIMESTAMP,
+    pOperationType INT, pEventType VARCHAR)
+RETURNS TABLE (status VARCHAR, userID VARCHAR, balance BIGINT) AS $$
+#variable_conflict use_column
+DECLARE
+    vShards INT;
+BEGIN
+    SELECT w.shards INTO vShards FROM UserWallet w WHERE w.userID = pUserID;
+    IF NOT FOUND THEN
+        RETURN QUERY SELECT 'wallet_not_found'::VARCHAR, pUserID, 0::BIGINT;
+        RETURN;
+    END IF;
+    -- the row lock serializes requests of the wallet, so a retried transactionID sees the committed one,
+    -- a sharded wallet skips it and a concurrent retry fails on the transactionID unique key instead
+    IF vShards = 0 THEN
+        PERFORM 1 FROM UserWallet w WHERE w.userID = pUserID FOR UPDATE;
+    END IF;
+    IF EXISTS (SELECT 1 FROM UserWalletTransaction t WHERE t.transactionID = pTransactionID) THEN
+        RETURN QUERY SELECT 'replayed'::VARCHAR, pUserID, walletBalance(pUserID);
+        RETURN;
+    END IF;
+
+    PERFORM walletCredit(pUserID, pAmount);
+    INSERT INTO UserWalletTransaction (userID, transactionID, operationType, amount, passiveUserID, createdAt)
+    VALUES (pUserID, pTransactionID, pOperationType, pAmount, '', pNow);
+    PERFORM walletRecordEvents(pTransactionID, pEventType);
+    -- wallet_events is repository.WalletEventsChannel, delivered when the transaction commits
+    PERFORM pg_notify('wallet_events', pUserID);
+
+    RETURN QUERY SELECT 'ok'::VARCHAR, pUserID, walletBalance(pUserID);
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION walletWithdraw(pUserID VARCHAR, pTransactionID VARCHAR, pAmount BIGINT, pNow TIMESTAMP,
+    pOperationType INT, pEventType VARCHAR)
+RETURNS TABLE (status VARCHAR, userID VARCHAR, balance BIGINT) AS $$
+#variable_conflict use_column
+BEGIN
+    -- debits always take the row lock, sharded or not
+    PERFORM 1 FROM UserWallet w WHERE w.userID = pUserID FOR UPDATE;
+    IF NOT FOUND THEN
+        RETURN QUERY SELECT 'wallet_not_found'::VARCHAR, pUserID, 0::BIGINT;
+        RETURN;
+    END IF;
+    IF EXISTS (SELECT 1 FROM UserWalletTransaction t WHERE t.transactionID = pTransactionID) THEN
+        RETURN QUERY SELECT 'replayed'::VARCHAR, pUserID, walletBalance(pUserID);
+        RETURN;
+    END IF;
+    IF NOT walletDebit(pUserID, pAmount) THEN
+        RETURN QUERY SELECT 'not_enough_balance'::VARCHAR, pUserID, walletBalance(pUserID);
+        RETURN;
+    END IF;
+
+    INSERT INTO UserWalletTransaction (userID, transactionID, operationType, amount, passiveUserID, createdAt)
+    VALUES (pUserID, pTransactionID, pOperationType, pAmount, '', pNow);
+    PERFORM walletRecordEvents(pTransactionID, pEventType);
+    PERFORM pg_notify('wallet_events', pUserID);
+
+    RETURN QUERY SELECT 'ok'::VARCHAR, pUserID, walletBalance(pUserID);
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION walletTransfer(pUserID VARCHAR, pPassiveUserID VARCHAR, pTransactionID VARCHAR,
+    pPassiveTransactionID VARCHAR, pAmount BIGINT, pNow TIMESTAMP,
+    pOperationType INT, pEventType VARCHAR, pPassiveOperationType INT, pPassiveEventType VARCHAR)
+RETURNS TABLE (status VARCHAR, userID VARCHAR, balance BIGINT) AS $$
+#variable_conflict use_column
+BEGIN
+    -- lock the sender and an unsharded receiver in userID order, so concurrent A to B and B to A transfers
+    -- cannot deadlock, a sharded receiver is credited on a shard without its row lock
+    PERFORM 1 FROM UserWallet w
+    WHERE w.userID = pUserID OR (w.userID = pPassiveUserID AND w.shards = 0)
+    ORDER BY w.userID FOR UPDATE;
+
+    IF NOT EXISTS (SELECT 1 FROM UserWallet w WHERE w.userID = pUserID) THEN
+        RETURN QUERY SELECT 'wallet_not_found'::VARCHAR, pUserID, 0::BIGINT;
+        RETURN;
+    END IF;
+    IF NOT EXISTS (SELECT 1 FROM UserWallet w WHERE w.userID = pPassiveUserID) THEN
+        RETURN QUERY SELECT 'passive_wallet_not_found'::VARCHAR, pPassiveUserID, 0::BIGINT;
+        RETURN;
+    END IF;
+    IF EXISTS (SELECT 1 FROM UserWalletTransaction t WHERE t.transactionID = pTransactionID) THEN
+        RETURN QUERY SELECT 'replayed'::VARCHAR, pUserID, walletBalance(pUserID);
+        RETURN;
+    END IF;
+    IF NOT walletDebit(pUserID, pAmount) THEN
+        RETURN QUERY SELECT 'not_enough_balance'::VARCHAR, pUserID, walletBalance(pUserID);
+        RETURN;
+    END IF;
+
+    PERFORM walletCredit(pPassiveUserID, pAmount);
+    INSERT INTO UserWalletTransaction (userID, transactionID, operationType, amount, passiveUserID, createdAt)
+    VALUES (pUserID, pTransactionID, pOperationType, pAmount, pPassiveUserID, pNow),
+           (pPassiveUserID, pPassiveTransactionID, pPassiveOperationType, pAmount, pUserID, pNow);
+    PERFORM walletRecordEvents(pTransactionID, pEventType);
+    PERFORM walletRecordEvents(pPassiveTransactionID, pPassiveEventType);
+    PERFORM pg_notify('wallet_events', pUserID);
+    PERFORM pg_notify('wallet_events', pPassiveUserID);
+
+    RETURN QUERY SELECT 'ok'::VARCHAR, pUserID, walletBalance(pUserID);
+END;
+$$ LANGUAGE plpgsql;
+COMMIT;
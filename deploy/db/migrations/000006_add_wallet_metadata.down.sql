@@ -0,0 +1,6 @@
+BEGIN;
+ALTER TABLE UserWallet
+    DROP COLUMN IF EXISTS tags,
+    DROP COLUMN IF EXISTS asset,
+    DROP COLUMN IF EXISTS displayName;
+COMMIT;
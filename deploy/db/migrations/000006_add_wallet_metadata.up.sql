@@ -0,0 +1,7 @@
+BEGIN;
+-- optional metadata given on creation, the limits are checked by domain.WalletMetadata.Validate
+ALTER TABLE UserWallet
+    ADD COLUMN IF NOT EXISTS displayName VARCHAR(100) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS asset VARCHAR(16) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS tags TEXT[] NOT NULL DEFAULT '{}';
+COMMIT;
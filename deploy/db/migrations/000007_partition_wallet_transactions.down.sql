@@ -0,0 +1,33 @@
+BEGIN;
+-- the transactions of archived partitions are not restored, load their archive files first to keep them
+DROP TRIGGER IF EXISTS trgUserWalletTransactionKey ON UserWalletTransaction;
+DROP FUNCTION IF EXISTS walletRecordTransactionKey();
+DROP FUNCTION IF EXISTS walletCreateTransactionPartitions(TIMESTAMP, TIMESTAMP);
+
+ALTER TABLE UserWalletTransaction RENAME TO UserWalletTransactionPartitioned;
+ALTER SEQUENCE userwallettransaction_id_seq OWNED BY NONE;
+DROP TABLE UserWalletTransactionKey;
+
+CREATE TABLE UserWalletTransaction (
+    ID BIGINT NOT NULL DEFAULT nextval('userwallettransaction_id_seq') PRIMARY KEY,
+    userID VARCHAR(36) NOT NULL,
+    transactionID VARCHAR(60) UNIQUE NOT NULL,
+    operationType INT NOT NULL,
+    passiveUserID VARCHAR(36),
+    amount BIGINT NOT NULL,
+    createdAt TIMESTAMP NOT NULL
+);
+ALTER SEQUENCE userwallettransaction_id_seq OWNED BY UserWalletTransaction.ID;
+
+INSERT INTO UserWalletTransaction (ID, userID, transactionID, operationType, passiveUserID, amount, createdAt)
+SELECT ID, userID, transactionID, operationType, passiveUserID, amount, createdAt FROM UserWalletTransactionPartitioned;
+
+-- drops the attached partitions with it, detached ones are left as plain tables
+DROP TABLE UserWalletTransactionPartitioned;
+
+CREATE INDEX idxUserWalletTransactionUserIDCreatedAtID ON UserWalletTransaction(userID, createdAt, ID);
+CREATE INDEX idxUserWalletTransactionTransactionID ON UserWalletTransaction(transactionID);
+
+DROP TABLE IF EXISTS UserWalletTransactionArchiveUser;
+DROP TABLE IF EXISTS UserWalletTransactionArchive;
+COMMIT;
@@ -0,0 +1,104 @@
+BEGIN;
+-- UserWalletTransaction is range partitioned by month on createdAt, so old months can be archived and detached
+-- instead of growing one table forever, the rows are copied here, large tables need a maintenance window
+
+-- archived partitions, written by the archiver when it detaches a partition, the location is the archive file
+CREATE TABLE IF NOT EXISTS UserWalletTransactionArchive (
+    partitionName VARCHAR(63) PRIMARY KEY,
+    rangeStart TIMESTAMP NOT NULL,
+    rangeEnd TIMESTAMP NOT NULL,
+    location TEXT NOT NULL,
+    transactions BIGINT NOT NULL,
+    archivedAt TIMESTAMP NOT NULL
+);
+
+-- the users of each archived partition, so only the histories reaching an archived month look for it
+CREATE TABLE IF NOT EXISTS UserWalletTransactionArchiveUser (
+    partitionName VARCHAR(63) NOT NULL REFERENCES UserWalletTransactionArchive(partitionName) ON DELETE CASCADE,
+    userID VARCHAR(36) NOT NULL,
+    oldestCreatedAt TIMESTAMP NOT NULL,
+    transactions BIGINT NOT NULL,
+    PRIMARY KEY (userID, partitionName)
+);
+
+ALTER TABLE UserWalletTransaction RENAME TO UserWalletTransactionUnpartitioned;
+-- the IDs continue from the sequence of the old table, which must survive its drop
+ALTER SEQUENCE userwallettransaction_id_seq OWNED BY NONE;
+
+-- the primary key of a partitioned table includes the partition key
+CREATE TABLE UserWalletTransaction (
+    ID BIGINT NOT NULL DEFAULT nextval('userwallettransaction_id_seq'),
+    userID VARCHAR(36) NOT NULL,
+    transactionID VARCHAR(60) NOT NULL,
+    operationType INT NOT NULL,
+    passiveUserID VARCHAR(36),
+    amount BIGINT NOT NULL,
+    createdAt TIMESTAMP NOT NULL,
+    PRIMARY KEY (ID, createdAt)
+) PARTITION BY RANGE (createdAt);
+ALTER SEQUENCE userwallettransaction_id_seq OWNED BY UserWalletTransaction.ID;
+
+-- rows outside every monthly partition, like a clock far off, land here instead of failing the write
+CREATE TABLE UserWalletTransactionDefault PARTITION OF UserWalletTransaction DEFAULT;
+
+-- walletCreateTransactionPartitions creates the missing monthly partitions from the month of pFrom to the month of pTo,
+-- named userwallettransaction_YYYYMM, archived months are not created again, it returns the number created
+CREATE OR REPLACE FUNCTION walletCreateTransactionPartitions(pFrom TIMESTAMP, pTo TIMESTAMP) RETURNS INT AS $$
+DECLARE
+    vMonth TIMESTAMP := date_trunc('month', pFrom);
+    vName TEXT;
+    vCreated INT := 0;
+BEGIN
+    -- replicas creating the same partitions take turns, "parts" in ascii
+    PERFORM pg_advisory_xact_lock(482671228019);
+    WHILE vMonth <= pTo LOOP
+        vName := 'userwallettransaction_' || to_char(vMonth, 'YYYYMM');
+        IF to_regclass(vName) IS NULL
+            AND NOT EXISTS (SELECT 1 FROM UserWalletTransactionArchive a WHERE a.partitionName = vName) THEN
+            EXECUTE format('CREATE TABLE %I PARTITION OF UserWalletTransaction FOR VALUES FROM (%L) TO (%L)',
+                vName, vMonth, vMonth + INTERVAL '1 month');
+            vCreated := vCreated + 1;
+        END IF;
+        vMonth := vMonth + INTERVAL '1 month';
+    END LOOP;
+
+    RETURN vCreated;
+END;
+$$ LANGUAGE plpgsql;
+
+SELECT walletCreateTransactionPartitions(
+    COALESCE((SELECT MIN(createdAt) FROM UserWalletTransactionUnpartitioned), now()::TIMESTAMP),
+    (now() + INTERVAL '3 months')::TIMESTAMP);
+
+INSERT INTO UserWalletTransaction (ID, userID, transactionID, operationType, passiveUserID, amount, createdAt)
+SELECT ID, userID, transactionID, operationType, passiveUserID, amount, createdAt FROM UserWalletTransactionUnpartitioned;
+
+-- a unique transactionID across partitions needs a table of its own, archived transactionIDs stay in it,
+-- so a retried request is still replayed after its transaction is archived
+CREATE TABLE UserWalletTransactionKey (
+    transactionID VARCHAR(60) NOT NULL,
+    createdAt TIMESTAMP NOT NULL
+);
+INSERT INTO UserWalletTransactionKey (transactionID, createdAt)
+SELECT transactionID, createdAt FROM UserWalletTransactionUnpartitioned;
+
+DROP TABLE UserWalletTransactionUnpartitioned;
+
+-- the constraint keeps the name of the old unique key, the wallet repository replays on its violation
+ALTER TABLE UserWalletTransactionKey ADD CONSTRAINT userwallettransaction_transactionid_key PRIMARY KEY (transactionID);
+
+CREATE INDEX idxUserWalletTransactionUserIDCreatedAtID ON UserWalletTransaction(userID, createdAt, ID);
+CREATE INDEX idxUserWalletTransactionTransactionID ON UserWalletTransaction(transactionID);
+
+-- walletRecordTransactionKey claims the transactionID of every inserted transaction, a duplicate fails the insert
+CREATE OR REPLACE FUNCTION walletRecordTransactionKey() RETURNS TRIGGER AS $$
+BEGIN
+    INSERT INTO UserWalletTransactionKey (transactionID, createdAt) VALUES (NEW.transactionID, NEW.createdAt);
+
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER trgUserWalletTransactionKey AFTER INSERT ON UserWalletTransaction
+    FOR EACH ROW EXECUTE FUNCTION walletRecordTransactionKey();
+COMMIT;
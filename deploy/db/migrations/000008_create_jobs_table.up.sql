@@ -0,0 +1,19 @@
+BEGIN;
+-- background jobs, runners claim due pending jobs with FOR UPDATE SKIP LOCKED and lease them by moving runAt
+CREATE TABLE IF NOT EXISTS Job (
+    ID BIGSERIAL PRIMARY KEY,
+    jobType VARCHAR(64) NOT NULL,
+    payload JSONB NOT NULL,
+    -- 0 pending, 1 done, 2 dead
+    status INT NOT NULL DEFAULT 0,
+    attempts INT NOT NULL DEFAULT 0,
+    maxAttempts INT NOT NULL,
+    runAt TIMESTAMP NOT NULL,
+    lastError TEXT NOT NULL DEFAULT '',
+    createdAt TIMESTAMP NOT NULL,
+    finishedAt TIMESTAMP
+);
+
+CREATE INDEX idxJobPendingRunAt ON Job(runAt) WHERE status = 0;
+CREATE INDEX idxJobFinishedAt ON Job(finishedAt) WHERE status <> 0;
+COMMIT;
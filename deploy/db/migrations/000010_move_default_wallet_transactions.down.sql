@@ -0,0 +1,25 @@
+BEGIN;
+-- the function of 000007, rows already moved out of the default partition stay in their monthly partitions
+CREATE OR REPLACE FUNCTION walletCreateTransactionPartitions(pFrom TIMESTAMP, pTo TIMESTAMP) RETURNS INT AS $$
+DECLARE
+    vMonth TIMESTAMP := date_trunc('month', pFrom);
+    vName TEXT;
+    vCreated INT := 0;
+BEGIN
+    -- replicas creating the same partitions take turns, "parts" in ascii
+    PERFORM pg_advisory_xact_lock(482671228019);
+    WHILE vMonth <= pTo LOOP
+        vName := 'userwallettransaction_' || to_char(vMonth, 'YYYYMM');
+        IF to_regclass(vName) IS NULL
+            AND NOT EXISTS (SELECT 1 FROM UserWalletTransactionArchive a WHERE a.partitionName = vName) THEN
+            EXECUTE format('CREATE TABLE %I PARTITION OF UserWalletTransaction FOR VALUES FROM (%L) TO (%L)',
+                vName, vMonth, vMonth + INTERVAL '1 month');
+            vCreated := vCreated + 1;
+        END IF;
+        vMonth := vMonth + INTERVAL '1 month';
+    END LOOP;
+
+    RETURN vCreated;
+END;
+$$ LANGUAGE plpgsql;
+COMMIT;
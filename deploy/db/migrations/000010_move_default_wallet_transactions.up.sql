@@ -0,0 +1,39 @@
+BEGIN;
+-- walletCreateTransactionPartitions creates the missing monthly partitions from the month of pFrom to the month of pTo,
+-- named userwallettransaction_YYYYMM, archived months are not created again, it returns the number created
+-- the rows of the month which landed in UserWalletTransactionDefault before its partition existed, like from a clock
+-- far off, are moved into the new partition, postgres refuses to create a partition whose rows are in the default one
+CREATE OR REPLACE FUNCTION walletCreateTransactionPartitions(pFrom TIMESTAMP, pTo TIMESTAMP) RETURNS INT AS $$
+DECLARE
+    vMonth TIMESTAMP := date_trunc('month', pFrom);
+    vName TEXT;
+    vCreated INT := 0;
+BEGIN
+    -- replicas creating the same partitions take turns, "parts" in ascii
+    PERFORM pg_advisory_xact_lock(482671228019);
+    WHILE vMonth <= pTo LOOP
+        vName := 'userwallettransaction_' || to_char(vMonth, 'YYYYMM');
+        IF to_regclass(vName) IS NULL
+            AND NOT EXISTS (SELECT 1 FROM UserWalletTransactionArchive a WHERE a.partitionName = vName) THEN
+            IF EXISTS (SELECT 1 FROM UserWalletTransactionDefault d
+                WHERE d.createdAt >= vMonth AND d.createdAt < vMonth + INTERVAL '1 month') THEN
+                -- the rows are moved into a plain table which is then attached, its transactionIDs are already claimed
+                -- and the indexes of UserWalletTransaction are created on attach
+                EXECUTE format('CREATE TABLE %I (LIKE UserWalletTransaction INCLUDING DEFAULTS INCLUDING CONSTRAINTS)', vName);
+                EXECUTE format('WITH moved AS (DELETE FROM UserWalletTransactionDefault WHERE createdAt >= %L AND createdAt < %L RETURNING *)
+                    INSERT INTO %I SELECT * FROM moved', vMonth, vMonth + INTERVAL '1 month', vName);
+                EXECUTE format('ALTER TABLE UserWalletTransaction ATTACH PARTITION %I FOR VALUES FROM (%L) TO (%L)',
+                    vName, vMonth, vMonth + INTERVAL '1 month');
+            ELSE
+                EXECUTE format('CREATE TABLE %I PARTITION OF UserWalletTransaction FOR VALUES FROM (%L) TO (%L)',
+                    vName, vMonth, vMonth + INTERVAL '1 month');
+            END IF;
+            vCreated := vCreated + 1;
+        END IF;
+        vMonth := vMonth + INTERVAL '1 month';
+    END LOOP;
+
+    RETURN vCreated;
+END;
+$$ LANGUAGE plpgsql;
+COMMIT;
@@ -0,0 +1,112 @@
+BEGIN;
+-- the write functions replay a transactionID found in UserWalletTransactionKey, which keeps the transactionIDs
+-- of the archived months, UserWalletTransaction lost them when their partition was detached,
+-- so a retried request whose transaction is archived is replayed instead of failing on the key
+CREATE OR REPLACE FUNCTION walletDeposit(pUserID VARCHAR, pTransactionID VARCHAR, pAmount BIGINT, pNow TIMESTAMP,
+    pOperationType INT, pEventType VARCHAR)
+RETURNS TABLE (status VARCHAR, userID VARCHAR, balance BIGINT) AS $$
+#variable_conflict use_column
+DECLARE
+    vShards INT;
+BEGIN
+    SELECT w.shards INTO vShards FROM UserWallet w WHERE w.userID = pUserID;
+    IF NOT FOUND THEN
+        RETURN QUERY SELECT 'wallet_not_found'::VARCHAR, pUserID, 0::BIGINT;
+        RETURN;
+    END IF;
+    -- the row lock serializes requests of the wallet, so a retried transactionID sees the committed one,
+    -- a sharded wallet skips it and a concurrent retry fails on the transactionID unique key instead
+    IF vShards = 0 THEN
+        PERFORM 1 FROM UserWallet w WHERE w.userID = pUserID FOR UPDATE;
+    END IF;
+    IF EXISTS (SELECT 1 FROM UserWalletTransactionKey k WHERE k.transactionID = pTransactionID) THEN
+        RETURN QUERY SELECT 'replayed'::VARCHAR, pUserID, walletBalance(pUserID);
+        RETURN;
+    END IF;
+
+    PERFORM walletCredit(pUserID, pAmount);
+    PERFORM walletLockEvents(pUserID);
+    INSERT INTO UserWalletTransaction (userID, transactionID, operationType, amount, passiveUserID, createdAt)
+    VALUES (pUserID, pTransactionID, pOperationType, pAmount, '', pNow);
+    PERFORM walletRecordEvents(pTransactionID, pEventType);
+    -- wallet_events is repository.WalletEventsChannel, delivered when the transaction commits
+    PERFORM pg_notify('wallet_events', pUserID);
+
+    RETURN QUERY SELECT 'ok'::VARCHAR, pUserID, walletBalance(pUserID);
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION walletWithdraw(pUserID VARCHAR, pTransactionID VARCHAR, pAmount BIGINT, pNow TIMESTAMP,
+    pOperationType INT, pEventType VARCHAR)
+RETURNS TABLE (status VARCHAR, userID VARCHAR, balance BIGINT) AS $$
+#variable_conflict use_column
+BEGIN
+    -- debits always take the row lock, sharded or not
+    PERFORM 1 FROM UserWallet w WHERE w.userID = pUserID FOR UPDATE;
+    IF NOT FOUND THEN
+        RETURN QUERY SELECT 'wallet_not_found'::VARCHAR, pUserID, 0::BIGINT;
+        RETURN;
+    END IF;
+    IF EXISTS (SELECT 1 FROM UserWalletTransactionKey k WHERE k.transactionID = pTransactionID) THEN
+        RETURN QUERY SELECT 'replayed'::VARCHAR, pUserID, walletBalance(pUserID);
+        RETURN;
+    END IF;
+    IF NOT walletDebit(pUserID, pAmount) THEN
+        RETURN QUERY SELECT 'not_enough_balance'::VARCHAR, pUserID, walletBalance(pUserID);
+        RETURN;
+    END IF;
+
+    PERFORM walletLockEvents(pUserID);
+    INSERT INTO UserWalletTransaction (userID, transactionID, operationType, amount, passiveUserID, createdAt)
+    VALUES (pUserID, pTransactionID, pOperationType, pAmount, '', pNow);
+    PERFORM walletRecordEvents(pTransactionID, pEventType);
+    PERFORM pg_notify('wallet_events', pUserID);
+
+    RETURN QUERY SELECT 'ok'::VARCHAR, pUserID, walletBalance(pUserID);
+END;
+$$ LANGUAGE plpgsql;
+
+-- both event locks are taken in key order, so concurrent A to B and B to A transfers cannot deadlock on them
+CREATE OR REPLACE FUNCTION walletTransfer(pUserID VARCHAR, pPassiveUserID VARCHAR, pTransactionID VARCHAR,
+    pPassiveTransactionID VARCHAR, pAmount BIGINT, pNow TIMESTAMP,
+    pOperationType INT, pEventType VARCHAR, pPassiveOperationType INT, pPassiveEventType VARCHAR)
+RETURNS TABLE (status VARCHAR, userID VARCHAR, balance BIGINT) AS $$
+#variable_conflict use_column
+BEGIN
+    -- lock the sender and an unsharded receiver in userID order, so concurrent A to B and B to A transfers
+    -- cannot deadlock, a sharded receiver is credited on a shard without its row lock
+    PERFORM 1 FROM UserWallet w
+    WHERE w.userID = pUserID OR (w.userID = pPassiveUserID AND w.shards = 0)
+    ORDER BY w.userID FOR UPDATE;
+
+    IF NOT EXISTS (SELECT 1 FROM UserWallet w WHERE w.userID = pUserID) THEN
+        RETURN QUERY SELECT 'wallet_not_found'::VARCHAR, pUserID, 0::BIGINT;
+        RETURN;
+    END IF;
+    IF NOT EXISTS (SELECT 1 FROM UserWallet w WHERE w.userID = pPassiveUserID) THEN
+        RETURN QUERY SELECT 'passive_wallet_not_found'::VARCHAR, pPassiveUserID, 0::BIGINT;
+        RETURN;
+    END IF;
+    IF EXISTS (SELECT 1 FROM UserWalletTransactionKey k WHERE k.transactionID = pTransactionID) THEN
+        RETURN QUERY SELECT 'replayed'::VARCHAR, pUserID, walletBalance(pUserID);
+        RETURN;
+    END IF;
+    IF NOT walletDebit(pUserID, pAmount) THEN
+        RETURN QUERY SELECT 'not_enough_balance'::VARCHAR, pUserID, walletBalance(pUserID);
+        RETURN;
+    END IF;
+
+    PERFORM walletCredit(pPassiveUserID, pAmount);
+    PERFORM walletLockEvents(u) FROM unnest(ARRAY[pUserID, pPassiveUserID]) u ORDER BY hashtext(u);
+    INSERT INTO UserWalletTransaction (userID, transactionID, operationType, amount, passiveUserID, createdAt)
+    VALUES (pUserID, pTransactionID, pOperationType, pAmount, pPassiveUserID, pNow),
+           (pPassiveUserID, pPassiveTransactionID, pPassiveOperationType, pAmount, pUserID, pNow);
+    PERFORM walletRecordEvents(pTransactionID, pEventType);
+    PERFORM walletRecordEvents(pPassiveTransactionID, pPassiveEventType);
+    PERFORM pg_notify('wallet_events', pUserID);
+    PERFORM pg_notify('wallet_events', pPassiveUserID);
+
+    RETURN QUERY SELECT 'ok'::VARCHAR, pUserID, walletBalance(pUserID);
+END;
+$$ LANGUAGE plpgsql;
+COMMIT;
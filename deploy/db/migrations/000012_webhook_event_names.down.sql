@@ -0,0 +1,58 @@
+BEGIN;
+-- back to the operation types of 000002, an event name without one becomes 0
+CREATE FUNCTION webhookOperationType(pEventType VARCHAR) RETURNS INT AS $$
+    SELECT CASE pEventType
+        WHEN 'wallet.deposited' THEN 1
+        WHEN 'wallet.withdrawn' THEN 2
+        WHEN 'wallet.transferred_in' THEN 3
+        WHEN 'wallet.transferred_out' THEN 4
+        ELSE 0
+    END;
+$$ LANGUAGE sql IMMUTABLE;
+
+CREATE FUNCTION webhookOperationTypes(pEventTypes VARCHAR[]) RETURNS INT[] AS $$
+    SELECT COALESCE(array_agg(webhookOperationType(e) ORDER BY i), '{}')
+    FROM unnest(pEventTypes) WITH ORDINALITY AS u(e, i);
+$$ LANGUAGE sql IMMUTABLE;
+
+ALTER TABLE WebhookEndpoint ALTER COLUMN eventTypes DROP DEFAULT;
+ALTER TABLE WebhookEndpoint ALTER COLUMN eventTypes TYPE INT[] USING webhookOperationTypes(eventTypes);
+ALTER TABLE WebhookEndpoint ALTER COLUMN eventTypes SET DEFAULT '{}';
+ALTER TABLE WebhookDelivery ALTER COLUMN eventType TYPE INT USING webhookOperationType(eventType);
+UPDATE WebhookDelivery SET payload = jsonb_set(payload, '{eventType}', to_jsonb(eventType));
+
+DROP FUNCTION webhookOperationTypes(VARCHAR[]);
+DROP FUNCTION webhookOperationType(VARCHAR);
+
+-- the function of 000005
+CREATE OR REPLACE FUNCTION walletRecordEvents(pTransactionID VARCHAR, pEventType VARCHAR) RETURNS VOID AS $$
+DECLARE
+    vPayload JSONB;
+    vUserID VARCHAR;
+    vOperationType INT;
+    vCreatedAt TIMESTAMP;
+BEGIN
+    SELECT t.userID, t.operationType, t.createdAt, jsonb_build_object(
+        'eventType', t.operationType,
+        'transaction', jsonb_build_object(
+            'ID', t.ID,
+            'transactionID', t.transactionID,
+            'userID', t.userID,
+            'amount', t.amount,
+            'operationType', t.operationType,
+            'passiveUserID', t.passiveUserID,
+            'createdAt', to_char(t.createdAt, 'YYYY-MM-DD"T"HH24:MI:SS.US"Z"')),
+        'wallet', jsonb_build_object('userID', t.userID, 'balance', walletBalance(t.userID)))
+    INTO vUserID, vOperationType, vCreatedAt, vPayload
+    FROM UserWalletTransaction t
+    WHERE t.transactionID = pTransactionID;
+
+    INSERT INTO WebhookDelivery (endpointID, transactionID, eventType, payload, status, attempts, nextAttemptAt, createdAt)
+    SELECT e.ID, pTransactionID, vOperationType, vPayload, 0, 0, vCreatedAt, vCreatedAt
+    FROM WebhookEndpoint e
+    WHERE e.userID = vUserID AND (cardinality(e.eventTypes) = 0 OR vOperationType = ANY(e.eventTypes));
+
+    INSERT INTO Outbox (aggregateID, eventType, payload, createdAt) VALUES (vUserID, pEventType, vPayload, vCreatedAt);
+END;
+$$ LANGUAGE plpgsql;
+COMMIT;
@@ -0,0 +1,57 @@
+BEGIN;
+-- webhooks name their events like the outbox, wallet.deposited, wallet.withdrawn, wallet.transferred_in and
+-- wallet.transferred_out, instead of the operation types 1 to 4, in the subscriptions, the deliveries and their payload
+CREATE FUNCTION webhookEventType(pOperationType INT) RETURNS VARCHAR AS $$
+    SELECT CASE pOperationType
+        WHEN 1 THEN 'wallet.deposited'
+        WHEN 2 THEN 'wallet.withdrawn'
+        WHEN 3 THEN 'wallet.transferred_in'
+        WHEN 4 THEN 'wallet.transferred_out'
+    END;
+$$ LANGUAGE sql IMMUTABLE;
+
+CREATE FUNCTION webhookEventTypes(pOperationTypes INT[]) RETURNS VARCHAR[] AS $$
+    SELECT COALESCE(array_agg(webhookEventType(o) ORDER BY i), '{}')
+    FROM unnest(pOperationTypes) WITH ORDINALITY AS u(o, i);
+$$ LANGUAGE sql IMMUTABLE;
+
+ALTER TABLE WebhookEndpoint ALTER COLUMN eventTypes DROP DEFAULT;
+ALTER TABLE WebhookEndpoint ALTER COLUMN eventTypes TYPE VARCHAR(32)[] USING webhookEventTypes(eventTypes);
+ALTER TABLE WebhookEndpoint ALTER COLUMN eventTypes SET DEFAULT '{}';
+ALTER TABLE WebhookDelivery ALTER COLUMN eventType TYPE VARCHAR(32) USING webhookEventType(eventType);
+-- redelivered payloads carry the new name too
+UPDATE WebhookDelivery SET payload = jsonb_set(payload, '{eventType}', to_jsonb(eventType));
+
+DROP FUNCTION webhookEventTypes(INT[]);
+DROP FUNCTION webhookEventType(INT);
+
+CREATE OR REPLACE FUNCTION walletRecordEvents(pTransactionID VARCHAR, pEventType VARCHAR) RETURNS VOID AS $$
+DECLARE
+    vPayload JSONB;
+    vUserID VARCHAR;
+    vCreatedAt TIMESTAMP;
+BEGIN
+    SELECT t.userID, t.createdAt, jsonb_build_object(
+        'eventType', pEventType,
+        'transaction', jsonb_build_object(
+            'ID', t.ID,
+            'transactionID', t.transactionID,
+            'userID', t.userID,
+            'amount', t.amount,
+            'operationType', t.operationType,
+            'passiveUserID', t.passiveUserID,
+            'createdAt', to_char(t.createdAt, 'YYYY-MM-DD"T"HH24:MI:SS.US"Z"')),
+        'wallet', jsonb_build_object('userID', t.userID, 'balance', walletBalance(t.userID)))
+    INTO vUserID, vCreatedAt, vPayload
+    FROM UserWalletTransaction t
+    WHERE t.transactionID = pTransactionID;
+
+    INSERT INTO WebhookDelivery (endpointID, transactionID, eventType, payload, status, attempts, nextAttemptAt, createdAt)
+    SELECT e.ID, pTransactionID, pEventType, vPayload, 0, 0, vCreatedAt, vCreatedAt
+    FROM WebhookEndpoint e
+    WHERE e.userID = vUserID AND (cardinality(e.eventTypes) = 0 OR pEventType = ANY(e.eventTypes));
+
+    INSERT INTO Outbox (aggregateID, eventType, payload, createdAt) VALUES (vUserID, pEventType, vPayload, vCreatedAt);
+END;
+$$ LANGUAGE plpgsql;
+COMMIT;
@@ -0,0 +1,9 @@
+// Package migrations embeds the database migrations, so the API binary migrates without the migrate CLI
+package migrations
+
+import "embed"
+
+// FS holds the up and down migrations of this folder
+//
+//go:embed *.sql
+var FS embed.FS
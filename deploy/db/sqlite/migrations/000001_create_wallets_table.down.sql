@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS UserWalletTransaction;
+DROP TABLE IF EXISTS UserWallet;
@@ -0,0 +1,28 @@
+-- golang-migrate runs each sqlite migration in a transaction, so there is no BEGIN and COMMIT here
+CREATE TABLE IF NOT EXISTS UserWallet (
+    ID INTEGER PRIMARY KEY AUTOINCREMENT,
+    userID VARCHAR(36) UNIQUE NOT NULL,
+    -- 1 dollor will be 10^6, like the postgres schema
+    balance BIGINT NOT NULL DEFAULT 0
+    constraint balanceNonnegative check (balance >= 0),
+    displayName VARCHAR(100) NOT NULL DEFAULT '',
+    asset VARCHAR(16) NOT NULL DEFAULT '',
+    -- JSON array of strings
+    tags TEXT NOT NULL DEFAULT '[]'
+);
+
+CREATE TABLE IF NOT EXISTS UserWalletTransaction (
+    ID INTEGER PRIMARY KEY AUTOINCREMENT,
+    userID VARCHAR(36) NOT NULL REFERENCES UserWallet(userID),
+    transactionID VARCHAR(60) UNIQUE NOT NULL,
+    operationType INT NOT NULL,
+    passiveUserID VARCHAR(36) NOT NULL DEFAULT '',
+    amount BIGINT NOT NULL
+    constraint amountPositive check (amount > 0),
+    -- the wallet balance after the transaction, writes hold the database lock so it is exact
+    balance BIGINT NOT NULL,
+    createdAt TIMESTAMP NOT NULL
+);
+
+CREATE INDEX idxUserWalletTransactionUserIDCreatedAtID ON UserWalletTransaction(userID, createdAt, ID);
+CREATE INDEX idxUserWalletTransactionUserIDID ON UserWalletTransaction(userID, ID);
@@ -0,0 +1,9 @@
+// Package migrations embeds the SQLite database migrations, the schema of the sqlite database driver
+package migrations
+
+import "embed"
+
+// FS holds the up and down migrations of this folder
+//
+//go:embed *.sql
+var FS embed.FS
@@ -1,5 +1,6 @@
 package domain
 
 type ErrorRespond struct {
-	Error string `json:"error"`
+	Error     string `json:"error"`
+	RequestID string `json:"requestID,omitempty"`
 }
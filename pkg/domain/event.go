@@ -0,0 +1,50 @@
+package domain
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// Event is a committed wallet mutation recorded in the outbox
+type Event struct {
+	ID          int             `json:"ID"`
+	AggregateID string          `json:"aggregateID"`
+	Type        string          `json:"type"`
+	Payload     json.RawMessage `json:"payload"`
+	CreatedAt   time.Time       `json:"createdAt"`
+}
+
+const (
+	EventTypeWalletCreated  = "wallet.created"
+	EventTypeDeposited      = "wallet.deposited"
+	EventTypeWithdrawn      = "wallet.withdrawn"
+	EventTypeTransferredIn  = "wallet.transferred_in"
+	EventTypeTransferredOut = "wallet.transferred_out"
+)
+
+// EventType returns the outbox event type of the operation
+func (o OperationType) EventType() string {
+	switch o {
+	case OperationTypeDeposit:
+
+		return EventTypeDeposited
+	case OperationTypeWithdraw:
+
+		return EventTypeWithdrawn
+	case OperationTypeTransferIn:
+
+		return EventTypeTransferredIn
+	case OperationTypeTransferOut:
+
+		return EventTypeTransferredOut
+	}
+
+	return ""
+}
+
+// Publisher publishes outbox events to a message bus,
+// it must return nil only when the event is accepted by the bus
+type Publisher interface {
+	Publish(ctx context.Context, event *Event) error
+}
@@ -0,0 +1,27 @@
+package domain
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type JobStatus int
+
+const (
+	JobStatusPending JobStatus = 0
+	JobStatusDone    JobStatus = 1
+	JobStatusDead    JobStatus = 2
+)
+
+// Job is a unit of background work of the job queue, handled by the handler of its Type
+type Job struct {
+	ID          int             `json:"ID"`
+	Type        string          `json:"type"`
+	Payload     json.RawMessage `json:"payload"`
+	Status      JobStatus       `json:"status"`
+	Attempts    int             `json:"attempts"`
+	MaxAttempts int             `json:"maxAttempts"`
+	RunAt       time.Time       `json:"runAt"`
+	LastError   string          `json:"lastError"`
+	CreatedAt   time.Time       `json:"createdAt"`
+}
@@ -2,6 +2,7 @@ package domain
 
 import (
 	"context"
+	"fmt"
 	"time"
 )
 
@@ -9,6 +10,48 @@ type Wallet struct {
 	ID      int    `json:"-"`
 	UserID  string `json:"userID"`
 	Balance int    `json:"balance"`
+	WalletMetadata
+	// Created is true when Create made the wallet, false when it already existed
+	Created bool `json:"-"`
+}
+
+// WalletMetadata is the optional information given when the wallet is created
+type WalletMetadata struct {
+	DisplayName string   `json:"displayName,omitempty"`
+	Asset       string   `json:"asset,omitempty"`
+	Tags        []string `json:"tags,omitempty" db:"-"`
+}
+
+// metadata limits, they match the UserWallet columns
+const (
+	maxDisplayNameLength = 100
+	maxAssetLength       = 16
+	maxTags              = 10
+	maxTagLength         = 32
+)
+
+// Validate checks the metadata against the limits
+func (m WalletMetadata) Validate() error {
+	if len(m.DisplayName) > maxDisplayNameLength {
+
+		return fmt.Errorf("%w, displayName is longer than %d", ErrInvalidMetadata, maxDisplayNameLength)
+	}
+	if len(m.Asset) > maxAssetLength {
+
+		return fmt.Errorf("%w, asset is longer than %d", ErrInvalidMetadata, maxAssetLength)
+	}
+	if len(m.Tags) > maxTags {
+
+		return fmt.Errorf("%w, more than %d tags", ErrInvalidMetadata, maxTags)
+	}
+	for _, tag := range m.Tags {
+		if tag == "" || len(tag) > maxTagLength {
+
+			return fmt.Errorf("%w, tags must be 1 to %d long", ErrInvalidMetadata, maxTagLength)
+		}
+	}
+
+	return nil
 }
 
 type OperationType int
@@ -31,6 +74,58 @@ type Transaction struct {
 	CreatedAt     time.Time     `json:"createdAt"`
 }
 
+// archivedTransactionsKey is the context key of WithArchivedTransactions
+type archivedTransactionsKey struct{}
+
+// WithArchivedTransactions returns ctx whose GetTransactions read archived months too, which is slower,
+// without it a page stops before them, see WithMoreArchived, and a page starting past the live transactions
+// fails with ErrTransactionsArchived
+func WithArchivedTransactions(ctx context.Context) context.Context {
+
+	return context.WithValue(ctx, archivedTransactionsKey{}, true)
+}
+
+// ArchivedTransactions reports whether GetTransactions of ctx read archived months
+func ArchivedTransactions(ctx context.Context) bool {
+	archived, _ := ctx.Value(archivedTransactionsKey{}).(bool)
+
+	return archived
+}
+
+// moreArchivedKey is the context key of WithMoreArchived
+type moreArchivedKey struct{}
+
+// WithMoreArchived returns ctx whose GetTransactions set more when their page stops before archived transactions
+// of the user, which a page with WithArchivedTransactions reads
+func WithMoreArchived(ctx context.Context, more *bool) context.Context {
+
+	return context.WithValue(ctx, moreArchivedKey{}, more)
+}
+
+// SetMoreArchived tells the caller of ctx, see WithMoreArchived, that older transactions are archived
+func SetMoreArchived(ctx context.Context) {
+	if more, ok := ctx.Value(moreArchivedKey{}).(*bool); ok {
+		*more = true
+	}
+}
+
+// primaryReadKey is the context key of WithPrimaryRead
+type primaryReadKey struct{}
+
+// WithPrimaryRead returns ctx whose reads go to the primary database instead of a replica, like the reads of
+// a cache miss, which would otherwise store a replica that has not replayed the latest writes yet
+func WithPrimaryRead(ctx context.Context) context.Context {
+
+	return context.WithValue(ctx, primaryReadKey{}, true)
+}
+
+// PrimaryRead reports whether the reads of ctx go to the primary database
+func PrimaryRead(ctx context.Context) bool {
+	primary, _ := ctx.Value(primaryReadKey{}).(bool)
+
+	return primary
+}
+
 type TransactionID string
 
 func (t TransactionID) ID() string {
@@ -43,7 +138,7 @@ func (t TransactionID) PassiveID() string {
 }
 
 type WalletService interface {
-	Create(ctx context.Context, user User) (*Wallet, error)
+	Create(ctx context.Context, user User, metadata WalletMetadata) (*Wallet, error)
 	Get(ctx context.Context, user User) (*Wallet, error)
 	CreateTransactionID(ctx context.Context) TransactionID
 	GetTransactions(ctx context.Context, user User, createdAt time.Time, lastReturnedID int, limit int) ([]*Transaction, error)
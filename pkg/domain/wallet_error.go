@@ -1,6 +1,9 @@
 package domain
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+)
 
 var (
 	ErrInvalidAmount    = errors.New("invalid amount")
@@ -8,4 +11,13 @@ var (
 	ErrNotEnoughBalance = errors.New("not enough balance")
 	ErrTransferToSelf   = errors.New("transfer to self")
 	ErrUserIDRequired   = errors.New("userID is required")
+	ErrInvalidMetadata  = errors.New("invalid metadata")
+
+	// ErrTransactionsArchived is a page of transactions starting past the live ones without WithArchivedTransactions
+	ErrTransactionsArchived = errors.New("transactions are archived")
+	// ErrArchiveOffline is an archive file which cannot be read
+	ErrArchiveOffline = errors.New("archive is offline")
+
+	// ErrPassiveWalletNotFound is the missing receiver of a transfer, it is also ErrWalletNotFound
+	ErrPassiveWalletNotFound = fmt.Errorf("passive %w", ErrWalletNotFound)
 )
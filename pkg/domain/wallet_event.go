@@ -0,0 +1,17 @@
+package domain
+
+import "context"
+
+// WalletEvent is pushed to subscribers whenever a transaction changes the wallet of the user,
+// ID is the ID of the transaction so it can be used to resume a subscription
+type WalletEvent struct {
+	ID          int          `json:"ID"`
+	UserID      string       `json:"userID"`
+	Balance     int          `json:"balance"`
+	Transaction *Transaction `json:"transaction"`
+}
+
+type WalletEventService interface {
+	// Subscribe streams the events of the user after lastEventID until ctx is done, 0 starts after the latest event
+	Subscribe(ctx context.Context, user User, lastEventID int) (<-chan *WalletEvent, error)
+}
@@ -1,6 +1,7 @@
 package domain_test
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/sappy5678/cryptocom/pkg/domain"
@@ -12,3 +13,68 @@ func TestTransactionID(t *testing.T) {
 	assert.Equal(t, "1234567890", transactionID.ID())
 	assert.Equal(t, "1234567890-passive", transactionID.PassiveID())
 }
+
+func TestOperationTypeEventType(t *testing.T) {
+	assert.Equal(t, domain.EventTypeDeposited, domain.OperationTypeDeposit.EventType())
+	assert.Equal(t, domain.EventTypeWithdrawn, domain.OperationTypeWithdraw.EventType())
+	assert.Equal(t, domain.EventTypeTransferredIn, domain.OperationTypeTransferIn.EventType())
+	assert.Equal(t, domain.EventTypeTransferredOut, domain.OperationTypeTransferOut.EventType())
+	assert.Equal(t, "", domain.OperationTypeDummy.EventType())
+}
+
+func TestWalletMetadataValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		metadata domain.WalletMetadata
+		wantErr  bool
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name: "valid",
+			metadata: domain.WalletMetadata{
+				DisplayName: "Shop",
+				Asset:       "USD",
+				Tags:        []string{"merchant", "vip"},
+			},
+		},
+		{
+			name:     "display name too long",
+			metadata: domain.WalletMetadata{DisplayName: strings.Repeat("a", 101)},
+			wantErr:  true,
+		},
+		{
+			name:     "asset too long",
+			metadata: domain.WalletMetadata{Asset: strings.Repeat("A", 17)},
+			wantErr:  true,
+		},
+		{
+			name:     "too many tags",
+			metadata: domain.WalletMetadata{Tags: strings.Split("a,b,c,d,e,f,g,h,i,j,k", ",")},
+			wantErr:  true,
+		},
+		{
+			name:     "empty tag",
+			metadata: domain.WalletMetadata{Tags: []string{""}},
+			wantErr:  true,
+		},
+		{
+			name:     "tag too long",
+			metadata: domain.WalletMetadata{Tags: []string{strings.Repeat("a", 33)}},
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.metadata.Validate()
+			if tt.wantErr {
+				assert.ErrorIs(t, err, domain.ErrInvalidMetadata)
+
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package domain
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+type WebhookEndpoint struct {
+	ID     int    `json:"ID"`
+	UserID string `json:"userID"`
+	URL    string `json:"url"`
+	Secret string `json:"secret,omitempty"`
+	// EventTypes are the event types to deliver, like EventTypeDeposited, empty means all
+	EventTypes []string  `json:"eventTypes"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+type WebhookDeliveryStatus int
+
+const (
+	WebhookDeliveryStatusPending   WebhookDeliveryStatus = 0
+	WebhookDeliveryStatusDelivered WebhookDeliveryStatus = 1
+	WebhookDeliveryStatusDead      WebhookDeliveryStatus = 2
+)
+
+type WebhookDelivery struct {
+	ID            int                   `json:"ID"`
+	EndpointID    int                   `json:"endpointID"`
+	TransactionID TransactionID         `json:"transactionID"`
+	EventType     string                `json:"eventType"`
+	Payload       json.RawMessage       `json:"payload"`
+	Status        WebhookDeliveryStatus `json:"status"`
+	Attempts      int                   `json:"attempts"`
+	NextAttemptAt time.Time             `json:"nextAttemptAt"`
+	LastError     string                `json:"lastError"`
+	CreatedAt     time.Time             `json:"createdAt"`
+}
+
+type WebhookService interface {
+	Register(ctx context.Context, user User, url string, eventTypes []string) (*WebhookEndpoint, error)
+	List(ctx context.Context, user User) ([]*WebhookEndpoint, error)
+	Delete(ctx context.Context, user User, endpointID int) error
+	GetDeliveries(ctx context.Context, user User, endpointID int, status *WebhookDeliveryStatus, IDBefore int, limit int) ([]*WebhookDelivery, error)
+	Redeliver(ctx context.Context, user User, deliveryID int) (*WebhookDelivery, error)
+	// RedeliverDead queues a job putting every dead delivery of the endpoint back to the queue
+	RedeliverDead(ctx context.Context, user User, endpointID int) (*Job, error)
+}
@@ -0,0 +1,14 @@
+package domain
+
+import "errors"
+
+var (
+	ErrWebhookNotFound    = errors.New("webhook not found")
+	ErrDeliveryNotFound   = errors.New("webhook delivery not found")
+	ErrInvalidWebhookURL  = errors.New("invalid webhook url")
+	ErrInvalidEventType   = errors.New("invalid event type")
+	ErrInvalidWebhookSign = errors.New("invalid webhook signature")
+	// ErrForbiddenWebhookAddress is returned for a webhook url reaching a loopback, private or link-local address
+	ErrForbiddenWebhookAddress = errors.New("webhook url resolves to a forbidden address")
+	ErrJobQueueDisabled        = errors.New("job queue is not enabled")
+)
@@ -0,0 +1,265 @@
+// Package archive keeps the monthly partitions of wallet transactions and archives the closed months to files
+package archive
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/sappy5678/cryptocom/pkg/domain"
+	"github.com/sappy5678/cryptocom/pkg/service/archive/repository"
+)
+
+const source = "archive"
+
+// fileExtension is the extension of the archive files, gzipped newline delimited JSON of domain.Transaction
+const fileExtension = ".ndjson.gz"
+
+// New creates new archiver with defaults, archiving is disabled until Dir is set
+func New(db *sqlx.DB, archiveRepo repository.ArchiveRepository, logger domain.Logger) *Archiver {
+
+	return &Archiver{
+		db:          db,
+		archiveRepo: archiveRepo,
+		logger:      logger,
+		AheadMonths: 3,
+		Interval:    time.Hour,
+	}
+}
+
+// Archiver creates the monthly partitions of UserWalletTransaction ahead of time, so writes never wait for one,
+// and moves the transactions of the months closed for more than AfterMonths to a file in Dir each,
+// a month is written and synced before its partition is detached, so a failure leaves it in the table
+type Archiver struct {
+	db          *sqlx.DB
+	archiveRepo repository.ArchiveRepository
+	logger      domain.Logger
+
+	Dir         string
+	AfterMonths int
+	AheadMonths int
+	Interval    time.Duration
+}
+
+// Run keeps the partitions until ctx is done
+func (a *Archiver) Run(ctx context.Context) {
+	ticker := time.NewTicker(a.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := a.RunNow(ctx); err != nil {
+			a.logger.Log(ctx, source, "Archive transactions", err, nil)
+		}
+
+		select {
+		case <-ctx.Done():
+
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunNow runs RunOnce at the current time and logs the archived months, the job runner calls it every Interval on its leader
+func (a *Archiver) RunNow(ctx context.Context) error {
+	n, err := a.RunOnce(ctx, time.Now())
+	if n > 0 {
+		a.logger.Log(ctx, source, "Archive transactions", nil, map[string]interface{}{
+			"archived": n,
+		})
+	}
+
+	return err
+}
+
+// RunOnce creates the partitions up to AheadMonths after now and archives the closed months,
+// it returns the number of archived months
+func (a *Archiver) RunOnce(ctx context.Context, now time.Time) (int, error) {
+	month := monthStart(now)
+	if _, err := a.archiveRepo.CreatePartitions(ctx, a.db, month, month.AddDate(0, a.AheadMonths, 0)); err != nil {
+
+		return 0, err
+	}
+	if a.Dir == "" {
+
+		return 0, nil
+	}
+
+	partitions, err := a.archiveRepo.Partitions(ctx, a.db)
+	if err != nil {
+
+		return 0, err
+	}
+	closed := month.AddDate(0, -a.AfterMonths, 0)
+	archived := 0
+	for _, partition := range partitions {
+		if partition.RangeEnd.After(closed) {
+
+			break
+		}
+		ok, err := a.archive(ctx, partition, now)
+		if err != nil {
+
+			return archived, err
+		} else if !ok {
+			// another replica is archiving
+
+			return archived, nil
+		}
+		archived++
+	}
+
+	return archived, nil
+}
+
+// archive writes partition to a temporary file, which becomes its archive file when it is flushed
+func (a *Archiver) archive(ctx context.Context, partition *repository.Partition, now time.Time) (bool, error) {
+	location := filepath.Join(a.Dir, partition.Name+fileExtension)
+	if err := os.MkdirAll(a.Dir, 0o750); err != nil {
+
+		return false, err
+	}
+	file, err := os.CreateTemp(a.Dir, partition.Name+"-*.tmp")
+	if err != nil {
+
+		return false, err
+	}
+	// the file is renamed when flushed
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	gz := gzip.NewWriter(file)
+	encoder := json.NewEncoder(gz)
+
+	return a.archiveRepo.Archive(ctx, a.db, partition, location, now, func(transaction *domain.Transaction) error {
+
+		return encoder.Encode(transaction)
+	}, func() error {
+		if err := gz.Close(); err != nil {
+
+			return err
+		}
+		if err := file.Sync(); err != nil {
+
+			return err
+		}
+		if err := file.Close(); err != nil {
+
+			return err
+		}
+
+		return os.Rename(file.Name(), location)
+	})
+}
+
+// Archived reports whether user has archived transactions created at or before createdBefore
+func (a *Archiver) Archived(ctx context.Context, user domain.User, createdBefore time.Time) (bool, error) {
+	partitions, err := a.archiveRepo.Archived(ctx, a.db, user, createdBefore)
+	if err != nil {
+
+		return false, err
+	}
+
+	return len(partitions) > 0, nil
+}
+
+// GetTransactions returns the archived transactions of user like the wallet repository, newest first,
+// it fails with domain.ErrArchiveOffline when an archive file cannot be read
+func (a *Archiver) GetTransactions(ctx context.Context, user domain.User, createdBefore time.Time, IDBefore int, limit int) ([]*domain.Transaction, error) {
+	// default values
+	if createdBefore.IsZero() {
+		createdBefore = time.Now()
+	}
+	if IDBefore == 0 {
+		IDBefore = math.MaxInt64
+	}
+	if limit <= 0 {
+		limit = 100
+	}
+
+	partitions, err := a.archiveRepo.Archived(ctx, a.db, user, createdBefore)
+	if err != nil {
+
+		return nil, err
+	}
+	transactions := []*domain.Transaction{}
+	for _, partition := range partitions {
+		if err := ctx.Err(); err != nil {
+
+			return nil, err
+		}
+		if transactions, err = readTransactions(partition.Location, user, createdBefore, IDBefore, limit, transactions); err != nil {
+
+			return nil, err
+		}
+		if len(transactions) == limit {
+
+			break
+		}
+	}
+
+	return transactions, nil
+}
+
+// readTransactions appends the transactions of user in the archive file at location until there are limit,
+// the file is ordered by userID DESC, createdAt DESC and ID DESC, so the scan stops after the transactions of user,
+// there is no per-user offset, every read decompresses and scans the file from its start up to user
+func readTransactions(location string, user domain.User, createdBefore time.Time, IDBefore int, limit int, transactions []*domain.Transaction) ([]*domain.Transaction, error) {
+	file, err := os.Open(location)
+	if err != nil {
+
+		return nil, fmt.Errorf("%w, %v", domain.ErrArchiveOffline, err)
+	}
+	defer file.Close()
+	gz, err := gzip.NewReader(bufio.NewReader(file))
+	if err != nil {
+
+		return nil, fmt.Errorf("%w, %s, %v", domain.ErrArchiveOffline, location, err)
+	}
+	defer gz.Close()
+
+	decoder := json.NewDecoder(gz)
+	found := false
+	for decoder.More() {
+		transaction := &domain.Transaction{}
+		if err := decoder.Decode(transaction); err != nil {
+
+			return nil, fmt.Errorf("%w, %s, %v", domain.ErrArchiveOffline, location, err)
+		}
+		if transaction.UserID != user.ID {
+			if found {
+
+				break
+			}
+
+			continue
+		}
+		found = true
+		if transaction.CreatedAt.After(createdBefore) || transaction.ID >= IDBefore {
+
+			continue
+		}
+		transactions = append(transactions, transaction)
+		if len(transactions) == limit {
+
+			break
+		}
+	}
+
+	return transactions, nil
+}
+
+// monthStart returns the first instant of the month of t in UTC
+func monthStart(t time.Time) time.Time {
+	t = t.UTC()
+
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,309 @@
+package archive_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
+
+	"github.com/sappy5678/cryptocom/pkg/domain"
+	"github.com/sappy5678/cryptocom/pkg/service/archive"
+	"github.com/sappy5678/cryptocom/pkg/service/archive/repository"
+	"github.com/sappy5678/cryptocom/pkg/utl/zlog"
+)
+
+// store keeps partitions in memory and archives them like the real repository
+type store struct {
+	partitions []*repository.Partition
+	archived   []*repository.Partition
+	rows       map[string][]*domain.Transaction
+	created    [][2]time.Time
+	locked     bool
+	archiveErr error
+}
+
+func month(year int, month time.Month) time.Time {
+
+	return time.Date(year, month, 1, 0, 0, 0, 0, time.UTC)
+}
+
+func partition(start time.Time) *repository.Partition {
+
+	return &repository.Partition{Name: "userwallettransaction_" + start.Format("200601"), RangeStart: start, RangeEnd: start.AddDate(0, 1, 0)}
+}
+
+// newStore creates a store with the months from January to June 2024, holding transactions from January to March
+func newStore() *store {
+	s := &store{rows: map[string][]*domain.Transaction{}}
+	for m := time.January; m <= time.June; m++ {
+		s.partitions = append(s.partitions, partition(month(2024, m)))
+	}
+	id := 0
+	for m := time.January; m <= time.March; m++ {
+		for _, userID := range []string{"alice", "bob", "carol"} {
+			for day := 1; day <= 2; day++ {
+				id++
+				p := partition(month(2024, m))
+				s.rows[p.Name] = append(s.rows[p.Name], &domain.Transaction{
+					ID:            id,
+					TransactionID: domain.TransactionID(userID + "-" + p.Name + "-" + time.Weekday(day).String()),
+					UserID:        userID,
+					Amount:        id,
+					OperationType: domain.OperationTypeDeposit,
+					CreatedAt:     month(2024, m).AddDate(0, 0, day),
+				})
+			}
+		}
+	}
+
+	return s
+}
+
+func (s *store) repository() *repository.MockArchiveRepository {
+
+	return &repository.MockArchiveRepository{
+		CreatePartitionsFunc: func(ctx context.Context, db sqlx.ExtContext, from time.Time, to time.Time) (int, error) {
+			s.created = append(s.created, [2]time.Time{from, to})
+
+			return 0, nil
+		},
+		PartitionsFunc: func(ctx context.Context, db sqlx.ExtContext) ([]*repository.Partition, error) {
+
+			return append([]*repository.Partition{}, s.partitions...), nil
+		},
+		ArchiveFunc: func(ctx context.Context, db *sqlx.DB, partition *repository.Partition, location string, now time.Time, write func(*domain.Transaction) error, flush func() error) (bool, error) {
+			if s.locked {
+
+				return false, nil
+			}
+			if s.archiveErr != nil {
+
+				return false, s.archiveErr
+			}
+			rows := append([]*domain.Transaction{}, s.rows[partition.Name]...)
+			sort.Slice(rows, func(i, j int) bool {
+				if rows[i].UserID != rows[j].UserID {
+
+					return rows[i].UserID > rows[j].UserID
+				}
+
+				return rows[i].ID > rows[j].ID
+			})
+			for _, row := range rows {
+				if err := write(row); err != nil {
+
+					return false, err
+				}
+			}
+			if err := flush(); err != nil {
+
+				return false, err
+			}
+			s.partitions = s.partitions[1:]
+			archived := *partition
+			archived.Location = location
+			s.archived = append([]*repository.Partition{&archived}, s.archived...)
+
+			return true, nil
+		},
+		ArchivedFunc: func(ctx context.Context, db sqlx.ExtContext, user domain.User, createdBefore time.Time) ([]*repository.Partition, error) {
+			partitions := []*repository.Partition{}
+			for _, partition := range s.archived {
+				for _, row := range s.rows[partition.Name] {
+					if row.UserID == user.ID && !row.CreatedAt.After(createdBefore) {
+						partitions = append(partitions, partition)
+
+						break
+					}
+				}
+			}
+
+			return partitions, nil
+		},
+	}
+}
+
+func TestRunOnce(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	mockError := errors.New("error")
+	now := time.Date(2024, 4, 15, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name         string
+		noDir        bool
+		afterMonths  int
+		locked       bool
+		archiveErr   error
+		wantArchived int
+		wantErr      error
+		wantFiles    []string
+	}{
+		{
+			name:  "archiving disabled",
+			noDir: true,
+		},
+		{
+			name:         "closed months",
+			afterMonths:  1,
+			wantArchived: 2,
+			wantFiles:    []string{"userwallettransaction_202401.ndjson.gz", "userwallettransaction_202402.ndjson.gz"},
+		},
+		{
+			name:         "every closed month",
+			wantArchived: 3,
+			wantFiles: []string{"userwallettransaction_202401.ndjson.gz", "userwallettransaction_202402.ndjson.gz",
+				"userwallettransaction_202403.ndjson.gz"},
+		},
+		{
+			name:        "another replica is archiving",
+			afterMonths: 1,
+			locked:      true,
+			wantFiles:   []string{},
+		},
+		{
+			name:        "archive error",
+			afterMonths: 1,
+			archiveErr:  mockError,
+			wantErr:     mockError,
+			wantFiles:   []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newStore()
+			s.locked = tt.locked
+			s.archiveErr = tt.archiveErr
+			archiver := archive.New(nil, s.repository(), zlog.New())
+			if !tt.noDir {
+				archiver.Dir = t.TempDir()
+			}
+			archiver.AfterMonths = tt.afterMonths
+
+			n, err := archiver.RunOnce(context.Background(), now)
+			assert.ErrorIs(t, err, tt.wantErr)
+			assert.Equal(t, tt.wantArchived, n)
+			assert.Equal(t, [][2]time.Time{{month(2024, time.April), month(2024, time.July)}}, s.created)
+			assert.Len(t, s.partitions, 6-tt.wantArchived)
+			if tt.noDir {
+
+				return
+			}
+
+			// the temporary files are removed
+			entries, err := os.ReadDir(archiver.Dir)
+			assert.NoError(t, err)
+			files := []string{}
+			for _, entry := range entries {
+				files = append(files, entry.Name())
+			}
+			assert.Equal(t, tt.wantFiles, files)
+		})
+	}
+}
+
+func TestGetTransactions(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	s := newStore()
+	archiver := archive.New(nil, s.repository(), zlog.New())
+	archiver.Dir = t.TempDir()
+	n, err := archiver.RunOnce(context.Background(), time.Date(2024, 4, 15, 12, 0, 0, 0, time.UTC))
+	assert.NoError(t, err)
+	assert.Equal(t, 3, n)
+
+	ids := func(transactions []*domain.Transaction) []int {
+		got := []int{}
+		for _, transaction := range transactions {
+			got = append(got, transaction.ID)
+		}
+
+		return got
+	}
+
+	tests := []struct {
+		name          string
+		user          domain.User
+		createdBefore time.Time
+		IDBefore      int
+		limit         int
+		wantIDs       []int
+	}{
+		{
+			name:    "newest first across months",
+			user:    domain.User{ID: "alice"},
+			wantIDs: []int{14, 13, 8, 7, 2, 1},
+		},
+		{
+			name:    "limit",
+			user:    domain.User{ID: "bob"},
+			limit:   3,
+			wantIDs: []int{16, 15, 10},
+		},
+		{
+			name:          "cursor",
+			user:          domain.User{ID: "bob"},
+			createdBefore: time.Date(2024, 2, 3, 0, 0, 0, 0, time.UTC),
+			IDBefore:      10,
+			wantIDs:       []int{9, 4, 3},
+		},
+		{
+			name:          "created before",
+			user:          domain.User{ID: "carol"},
+			createdBefore: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC),
+			wantIDs:       []int{5},
+		},
+		{
+			name:    "no archived transactions",
+			user:    domain.User{ID: "dave"},
+			wantIDs: []int{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transactions, err := archiver.GetTransactions(context.Background(), tt.user, tt.createdBefore, tt.IDBefore, tt.limit)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantIDs, ids(transactions))
+		})
+	}
+
+	transactions, err := archiver.GetTransactions(context.Background(), domain.User{ID: "alice"}, time.Time{}, 0, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, &domain.Transaction{
+		ID:            14,
+		TransactionID: "alice-userwallettransaction_202403-Tuesday",
+		UserID:        "alice",
+		Amount:        14,
+		OperationType: domain.OperationTypeDeposit,
+		CreatedAt:     time.Date(2024, 3, 3, 0, 0, 0, 0, time.UTC),
+	}, transactions[0])
+
+	archived, err := archiver.Archived(context.Background(), domain.User{ID: "alice"}, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	assert.NoError(t, err)
+	assert.False(t, archived)
+	archived, err = archiver.Archived(context.Background(), domain.User{ID: "alice"}, time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC))
+	assert.NoError(t, err)
+	assert.True(t, archived)
+
+	// a missing file is offline, a corrupt one too
+	assert.NoError(t, os.Remove(filepath.Join(archiver.Dir, "userwallettransaction_202402.ndjson.gz")))
+	_, err = archiver.GetTransactions(context.Background(), domain.User{ID: "alice"}, time.Time{}, 0, 0)
+	assert.ErrorIs(t, err, domain.ErrArchiveOffline)
+	// the newer month is enough
+	transactions, err = archiver.GetTransactions(context.Background(), domain.User{ID: "alice"}, time.Time{}, 0, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{14, 13}, ids(transactions))
+
+	assert.NoError(t, os.WriteFile(filepath.Join(archiver.Dir, "userwallettransaction_202403.ndjson.gz"), []byte("not gzip"), 0o600))
+	_, err = archiver.GetTransactions(context.Background(), domain.User{ID: "alice"}, time.Time{}, 0, 2)
+	assert.ErrorIs(t, err, domain.ErrArchiveOffline)
+}
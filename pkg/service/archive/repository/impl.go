@@ -0,0 +1,184 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+
+	"github.com/sappy5678/cryptocom/pkg/domain"
+	wr "github.com/sappy5678/cryptocom/pkg/service/wallet/repository"
+)
+
+// Archive represents the client for the partitions of UserWalletTransaction and their archive
+type Archive struct{}
+
+// partitionPrefix prefixes the monthly partitions, followed by the month like 202401, see walletCreateTransactionPartitions
+const partitionPrefix = "userwallettransaction_"
+
+// partitionMonth is the time layout of the month of a partition name
+const partitionMonth = "200601"
+
+const createPartitionsQuery = `SELECT walletCreateTransactionPartitions($1, $2)`
+
+func (a *Archive) CreatePartitions(ctx context.Context, db sqlx.ExtContext, from time.Time, to time.Time) (int, error) {
+	var created int
+	if err := sqlx.GetContext(ctx, db, &created, createPartitionsQuery, wr.TimeToUTC(from), wr.TimeToUTC(to)); err != nil {
+
+		return 0, err
+	}
+
+	return created, nil
+}
+
+// partitionsQuery lists the monthly partitions, the default partition does not match
+const partitionsQuery = `SELECT c.relname FROM pg_inherits i JOIN pg_class c ON c.oid = i.inhrelid
+WHERE i.inhparent = 'userwallettransaction'::regclass AND c.relname ~ '^userwallettransaction_[0-9]{6}$'
+ORDER BY c.relname`
+
+func (a *Archive) Partitions(ctx context.Context, db sqlx.ExtContext) ([]*Partition, error) {
+	names := []string{}
+	if err := sqlx.SelectContext(ctx, db, &names, partitionsQuery); err != nil {
+
+		return nil, err
+	}
+
+	partitions := make([]*Partition, 0, len(names))
+	for _, name := range names {
+		month, err := time.Parse(partitionMonth, strings.TrimPrefix(name, partitionPrefix))
+		if err != nil {
+
+			return nil, fmt.Errorf("partition %s, %w", name, err)
+		}
+		partitions = append(partitions, &Partition{Name: name, RangeStart: month, RangeEnd: month.AddDate(0, 1, 0)})
+	}
+
+	return partitions, nil
+}
+
+// archiveLockKey is the advisory lock key of the archiver, "archive" in ascii
+const archiveLockKey = 0x61726368697665
+
+// archiveLockQuery makes the archiver a singleton across replicas, the lock is released on commit or rollback
+const archiveLockQuery = `SELECT pg_try_advisory_xact_lock($1)`
+
+// a partition is exported in one statement, which takes longer than the statement_timeout of the API
+const disableStatementTimeoutQuery = `SET LOCAL statement_timeout = 0`
+
+// the queries on a partition take its quoted name, the share lock keeps late writes out while it is archived
+const (
+	lockPartitionQuery   = `LOCK TABLE %s IN SHARE MODE`
+	exportPartitionQuery = `SELECT ID, userID, transactionID, operationType, amount, COALESCE(passiveUserID, '') AS passiveUserID, createdAt
+FROM %s ORDER BY userID DESC, createdAt DESC, ID DESC`
+	detachPartitionQuery = `ALTER TABLE UserWalletTransaction DETACH PARTITION %s`
+	archiveUsersQuery    = `INSERT INTO UserWalletTransactionArchiveUser (partitionName, userID, oldestCreatedAt, transactions)
+SELECT $1, userID, MIN(createdAt), COUNT(*) FROM %s GROUP BY userID`
+)
+
+const insertArchiveQuery = `INSERT INTO UserWalletTransactionArchive (partitionName, rangeStart, rangeEnd, location, transactions, archivedAt)
+VALUES ($1, $2, $3, $4, $5, $6)`
+
+func (a *Archive) Archive(ctx context.Context, db *sqlx.DB, partition *Partition, location string, now time.Time, write func(*domain.Transaction) error, flush func() error) (bool, error) {
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+
+		return false, err
+	}
+	defer tx.Rollback()
+
+	// another replica is archiving
+	var locked bool
+	if err := tx.GetContext(ctx, &locked, archiveLockQuery, archiveLockKey); err != nil {
+
+		return false, err
+	} else if !locked {
+
+		return false, nil
+	}
+
+	table := pq.QuoteIdentifier(partition.Name)
+	for _, query := range []string{disableStatementTimeoutQuery, fmt.Sprintf(lockPartitionQuery, table)} {
+		if _, err := tx.ExecContext(ctx, query); err != nil {
+
+			return false, err
+		}
+	}
+
+	transactions, err := export(ctx, tx, table, write)
+	if err != nil {
+
+		return false, err
+	}
+	if err := flush(); err != nil {
+
+		return false, err
+	}
+
+	if _, err := tx.ExecContext(ctx, insertArchiveQuery, partition.Name, partition.RangeStart, partition.RangeEnd,
+		location, transactions, wr.TimeToUTC(now)); err != nil {
+
+		return false, err
+	}
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf(archiveUsersQuery, table), partition.Name); err != nil {
+
+		return false, err
+	}
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf(detachPartitionQuery, table)); err != nil {
+
+		return false, err
+	}
+	if err := tx.Commit(); err != nil {
+
+		return false, err
+	}
+
+	return true, nil
+}
+
+// export writes every transaction of table and returns their number
+func export(ctx context.Context, tx *sqlx.Tx, table string, write func(*domain.Transaction) error) (int, error) {
+	rows, err := tx.QueryxContext(ctx, fmt.Sprintf(exportPartitionQuery, table))
+	if err != nil {
+
+		return 0, err
+	}
+	defer rows.Close()
+
+	transactions := 0
+	for rows.Next() {
+		transaction := &domain.Transaction{}
+		if err := rows.StructScan(transaction); err != nil {
+
+			return 0, err
+		}
+		transaction.CreatedAt = wr.TimeToUTC(transaction.CreatedAt)
+		if err := write(transaction); err != nil {
+
+			return 0, err
+		}
+		transactions++
+	}
+
+	return transactions, rows.Err()
+}
+
+const archivedQuery = `SELECT a.partitionName AS name, a.rangeStart, a.rangeEnd, a.location
+FROM UserWalletTransactionArchive a JOIN UserWalletTransactionArchiveUser u ON u.partitionName = a.partitionName
+WHERE u.userID = $1 AND u.oldestCreatedAt <= $2 ORDER BY a.rangeStart DESC`
+
+func (a *Archive) Archived(ctx context.Context, db sqlx.ExtContext, user domain.User, createdBefore time.Time) ([]*Partition, error) {
+	partitions := []*Partition{}
+	if err := sqlx.SelectContext(ctx, db, &partitions, archivedQuery, user.ID, wr.TimeToUTC(createdBefore)); err != nil {
+
+		return nil, err
+	}
+	for _, partition := range partitions {
+		partition.RangeStart = wr.TimeToUTC(partition.RangeStart)
+		partition.RangeEnd = wr.TimeToUTC(partition.RangeEnd)
+	}
+
+	return partitions, nil
+}
@@ -0,0 +1,36 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/sappy5678/cryptocom/pkg/domain"
+)
+
+type MockArchiveRepository struct {
+	CreatePartitionsFunc func(ctx context.Context, db sqlx.ExtContext, from time.Time, to time.Time) (int, error)
+	PartitionsFunc       func(ctx context.Context, db sqlx.ExtContext) ([]*Partition, error)
+	ArchiveFunc          func(ctx context.Context, db *sqlx.DB, partition *Partition, location string, now time.Time, write func(*domain.Transaction) error, flush func() error) (bool, error)
+	ArchivedFunc         func(ctx context.Context, db sqlx.ExtContext, user domain.User, createdBefore time.Time) ([]*Partition, error)
+}
+
+func (m *MockArchiveRepository) CreatePartitions(ctx context.Context, db sqlx.ExtContext, from time.Time, to time.Time) (int, error) {
+
+	return m.CreatePartitionsFunc(ctx, db, from, to)
+}
+
+func (m *MockArchiveRepository) Partitions(ctx context.Context, db sqlx.ExtContext) ([]*Partition, error) {
+
+	return m.PartitionsFunc(ctx, db)
+}
+
+func (m *MockArchiveRepository) Archive(ctx context.Context, db *sqlx.DB, partition *Partition, location string, now time.Time, write func(*domain.Transaction) error, flush func() error) (bool, error) {
+
+	return m.ArchiveFunc(ctx, db, partition, location, now, write, flush)
+}
+
+func (m *MockArchiveRepository) Archived(ctx context.Context, db sqlx.ExtContext, user domain.User, createdBefore time.Time) ([]*Partition, error) {
+
+	return m.ArchivedFunc(ctx, db, user, createdBefore)
+}
@@ -0,0 +1,34 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/sappy5678/cryptocom/pkg/domain"
+)
+
+// Partition is a monthly partition of UserWalletTransaction, holding the transactions created from RangeStart
+// until RangeEnd, Location is its archive file once archived
+type Partition struct {
+	Name       string
+	RangeStart time.Time
+	RangeEnd   time.Time
+	Location   string
+}
+
+// ArchiveRepository represents transaction archive repository interface
+type ArchiveRepository interface {
+	// CreatePartitions creates the missing monthly partitions from the month of from to the month of to,
+	// it returns the number created
+	CreatePartitions(ctx context.Context, db sqlx.ExtContext, from time.Time, to time.Time) (int, error)
+	// Partitions returns the attached monthly partitions, oldest first
+	Partitions(ctx context.Context, db sqlx.ExtContext) ([]*Partition, error)
+	// Archive writes the transactions of the partition by userID, createdAt and ID, all descending, flushes them,
+	// then detaches the partition and records it archived at location, in one transaction,
+	// it returns false when another replica is archiving
+	Archive(ctx context.Context, db *sqlx.DB, partition *Partition, location string, now time.Time, write func(*domain.Transaction) error, flush func() error) (bool, error)
+	// Archived returns the archived partitions holding transactions of user created at or before createdBefore,
+	// newest first
+	Archived(ctx context.Context, db sqlx.ExtContext, user domain.User, createdBefore time.Time) ([]*Partition, error)
+}
@@ -0,0 +1,90 @@
+package job
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/sappy5678/cryptocom/pkg/service/job/repository"
+)
+
+// elect tries to become leader every LeaderInterval and runs the singletons while it is,
+// the leadership is checked on every interval, and the singletons stop as soon as it is lost
+func (r *Runner) elect(ctx context.Context) {
+	ticker := time.NewTicker(r.LeaderInterval)
+	defer ticker.Stop()
+
+	var leadership repository.Leadership
+	var stop func()
+	resign := func() {
+		stop()
+		// resign even when ctx is done, so another runner leads without waiting for the connection to drop
+		if err := leadership.Resign(context.WithoutCancel(ctx)); err != nil {
+			r.logger.Log(ctx, source, "Resign leader", err, nil)
+		}
+		leadership, stop = nil, nil
+	}
+
+	for {
+		if leadership == nil {
+			var err error
+			if leadership, err = r.jobRepo.TryLead(ctx, r.db); err != nil {
+				r.logger.Log(ctx, source, "Try lead", err, nil)
+			} else if leadership != nil {
+				stop = r.lead(ctx)
+			}
+		} else if err := leadership.Check(ctx); err != nil && ctx.Err() == nil {
+			r.logger.Log(ctx, source, "Check leader", err, nil)
+			resign()
+		}
+
+		select {
+		case <-ctx.Done():
+			if leadership != nil {
+				resign()
+			}
+
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// lead starts the singletons, the returned stop cancels them and waits for them to return
+func (r *Runner) lead(ctx context.Context) (stop func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	for _, s := range r.singletons {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.runSingleton(ctx, s)
+		}()
+	}
+
+	return func() {
+		cancel()
+		wg.Wait()
+	}
+}
+
+// runSingleton runs s every interval until ctx is done, it runs at once since a new leader may be late
+func (r *Runner) runSingleton(ctx context.Context, s *singleton) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.fn(ctx); err != nil && ctx.Err() == nil {
+			r.logger.Log(ctx, source, "Run singleton", err, map[string]interface{}{
+				"singleton": s.name,
+			})
+		}
+
+		select {
+		case <-ctx.Done():
+
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package repository
+
+import (
+	"context"
+	"database/sql/driver"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+
+	"github.com/sappy5678/cryptocom/pkg/domain"
+	wr "github.com/sappy5678/cryptocom/pkg/service/wallet/repository"
+)
+
+// Job represents the client for the job queue
+type Job struct{}
+
+func cleanJob(job *domain.Job) {
+	job.RunAt = wr.TimeToUTC(job.RunAt)
+	job.CreatedAt = wr.TimeToUTC(job.CreatedAt)
+}
+
+// jobColumns are the columns of domain.Job, jobType is aliased to its field
+const jobColumns = `ID, jobType AS type, payload, status, attempts, maxAttempts, runAt, lastError, createdAt`
+
+const enqueueQuery = `INSERT INTO Job (jobType, payload, status, attempts, maxAttempts, runAt, lastError, createdAt)
+VALUES ($1, $2, 0, 0, $3, $4, '', $5) RETURNING ` + jobColumns
+
+func (j *Job) Enqueue(ctx context.Context, db sqlx.ExtContext, now time.Time, job *domain.Job) (*domain.Job, error) {
+	payload := job.Payload
+	if len(payload) == 0 {
+		payload = []byte("{}")
+	}
+
+	enqueued := &domain.Job{}
+	if err := sqlx.GetContext(ctx, db, enqueued, enqueueQuery, job.Type, []byte(payload), job.MaxAttempts,
+		wr.TimeToUTC(job.RunAt), wr.TimeToUTC(now)); err != nil {
+
+		return nil, err
+	}
+	cleanJob(enqueued)
+
+	return enqueued, nil
+}
+
+// claimQuery leases due jobs until leaseUntil, so the handler does not hold any lock,
+// SKIP LOCKED lets every runner claim a different batch
+const claimQuery = `UPDATE Job j SET attempts = j.attempts + 1, runAt = $2
+WHERE j.ID IN (
+	SELECT ID FROM Job WHERE status = 0 AND runAt <= $1 AND jobType = ANY($3) ORDER BY runAt LIMIT $4 FOR UPDATE SKIP LOCKED
+)
+RETURNING ` + jobColumns
+
+func (j *Job) Claim(ctx context.Context, db *sqlx.DB, jobTypes []string, now time.Time, leaseUntil time.Time, limit int) ([]*domain.Job, error) {
+	jobs := []*domain.Job{}
+	if err := db.SelectContext(ctx, &jobs, claimQuery, wr.TimeToUTC(now), wr.TimeToUTC(leaseUntil),
+		pq.Array(jobTypes), limit); err != nil {
+
+		return nil, err
+	}
+
+	for _, job := range jobs {
+		cleanJob(job)
+	}
+
+	return jobs, nil
+}
+
+// the pending status and attempts fence the marks to the claim they belong to,
+// so a runner whose lease ran out does not overwrite the result of the runner which claimed the job again
+const markDoneQuery = `UPDATE Job SET status = 1, lastError = '', finishedAt = $3 WHERE ID = $1 AND attempts = $2 AND status = 0`
+
+func (j *Job) MarkDone(ctx context.Context, db *sqlx.DB, now time.Time, jobID int, attempts int) error {
+	_, err := db.ExecContext(ctx, markDoneQuery, jobID, attempts, wr.TimeToUTC(now))
+
+	return err
+}
+
+// markFailedQuery finishes the job when it is dead
+const markFailedQuery = `UPDATE Job SET status = $5, lastError = $3, runAt = $4,
+	finishedAt = CASE WHEN $5 = 2 THEN $6::TIMESTAMP END
+WHERE ID = $1 AND attempts = $2 AND status = 0`
+
+func (j *Job) MarkFailed(ctx context.Context, db *sqlx.DB, now time.Time, jobID int, attempts int, lastError string, runAt time.Time, status domain.JobStatus) error {
+	_, err := db.ExecContext(ctx, markFailedQuery, jobID, attempts, lastError, wr.TimeToUTC(runAt), int(status), wr.TimeToUTC(now))
+
+	return err
+}
+
+const pruneQuery = `DELETE FROM Job WHERE status <> 0 AND finishedAt < $1`
+
+func (j *Job) Prune(ctx context.Context, db *sqlx.DB, finishedBefore time.Time) (int, error) {
+	result, err := db.ExecContext(ctx, pruneQuery, wr.TimeToUTC(finishedBefore))
+	if err != nil {
+
+		return 0, err
+	}
+	pruned, err := result.RowsAffected()
+
+	return int(pruned), err
+}
+
+// leaderLockKey is the advisory lock key of the leader, "leader" in ascii
+const leaderLockKey = 0x6c6561646572
+
+// the leader lock is a session lock, held as long as its connection, so a leader which dies loses it
+const (
+	tryLeadQuery = `SELECT pg_try_advisory_lock($1)`
+	resignQuery  = `SELECT pg_advisory_unlock($1)`
+	checkQuery   = `SELECT 1`
+)
+
+func (j *Job) TryLead(ctx context.Context, db *sqlx.DB) (Leadership, error) {
+	conn, err := db.Connx(ctx)
+	if err != nil {
+
+		return nil, err
+	}
+
+	var locked bool
+	if err := conn.GetContext(ctx, &locked, tryLeadQuery, leaderLockKey); err != nil {
+		conn.Close()
+
+		return nil, err
+	}
+	if !locked {
+		conn.Close()
+
+		return nil, nil
+	}
+
+	return &leadership{conn: conn}, nil
+}
+
+// leadership holds the leader lock on conn
+type leadership struct {
+	conn *sqlx.Conn
+}
+
+func (l *leadership) Check(ctx context.Context) error {
+	_, err := l.conn.ExecContext(ctx, checkQuery)
+
+	return err
+}
+
+// Resign unlocks before conn goes back to the pool, a conn which fails to unlock is discarded instead,
+// since the pool would keep the lock with it
+func (l *leadership) Resign(ctx context.Context) error {
+	var unlocked bool
+	err := l.conn.GetContext(ctx, &unlocked, resignQuery, leaderLockKey)
+	if err != nil {
+		_ = l.conn.Raw(func(interface{}) error {
+
+			return driver.ErrBadConn
+		})
+	}
+	l.conn.Close()
+
+	return err
+}
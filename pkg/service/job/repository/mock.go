@@ -0,0 +1,63 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/sappy5678/cryptocom/pkg/domain"
+)
+
+type MockJobRepository struct {
+	EnqueueFunc    func(ctx context.Context, db sqlx.ExtContext, now time.Time, job *domain.Job) (*domain.Job, error)
+	ClaimFunc      func(ctx context.Context, db *sqlx.DB, jobTypes []string, now time.Time, leaseUntil time.Time, limit int) ([]*domain.Job, error)
+	MarkDoneFunc   func(ctx context.Context, db *sqlx.DB, now time.Time, jobID int, attempts int) error
+	MarkFailedFunc func(ctx context.Context, db *sqlx.DB, now time.Time, jobID int, attempts int, lastError string, runAt time.Time, status domain.JobStatus) error
+	PruneFunc      func(ctx context.Context, db *sqlx.DB, finishedBefore time.Time) (int, error)
+	TryLeadFunc    func(ctx context.Context, db *sqlx.DB) (Leadership, error)
+}
+
+func (m *MockJobRepository) Enqueue(ctx context.Context, db sqlx.ExtContext, now time.Time, job *domain.Job) (*domain.Job, error) {
+
+	return m.EnqueueFunc(ctx, db, now, job)
+}
+
+func (m *MockJobRepository) Claim(ctx context.Context, db *sqlx.DB, jobTypes []string, now time.Time, leaseUntil time.Time, limit int) ([]*domain.Job, error) {
+
+	return m.ClaimFunc(ctx, db, jobTypes, now, leaseUntil, limit)
+}
+
+func (m *MockJobRepository) MarkDone(ctx context.Context, db *sqlx.DB, now time.Time, jobID int, attempts int) error {
+
+	return m.MarkDoneFunc(ctx, db, now, jobID, attempts)
+}
+
+func (m *MockJobRepository) MarkFailed(ctx context.Context, db *sqlx.DB, now time.Time, jobID int, attempts int, lastError string, runAt time.Time, status domain.JobStatus) error {
+
+	return m.MarkFailedFunc(ctx, db, now, jobID, attempts, lastError, runAt, status)
+}
+
+func (m *MockJobRepository) Prune(ctx context.Context, db *sqlx.DB, finishedBefore time.Time) (int, error) {
+
+	return m.PruneFunc(ctx, db, finishedBefore)
+}
+
+func (m *MockJobRepository) TryLead(ctx context.Context, db *sqlx.DB) (Leadership, error) {
+
+	return m.TryLeadFunc(ctx, db)
+}
+
+type MockLeadership struct {
+	CheckFunc  func(ctx context.Context) error
+	ResignFunc func(ctx context.Context) error
+}
+
+func (m *MockLeadership) Check(ctx context.Context) error {
+
+	return m.CheckFunc(ctx)
+}
+
+func (m *MockLeadership) Resign(ctx context.Context) error {
+
+	return m.ResignFunc(ctx)
+}
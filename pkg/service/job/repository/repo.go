@@ -0,0 +1,35 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/sappy5678/cryptocom/pkg/domain"
+)
+
+// JobRepository represents job queue repository interface
+type JobRepository interface {
+	// Enqueue inserts a pending job, db may be the transaction of the change the job follows, so it commits with it
+	Enqueue(ctx context.Context, db sqlx.ExtContext, now time.Time, job *domain.Job) (*domain.Job, error)
+	// Claim leases due pending jobs of jobTypes until leaseUntil, oldest runAt first, and counts the attempt,
+	// jobs locked by another runner are skipped
+	Claim(ctx context.Context, db *sqlx.DB, jobTypes []string, now time.Time, leaseUntil time.Time, limit int) ([]*domain.Job, error)
+	// MarkDone and MarkFailed record the result of the claim that counted attempts,
+	// they do nothing once the job was claimed again
+	MarkDone(ctx context.Context, db *sqlx.DB, now time.Time, jobID int, attempts int) error
+	// MarkFailed records lastError and retries the job at runAt, a dead job is not retried
+	MarkFailed(ctx context.Context, db *sqlx.DB, now time.Time, jobID int, attempts int, lastError string, runAt time.Time, status domain.JobStatus) error
+	// Prune deletes the done and dead jobs finished before finishedBefore, it returns the number deleted
+	Prune(ctx context.Context, db *sqlx.DB, finishedBefore time.Time) (int, error)
+	// TryLead takes the leader lock on a connection of its own, it returns nil when another runner holds it
+	TryLead(ctx context.Context, db *sqlx.DB) (Leadership, error)
+}
+
+// Leadership is the leader lock, held as long as its connection
+type Leadership interface {
+	// Check fails when the lock may be lost, like when its connection broke
+	Check(ctx context.Context) error
+	// Resign releases the lock and its connection
+	Resign(ctx context.Context) error
+}
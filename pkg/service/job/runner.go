@@ -0,0 +1,255 @@
+// Package job runs background jobs from a Postgres queue, and singleton jobs on the one runner elected leader
+package job
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/sappy5678/cryptocom/pkg/domain"
+	"github.com/sappy5678/cryptocom/pkg/service/job/repository"
+)
+
+const source = "job"
+
+// Handler handles a job, an error retries it with backoff until its MaxAttempts, then it is dead
+// the job may run again after a crash, so handlers must be idempotent
+type Handler func(ctx context.Context, job *domain.Job) error
+
+// NewRunner creates new job runner with defaults
+func NewRunner(db *sqlx.DB, jobRepo repository.JobRepository, logger domain.Logger) *Runner {
+
+	return &Runner{
+		db:             db,
+		jobRepo:        jobRepo,
+		logger:         logger,
+		handlers:       map[string]Handler{},
+		Workers:        4,
+		MaxAttempts:    10,
+		PollInterval:   time.Second,
+		Lease:          5 * time.Minute,
+		BaseBackoff:    10 * time.Second,
+		MaxBackoff:     time.Hour,
+		LeaderInterval: 5 * time.Second,
+	}
+}
+
+// Runner runs the jobs of its handlers, every runner claims different jobs, so they scale out,
+// and the singletons run only on the runner holding the leader lock
+type Runner struct {
+	db         *sqlx.DB
+	jobRepo    repository.JobRepository
+	logger     domain.Logger
+	handlers   map[string]Handler
+	singletons []*singleton
+
+	// Workers is how many jobs run at once
+	Workers int
+	// MaxAttempts of the jobs enqueued without one
+	MaxAttempts  int
+	PollInterval time.Duration
+	// Lease is how long a claimed job is hidden from other runners, a handler is canceled when it runs out
+	Lease       time.Duration
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+	// LeaderInterval is how often the leadership is tried or checked
+	LeaderInterval time.Duration
+}
+
+type singleton struct {
+	name     string
+	interval time.Duration
+	fn       func(ctx context.Context) error
+}
+
+// Handle registers the handler of jobType, it must be called before Run
+func (r *Runner) Handle(jobType string, handler Handler) {
+	r.handlers[jobType] = handler
+}
+
+// Singleton registers fn to run every interval on the leader only, it must be called before Run
+func (r *Runner) Singleton(name string, interval time.Duration, fn func(ctx context.Context) error) {
+	r.singletons = append(r.singletons, &singleton{name: name, interval: interval, fn: fn})
+}
+
+// Enqueue adds a job of jobType with the JSON of payload, run at runAt or as soon as possible when it is zero,
+// db may be a transaction, so the job is enqueued only when it commits
+func (r *Runner) Enqueue(ctx context.Context, db sqlx.ExtContext, jobType string, payload interface{}, runAt time.Time) (*domain.Job, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+
+		return nil, err
+	}
+	now := time.Now()
+	if runAt.IsZero() {
+		runAt = now
+	}
+
+	return r.jobRepo.Enqueue(ctx, db, now, &domain.Job{
+		Type:        jobType,
+		Payload:     data,
+		MaxAttempts: r.MaxAttempts,
+		RunAt:       runAt,
+	})
+}
+
+// Run runs jobs and, while leader, the singletons until ctx is done, then it waits for the running ones to finish
+func (r *Runner) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	if len(r.singletons) > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.elect(ctx)
+		}()
+	}
+	if len(r.handlers) > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.poll(ctx)
+		}()
+	}
+	wg.Wait()
+}
+
+// poll keeps Workers jobs running, a worker claims the next job as soon as its job is done, so a slow job
+// does not hold the others, the queue is polled every PollInterval once drained
+// the jobs are not canceled with ctx, so a shutdown waits for them, each is canceled when its lease runs out
+func (r *Runner) poll(ctx context.Context) {
+	ticker := time.NewTicker(r.PollInterval)
+	defer ticker.Stop()
+
+	jobCtx := context.WithoutCancel(ctx)
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	// every running job sends once, so the buffer never blocks a worker waiting for the poll loop to return
+	finished := make(chan struct{}, r.Workers)
+	running := 0
+	drained := false
+	for {
+		for ctx.Err() == nil && !drained && running < r.Workers {
+			idle := r.Workers - running
+			jobs, err := r.claim(ctx, time.Now(), idle)
+			if err != nil {
+				r.logger.Log(ctx, source, "Run jobs", err, nil)
+			}
+			for _, job := range jobs {
+				running++
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					if err := r.run(jobCtx, job); err != nil {
+						r.logger.Log(ctx, source, "Mark job", err, map[string]interface{}{
+							"jobID": job.ID,
+						})
+					}
+					finished <- struct{}{}
+				}()
+			}
+			drained = err != nil || len(jobs) < idle
+		}
+
+		select {
+		case <-ctx.Done():
+
+			return
+		case <-finished:
+			running--
+		case <-ticker.C:
+			drained = false
+		}
+	}
+}
+
+// RunOnce claims up to Workers due jobs and runs them at once, it returns the number claimed once they are done,
+// Run does not wait for a batch, it claims a job for every worker which is done
+// the jobs are not canceled with ctx, each is canceled when its lease runs out
+func (r *Runner) RunOnce(ctx context.Context, now time.Time) (int, error) {
+	jobs, err := r.claim(ctx, now, r.Workers)
+	if err != nil {
+
+		return 0, err
+	}
+
+	ctx = context.WithoutCancel(ctx)
+	errs := make([]error, len(jobs))
+	var wg sync.WaitGroup
+	for i, job := range jobs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = r.run(ctx, job)
+		}()
+	}
+	wg.Wait()
+
+	return len(jobs), errors.Join(errs...)
+}
+
+// claim leases up to limit due jobs of the handled types
+func (r *Runner) claim(ctx context.Context, now time.Time, limit int) ([]*domain.Job, error) {
+	jobTypes := make([]string, 0, len(r.handlers))
+	for jobType := range r.handlers {
+		jobTypes = append(jobTypes, jobType)
+	}
+	sort.Strings(jobTypes)
+
+	return r.jobRepo.Claim(ctx, r.db, jobTypes, now, now.Add(r.Lease), limit)
+}
+
+// run handles job within the lease and records the result
+func (r *Runner) run(ctx context.Context, job *domain.Job) error {
+	handleCtx, cancel := context.WithTimeout(ctx, r.Lease)
+	defer cancel()
+	if err := handle(handleCtx, r.handlers[job.Type], job); err != nil {
+		status := domain.JobStatusPending
+		if job.Attempts >= job.MaxAttempts {
+			status = domain.JobStatusDead
+		}
+
+		r.logger.Log(ctx, source, "Run job", err, map[string]interface{}{
+			"jobID":    job.ID,
+			"jobType":  job.Type,
+			"attempts": job.Attempts,
+			"dead":     status == domain.JobStatusDead,
+		})
+
+		now := time.Now()
+
+		return r.jobRepo.MarkFailed(ctx, r.db, now, job.ID, job.Attempts, err.Error(), now.Add(r.Backoff(job.Attempts)), status)
+	}
+
+	return r.jobRepo.MarkDone(ctx, r.db, time.Now(), job.ID, job.Attempts)
+}
+
+// handle calls handler, a panic fails the job instead of the runner
+func handle(ctx context.Context, handler Handler, job *domain.Job) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("job panicked, %v", p)
+		}
+	}()
+
+	return handler(ctx, job)
+}
+
+// Backoff returns the delay before the next attempt, it doubles on every attempt up to MaxBackoff
+func (r *Runner) Backoff(attempts int) time.Duration {
+	backoff := r.BaseBackoff
+	for i := 1; i < attempts; i++ {
+		backoff *= 2
+		if backoff >= r.MaxBackoff {
+
+			return r.MaxBackoff
+		}
+	}
+
+	return backoff
+}
@@ -0,0 +1,327 @@
+package job_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
+
+	"github.com/sappy5678/cryptocom/pkg/domain"
+	"github.com/sappy5678/cryptocom/pkg/service/job"
+	"github.com/sappy5678/cryptocom/pkg/service/job/repository"
+	"github.com/sappy5678/cryptocom/pkg/utl/zlog"
+)
+
+// result records how a job was finished
+type result struct {
+	attempts  int
+	done      bool
+	lastError string
+	runAt     time.Time
+	status    domain.JobStatus
+}
+
+// queueRepository claims the pending jobs of the claimed types up to limit and records their results
+func queueRepository(pending *[]*domain.Job, gotTypes *[]string, results map[int]*result) *repository.MockJobRepository {
+	var mu sync.Mutex
+
+	return &repository.MockJobRepository{
+		ClaimFunc: func(ctx context.Context, db *sqlx.DB, jobTypes []string, now time.Time, leaseUntil time.Time, limit int) ([]*domain.Job, error) {
+			*gotTypes = jobTypes
+			claimed, left := []*domain.Job{}, []*domain.Job{}
+			for _, j := range *pending {
+				handled := false
+				for _, jobType := range jobTypes {
+					handled = handled || j.Type == jobType
+				}
+				if handled && len(claimed) < limit {
+					j.Attempts++
+					claimed = append(claimed, j)
+				} else {
+					left = append(left, j)
+				}
+			}
+			*pending = left
+
+			return claimed, nil
+		},
+		MarkDoneFunc: func(ctx context.Context, db *sqlx.DB, now time.Time, jobID int, attempts int) error {
+			mu.Lock()
+			defer mu.Unlock()
+			results[jobID] = &result{attempts: attempts, done: true}
+
+			return nil
+		},
+		MarkFailedFunc: func(ctx context.Context, db *sqlx.DB, now time.Time, jobID int, attempts int, lastError string, runAt time.Time, status domain.JobStatus) error {
+			mu.Lock()
+			defer mu.Unlock()
+			results[jobID] = &result{attempts: attempts, lastError: lastError, runAt: runAt, status: status}
+
+			return nil
+		},
+	}
+}
+
+func TestRunOnce(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	tests := []struct {
+		name        string
+		attempts    int
+		handlerErr  error
+		panics      bool
+		wantDone    bool
+		wantStatus  domain.JobStatus
+		wantError   string
+		wantBackoff time.Duration
+	}{
+		{
+			name:     "success",
+			wantDone: true,
+		},
+		{
+			name:        "retried",
+			attempts:    1,
+			handlerErr:  errors.New("error"),
+			wantStatus:  domain.JobStatusPending,
+			wantError:   "error",
+			wantBackoff: 20 * time.Second,
+		},
+		{
+			name:        "dead",
+			attempts:    2,
+			handlerErr:  errors.New("error"),
+			wantStatus:  domain.JobStatusDead,
+			wantError:   "error",
+			wantBackoff: 40 * time.Second,
+		},
+		{
+			name:        "panic",
+			panics:      true,
+			wantStatus:  domain.JobStatusPending,
+			wantError:   "job panicked, boom",
+			wantBackoff: 10 * time.Second,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pending := []*domain.Job{
+				{ID: 1, Type: "send", Attempts: tt.attempts, MaxAttempts: 3},
+				{ID: 2, Type: "unknown", MaxAttempts: 3},
+			}
+			var gotTypes []string
+			results := map[int]*result{}
+
+			runner := job.NewRunner(nil, queueRepository(&pending, &gotTypes, results), zlog.New())
+			runner.Handle("send", func(ctx context.Context, j *domain.Job) error {
+				if tt.panics {
+					panic("boom")
+				}
+
+				return tt.handlerErr
+			})
+			runner.Handle("archive", func(ctx context.Context, j *domain.Job) error {
+
+				return nil
+			})
+
+			now := time.Now()
+			n, err := runner.RunOnce(context.Background(), now)
+			assert.NoError(t, err)
+			assert.Equal(t, 1, n)
+			assert.Equal(t, []string{"archive", "send"}, gotTypes)
+			// the jobs nobody handles are left pending
+			assert.Len(t, pending, 1)
+			assert.Len(t, results, 1)
+
+			// the result is fenced to the claim
+			got := results[1]
+			assert.Equal(t, tt.attempts+1, got.attempts)
+			assert.Equal(t, tt.wantDone, got.done)
+			if !tt.wantDone {
+				assert.Equal(t, tt.wantStatus, got.status)
+				assert.Equal(t, tt.wantError, got.lastError)
+				assert.WithinDuration(t, now.Add(tt.wantBackoff), got.runAt, time.Minute)
+			}
+		})
+	}
+
+	// a claim error is returned
+	mockError := errors.New("error")
+	runner := job.NewRunner(nil, &repository.MockJobRepository{
+		ClaimFunc: func(ctx context.Context, db *sqlx.DB, jobTypes []string, now time.Time, leaseUntil time.Time, limit int) ([]*domain.Job, error) {
+
+			return nil, mockError
+		},
+	}, zlog.New())
+	_, err := runner.RunOnce(context.Background(), time.Now())
+	assert.ErrorIs(t, err, mockError)
+}
+
+func TestRunWorkerPool(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	pending := []*domain.Job{
+		{ID: 1, Type: "send", MaxAttempts: 3},
+		{ID: 2, Type: "send", MaxAttempts: 3},
+		{ID: 3, Type: "send", MaxAttempts: 3},
+	}
+	var gotTypes []string
+	results := map[int]*result{}
+
+	release := make(chan struct{})
+	handled := make(chan int, len(pending))
+	runner := job.NewRunner(nil, queueRepository(&pending, &gotTypes, results), zlog.New())
+	runner.Workers = 2
+	runner.PollInterval = time.Hour
+	runner.Handle("send", func(ctx context.Context, j *domain.Job) error {
+		if j.ID == 1 {
+			<-release
+		}
+		handled <- j.ID
+
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		runner.Run(ctx)
+	}()
+
+	// a slow job does not hold the other worker, which claims the next job once its own is done
+	for _, wantID := range []int{2, 3} {
+		select {
+		case id := <-handled:
+			assert.Equal(t, wantID, id)
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for job")
+		}
+	}
+
+	// a shutdown waits for the running job
+	cancel()
+	select {
+	case <-done:
+		t.Fatal("run returned before the running job")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	<-done
+	assert.Equal(t, 1, <-handled)
+	assert.Len(t, results, 3)
+}
+
+func TestBackoff(t *testing.T) {
+	runner := job.NewRunner(nil, nil, zlog.New())
+	runner.BaseBackoff = time.Second
+	runner.MaxBackoff = 5 * time.Second
+
+	assert.Equal(t, time.Second, runner.Backoff(0))
+	assert.Equal(t, time.Second, runner.Backoff(1))
+	assert.Equal(t, 2*time.Second, runner.Backoff(2))
+	assert.Equal(t, 4*time.Second, runner.Backoff(3))
+	assert.Equal(t, 5*time.Second, runner.Backoff(4))
+	assert.Equal(t, 5*time.Second, runner.Backoff(100))
+}
+
+func TestRun(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	pending := []*domain.Job{
+		{ID: 1, Type: "send", MaxAttempts: 3},
+		{ID: 2, Type: "send", MaxAttempts: 3},
+		{ID: 3, Type: "send", MaxAttempts: 3},
+	}
+	var gotTypes []string
+	results := map[int]*result{}
+	repo := queueRepository(&pending, &gotTypes, results)
+
+	// the first try loses the election, the second leads until the check fails, then the runner leads again
+	var tries, checks int
+	resigned := make(chan struct{}, 2)
+	repo.TryLeadFunc = func(ctx context.Context, db *sqlx.DB) (repository.Leadership, error) {
+		tries++
+		if tries == 1 {
+
+			return nil, nil
+		}
+
+		return &repository.MockLeadership{
+			CheckFunc: func(ctx context.Context) error {
+				checks++
+				if checks == 1 {
+
+					return errors.New("connection lost")
+				}
+
+				return nil
+			},
+			ResignFunc: func(ctx context.Context) error {
+				resigned <- struct{}{}
+
+				return nil
+			},
+		}, nil
+	}
+
+	handled := make(chan int, len(pending))
+	led := make(chan struct{}, 10)
+	runner := job.NewRunner(nil, repo, zlog.New())
+	runner.Workers = 1
+	runner.PollInterval = time.Hour
+	runner.LeaderInterval = 10 * time.Millisecond
+	runner.Handle("send", func(ctx context.Context, j *domain.Job) error {
+		handled <- j.ID
+
+		return nil
+	})
+	runner.Singleton("tick", time.Hour, func(ctx context.Context) error {
+		led <- struct{}{}
+
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		runner.Run(ctx)
+	}()
+
+	// the queue is drained without waiting for the next tick
+	for _, wantID := range []int{1, 2, 3} {
+		select {
+		case id := <-handled:
+			assert.Equal(t, wantID, id)
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for job")
+		}
+	}
+
+	// the singleton runs once per leadership, the lost one is resigned
+	for i := 0; i < 2; i++ {
+		select {
+		case <-led:
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for singleton")
+		}
+	}
+	select {
+	case <-resigned:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for resign")
+	}
+
+	cancel()
+	<-done
+	// the leader resigns on shutdown
+	assert.Len(t, resigned, 1)
+}
@@ -0,0 +1,81 @@
+// Package outbox relays committed wallet events to a message bus
+package outbox
+
+import (
+	"context"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/sappy5678/cryptocom/pkg/domain"
+	"github.com/sappy5678/cryptocom/pkg/service/outbox/repository"
+)
+
+const source = "outbox"
+
+// NewRelay creates new outbox relay with defaults
+func NewRelay(db *sqlx.DB, outboxRepo repository.OutboxRepository, publisher domain.Publisher, logger domain.Logger) *Relay {
+
+	return &Relay{
+		db:           db,
+		outboxRepo:   outboxRepo,
+		publisher:    publisher,
+		logger:       logger,
+		BatchSize:    100,
+		PollInterval: 500 * time.Millisecond,
+	}
+}
+
+// Relay publishes outbox events through the publisher,
+// an event is marked published only after the publisher accepts it, so delivery is at-least-once
+type Relay struct {
+	db         *sqlx.DB
+	outboxRepo repository.OutboxRepository
+	publisher  domain.Publisher
+	logger     domain.Logger
+
+	BatchSize    int
+	PollInterval time.Duration
+}
+
+// Run relays events until ctx is done
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		// drain the outbox before waiting for the next tick
+		if n, err := r.Drain(ctx); err != nil {
+			r.logger.Log(ctx, source, "Relay outbox events", err, map[string]interface{}{
+				"published": n,
+			})
+		}
+
+		select {
+		case <-ctx.Done():
+
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Drain publishes batches of events until a batch is not full, it returns the number of published events,
+// the job runner calls it every PollInterval on its leader
+func (r *Relay) Drain(ctx context.Context) (int, error) {
+	published := 0
+	for {
+		n, err := r.RelayOnce(ctx, time.Now())
+		published += n
+		if err != nil || n < r.BatchSize || ctx.Err() != nil {
+
+			return published, err
+		}
+	}
+}
+
+// RelayOnce publishes one batch of events, it returns the number of published events
+func (r *Relay) RelayOnce(ctx context.Context, now time.Time) (int, error) {
+
+	return r.outboxRepo.Relay(ctx, r.db, now, r.BatchSize, r.publisher.Publish)
+}
@@ -0,0 +1,157 @@
+package outbox_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
+
+	"github.com/sappy5678/cryptocom/pkg/domain"
+	"github.com/sappy5678/cryptocom/pkg/service/outbox"
+	"github.com/sappy5678/cryptocom/pkg/service/outbox/repository"
+	"github.com/sappy5678/cryptocom/pkg/utl/publisher"
+	"github.com/sappy5678/cryptocom/pkg/utl/zlog"
+)
+
+// relayRepository publishes the pending events in order and stops at the first failure like the real repository
+func relayRepository(pending *[]*domain.Event, gotLimit *int) *repository.MockOutboxRepository {
+
+	return &repository.MockOutboxRepository{
+		RelayFunc: func(ctx context.Context, db *sqlx.DB, now time.Time, limit int, publish func(context.Context, *domain.Event) error) (int, error) {
+			*gotLimit = limit
+			n := 0
+			for _, event := range *pending {
+				if n == limit {
+
+					break
+				}
+				if err := publish(ctx, event); err != nil {
+					*pending = (*pending)[n:]
+
+					return n, err
+				}
+				n++
+			}
+			*pending = (*pending)[n:]
+
+			return n, nil
+		},
+	}
+}
+
+func TestRelayOnce(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	events := []*domain.Event{
+		{ID: 1, AggregateID: "user-1", Type: domain.EventTypeWalletCreated},
+		{ID: 2, AggregateID: "user-1", Type: domain.EventTypeDeposited},
+		{ID: 3, AggregateID: "user-1", Type: domain.EventTypeWithdrawn},
+	}
+	mockError := errors.New("error")
+
+	tests := []struct {
+		name          string
+		publishErr    error
+		wantPublished int
+		wantErr       error
+		wantEvents    []*domain.Event
+		wantPending   int
+	}{
+		{
+			name:          "success",
+			wantPublished: 2,
+			wantEvents:    events[:2],
+			wantPending:   1,
+		},
+		{
+			name:        "publisher error",
+			publishErr:  mockError,
+			wantErr:     mockError,
+			wantEvents:  []*domain.Event{},
+			wantPending: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pending := append([]*domain.Event{}, events...)
+			var gotLimit int
+			bus := publisher.NewMemory()
+			bus.SetErr(tt.publishErr)
+
+			relay := outbox.NewRelay(nil, relayRepository(&pending, &gotLimit), bus, zlog.New())
+			relay.BatchSize = 2
+			n, err := relay.RelayOnce(context.Background(), time.Now())
+			assert.ErrorIs(t, err, tt.wantErr)
+			assert.Equal(t, tt.wantPublished, n)
+			assert.Equal(t, 2, gotLimit)
+			assert.Equal(t, tt.wantEvents, bus.Events())
+			assert.Len(t, pending, tt.wantPending)
+		})
+	}
+}
+
+func TestDrain(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	pending := []*domain.Event{
+		{ID: 1, AggregateID: "user-1", Type: domain.EventTypeWalletCreated},
+		{ID: 2, AggregateID: "user-1", Type: domain.EventTypeDeposited},
+		{ID: 3, AggregateID: "user-2", Type: domain.EventTypeWalletCreated},
+	}
+	var gotLimit int
+	bus := publisher.NewMemory()
+
+	// full batches are followed by the next one
+	relay := outbox.NewRelay(nil, relayRepository(&pending, &gotLimit), bus, zlog.New())
+	relay.BatchSize = 2
+	n, err := relay.Drain(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 3, n)
+	assert.Len(t, bus.Events(), 3)
+	assert.Empty(t, pending)
+}
+
+func TestRun(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	pending := []*domain.Event{
+		{ID: 1, AggregateID: "user-1", Type: domain.EventTypeWalletCreated},
+		{ID: 2, AggregateID: "user-1", Type: domain.EventTypeDeposited},
+		{ID: 3, AggregateID: "user-2", Type: domain.EventTypeWalletCreated},
+	}
+	var gotLimit int
+	bus := publisher.NewMemory()
+	received := make(chan *domain.Event, len(pending))
+	bus.Subscribe(func(event *domain.Event) {
+		received <- event
+	})
+
+	relay := outbox.NewRelay(nil, relayRepository(&pending, &gotLimit), bus, zlog.New())
+	relay.BatchSize = 1
+	relay.PollInterval = time.Hour
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		relay.Run(ctx)
+	}()
+
+	// the outbox is drained without waiting for the next tick
+	for _, wantID := range []int{1, 2, 3} {
+		select {
+		case event := <-received:
+			assert.Equal(t, wantID, event.ID)
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for event")
+		}
+	}
+
+	cancel()
+	<-done
+}
@@ -0,0 +1,74 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+
+	"github.com/sappy5678/cryptocom/pkg/domain"
+	wr "github.com/sappy5678/cryptocom/pkg/service/wallet/repository"
+)
+
+// Outbox represents the client for outbox table
+type Outbox struct{}
+
+// relayLockKey is the advisory lock key of the relay, "outbox" in ascii
+const relayLockKey = 0x6f7574626f78
+
+// relayLockQuery makes the relay a singleton across replicas, the lock is released on commit or rollback
+const relayLockQuery = `SELECT pg_try_advisory_xact_lock($1)`
+
+const getUnpublishedQuery = `SELECT ID, aggregateID, eventType AS type, payload, createdAt FROM Outbox WHERE publishedAt IS NULL ORDER BY ID LIMIT $1`
+
+const markPublishedQuery = `UPDATE Outbox SET publishedAt = $2 WHERE ID = ANY($1)`
+
+func (o *Outbox) Relay(ctx context.Context, db *sqlx.DB, now time.Time, limit int, publish func(context.Context, *domain.Event) error) (int, error) {
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// another replica is relaying
+	var locked bool
+	if err := tx.GetContext(ctx, &locked, relayLockQuery, relayLockKey); err != nil {
+
+		return 0, err
+	} else if !locked {
+
+		return 0, nil
+	}
+
+	events := []*domain.Event{}
+	if err := tx.SelectContext(ctx, &events, getUnpublishedQuery, limit); err != nil {
+
+		return 0, err
+	}
+
+	published := pq.Int64Array{}
+	var publishErr error
+	for _, event := range events {
+		event.CreatedAt = wr.TimeToUTC(event.CreatedAt)
+		if publishErr = publish(ctx, event); publishErr != nil {
+
+			break
+		}
+		published = append(published, int64(event.ID))
+	}
+
+	if len(published) > 0 {
+		if _, err := tx.ExecContext(ctx, markPublishedQuery, published, wr.TimeToUTC(now)); err != nil {
+
+			return 0, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+
+		return 0, err
+	}
+
+	return len(published), publishErr
+}
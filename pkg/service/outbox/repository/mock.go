@@ -0,0 +1,18 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/sappy5678/cryptocom/pkg/domain"
+)
+
+type MockOutboxRepository struct {
+	RelayFunc func(ctx context.Context, db *sqlx.DB, now time.Time, limit int, publish func(context.Context, *domain.Event) error) (int, error)
+}
+
+func (m *MockOutboxRepository) Relay(ctx context.Context, db *sqlx.DB, now time.Time, limit int, publish func(context.Context, *domain.Event) error) (int, error) {
+
+	return m.RelayFunc(ctx, db, now, limit, publish)
+}
@@ -0,0 +1,16 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/sappy5678/cryptocom/pkg/domain"
+)
+
+// OutboxRepository represents outbox repository interface
+type OutboxRepository interface {
+	// Relay publishes unpublished events in ID order and marks them published,
+	// it stops at the first failure so events of a wallet are never published out of order
+	Relay(ctx context.Context, db *sqlx.DB, now time.Time, limit int, publish func(context.Context, *domain.Event) error) (int, error)
+}
@@ -32,43 +32,617 @@
 package service
 
 import (
-	"net/http"
-	"os"
+	"context"
+	"fmt"
+	"sync"
+	"time"
 
+	"github.com/jmoiron/sqlx"
 	"github.com/labstack/echo"
+	"github.com/labstack/echo/middleware"
+	"github.com/lib/pq"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/sappy5678/cryptocom/deploy/db/migrations"
+	sqlitemigrations "github.com/sappy5678/cryptocom/deploy/db/sqlite/migrations"
+	"github.com/sappy5678/cryptocom/pkg/domain"
+	"github.com/sappy5678/cryptocom/pkg/service/archive"
+	ar "github.com/sappy5678/cryptocom/pkg/service/archive/repository"
+	"github.com/sappy5678/cryptocom/pkg/service/job"
+	jr "github.com/sappy5678/cryptocom/pkg/service/job/repository"
+	"github.com/sappy5678/cryptocom/pkg/service/outbox"
+	or "github.com/sappy5678/cryptocom/pkg/service/outbox/repository"
 	"github.com/sappy5678/cryptocom/pkg/service/wallet"
+	wa "github.com/sappy5678/cryptocom/pkg/service/wallet/archive"
+	wc "github.com/sappy5678/cryptocom/pkg/service/wallet/cache"
+	we "github.com/sappy5678/cryptocom/pkg/service/wallet/events"
 	wl "github.com/sappy5678/cryptocom/pkg/service/wallet/logging"
+	wm "github.com/sappy5678/cryptocom/pkg/service/wallet/metrics"
+	"github.com/sappy5678/cryptocom/pkg/service/wallet/repository"
+	wtr "github.com/sappy5678/cryptocom/pkg/service/wallet/tracing"
 	wt "github.com/sappy5678/cryptocom/pkg/service/wallet/transport"
+	wg "github.com/sappy5678/cryptocom/pkg/service/wallet/transport/grpc"
+	"github.com/sappy5678/cryptocom/pkg/service/webhook"
+	whr "github.com/sappy5678/cryptocom/pkg/service/webhook/repository"
+	wht "github.com/sappy5678/cryptocom/pkg/service/webhook/transport"
 	"github.com/sappy5678/cryptocom/pkg/utl/config"
+	"github.com/sappy5678/cryptocom/pkg/utl/health"
+	"github.com/sappy5678/cryptocom/pkg/utl/migration"
 	"github.com/sappy5678/cryptocom/pkg/utl/postgres"
+	"github.com/sappy5678/cryptocom/pkg/utl/publisher"
+	"github.com/sappy5678/cryptocom/pkg/utl/redis"
 	"github.com/sappy5678/cryptocom/pkg/utl/server"
+	"github.com/sappy5678/cryptocom/pkg/utl/sqlite"
+	"github.com/sappy5678/cryptocom/pkg/utl/tracing"
 	"github.com/sappy5678/cryptocom/pkg/utl/zlog"
+	"go.opentelemetry.io/otel"
+	"google.golang.org/grpc"
 )
 
-// Start starts the API service
-func Start(cfg *config.Configuration) error {
-	db, err := postgres.New(os.Getenv("DATABASE_URL"))
+// Start serves the API until ctx is done, then it shuts down gracefully, readiness fails first, the servers drain,
+// the background workers stop and the connections are closed, it returns the error the service failed with
+func Start(ctx context.Context, cfg *config.Configuration) error {
+	// statements are traced through the global tracer provider, so set it up before any query
+	if cfg.Tracing != nil {
+		tp, err := tracing.New(context.Background(), &tracing.Config{
+			ServiceName: cfg.Tracing.ServiceName,
+			Endpoint:    cfg.Tracing.OTLPEndpoint,
+			Insecure:    cfg.Tracing.Insecure,
+			SampleRatio: cfg.Tracing.SampleRatio,
+		})
+		if err != nil {
+
+			return err
+		}
+		defer tp.Shutdown(context.Background())
+	}
+
+	// the background workers run until the servers are stopped, not until ctx is done,
+	// so the requests in flight during the drain still get notifications and events relayed
+	workerCtx, stopWorkers := context.WithCancel(context.WithoutCancel(ctx))
+	var workers sync.WaitGroup
+	runWorker := func(run func(ctx context.Context)) {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			run(workerCtx)
+		}()
+	}
+	stopBackground := func() {
+		stopWorkers()
+		workers.Wait()
+	}
+	// a failed start stops the workers too
+	defer stopBackground()
+
+	checker := health.New()
+
+	// the memory driver keeps the wallets in process and sqlite in a file, without postgres there are no webhooks or outbox
+	// and wallet changes are notified by the repository instead of LISTEN/NOTIFY
+	var db *sqlx.DB
+	var walletRepo repository.WalletRepository
+	var listener *pq.Listener
+	var notify *func(userID string)
+	var replicas *postgres.Replicas
+	queryTimeout := time.Duration(cfg.Database.QueryTimeoutSeconds) * time.Second
+	switch cfg.Database.Driver {
+	case config.DriverMemory:
+		memory := repository.NewMemory()
+		walletRepo, notify = memory, &memory.Notify
+	case config.DriverSQLite:
+		var err error
+		db, err = newSQLite(cfg.Database, checker)
+		if err != nil {
+
+			return err
+		}
+
+		sqliteRepo := &repository.SQLite{QueryTimeout: queryTimeout}
+		walletRepo, notify = sqliteRepo, &sqliteRepo.Notify
+	default:
+		var err error
+		db, listener, err = newPostgres(cfg.Database, checker)
+		if err != nil {
+
+			return err
+		}
+		defer listener.Close()
+
+		walletRepo = &repository.Wallet{QueryTimeout: queryTimeout}
+
+		if len(cfg.Database.ReplicaDSNs) > 0 {
+			if replicas, err = newReplicas(cfg.Database, db, checker); err != nil {
+
+				return err
+			}
+			defer replicas.Close()
+			runWorker(func(ctx context.Context) {
+				replicas.Run(ctx, replicaPollInterval)
+			})
+		}
+	}
+	if db != nil {
+		defer db.Close()
+	}
+
+	// the hub ends the SSE streams once the server is drained, see OnDrained, it is closed here when the start fails
+	hub := we.New(db, walletRepo)
+	defer hub.Close()
+	if listener != nil {
+		runWorker(func(ctx context.Context) {
+			hub.Listen(ctx, listener.Notify)
+		})
+	} else {
+		*notify = hub.Notify
+	}
+
+	log, err := newLogger(cfg.Logging)
 	if err != nil {
 
 		return err
 	}
+	defer log.Close()
 
-	log := zlog.New()
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	if db != nil {
+		reg.MustRegister(collectors.NewDBStatsCollector(db.DB, "cryptocom"))
+	}
+
+	// reads of the wallet service go to the replicas, a nil *Replicas must not become a non nil Reader
+	var reader wallet.Reader
+	if replicas != nil {
+		reader = replicas
+	}
+	var walletCore domain.WalletService = wallet.NewWithReader(db, reader, walletRepo)
+	if cfg.Archive != nil && cfg.Database.Postgres() {
+		walletCore = wa.New(walletCore, newArchiver(cfg.Archive, db, log))
+	}
+	if cfg.Cache != nil {
+		cached, closeCache := newCache(cfg.Cache, walletCore, checker)
+		defer closeCache()
+		// reads with a consistency token must see their writes, a cached entry may predate them
+		if replicas != nil {
+			cached.Bypass = replicas.HasToken
+		}
+		walletCore = cached
+	}
+	walletService := wtr.New(wm.New(wl.New(walletCore, log), reg), otel.GetTracerProvider())
 
 	e := server.New()
+	e.Use(server.RequestID(), server.Tracing(otel.GetTracerProvider(), otel.GetTextMapPropagator()), server.Metrics(reg))
+	if cfg.Limits != nil && cfg.Limits.BodyLimit != "" {
+		e.Use(middleware.BodyLimit(cfg.Limits.BodyLimit))
+	}
+	if replicas != nil {
+		e.Use(server.ReadYourWrites(replicas))
+	}
+	// the probes present no client certificate
+	if cfg.Server.TLSCertFile != "" && cfg.Server.TLSClientCAFile != "" {
+		e.Use(server.RequireClientCert("/livez", "/readyz"))
+	}
+	health.NewHTTP(checker, e)
+	if cfg.Server.AdminPort != "" {
+		admin, err := server.StartAdmin(cfg.Server.AdminPort, reg)
+		if err != nil {
+
+			return err
+		}
+		defer admin.Shutdown(context.Background())
+	} else {
+		e.GET("/metrics", echo.WrapHandler(server.MetricsHandler(reg)))
+	}
+
 	v1 := e.Group("/v1")
-	wt.NewHTTP(wl.New(wallet.Initialize(db), log), v1)
+	if cfg.Auth != nil && cfg.Auth.JWTSecret != "" {
+		v1.Use(server.JWT(cfg.Auth.JWTSecret))
+	}
+	wt.NewHTTP(walletService, v1)
+	if cfg.Features.SSE {
+		wt.NewSSE(hub, v1)
+	}
+	if cfg.Features.Webhooks && cfg.Database.Postgres() {
+		wht.NewHTTP(newWebhookService(cfg.Jobs, db, log), v1)
+	}
+
+	// the background workers run on the leader of the job runner, which the worker command runs when it is standalone,
+	// see StartWorker, and on every replica without the jobs section
+	if cfg.Jobs == nil || !cfg.Jobs.Standalone {
+		background, closeBackground, err := newBackgroundWorkers(cfg, db, log, checker)
+		if err != nil {
 
-	v1.GET("/health", func(c echo.Context) error {
+			return err
+		}
+		defer closeBackground()
+
+		if cfg.Jobs == nil {
+			for _, b := range background {
+				runWorker(b.run)
+			}
+		} else {
+			runWorker(newJobRunner(cfg.Jobs, db, log, background).Run)
+		}
+	}
+
+	serverCfg := &server.Config{
+		Port:                   cfg.Server.Port,
+		ReadTimeoutSeconds:     cfg.Server.ReadTimeout,
+		WriteTimeoutSeconds:    cfg.Server.WriteTimeout,
+		Debug:                  cfg.Server.Debug,
+		OnShutdown:             checker.Shutdown,
+		DrainSeconds:           cfg.Server.DrainSeconds,
+		OnDrained:              hub.Close,
+		ShutdownTimeoutSeconds: cfg.Server.ShutdownTimeoutSeconds,
+		HTTP2:                  cfg.Server.HTTP2,
+	}
+	if cfg.Server.TLSCertFile != "" {
+		if serverCfg.TLS, err = newCertReloader(cfg.Server, log); err != nil {
+
+			return err
+		}
+	}
 
-		return c.NoContent(http.StatusOK)
+	var gs *grpc.Server
+	if cfg.Server.GRPCPort != "" {
+		opts := []grpc.ServerOption{}
+		if serverCfg.TLS != nil {
+			opts = append(opts, grpc.Creds(server.GRPCCredentials(serverCfg.TLS)))
+		}
+		if serverCfg.TLS != nil && cfg.Server.TLSClientCAFile != "" {
+			opts = append(opts,
+				grpc.ChainUnaryInterceptor(server.RequireClientCertUnary()),
+				grpc.ChainStreamInterceptor(server.RequireClientCertStream()))
+		}
+		if cfg.Auth != nil && cfg.Auth.JWTSecret != "" {
+			opts = append(opts,
+				grpc.ChainUnaryInterceptor(server.JWTUnary(cfg.Auth.JWTSecret)),
+				grpc.ChainStreamInterceptor(server.JWTStream(cfg.Auth.JWTSecret)))
+		}
+		if replicas != nil {
+			opts = append(opts, grpc.ChainUnaryInterceptor(server.ReadYourWritesUnary(replicas, wg.WriteMethods...)))
+		}
+		gs = server.NewGRPC(opts...)
+		wg.NewGRPC(walletService, gs)
+		if err := server.StartGRPC(gs, cfg.Server.GRPCPort); err != nil {
+
+			return err
+		}
+	}
+
+	err = server.Start(ctx, e, serverCfg)
+	// gRPC is stopped once HTTP is drained, then the workers, before the deferred closes release what they use
+	if gs != nil {
+		server.StopGRPC(gs, serverCfg.ShutdownTimeout())
+	}
+	stopBackground()
+
+	return err
+}
+
+// newPostgres connects, migrates when configured and listens for wallet changes, registering their health checks
+func newPostgres(cfg *config.Database, checker *health.Checker) (*sqlx.DB, *pq.Listener, error) {
+	db, err := connectPostgres(cfg)
+	if err != nil {
+
+		return nil, nil, err
+	}
+
+	// readiness fails until the database is migrated to the latest embedded migration
+	schemaVersion, err := migration.Latest(migrations.FS)
+	if err != nil {
+
+		return nil, nil, err
+	}
+	if cfg.AutoMigrate {
+		if err := migration.New(db, migrations.FS).Up(context.Background()); err != nil {
+
+			return nil, nil, fmt.Errorf("auto migrate, %w", err)
+		}
+	}
+
+	listener, err := postgres.NewListener(cfg.DSN, repository.WalletEventsChannel)
+	if err != nil {
+
+		return nil, nil, err
+	}
+
+	checker.Register("postgres", postgres.PingCheck(db))
+	checker.Register("migrations", postgres.MigrationCheck(db, schemaVersion))
+	checker.Register("listener", postgres.ListenerCheck(listener))
+
+	return db, listener, nil
+}
+
+// connectPostgres connects to the primary with the pool settings of cfg
+func connectPostgres(cfg *config.Database) (*sqlx.DB, error) {
+
+	return postgres.NewWithConfig(&postgres.Config{
+		DSN:              cfg.DSN,
+		MaxOpenConns:     cfg.MaxOpenConns,
+		MaxIdleConns:     cfg.MaxIdleConns,
+		ConnMaxLifetime:  time.Duration(cfg.ConnMaxLifetimeSeconds) * time.Second,
+		ConnMaxIdleTime:  time.Duration(cfg.ConnMaxIdleTimeSeconds) * time.Second,
+		ConnectTimeout:   time.Duration(cfg.ConnectTimeoutSeconds) * time.Second,
+		StatementTimeout: time.Duration(cfg.StatementTimeoutSeconds) * time.Second,
 	})
-	server.Start(e, &server.Config{
-		Port:                cfg.Server.Port,
-		ReadTimeoutSeconds:  cfg.Server.ReadTimeout,
-		WriteTimeoutSeconds: cfg.Server.WriteTimeout,
-		Debug:               cfg.Server.Debug,
+}
+
+// replicaPollInterval is how often the replay position and lag of the replicas are read
+const replicaPollInterval = time.Second
+
+// newReplicas opens the replica pools with the settings of the primary, a replica down on start gets no reads
+// until it answers a poll
+func newReplicas(cfg *config.Database, primary *sqlx.DB, checker *health.Checker) (*postgres.Replicas, error) {
+	pools := []*sqlx.DB{}
+	for _, dsn := range cfg.ReplicaDSNs {
+		pool, err := postgres.Open(&postgres.Config{
+			DSN:              dsn,
+			MaxOpenConns:     cfg.MaxOpenConns,
+			MaxIdleConns:     cfg.MaxIdleConns,
+			ConnMaxLifetime:  time.Duration(cfg.ConnMaxLifetimeSeconds) * time.Second,
+			ConnMaxIdleTime:  time.Duration(cfg.ConnMaxIdleTimeSeconds) * time.Second,
+			StatementTimeout: time.Duration(cfg.StatementTimeoutSeconds) * time.Second,
+		})
+		if err != nil {
+			for _, pool := range pools {
+				pool.Close()
+			}
+
+			return nil, err
+		}
+		pools = append(pools, pool)
+	}
+
+	replicas := postgres.NewReplicas(primary, pools, time.Duration(cfg.MaxReplicaLagSeconds)*time.Second)
+	checker.Register("replicas", postgres.ReplicaCheck(replicas))
+
+	return replicas, nil
+}
+
+// newSQLite opens the database file and migrates it when configured, registering its health checks,
+// the ping and migration checks of postgres are plain database/sql
+func newSQLite(cfg *config.Database, checker *health.Checker) (*sqlx.DB, error) {
+	db, err := sqlite.New(&sqlite.Config{
+		DSN:             cfg.DSN,
+		MaxOpenConns:    cfg.MaxOpenConns,
+		MaxIdleConns:    cfg.MaxIdleConns,
+		ConnMaxLifetime: time.Duration(cfg.ConnMaxLifetimeSeconds) * time.Second,
+		ConnMaxIdleTime: time.Duration(cfg.ConnMaxIdleTimeSeconds) * time.Second,
+		BusyTimeout:     time.Duration(cfg.StatementTimeoutSeconds) * time.Second,
 	})
+	if err != nil {
+
+		return nil, err
+	}
+
+	schemaVersion, err := migration.Latest(sqlitemigrations.FS)
+	if err != nil {
+
+		return nil, err
+	}
+	if cfg.AutoMigrate {
+		if err := migration.NewSQLite(db, sqlitemigrations.FS).Up(context.Background()); err != nil {
+
+			return nil, fmt.Errorf("auto migrate, %w", err)
+		}
+	}
+
+	checker.Register("sqlite", postgres.PingCheck(db))
+	checker.Register("migrations", postgres.MigrationCheck(db, schemaVersion))
+
+	return db, nil
+}
+
+// newArchiver creates the archiver, which always creates the monthly partitions of the wallet transactions ahead of time
+// and archives the closed months when cfg is set
+func newArchiver(cfg *config.Archive, db *sqlx.DB, log domain.Logger) *archive.Archiver {
+	archiver := archive.New(db, &ar.Archive{}, log)
+	if cfg != nil {
+		archiver.Dir = cfg.Dir
+		archiver.AfterMonths = cfg.AfterMonths
+		if cfg.IntervalSeconds > 0 {
+			archiver.Interval = time.Duration(cfg.IntervalSeconds) * time.Second
+		}
+	}
+
+	return archiver
+}
+
+// backgroundWorker is a worker of the primary database, once runs it a single time, as a singleton of the job runner,
+// run runs it every interval until ctx is done
+type backgroundWorker struct {
+	name     string
+	interval time.Duration
+	once     func(ctx context.Context) error
+	run      func(ctx context.Context)
+}
+
+// newBackgroundWorkers creates the archiver, the webhook dispatcher and the outbox relay of cfg, the returned close
+// releases the publisher of the relay, checker gets the health check of the publisher unless nil
+func newBackgroundWorkers(cfg *config.Configuration, db *sqlx.DB, log domain.Logger, checker *health.Checker) ([]*backgroundWorker, func(), error) {
+	if !cfg.Database.Postgres() {
+
+		return nil, func() {}, nil
+	}
+
+	// the monthly partitions are always created ahead of time, the closed months are archived when configured
+	archiver := newArchiver(cfg.Archive, db, log)
+	background := []*backgroundWorker{{
+		name:     "archive",
+		interval: archiver.Interval,
+		once:     archiver.RunNow,
+		run:      archiver.Run,
+	}}
+	if cfg.Features.Webhooks {
+		dispatcher := webhook.NewDispatcher(db, &whr.Webhook{}, log)
+		background = append(background, &backgroundWorker{
+			name:     "webhook.dispatch",
+			interval: dispatcher.PollInterval,
+			once:     drain(dispatcher.Drain),
+			run:      dispatcher.Run,
+		})
+	}
+	if cfg.Outbox == nil {
+
+		return background, func() {}, nil
+	}
+
+	pub, closePub, err := newPublisher(cfg.Outbox, checker)
+	if err != nil {
+
+		return nil, nil, err
+	}
+	relay := outbox.NewRelay(db, &or.Outbox{}, pub, log)
+	background = append(background, &backgroundWorker{
+		name:     "outbox.relay",
+		interval: relay.PollInterval,
+		once:     drain(relay.Drain),
+		run:      relay.Run,
+	})
+
+	return background, closePub, nil
+}
+
+// drain drops the count of fn
+func drain(fn func(ctx context.Context) (int, error)) func(ctx context.Context) error {
+
+	return func(ctx context.Context) error {
+		_, err := fn(ctx)
+
+		return err
+	}
+}
+
+// defaultJobRetention is how long the finished jobs are kept when not configured
+const defaultJobRetention = 7 * 24 * time.Hour
+
+// newWebhookService creates the webhook service, it queues the redelivery of the dead deliveries of an endpoint
+// when cfg is set, the job runner of any replica or worker handles it
+func newWebhookService(cfg *config.Jobs, db *sqlx.DB, log domain.Logger) domain.WebhookService {
+	if cfg == nil {
+
+		return webhook.Initialize(db)
+	}
+
+	return webhook.NewWithQueue(db, &whr.Webhook{}, newJobRunner(cfg, db, log, nil))
+}
+
+// newJobRunner creates the job runner with the handlers and singletons of the service,
+// the leader runs the background workers and prunes the finished jobs
+func newJobRunner(cfg *config.Jobs, db *sqlx.DB, log domain.Logger, background []*backgroundWorker) *job.Runner {
+	jobRepo := &jr.Job{}
+	runner := job.NewRunner(db, jobRepo, log)
+	if cfg.Workers > 0 {
+		runner.Workers = cfg.Workers
+	}
+	if cfg.PollIntervalSeconds > 0 {
+		runner.PollInterval = time.Duration(cfg.PollIntervalSeconds) * time.Second
+	}
+	if cfg.LeaseSeconds > 0 {
+		runner.Lease = time.Duration(cfg.LeaseSeconds) * time.Second
+	}
+	if cfg.MaxAttempts > 0 {
+		runner.MaxAttempts = cfg.MaxAttempts
+	}
+	retention := defaultJobRetention
+	if cfg.RetentionHours > 0 {
+		retention = time.Duration(cfg.RetentionHours) * time.Hour
+	}
+
+	runner.Handle(webhook.RedeliverDeadJob, webhook.RedeliverDeadHandler(db, &whr.Webhook{}))
+	for _, b := range background {
+		runner.Singleton(b.name, b.interval, b.once)
+	}
+	runner.Singleton("job.prune", time.Hour, func(ctx context.Context) error {
+		_, err := jobRepo.Prune(ctx, db, time.Now().Add(-retention))
+
+		return err
+	})
+
+	return runner
+}
+
+// newCertReloader loads the TLS files of the servers, a renewed certificate which fails to load is logged
+// and the previous one is served until it loads
+func newCertReloader(cfg *config.Server, log domain.Logger) (*server.CertReloader, error) {
+
+	return server.NewCertReloader(&server.TLS{
+		CertFile:     cfg.TLSCertFile,
+		KeyFile:      cfg.TLSKeyFile,
+		ClientCAFile: cfg.TLSClientCAFile,
+		OnReloadError: func(err error) {
+			log.Log(context.Background(), "server", "Reload TLS", err, nil)
+		},
+	})
+}
+
+// newCache wraps svc with the Redis cache and registers its health check, which never fails since the cache
+// falls back to svc while Redis is down
+func newCache(cfg *config.Cache, svc domain.WalletService, checker *health.Checker) (*wc.CacheService, func()) {
+	client := redis.New(&redis.Config{
+		Addr:     cfg.RedisAddr,
+		Password: cfg.RedisPassword,
+		DB:       cfg.RedisDB,
+	})
+	checker.Register("redis", redis.PingCheck(client))
+
+	return wc.New(svc, client, time.Duration(cfg.TTLSeconds)*time.Second), func() { client.Close() }
+}
+
+func newLogger(cfg *config.Logging) (*zlog.Log, error) {
+	if cfg == nil {
+
+		return zlog.New(), nil
+	}
+
+	logCfg := &zlog.Config{
+		Level:  cfg.Level,
+		Format: cfg.Format,
+		Redact: cfg.Redact,
+	}
+	if cfg.File != nil {
+		logCfg.File = &zlog.FileConfig{
+			Path:       cfg.File.Path,
+			MaxSizeMB:  cfg.File.MaxSizeMB,
+			MaxBackups: cfg.File.MaxBackups,
+			MaxAgeDays: cfg.File.MaxAgeDays,
+			Compress:   cfg.File.Compress,
+		}
+	}
+	if cfg.Sampling != nil {
+		logCfg.Sampling = &zlog.SamplingConfig{
+			Burst:      cfg.Sampling.Burst,
+			Period:     time.Duration(cfg.Sampling.PeriodSeconds) * time.Second,
+			Thereafter: cfg.Sampling.Thereafter,
+		}
+	}
+
+	return zlog.NewWithConfig(logCfg)
+}
+
+func newPublisher(cfg *config.Outbox, checker *health.Checker) (domain.Publisher, func(), error) {
+	switch cfg.Publisher {
+	case "stdout":
+
+		return publisher.NewStdout(), func() {}, nil
+	case "nats":
+		pub, err := publisher.NewNATS(cfg.NATSURL, cfg.SubjectPrefix)
+		if err != nil {
+
+			return nil, nil, err
+		}
+		if checker != nil {
+			checker.Register("nats", func(ctx context.Context) (map[string]interface{}, error) {
+
+				return nil, pub.Ping(ctx)
+			})
+		}
+
+		return pub, pub.Close, nil
+	}
 
-	return nil
+	return nil, nil, fmt.Errorf("unknown outbox publisher %q", cfg.Publisher)
 }
@@ -0,0 +1,97 @@
+package service_test
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
+
+	"github.com/sappy5678/cryptocom/pkg/service"
+	"github.com/sappy5678/cryptocom/pkg/utl/config"
+)
+
+// freePort returns a port nothing listens on
+func freePort(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer listener.Close()
+
+	return listener.Addr().String()
+}
+
+func TestStart(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	addr := freePort(t)
+	cfg := &config.Configuration{
+		Server:   &config.Server{Port: addr, ShutdownTimeoutSeconds: 5},
+		Database: &config.Database{Driver: config.DriverMemory},
+		Features: &config.Features{SSE: true},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- service.Start(ctx, cfg)
+	}()
+
+	ready := false
+	for i := 0; i < 50 && !ready; i++ {
+		resp, err := http.Get("http://" + addr + "/readyz")
+		if err == nil {
+			resp.Body.Close()
+			ready = resp.StatusCode == http.StatusOK
+		}
+		if !ready {
+			time.Sleep(100 * time.Millisecond)
+		}
+	}
+	assert.True(t, ready)
+
+	// an open event stream does not hold the shutdown
+	req, err := http.NewRequest(http.MethodPut, "http://"+addr+"/v1/user/test-user-1/wallet/create", nil)
+	assert.NoError(t, err)
+	created, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	created.Body.Close()
+	stream, err := http.Get("http://" + addr + "/v1/user/test-user-1/wallet/events")
+	assert.NoError(t, err)
+	defer stream.Body.Close()
+	assert.Equal(t, http.StatusOK, stream.StatusCode)
+
+	// Start returns once the server is shut down
+	start := time.Now()
+	cancel()
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(15 * time.Second):
+		t.Fatal("timeout waiting for shutdown")
+	}
+	assert.Less(t, time.Since(start), 5*time.Second)
+	_, err = io.ReadAll(stream.Body)
+	assert.NoError(t, err)
+	_, err = http.Get("http://" + addr + "/readyz")
+	assert.Error(t, err)
+}
+
+func TestStartError(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer listener.Close()
+
+	// the port is taken, so Start fails instead of serving
+	err = service.Start(context.Background(), &config.Configuration{
+		Server:   &config.Server{Port: listener.Addr().String()},
+		Database: &config.Database{Driver: config.DriverMemory},
+		Features: &config.Features{},
+	})
+	assert.Error(t, err)
+}
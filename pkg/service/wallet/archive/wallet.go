@@ -0,0 +1,86 @@
+package wallet
+
+import (
+	"context"
+	"time"
+
+	"github.com/sappy5678/cryptocom/pkg/domain"
+)
+
+// defaultLimit is the page size of GetTransactions when the limit is not set, like the wallet repository
+const defaultLimit = 100
+
+// Archive reads the archived transactions, see archive.Archiver
+type Archive interface {
+	// Archived reports whether user has archived transactions created at or before createdBefore
+	Archived(ctx context.Context, user domain.User, createdBefore time.Time) (bool, error)
+	// GetTransactions returns the archived transactions of user like the wallet repository
+	GetTransactions(ctx context.Context, user domain.User, createdBefore time.Time, IDBefore int, limit int) ([]*domain.Transaction, error)
+}
+
+// New creates new wallet archive service, it continues the pages of GetTransactions in the archive
+func New(svc domain.WalletService, archive Archive) *ArchiveService {
+
+	return &ArchiveService{
+		WalletService: svc,
+		archive:       archive,
+	}
+}
+
+// ArchiveService represents wallet archive service
+type ArchiveService struct {
+	domain.WalletService
+	archive Archive
+}
+
+// GetTransactions fills a page the live transactions leave short with archived ones when ctx has
+// domain.WithArchivedTransactions, otherwise the short page is returned and domain.SetMoreArchived tells the caller
+// when the user has archived ones, so a history is never silently cut at the archived months,
+// a page whose cursor is past every live transaction fails with domain.ErrTransactionsArchived
+func (as *ArchiveService) GetTransactions(ctx context.Context, user domain.User, createdAt time.Time, lastReturnedID int, limit int) ([]*domain.Transaction, error) {
+	paging := !createdAt.IsZero() || lastReturnedID != 0
+	transactions, err := as.WalletService.GetTransactions(ctx, user, createdAt, lastReturnedID, limit)
+	if err != nil {
+
+		return nil, err
+	}
+	if limit <= 0 {
+		limit = defaultLimit
+	}
+	if len(transactions) >= limit {
+
+		return transactions, nil
+	}
+
+	// the archive continues after the last live transaction
+	if len(transactions) > 0 {
+		last := transactions[len(transactions)-1]
+		createdAt, lastReturnedID = last.CreatedAt, last.ID
+	}
+	if createdAt.IsZero() {
+		createdAt = time.Now()
+	}
+
+	if !domain.ArchivedTransactions(ctx) {
+		if archived, err := as.archive.Archived(ctx, user, createdAt); err != nil {
+
+			return nil, err
+		} else if archived {
+			if paging && len(transactions) == 0 {
+
+				return nil, domain.ErrTransactionsArchived
+			}
+			domain.SetMoreArchived(ctx)
+		}
+
+		return transactions, nil
+	}
+
+	archived, err := as.archive.GetTransactions(ctx, user, createdAt, lastReturnedID, limit-len(transactions))
+	if err != nil {
+
+		return nil, err
+	}
+
+	return append(transactions, archived...), nil
+}
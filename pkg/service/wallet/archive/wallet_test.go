@@ -0,0 +1,210 @@
+package wallet_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
+
+	"github.com/sappy5678/cryptocom/pkg/domain"
+	"github.com/sappy5678/cryptocom/pkg/service/wallet"
+	wa "github.com/sappy5678/cryptocom/pkg/service/wallet/archive"
+)
+
+// archive holds the transactions with ID up to 3, newest first, and records the cursor it was read with
+type archive struct {
+	err           error
+	createdBefore time.Time
+	IDBefore      int
+	limit         int
+}
+
+var archived = []*domain.Transaction{
+	{ID: 3, CreatedAt: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)},
+	{ID: 2, CreatedAt: time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+	{ID: 1, CreatedAt: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)},
+}
+
+func (a *archive) Archived(ctx context.Context, user domain.User, createdBefore time.Time) (bool, error) {
+	a.createdBefore = createdBefore
+
+	return user.ID == "alice", a.err
+}
+
+func (a *archive) GetTransactions(ctx context.Context, user domain.User, createdBefore time.Time, IDBefore int, limit int) ([]*domain.Transaction, error) {
+	a.createdBefore, a.IDBefore, a.limit = createdBefore, IDBefore, limit
+	if a.err != nil {
+
+		return nil, a.err
+	}
+	transactions := []*domain.Transaction{}
+	for _, transaction := range archived {
+		if user.ID == "alice" && transaction.ID < IDBefore && len(transactions) < limit {
+			transactions = append(transactions, transaction)
+		}
+	}
+
+	return transactions, nil
+}
+
+func TestGetTransactions(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	live := []*domain.Transaction{
+		{ID: 5, CreatedAt: time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)},
+		{ID: 4, CreatedAt: time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	svc := &wallet.MockWalletService{
+		GetTransactionsFunc: func(ctx context.Context, user domain.User, createdAt time.Time, lastReturnedID int, limit int) ([]*domain.Transaction, error) {
+			if user.ID == "nobody" {
+
+				return nil, domain.ErrWalletNotFound
+			}
+			transactions := []*domain.Transaction{}
+			for _, transaction := range live {
+				if (lastReturnedID == 0 || transaction.ID < lastReturnedID) && (limit <= 0 || len(transactions) < limit) {
+					transactions = append(transactions, transaction)
+				}
+			}
+
+			return transactions, nil
+		},
+	}
+	mockError := errors.New("error")
+
+	tests := []struct {
+		name              string
+		user              domain.User
+		withArchived      bool
+		lastReturnedID    int
+		limit             int
+		archiveErr        error
+		wantIDs           []int
+		wantMore          bool
+		wantErr           error
+		wantArchiveCursor int
+		wantArchiveLimit  int
+	}{
+		{
+			name:    "full live page",
+			user:    domain.User{ID: "alice"},
+			limit:   2,
+			wantIDs: []int{5, 4},
+		},
+		{
+			name:     "short live page",
+			user:     domain.User{ID: "alice"},
+			limit:    3,
+			wantIDs:  []int{5, 4},
+			wantMore: true,
+		},
+		{
+			name:    "short live page without archived transactions",
+			user:    domain.User{ID: "bob"},
+			limit:   3,
+			wantIDs: []int{5, 4},
+		},
+		{
+			name:           "no live transactions left",
+			user:           domain.User{ID: "alice"},
+			lastReturnedID: 4,
+			limit:          3,
+			wantErr:        domain.ErrTransactionsArchived,
+		},
+		{
+			name:           "nothing archived",
+			user:           domain.User{ID: "bob"},
+			lastReturnedID: 4,
+			limit:          3,
+			wantIDs:        []int{},
+		},
+		{
+			name:              "filled from the archive",
+			user:              domain.User{ID: "alice"},
+			withArchived:      true,
+			limit:             3,
+			wantIDs:           []int{5, 4, 3},
+			wantArchiveCursor: 4,
+			wantArchiveLimit:  1,
+		},
+		{
+			name:              "default limit",
+			user:              domain.User{ID: "alice"},
+			withArchived:      true,
+			wantIDs:           []int{5, 4, 3, 2, 1},
+			wantArchiveCursor: 4,
+			wantArchiveLimit:  98,
+		},
+		{
+			name:              "archive only",
+			user:              domain.User{ID: "alice"},
+			withArchived:      true,
+			lastReturnedID:    4,
+			limit:             2,
+			wantIDs:           []int{3, 2},
+			wantArchiveCursor: 4,
+			wantArchiveLimit:  2,
+		},
+		{
+			name:         "archive offline",
+			user:         domain.User{ID: "alice"},
+			withArchived: true,
+			limit:        3,
+			archiveErr:   domain.ErrArchiveOffline,
+			wantErr:      domain.ErrArchiveOffline,
+		},
+		{
+			name:           "archive error",
+			user:           domain.User{ID: "alice"},
+			lastReturnedID: 4,
+			archiveErr:     mockError,
+			wantErr:        mockError,
+		},
+		{
+			name:         "wallet error",
+			user:         domain.User{ID: "nobody"},
+			withArchived: true,
+			wantErr:      domain.ErrWalletNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &archive{err: tt.archiveErr}
+			ctx := context.Background()
+			if tt.withArchived {
+				ctx = domain.WithArchivedTransactions(ctx)
+			}
+			more := false
+			ctx = domain.WithMoreArchived(ctx, &more)
+
+			transactions, err := wa.New(svc, a).GetTransactions(ctx, tt.user, time.Time{}, tt.lastReturnedID, tt.limit)
+			assert.ErrorIs(t, err, tt.wantErr)
+			assert.Equal(t, tt.wantMore, more)
+			if tt.wantErr == nil {
+				got := []int{}
+				for _, transaction := range transactions {
+					got = append(got, transaction.ID)
+				}
+				assert.Equal(t, tt.wantIDs, got)
+			}
+			if tt.wantArchiveLimit > 0 {
+				assert.Equal(t, tt.wantArchiveCursor, a.IDBefore)
+				assert.Equal(t, tt.wantArchiveLimit, a.limit)
+				assert.False(t, a.createdBefore.IsZero())
+			}
+		})
+	}
+
+	// the archive continues at the last live transaction, a request without a cursor starts now
+	a := &archive{}
+	_, err := wa.New(svc, a).GetTransactions(context.Background(), domain.User{ID: "alice"}, time.Time{}, 0, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, live[1].CreatedAt, a.createdBefore)
+	_, err = wa.New(svc, a).GetTransactions(context.Background(), domain.User{ID: "bob"}, time.Time{}, 4, 10)
+	assert.NoError(t, err)
+	assert.WithinDuration(t, time.Now(), a.createdBefore, time.Minute)
+}
@@ -0,0 +1,226 @@
+package wallet
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/sappy5678/cryptocom/pkg/domain"
+)
+
+// defaultTTL is the TTL of New when it is not set
+const defaultTTL = 30 * time.Second
+
+// New creates new wallet caching service, it caches Get and the first page of GetTransactions in Redis for ttl,
+// 30 seconds when 0, and drops the entries of the users of every mutation
+// a miss reads svc with domain.WithPrimaryRead, an entry read from a lagging replica would outlive the invalidation
+// of the write it missed
+// every Redis error falls back to svc, so a Redis outage only costs the database reads it was saving
+func New(svc domain.WalletService, client redis.UniversalClient, ttl time.Duration) *CacheService {
+	if ttl <= 0 {
+		ttl = defaultTTL
+	}
+
+	return &CacheService{
+		WalletService: svc,
+		client:        client,
+		ttl:           ttl,
+	}
+}
+
+// CacheService represents wallet caching service
+type CacheService struct {
+	domain.WalletService
+	client redis.UniversalClient
+	ttl    time.Duration
+
+	// Bypass reads svc without the cache when it returns true, like for reads which must see the writes of a
+	// consistency token
+	Bypass func(ctx context.Context) bool
+}
+
+// the keys of a user share the {userID} hash tag, so they live on one Redis Cluster node and a script may use them together
+const keyPrefix = "cryptocom:"
+
+func walletKey(userID string) string {
+
+	return keyPrefix + "wallet:{" + userID + "}"
+}
+
+// transactionsKey is a hash of the first pages by limit
+func transactionsKey(userID string) string {
+
+	return keyPrefix + "transactions:{" + userID + "}"
+}
+
+// generationKey counts the mutations of a user, an entry read from svc is stored only when no mutation
+// happened since the read started, so a read racing a write cannot put back the entries the write dropped
+func generationKey(userID string) string {
+
+	return keyPrefix + "generation:{" + userID + "}"
+}
+
+// storeScript stores ARGV[3] in KEYS[2], or its ARGV[2] field when set, for ARGV[4] milliseconds
+// when the generation KEYS[1] is still ARGV[1]
+var storeScript = redis.NewScript(`
+if (redis.call('GET', KEYS[1]) or '') ~= ARGV[1] then
+	return 0
+end
+if ARGV[2] == '' then
+	redis.call('SET', KEYS[2], ARGV[3], 'PX', ARGV[4])
+else
+	redis.call('HSET', KEYS[2], ARGV[2], ARGV[3])
+	redis.call('PEXPIRE', KEYS[2], ARGV[4])
+end
+return 1
+`)
+
+// cachedWallet is the cache entry of a wallet, domain.Wallet leaves its ID out of JSON
+type cachedWallet struct {
+	ID       int                   `json:"id"`
+	UserID   string                `json:"userID"`
+	Balance  int                   `json:"balance"`
+	Metadata domain.WalletMetadata `json:"metadata"`
+}
+
+func (cs *CacheService) Create(ctx context.Context, user domain.User, metadata domain.WalletMetadata) (*domain.Wallet, error) {
+	defer cs.invalidate(ctx, user.ID)
+
+	return cs.WalletService.Create(ctx, user, metadata)
+}
+
+// Get returns the cached wallet, or reads and caches it
+func (cs *CacheService) Get(ctx context.Context, user domain.User) (*domain.Wallet, error) {
+	if cs.bypass(ctx) {
+
+		return cs.WalletService.Get(ctx, user)
+	}
+
+	values, err := cs.client.MGet(ctx, walletKey(user.ID), generationKey(user.ID)).Result()
+	if err != nil {
+
+		return cs.WalletService.Get(ctx, user)
+	}
+	if data, ok := values[0].(string); ok {
+		entry := cachedWallet{}
+		if err := json.Unmarshal([]byte(data), &entry); err == nil {
+
+			return &domain.Wallet{ID: entry.ID, UserID: entry.UserID, Balance: entry.Balance, WalletMetadata: entry.Metadata}, nil
+		}
+	}
+	generation, _ := values[1].(string)
+
+	wallet, err := cs.WalletService.Get(domain.WithPrimaryRead(ctx), user)
+	if err != nil {
+
+		return nil, err
+	}
+	cs.store(ctx, user.ID, generation, walletKey(user.ID), "", cachedWallet{
+		ID:       wallet.ID,
+		UserID:   wallet.UserID,
+		Balance:  wallet.Balance,
+		Metadata: wallet.WalletMetadata,
+	})
+
+	return wallet, nil
+}
+
+// GetTransactions returns the cached first page, or reads and caches it, other pages, pages reading
+// archived transactions and pages stopping before them are read from svc
+func (cs *CacheService) GetTransactions(ctx context.Context, user domain.User, createdAt time.Time, lastReturnedID int, limit int) ([]*domain.Transaction, error) {
+	if !createdAt.IsZero() || lastReturnedID != 0 || domain.ArchivedTransactions(ctx) || cs.bypass(ctx) {
+
+		return cs.WalletService.GetTransactions(ctx, user, createdAt, lastReturnedID, limit)
+	}
+
+	field := strconv.Itoa(limit)
+	pipe := cs.client.Pipeline()
+	page := pipe.HGet(ctx, transactionsKey(user.ID), field)
+	generationCmd := pipe.Get(ctx, generationKey(user.ID))
+	_, _ = pipe.Exec(ctx)
+	data, err := page.Result()
+	if err != nil && !errors.Is(err, redis.Nil) {
+
+		return cs.WalletService.GetTransactions(ctx, user, createdAt, lastReturnedID, limit)
+	}
+	if err == nil {
+		transactions := []*domain.Transaction{}
+		if err := json.Unmarshal([]byte(data), &transactions); err == nil {
+
+			return transactions, nil
+		}
+	}
+	generation, err := generationCmd.Result()
+	if err != nil && !errors.Is(err, redis.Nil) {
+
+		return cs.WalletService.GetTransactions(ctx, user, createdAt, lastReturnedID, limit)
+	}
+
+	more := false
+	transactions, err := cs.WalletService.GetTransactions(domain.WithMoreArchived(domain.WithPrimaryRead(ctx), &more),
+		user, createdAt, lastReturnedID, limit)
+	if err != nil {
+
+		return nil, err
+	}
+	// a hit could not tell the caller the page stops before archived transactions
+	if more {
+		domain.SetMoreArchived(ctx)
+
+		return transactions, nil
+	}
+	cs.store(ctx, user.ID, generation, transactionsKey(user.ID), field, transactions)
+
+	return transactions, nil
+}
+
+func (cs *CacheService) Withdraw(ctx context.Context, user domain.User, transactionID domain.TransactionID, amount int) (*domain.Wallet, error) {
+	defer cs.invalidate(ctx, user.ID)
+
+	return cs.WalletService.Withdraw(ctx, user, transactionID, amount)
+}
+
+func (cs *CacheService) Deposit(ctx context.Context, user domain.User, transactionID domain.TransactionID, amount int) (*domain.Wallet, error) {
+	defer cs.invalidate(ctx, user.ID)
+
+	return cs.WalletService.Deposit(ctx, user, transactionID, amount)
+}
+
+func (cs *CacheService) Transfer(ctx context.Context, user domain.User, transactionID domain.TransactionID, amount int, passiveUser domain.User) (*domain.Wallet, error) {
+	defer cs.invalidate(ctx, user.ID, passiveUser.ID)
+
+	return cs.WalletService.Transfer(ctx, user, transactionID, amount, passiveUser)
+}
+
+func (cs *CacheService) bypass(ctx context.Context) bool {
+
+	return cs.Bypass != nil && cs.Bypass(ctx)
+}
+
+// store caches value unless the user changed since generation was read, failures are left to the ttl
+func (cs *CacheService) store(ctx context.Context, userID string, generation string, key string, field string, value interface{}) {
+	data, err := json.Marshal(value)
+	if err != nil {
+
+		return
+	}
+	_ = storeScript.Run(ctx, cs.client, []string{generationKey(userID), key}, generation, field, data, cs.ttl.Milliseconds()).Err()
+}
+
+// invalidate drops the entries of the users after a mutation, failed ones too since a write may commit
+// before it fails, it runs even when ctx is canceled after the commit, a Redis error leaves the entries to the ttl
+func (cs *CacheService) invalidate(ctx context.Context, userIDs ...string) {
+	ctx = context.WithoutCancel(ctx)
+	pipe := cs.client.Pipeline()
+	for _, userID := range userIDs {
+		pipe.Incr(ctx, generationKey(userID))
+		// the generation only has to outlive the reads in flight
+		pipe.PExpire(ctx, generationKey(userID), cs.ttl)
+		pipe.Del(ctx, walletKey(userID), transactionsKey(userID))
+	}
+	_, _ = pipe.Exec(ctx)
+}
@@ -0,0 +1,351 @@
+package wallet_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
+
+	"github.com/sappy5678/cryptocom/pkg/domain"
+	"github.com/sappy5678/cryptocom/pkg/service/wallet"
+	wc "github.com/sappy5678/cryptocom/pkg/service/wallet/cache"
+	"github.com/sappy5678/cryptocom/pkg/utl/redis"
+)
+
+// store is a wallet service keeping balances in a map, it counts the reads the cache did not save
+type store struct {
+	mu           sync.Mutex
+	balances     map[string]int
+	reads        int
+	transactions map[string][]*domain.Transaction
+}
+
+func newStore() (*store, *wallet.MockWalletService) {
+	s := &store{balances: map[string]int{}, transactions: map[string][]*domain.Transaction{}}
+	write := func(userID string, amount int) *domain.Wallet {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.balances[userID] += amount
+		s.transactions[userID] = append(s.transactions[userID], &domain.Transaction{
+			ID:        len(s.transactions[userID]) + 1,
+			UserID:    userID,
+			Amount:    amount,
+			CreatedAt: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		})
+
+		return &domain.Wallet{ID: 1, UserID: userID, Balance: s.balances[userID]}
+	}
+	svc := &wallet.MockWalletService{
+		CreateFunc: func(ctx context.Context, user domain.User, metadata domain.WalletMetadata) (*domain.Wallet, error) {
+
+			return write(user.ID, 0), nil
+		},
+		GetFunc: func(ctx context.Context, user domain.User) (*domain.Wallet, error) {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			s.reads++
+			balance, ok := s.balances[user.ID]
+			if !ok {
+
+				return nil, domain.ErrWalletNotFound
+			}
+
+			return &domain.Wallet{ID: 1, UserID: user.ID, Balance: balance, WalletMetadata: domain.WalletMetadata{Tags: []string{"vip"}}}, nil
+		},
+		GetTransactionsFunc: func(ctx context.Context, user domain.User, createdAt time.Time, lastReturnedID int, limit int) ([]*domain.Transaction, error) {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			s.reads++
+
+			return append([]*domain.Transaction{}, s.transactions[user.ID]...), nil
+		},
+		DepositFunc: func(ctx context.Context, user domain.User, transactionID domain.TransactionID, amount int) (*domain.Wallet, error) {
+
+			return write(user.ID, amount), nil
+		},
+		WithdrawFunc: func(ctx context.Context, user domain.User, transactionID domain.TransactionID, amount int) (*domain.Wallet, error) {
+
+			return nil, domain.ErrNotEnoughBalance
+		},
+		TransferFunc: func(ctx context.Context, user domain.User, transactionID domain.TransactionID, amount int, passiveUser domain.User) (*domain.Wallet, error) {
+			write(passiveUser.ID, amount)
+
+			return write(user.ID, -amount), nil
+		},
+	}
+
+	return s, svc
+}
+
+func (s *store) readCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.reads
+}
+
+func TestCacheService(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	alice := domain.User{ID: "alice"}
+	bob := domain.User{ID: "bob"}
+	tests := []struct {
+		name      string
+		call      func(t *testing.T, ctx context.Context, svc *wc.CacheService, mr *miniredis.Miniredis)
+		wantReads int
+	}{
+		{
+			name: "get is cached",
+			call: func(t *testing.T, ctx context.Context, svc *wc.CacheService, mr *miniredis.Miniredis) {
+				want := &domain.Wallet{ID: 1, UserID: "alice", Balance: 10, WalletMetadata: domain.WalletMetadata{Tags: []string{"vip"}}}
+				for i := 0; i < 3; i++ {
+					w, err := svc.Get(ctx, alice)
+					assert.NoError(t, err)
+					assert.Equal(t, want, w)
+				}
+			},
+			wantReads: 1,
+		},
+		{
+			name: "errors are not cached",
+			call: func(t *testing.T, ctx context.Context, svc *wc.CacheService, mr *miniredis.Miniredis) {
+				for i := 0; i < 2; i++ {
+					_, err := svc.Get(ctx, domain.User{ID: "nobody"})
+					assert.ErrorIs(t, err, domain.ErrWalletNotFound)
+				}
+			},
+			wantReads: 2,
+		},
+		{
+			name: "mutations invalidate",
+			call: func(t *testing.T, ctx context.Context, svc *wc.CacheService, mr *miniredis.Miniredis) {
+				_, _ = svc.Get(ctx, alice)
+				_, err := svc.Deposit(ctx, alice, "deposit", 5)
+				assert.NoError(t, err)
+				w, _ := svc.Get(ctx, alice)
+				assert.Equal(t, 15, w.Balance)
+
+				// failed writes too, they may have committed
+				_, err = svc.Withdraw(ctx, alice, "withdraw", 100)
+				assert.ErrorIs(t, err, domain.ErrNotEnoughBalance)
+				_, _ = svc.Get(ctx, alice)
+
+				_, _ = svc.Create(ctx, alice, domain.WalletMetadata{})
+				_, _ = svc.Get(ctx, alice)
+				_, _ = svc.Get(ctx, alice)
+			},
+			wantReads: 4,
+		},
+		{
+			name: "transfer invalidates both users",
+			call: func(t *testing.T, ctx context.Context, svc *wc.CacheService, mr *miniredis.Miniredis) {
+				_, _ = svc.Get(ctx, alice)
+				_, _ = svc.Get(ctx, bob)
+				_, err := svc.Transfer(ctx, alice, "transfer", 3, bob)
+				assert.NoError(t, err)
+				a, _ := svc.Get(ctx, alice)
+				b, _ := svc.Get(ctx, bob)
+				assert.Equal(t, 7, a.Balance)
+				assert.Equal(t, 23, b.Balance)
+			},
+			wantReads: 4,
+		},
+		{
+			name: "first pages are cached by limit",
+			call: func(t *testing.T, ctx context.Context, svc *wc.CacheService, mr *miniredis.Miniredis) {
+				for i := 0; i < 2; i++ {
+					transactions, err := svc.GetTransactions(ctx, alice, time.Time{}, 0, 10)
+					assert.NoError(t, err)
+					assert.Equal(t, []*domain.Transaction{{ID: 1, UserID: "alice", Amount: 10, CreatedAt: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}}, transactions)
+				}
+				_, _ = svc.GetTransactions(ctx, alice, time.Time{}, 0, 20)
+				_, _ = svc.GetTransactions(ctx, alice, time.Time{}, 0, 20)
+				// later pages are not cached
+				_, _ = svc.GetTransactions(ctx, alice, time.Now(), 1, 10)
+				_, _ = svc.GetTransactions(ctx, alice, time.Now(), 1, 10)
+
+				_, _ = svc.Deposit(ctx, alice, "deposit", 5)
+				transactions, _ := svc.GetTransactions(ctx, alice, time.Time{}, 0, 10)
+				assert.Len(t, transactions, 2)
+				_, _ = svc.GetTransactions(ctx, alice, time.Time{}, 0, 20)
+			},
+			wantReads: 6,
+		},
+		{
+			name: "reads of archived transactions are not cached",
+			call: func(t *testing.T, ctx context.Context, svc *wc.CacheService, mr *miniredis.Miniredis) {
+				ctx = domain.WithArchivedTransactions(ctx)
+				_, _ = svc.GetTransactions(ctx, alice, time.Time{}, 0, 10)
+				_, _ = svc.GetTransactions(ctx, alice, time.Time{}, 0, 10)
+			},
+			wantReads: 2,
+		},
+		{
+			name: "pages stopping before archived transactions are not cached",
+			call: func(t *testing.T, ctx context.Context, svc *wc.CacheService, mr *miniredis.Miniredis) {
+				inner := svc.WalletService.(*wallet.MockWalletService)
+				getTransactions := inner.GetTransactionsFunc
+				inner.GetTransactionsFunc = func(ctx context.Context, user domain.User, createdAt time.Time, lastReturnedID int, limit int) ([]*domain.Transaction, error) {
+					domain.SetMoreArchived(ctx)
+
+					return getTransactions(ctx, user, createdAt, lastReturnedID, limit)
+				}
+				for i := 0; i < 2; i++ {
+					more := false
+					_, err := svc.GetTransactions(domain.WithMoreArchived(ctx, &more), alice, time.Time{}, 0, 10)
+					assert.NoError(t, err)
+					assert.True(t, more)
+				}
+			},
+			wantReads: 2,
+		},
+		{
+			name: "entries expire",
+			call: func(t *testing.T, ctx context.Context, svc *wc.CacheService, mr *miniredis.Miniredis) {
+				_, _ = svc.Get(ctx, alice)
+				_, _ = svc.GetTransactions(ctx, alice, time.Time{}, 0, 10)
+				mr.FastForward(time.Minute)
+				_, _ = svc.Get(ctx, alice)
+				_, _ = svc.GetTransactions(ctx, alice, time.Time{}, 0, 10)
+			},
+			wantReads: 4,
+		},
+		{
+			name: "read racing a write is not cached",
+			call: func(t *testing.T, ctx context.Context, svc *wc.CacheService, mr *miniredis.Miniredis) {
+				inner := svc.WalletService.(*wallet.MockWalletService)
+				get := inner.GetFunc
+				inner.GetFunc = func(ctx context.Context, user domain.User) (*domain.Wallet, error) {
+					w, err := get(ctx, user)
+					// the write commits and invalidates after the read
+					_, _ = svc.Deposit(ctx, user, "deposit", 5)
+
+					return w, err
+				}
+				w, _ := svc.Get(ctx, alice)
+				assert.Equal(t, 10, w.Balance)
+				inner.GetFunc = get
+				w, _ = svc.Get(ctx, alice)
+				assert.Equal(t, 15, w.Balance)
+			},
+			wantReads: 2,
+		},
+		{
+			name: "misses read the primary",
+			call: func(t *testing.T, ctx context.Context, svc *wc.CacheService, mr *miniredis.Miniredis) {
+				inner := svc.WalletService.(*wallet.MockWalletService)
+				get, getTransactions := inner.GetFunc, inner.GetTransactionsFunc
+				primary := []bool{}
+				inner.GetFunc = func(ctx context.Context, user domain.User) (*domain.Wallet, error) {
+					primary = append(primary, domain.PrimaryRead(ctx))
+
+					return get(ctx, user)
+				}
+				inner.GetTransactionsFunc = func(ctx context.Context, user domain.User, createdAt time.Time, lastReturnedID int, limit int) ([]*domain.Transaction, error) {
+					primary = append(primary, domain.PrimaryRead(ctx))
+
+					return getTransactions(ctx, user, createdAt, lastReturnedID, limit)
+				}
+				_, _ = svc.Get(ctx, alice)
+				_, _ = svc.GetTransactions(ctx, alice, time.Time{}, 0, 10)
+				// reads which are not stored may use a replica
+				_, _ = svc.GetTransactions(ctx, alice, time.Now(), 1, 10)
+				svc.Bypass = func(ctx context.Context) bool {
+
+					return true
+				}
+				_, _ = svc.Get(ctx, alice)
+				assert.Equal(t, []bool{true, true, false, false}, primary)
+			},
+			wantReads: 4,
+		},
+		{
+			name: "bypass",
+			call: func(t *testing.T, ctx context.Context, svc *wc.CacheService, mr *miniredis.Miniredis) {
+				svc.Bypass = func(ctx context.Context) bool {
+
+					return true
+				}
+				_, _ = svc.Get(ctx, alice)
+				_, _ = svc.Get(ctx, alice)
+				_, _ = svc.GetTransactions(ctx, alice, time.Time{}, 0, 10)
+			},
+			wantReads: 3,
+		},
+		{
+			name: "redis down falls back",
+			call: func(t *testing.T, ctx context.Context, svc *wc.CacheService, mr *miniredis.Miniredis) {
+				_, _ = svc.Get(ctx, alice)
+				mr.Close()
+
+				w, err := svc.Get(ctx, alice)
+				assert.NoError(t, err)
+				assert.Equal(t, 10, w.Balance)
+				w, err = svc.Deposit(ctx, alice, "deposit", 5)
+				assert.NoError(t, err)
+				assert.Equal(t, 15, w.Balance)
+				transactions, err := svc.GetTransactions(ctx, alice, time.Time{}, 0, 10)
+				assert.NoError(t, err)
+				assert.Len(t, transactions, 2)
+			},
+			wantReads: 3,
+		},
+		{
+			name: "corrupt entry is read again",
+			call: func(t *testing.T, ctx context.Context, svc *wc.CacheService, mr *miniredis.Miniredis) {
+				assert.NoError(t, mr.Set("cryptocom:wallet:{alice}", "not json"))
+				w, err := svc.Get(ctx, alice)
+				assert.NoError(t, err)
+				assert.Equal(t, 10, w.Balance)
+			},
+			wantReads: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mr, err := miniredis.Run()
+			assert.NoError(t, err)
+			defer mr.Close()
+			client := redis.New(&redis.Config{Addr: mr.Addr()})
+			defer client.Close()
+
+			s, inner := newStore()
+			s.balances["alice"] = 10
+			s.balances["bob"] = 20
+			s.transactions["alice"] = []*domain.Transaction{{ID: 1, UserID: "alice", Amount: 10, CreatedAt: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}}
+
+			svc := wc.New(inner, client, 0)
+			tt.call(t, context.Background(), svc, mr)
+			assert.Equal(t, tt.wantReads, s.readCount())
+		})
+	}
+}
+
+var errDown = errors.New("down")
+
+func TestCacheServicePassesErrors(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	mr, err := miniredis.Run()
+	assert.NoError(t, err)
+	defer mr.Close()
+	client := redis.New(&redis.Config{Addr: mr.Addr()})
+	defer client.Close()
+
+	svc := wc.New(&wallet.MockWalletService{
+		GetTransactionsFunc: func(ctx context.Context, user domain.User, createdAt time.Time, lastReturnedID int, limit int) ([]*domain.Transaction, error) {
+
+			return nil, errDown
+		},
+	}, client, time.Second)
+
+	_, err = svc.GetTransactions(context.Background(), domain.User{ID: "alice"}, time.Time{}, 0, 10)
+	assert.ErrorIs(t, err, errDown)
+	assert.False(t, mr.Exists("cryptocom:transactions:{alice}"))
+}
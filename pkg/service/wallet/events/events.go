@@ -0,0 +1,196 @@
+// Package events pushes wallet changes to subscribers
+package events
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+
+	"github.com/sappy5678/cryptocom/pkg/domain"
+	"github.com/sappy5678/cryptocom/pkg/service/wallet/repository"
+)
+
+// pageSize is the number of events fetched from the repository per round trip
+const pageSize = 100
+
+// pollInterval re-checks the repository in case a notification is lost
+const pollInterval = 30 * time.Second
+
+// New creates new wallet event hub
+func New(db *sqlx.DB, walletRepo repository.WalletRepository) *Hub {
+
+	return &Hub{
+		db:          db,
+		walletRepo:  walletRepo,
+		subscribers: map[string]map[chan struct{}]struct{}{},
+		done:        make(chan struct{}),
+	}
+}
+
+// Hub fans out wallet change notifications to the local subscribers,
+// notifications only wake the subscribers up, events are always read from the repository
+// so every replica serves the same events and subscriptions can be resumed
+type Hub struct {
+	db         *sqlx.DB
+	walletRepo repository.WalletRepository
+
+	mu          sync.Mutex
+	subscribers map[string]map[chan struct{}]struct{}
+
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+// Close ends every subscription, so long-lived streams do not block the server shutdown
+func (h *Hub) Close() {
+	h.closeOnce.Do(func() {
+		close(h.done)
+	})
+}
+
+// Listen consumes postgres notifications until ctx is done or the channel is closed,
+// a nil notification means the listener reconnected and notifications may be lost
+func (h *Hub) Listen(ctx context.Context, notifications <-chan *pq.Notification) {
+	for {
+		select {
+		case <-ctx.Done():
+
+			return
+		case n, ok := <-notifications:
+			if !ok {
+
+				return
+			}
+			if n == nil {
+				h.NotifyAll()
+
+				continue
+			}
+			h.Notify(n.Extra)
+		}
+	}
+}
+
+// Notify wakes up the subscribers of the user
+func (h *Hub) Notify(userID string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for wake := range h.subscribers[userID] {
+		select {
+		case wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// NotifyAll wakes up every subscriber
+func (h *Hub) NotifyAll() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, subscribers := range h.subscribers {
+		for wake := range subscribers {
+			select {
+			case wake <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+func (h *Hub) register(userID string) chan struct{} {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	wake := make(chan struct{}, 1)
+	if h.subscribers[userID] == nil {
+		h.subscribers[userID] = map[chan struct{}]struct{}{}
+	}
+	h.subscribers[userID][wake] = struct{}{}
+
+	return wake
+}
+
+func (h *Hub) unregister(userID string, wake chan struct{}) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	delete(h.subscribers[userID], wake)
+	if len(h.subscribers[userID]) == 0 {
+		delete(h.subscribers, userID)
+	}
+}
+
+// Subscribe streams the events of the user after lastEventID until ctx is done,
+// the channel is closed when ctx is done or the repository fails, clients resume with the last received ID,
+// a subscription without one, lastEventID 0, starts after the latest event instead of replaying the history
+func (h *Hub) Subscribe(ctx context.Context, user domain.User, lastEventID int) (<-chan *domain.WalletEvent, error) {
+	// registered before the latest event is read, so the events committed in between wake the subscriber up
+	wake := h.register(user.ID)
+
+	// fail fast when the wallet does not exist
+	var err error
+	if lastEventID == 0 {
+		lastEventID, err = h.walletRepo.LastEventID(ctx, h.db, user)
+	} else {
+		_, err = h.walletRepo.Get(ctx, h.db, user)
+	}
+	if err != nil {
+		h.unregister(user.ID, wake)
+
+		return nil, err
+	}
+
+	out := make(chan *domain.WalletEvent)
+
+	go func() {
+		defer close(out)
+		defer h.unregister(user.ID, wake)
+
+		ticker := time.NewTicker(pollInterval)
+		defer ticker.Stop()
+
+		for {
+			events, err := h.walletRepo.GetEvents(ctx, h.db, user, lastEventID, pageSize)
+			if err != nil {
+
+				return
+			}
+
+			for _, event := range events {
+				select {
+				case out <- event:
+					lastEventID = event.ID
+				case <-ctx.Done():
+
+					return
+				case <-h.done:
+
+					return
+				}
+			}
+
+			// more events are waiting
+			if len(events) == pageSize {
+				continue
+			}
+
+			select {
+			case <-ctx.Done():
+
+				return
+			case <-h.done:
+
+				return
+			case <-wake:
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	return out, nil
+}
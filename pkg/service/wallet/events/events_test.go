@@ -0,0 +1,179 @@
+package events_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
+
+	"github.com/sappy5678/cryptocom/pkg/domain"
+	"github.com/sappy5678/cryptocom/pkg/service/wallet/events"
+	"github.com/sappy5678/cryptocom/pkg/service/wallet/repository"
+)
+
+// eventLog is a fake event store shared by the mock repository
+type eventLog struct {
+	mu     sync.Mutex
+	events []*domain.WalletEvent
+}
+
+func (l *eventLog) append(event *domain.WalletEvent) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.events = append(l.events, event)
+}
+
+func (l *eventLog) repository() *repository.MockWalletRepository {
+
+	return &repository.MockWalletRepository{
+		GetFunc: func(ctx context.Context, db sqlx.ExtContext, user domain.User) (*domain.Wallet, error) {
+			if user.ID != "1" {
+
+				return nil, domain.ErrWalletNotFound
+			}
+
+			return &domain.Wallet{UserID: user.ID}, nil
+		},
+		LastEventIDFunc: func(ctx context.Context, db sqlx.ExtContext, user domain.User) (int, error) {
+			if user.ID != "1" {
+
+				return 0, domain.ErrWalletNotFound
+			}
+			l.mu.Lock()
+			defer l.mu.Unlock()
+
+			ID := 0
+			for _, event := range l.events {
+				if event.UserID == user.ID {
+					ID = event.ID
+				}
+			}
+
+			return ID, nil
+		},
+		GetEventsFunc: func(ctx context.Context, db sqlx.ExtContext, user domain.User, IDAfter int, limit int) ([]*domain.WalletEvent, error) {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+
+			events := []*domain.WalletEvent{}
+			for _, event := range l.events {
+				if event.UserID == user.ID && event.ID > IDAfter && len(events) < limit {
+					events = append(events, event)
+				}
+			}
+
+			return events, nil
+		},
+	}
+}
+
+func receive(t *testing.T, ch <-chan *domain.WalletEvent) *domain.WalletEvent {
+	select {
+	case event := <-ch:
+
+		return event
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for event")
+	}
+
+	return nil
+}
+
+func TestSubscribe(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	log := &eventLog{}
+	log.append(&domain.WalletEvent{ID: 1, UserID: "1", Balance: 10})
+	log.append(&domain.WalletEvent{ID: 2, UserID: "1", Balance: 20})
+
+	hub := events.New(&sqlx.DB{}, log.repository())
+	notifications := make(chan *pq.Notification)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan struct{})
+	go func() {
+		hub.Listen(ctx, notifications)
+		close(done)
+	}()
+
+	ch, err := hub.Subscribe(ctx, domain.User{ID: "1"}, 1)
+	assert.NoError(t, err)
+
+	// resume after the last event ID
+	assert.Equal(t, 2, receive(t, ch).ID)
+
+	// new event is pushed after notification
+	log.append(&domain.WalletEvent{ID: 3, UserID: "1", Balance: 30})
+	notifications <- &pq.Notification{Channel: repository.WalletEventsChannel, Extra: "1"}
+	assert.Equal(t, 3, receive(t, ch).ID)
+
+	// reconnect of the listener wakes everyone up
+	log.append(&domain.WalletEvent{ID: 4, UserID: "1", Balance: 40})
+	notifications <- nil
+	assert.Equal(t, 4, receive(t, ch).ID)
+
+	cancel()
+	<-done
+	_, ok := <-ch
+	assert.False(t, ok)
+}
+
+func TestSubscribeLatest(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	log := &eventLog{}
+	log.append(&domain.WalletEvent{ID: 1, UserID: "1", Balance: 10})
+	log.append(&domain.WalletEvent{ID: 2, UserID: "1", Balance: 20})
+
+	hub := events.New(&sqlx.DB{}, log.repository())
+	notifications := make(chan *pq.Notification)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan struct{})
+	go func() {
+		hub.Listen(ctx, notifications)
+		close(done)
+	}()
+
+	// without a last event ID the history is not replayed, only new events are pushed
+	ch, err := hub.Subscribe(ctx, domain.User{ID: "1"}, 0)
+	assert.NoError(t, err)
+	log.append(&domain.WalletEvent{ID: 3, UserID: "1", Balance: 30})
+	notifications <- &pq.Notification{Channel: repository.WalletEventsChannel, Extra: "1"}
+	assert.Equal(t, 3, receive(t, ch).ID)
+
+	cancel()
+	<-done
+	_, ok := <-ch
+	assert.False(t, ok)
+}
+
+func TestSubscribeWalletNotFound(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	hub := events.New(&sqlx.DB{}, (&eventLog{}).repository())
+	for _, lastEventID := range []int{0, 1} {
+		_, err := hub.Subscribe(context.Background(), domain.User{ID: "2"}, lastEventID)
+		assert.ErrorIs(t, err, domain.ErrWalletNotFound)
+	}
+}
+
+func TestClose(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	hub := events.New(&sqlx.DB{}, (&eventLog{}).repository())
+	ch, err := hub.Subscribe(context.Background(), domain.User{ID: "1"}, 0)
+	assert.NoError(t, err)
+
+	hub.Close()
+	hub.Close()
+	_, ok := <-ch
+	assert.False(t, ok)
+}
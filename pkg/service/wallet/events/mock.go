@@ -0,0 +1,16 @@
+package events
+
+import (
+	"context"
+
+	"github.com/sappy5678/cryptocom/pkg/domain"
+)
+
+type MockWalletEventService struct {
+	SubscribeFunc func(ctx context.Context, user domain.User, lastEventID int) (<-chan *domain.WalletEvent, error)
+}
+
+func (m *MockWalletEventService) Subscribe(ctx context.Context, user domain.User, lastEventID int) (<-chan *domain.WalletEvent, error) {
+
+	return m.SubscribeFunc(ctx, user, lastEventID)
+}
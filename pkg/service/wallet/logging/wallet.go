@@ -25,19 +25,20 @@ type LogService struct {
 const name = "wallet"
 
 // Create logging
-func (ls *LogService) Create(c context.Context, req domain.User) (wallet *domain.Wallet, err error) {
+func (ls *LogService) Create(c context.Context, req domain.User, metadata domain.WalletMetadata) (wallet *domain.Wallet, err error) {
 	defer func(begin time.Time) {
 		ls.logger.Log(
 			c,
 			name, "Create wallet request", err,
 			map[string]interface{}{
-				"req":  req,
-				"took": time.Since(begin),
+				"req":      req,
+				"metadata": metadata,
+				"took":     time.Since(begin),
 			},
 		)
 	}(time.Now())
 
-	return ls.WalletService.Create(c, req)
+	return ls.WalletService.Create(c, req, metadata)
 }
 
 func (ls *LogService) Get(c context.Context, req domain.User) (wallet *domain.Wallet, err error) {
@@ -14,7 +14,7 @@ import (
 )
 
 var mockWalletService = &wallet.MockWalletService{
-	CreateFunc: func(ctx context.Context, user domain.User) (*domain.Wallet, error) {
+	CreateFunc: func(ctx context.Context, user domain.User, metadata domain.WalletMetadata) (*domain.Wallet, error) {
 
 		return &domain.Wallet{UserID: user.ID, Balance: 0}, nil
 	},
@@ -49,8 +49,8 @@ func TestCreate(t *testing.T) {
 
 	log := zlog.New()
 	svc := wl.New(mockWalletService, log)
-	r1, e1 := svc.Create(context.Background(), domain.User{ID: "test-user-id"})
-	r2, e2 := mockWalletService.Create(context.Background(), domain.User{ID: "test-user-id"})
+	r1, e1 := svc.Create(context.Background(), domain.User{ID: "test-user-id"}, domain.WalletMetadata{})
+	r2, e2 := mockWalletService.Create(context.Background(), domain.User{ID: "test-user-id"}, domain.WalletMetadata{})
 
 	assert.Equal(t, r1, r2)
 	assert.Equal(t, e1, e2)
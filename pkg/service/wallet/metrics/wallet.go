@@ -0,0 +1,178 @@
+package wallet
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/sappy5678/cryptocom/pkg/domain"
+)
+
+const namespace = "wallet"
+
+// New creates new wallet metrics service, the metrics are registered on reg
+func New(svc domain.WalletService, reg prometheus.Registerer) *MetricsService {
+	ms := &MetricsService{
+		WalletService: svc,
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "requests_total",
+			Help:      "Number of wallet requests by operation.",
+		}, []string{"operation"}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "errors_total",
+			Help:      "Number of failed wallet requests by operation and domain error.",
+		}, []string{"operation", "error"}),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "request_duration_seconds",
+			Help:      "Latency of wallet requests by operation.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"operation"}),
+		amount: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "amount_moved_total",
+			Help:      "Amount moved by successful wallet requests in base units (10^6 = 1 dollar).",
+		}, []string{"operation"}),
+	}
+	reg.MustRegister(ms.requests, ms.errors, ms.latency, ms.amount)
+
+	return ms
+}
+
+// MetricsService represents wallet metrics service
+type MetricsService struct {
+	domain.WalletService
+	requests *prometheus.CounterVec
+	errors   *prometheus.CounterVec
+	latency  *prometheus.HistogramVec
+	amount   *prometheus.CounterVec
+}
+
+const (
+	operationCreate              = "create"
+	operationGet                 = "get"
+	operationCreateTransactionID = "create_transaction_id"
+	operationDeposit             = "deposit"
+	operationWithdraw            = "withdraw"
+	operationTransfer            = "transfer"
+	operationGetTransactions     = "get_transactions"
+)
+
+// ErrorLabel returns the error label of err, unknown errors are internal
+func ErrorLabel(err error) string {
+	switch {
+	case errors.Is(err, domain.ErrInvalidAmount):
+
+		return "invalid_amount"
+	case errors.Is(err, domain.ErrPassiveWalletNotFound):
+
+		return "passive_wallet_not_found"
+	case errors.Is(err, domain.ErrWalletNotFound):
+
+		return "wallet_not_found"
+	case errors.Is(err, domain.ErrNotEnoughBalance):
+
+		return "not_enough_balance"
+	case errors.Is(err, domain.ErrTransferToSelf):
+
+		return "transfer_to_self"
+	case errors.Is(err, domain.ErrUserIDRequired):
+
+		return "user_id_required"
+	case errors.Is(err, domain.ErrInvalidMetadata):
+
+		return "invalid_metadata"
+	case errors.Is(err, domain.ErrTransactionsArchived):
+
+		return "transactions_archived"
+	case errors.Is(err, domain.ErrArchiveOffline):
+
+		return "archive_offline"
+	case errors.Is(err, context.Canceled):
+
+		return "canceled"
+	case errors.Is(err, context.DeadlineExceeded):
+
+		return "deadline_exceeded"
+	}
+
+	return "internal"
+}
+
+func (ms *MetricsService) observe(operation string, begin time.Time, err error) {
+	ms.requests.WithLabelValues(operation).Inc()
+	ms.latency.WithLabelValues(operation).Observe(time.Since(begin).Seconds())
+	if err != nil {
+		ms.errors.WithLabelValues(operation, ErrorLabel(err)).Inc()
+	}
+}
+
+func (ms *MetricsService) moved(operation string, amount int, err error) {
+	if err == nil {
+		ms.amount.WithLabelValues(operation).Add(float64(amount))
+	}
+}
+
+// Create metrics
+func (ms *MetricsService) Create(c context.Context, req domain.User, metadata domain.WalletMetadata) (wallet *domain.Wallet, err error) {
+	defer func(begin time.Time) {
+		ms.observe(operationCreate, begin, err)
+	}(time.Now())
+
+	return ms.WalletService.Create(c, req, metadata)
+}
+
+func (ms *MetricsService) Get(c context.Context, req domain.User) (wallet *domain.Wallet, err error) {
+	defer func(begin time.Time) {
+		ms.observe(operationGet, begin, err)
+	}(time.Now())
+
+	return ms.WalletService.Get(c, req)
+}
+
+func (ms *MetricsService) Withdraw(c context.Context, req domain.User, transactionID domain.TransactionID, amount int) (wallet *domain.Wallet, err error) {
+	defer func(begin time.Time) {
+		ms.observe(operationWithdraw, begin, err)
+		ms.moved(operationWithdraw, amount, err)
+	}(time.Now())
+
+	return ms.WalletService.Withdraw(c, req, transactionID, amount)
+}
+
+func (ms *MetricsService) Deposit(c context.Context, req domain.User, transactionID domain.TransactionID, amount int) (wallet *domain.Wallet, err error) {
+	defer func(begin time.Time) {
+		ms.observe(operationDeposit, begin, err)
+		ms.moved(operationDeposit, amount, err)
+	}(time.Now())
+
+	return ms.WalletService.Deposit(c, req, transactionID, amount)
+}
+
+func (ms *MetricsService) GetTransactions(c context.Context, req domain.User, createdAt time.Time, lastReturnedID int, limit int) (transactions []*domain.Transaction, err error) {
+	defer func(begin time.Time) {
+		ms.observe(operationGetTransactions, begin, err)
+	}(time.Now())
+
+	return ms.WalletService.GetTransactions(c, req, createdAt, lastReturnedID, limit)
+}
+
+func (ms *MetricsService) Transfer(c context.Context, req domain.User, transactionID domain.TransactionID, amount int, passiveUser domain.User) (wallet *domain.Wallet, err error) {
+	defer func(begin time.Time) {
+		ms.observe(operationTransfer, begin, err)
+		ms.moved(operationTransfer, amount, err)
+	}(time.Now())
+
+	return ms.WalletService.Transfer(c, req, transactionID, amount, passiveUser)
+}
+
+func (ms *MetricsService) CreateTransactionID(c context.Context) domain.TransactionID {
+	defer func(begin time.Time) {
+		ms.observe(operationCreateTransactionID, begin, nil)
+	}(time.Now())
+
+	return ms.WalletService.CreateTransactionID(c)
+}
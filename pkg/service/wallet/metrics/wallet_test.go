@@ -0,0 +1,132 @@
+package wallet_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
+
+	"github.com/sappy5678/cryptocom/pkg/domain"
+	"github.com/sappy5678/cryptocom/pkg/service/wallet"
+	wm "github.com/sappy5678/cryptocom/pkg/service/wallet/metrics"
+)
+
+var mockWalletService = &wallet.MockWalletService{
+	CreateFunc: func(ctx context.Context, user domain.User, metadata domain.WalletMetadata) (*domain.Wallet, error) {
+
+		return &domain.Wallet{UserID: user.ID, Balance: 0}, nil
+	},
+	GetFunc: func(ctx context.Context, user domain.User) (*domain.Wallet, error) {
+
+		return nil, domain.ErrWalletNotFound
+	},
+	WithdrawFunc: func(ctx context.Context, user domain.User, transactionID domain.TransactionID, amount int) (*domain.Wallet, error) {
+
+		return nil, domain.ErrNotEnoughBalance
+	},
+	DepositFunc: func(ctx context.Context, user domain.User, transactionID domain.TransactionID, amount int) (*domain.Wallet, error) {
+
+		return &domain.Wallet{UserID: user.ID, Balance: amount}, nil
+	},
+	GetTransactionsFunc: func(ctx context.Context, user domain.User, createdAt time.Time, lastReturnedID int, limit int) ([]*domain.Transaction, error) {
+
+		return nil, errors.New("connection refused")
+	},
+	CreateTransactionIDFunc: func(ctx context.Context) domain.TransactionID {
+
+		return domain.TransactionID("test-transaction-id")
+	},
+	TransferFunc: func(ctx context.Context, user domain.User, transactionID domain.TransactionID, amount int, passiveUser domain.User) (*domain.Wallet, error) {
+
+		return &domain.Wallet{UserID: user.ID, Balance: 0}, nil
+	},
+}
+
+func TestMetricsService(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	reg := prometheus.NewRegistry()
+	svc := wm.New(mockWalletService, reg)
+	ctx := context.Background()
+	user := domain.User{ID: "test-user-id"}
+
+	// the decorator is transparent
+	r1, e1 := svc.Deposit(ctx, user, "txn-1", 100)
+	r2, e2 := mockWalletService.Deposit(ctx, user, "txn-1", 100)
+	assert.Equal(t, r1, r2)
+	assert.Equal(t, e1, e2)
+
+	_, _ = svc.Deposit(ctx, user, "txn-2", 50)
+	_, err := svc.Withdraw(ctx, user, "txn-3", 1000)
+	assert.ErrorIs(t, err, domain.ErrNotEnoughBalance)
+	_, _ = svc.Transfer(ctx, user, "txn-4", 30, domain.User{ID: "test-user-2"})
+	_, err = svc.Get(ctx, user)
+	assert.ErrorIs(t, err, domain.ErrWalletNotFound)
+	_, _ = svc.Create(ctx, user, domain.WalletMetadata{})
+	_, err = svc.GetTransactions(ctx, user, time.Now(), 0, 10)
+	assert.Error(t, err)
+	assert.Equal(t, domain.TransactionID("test-transaction-id"), svc.CreateTransactionID(ctx))
+
+	want := `
+# HELP wallet_amount_moved_total Amount moved by successful wallet requests in base units (10^6 = 1 dollar).
+# TYPE wallet_amount_moved_total counter
+wallet_amount_moved_total{operation="deposit"} 150
+wallet_amount_moved_total{operation="transfer"} 30
+# HELP wallet_errors_total Number of failed wallet requests by operation and domain error.
+# TYPE wallet_errors_total counter
+wallet_errors_total{error="internal",operation="get_transactions"} 1
+wallet_errors_total{error="not_enough_balance",operation="withdraw"} 1
+wallet_errors_total{error="wallet_not_found",operation="get"} 1
+# HELP wallet_requests_total Number of wallet requests by operation.
+# TYPE wallet_requests_total counter
+wallet_requests_total{operation="create"} 1
+wallet_requests_total{operation="create_transaction_id"} 1
+wallet_requests_total{operation="deposit"} 2
+wallet_requests_total{operation="get"} 1
+wallet_requests_total{operation="get_transactions"} 1
+wallet_requests_total{operation="transfer"} 1
+wallet_requests_total{operation="withdraw"} 1
+`
+	assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(want),
+		"wallet_amount_moved_total", "wallet_errors_total", "wallet_requests_total"))
+
+	count, err := testutil.GatherAndCount(reg, "wallet_request_duration_seconds")
+	assert.NoError(t, err)
+	assert.Equal(t, 7, count)
+}
+
+func TestErrorLabel(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{name: "invalid amount", err: domain.ErrInvalidAmount, want: "invalid_amount"},
+		{name: "wallet not found", err: domain.ErrWalletNotFound, want: "wallet_not_found"},
+		{name: "passive wallet not found", err: domain.ErrPassiveWalletNotFound, want: "passive_wallet_not_found"},
+		{name: "not enough balance", err: domain.ErrNotEnoughBalance, want: "not_enough_balance"},
+		{name: "transfer to self", err: domain.ErrTransferToSelf, want: "transfer_to_self"},
+		{name: "user ID required", err: domain.ErrUserIDRequired, want: "user_id_required"},
+		{name: "invalid metadata", err: domain.ErrInvalidMetadata, want: "invalid_metadata"},
+		{name: "transactions archived", err: domain.ErrTransactionsArchived, want: "transactions_archived"},
+		{name: "archive offline", err: fmt.Errorf("%w, no such file", domain.ErrArchiveOffline), want: "archive_offline"},
+		{name: "canceled", err: context.Canceled, want: "canceled"},
+		{name: "deadline exceeded", err: context.DeadlineExceeded, want: "deadline_exceeded"},
+		{name: "unknown", err: errors.New("connection refused"), want: "internal"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, wm.ErrorLabel(tt.err))
+		})
+	}
+}
@@ -8,7 +8,7 @@ import (
 )
 
 type MockWalletService struct {
-	CreateFunc              func(ctx context.Context, user domain.User) (*domain.Wallet, error)
+	CreateFunc              func(ctx context.Context, user domain.User, metadata domain.WalletMetadata) (*domain.Wallet, error)
 	GetFunc                 func(ctx context.Context, user domain.User) (*domain.Wallet, error)
 	WithdrawFunc            func(ctx context.Context, user domain.User, transactionID domain.TransactionID, amount int) (*domain.Wallet, error)
 	DepositFunc             func(ctx context.Context, user domain.User, transactionID domain.TransactionID, amount int) (*domain.Wallet, error)
@@ -17,9 +17,9 @@ type MockWalletService struct {
 	CreateTransactionIDFunc func(ctx context.Context) domain.TransactionID
 }
 
-func (m *MockWalletService) Create(ctx context.Context, user domain.User) (*domain.Wallet, error) {
+func (m *MockWalletService) Create(ctx context.Context, user domain.User, metadata domain.WalletMetadata) (*domain.Wallet, error) {
 
-	return m.CreateFunc(ctx, user)
+	return m.CreateFunc(ctx, user, metadata)
 }
 
 func (m *MockWalletService) Get(ctx context.Context, user domain.User) (*domain.Wallet, error) {
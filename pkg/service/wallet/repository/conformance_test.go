@@ -0,0 +1,526 @@
+package repository_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/sappy5678/cryptocom/pkg/domain"
+	"github.com/sappy5678/cryptocom/pkg/service/wallet/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"go.uber.org/goleak"
+)
+
+// ConformanceSuite is the behaviour every WalletRepository backend shares,
+// it runs against Memory in TestMemoryConformance and against postgres in TestSuite.TestConformance
+type ConformanceSuite struct {
+	suite.Suite
+	// newRepo returns an empty repository and its executor for each test
+	newRepo func() (repository.WalletRepository, sqlx.ExtContext)
+
+	repo repository.WalletRepository
+	db   sqlx.ExtContext
+}
+
+func (cs *ConformanceSuite) SetupTest() {
+	cs.repo, cs.db = cs.newRepo()
+}
+
+func TestMemoryConformance(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	suite.Run(t, &ConformanceSuite{
+		newRepo: func() (repository.WalletRepository, sqlx.ExtContext) {
+
+			return repository.NewMemory(), nil
+		},
+	})
+}
+
+// create creates the wallets of users with balance
+func (cs *ConformanceSuite) create(balance int, users ...domain.User) {
+	ctx := context.Background()
+	for _, user := range users {
+		_, err := cs.repo.Create(ctx, cs.db, user, domain.WalletMetadata{})
+		cs.Require().NoError(err)
+		if balance > 0 {
+			_, err = cs.repo.Deposit(ctx, cs.db, time.Now(), user, domain.TransactionID("test-tx-initial-"+user.ID), balance)
+			cs.Require().NoError(err)
+		}
+	}
+}
+
+func (cs *ConformanceSuite) balance(user domain.User) int {
+	wallet, err := cs.repo.Get(context.Background(), cs.db, user)
+	cs.Require().NoError(err)
+
+	return wallet.Balance
+}
+
+func (cs *ConformanceSuite) TestCreate() {
+	ctx := context.Background()
+	user := domain.User{ID: "test-user-1"}
+	metadata := domain.WalletMetadata{DisplayName: "Shop", Asset: "USD", Tags: []string{"merchant"}}
+
+	got, err := cs.repo.Create(ctx, cs.db, user, metadata)
+	cs.NoError(err)
+	cs.Equal(user.ID, got.UserID)
+	cs.Equal(0, got.Balance)
+	cs.Equal(metadata, got.WalletMetadata)
+	cs.True(got.Created)
+
+	got, err = cs.repo.Create(ctx, cs.db, user, domain.WalletMetadata{DisplayName: "Other"})
+	cs.NoError(err)
+	cs.Equal(metadata, got.WalletMetadata)
+	cs.False(got.Created)
+
+	_, err = cs.repo.Create(ctx, cs.db, domain.User{ID: "test-user-2"}, domain.WalletMetadata{Tags: []string{""}})
+	cs.ErrorIs(err, domain.ErrInvalidMetadata)
+	_, err = cs.repo.Get(ctx, cs.db, domain.User{ID: "test-user-2"})
+	cs.ErrorIs(err, domain.ErrWalletNotFound)
+
+	got, err = cs.repo.Get(ctx, cs.db, user)
+	cs.NoError(err)
+	cs.Equal(metadata, got.WalletMetadata)
+}
+
+func (cs *ConformanceSuite) TestWrites() {
+	ctx := context.Background()
+	now := time.Now()
+	user := domain.User{ID: "test-user-1"}
+	passiveUser := domain.User{ID: "test-user-2"}
+	missingUser := domain.User{ID: "test-user-missing"}
+	cs.create(100, user, passiveUser)
+
+	tests := []struct {
+		name        string
+		write       func() (*domain.Wallet, error)
+		want        int
+		wantErr     error
+		wantBalance int
+		wantPassive int
+	}{
+		{
+			name: "deposit invalid amount",
+			write: func() (*domain.Wallet, error) {
+
+				return cs.repo.Deposit(ctx, cs.db, now, user, "test-tx-1", 0)
+			},
+			wantErr:     domain.ErrInvalidAmount,
+			wantBalance: 100,
+			wantPassive: 100,
+		},
+		{
+			name: "deposit wallet not found",
+			write: func() (*domain.Wallet, error) {
+
+				return cs.repo.Deposit(ctx, cs.db, now, missingUser, "test-tx-1", 10)
+			},
+			wantErr:     domain.ErrWalletNotFound,
+			wantBalance: 100,
+			wantPassive: 100,
+		},
+		{
+			name: "deposit",
+			write: func() (*domain.Wallet, error) {
+
+				return cs.repo.Deposit(ctx, cs.db, now, user, "test-tx-1", 10)
+			},
+			want:        110,
+			wantBalance: 110,
+			wantPassive: 100,
+		},
+		{
+			name: "deposit replayed",
+			write: func() (*domain.Wallet, error) {
+
+				return cs.repo.Deposit(ctx, cs.db, now, user, "test-tx-1", 10)
+			},
+			want:        110,
+			wantBalance: 110,
+			wantPassive: 100,
+		},
+		{
+			name: "withdraw not enough balance",
+			write: func() (*domain.Wallet, error) {
+
+				return cs.repo.Withdraw(ctx, cs.db, now, user, "test-tx-2", 111)
+			},
+			wantErr:     domain.ErrNotEnoughBalance,
+			wantBalance: 110,
+			wantPassive: 100,
+		},
+		{
+			name: "withdraw",
+			write: func() (*domain.Wallet, error) {
+
+				return cs.repo.Withdraw(ctx, cs.db, now, user, "test-tx-2", 110)
+			},
+			want:        0,
+			wantBalance: 0,
+			wantPassive: 100,
+		},
+		{
+			name: "withdraw replayed",
+			write: func() (*domain.Wallet, error) {
+
+				return cs.repo.Withdraw(ctx, cs.db, now, user, "test-tx-2", 110)
+			},
+			want:        0,
+			wantBalance: 0,
+			wantPassive: 100,
+		},
+		{
+			name: "transfer to self",
+			write: func() (*domain.Wallet, error) {
+
+				return cs.repo.Transfer(ctx, cs.db, now, passiveUser, "test-tx-3", 10, passiveUser)
+			},
+			wantErr:     domain.ErrTransferToSelf,
+			wantBalance: 0,
+			wantPassive: 100,
+		},
+		{
+			name: "transfer wallet not found",
+			write: func() (*domain.Wallet, error) {
+
+				return cs.repo.Transfer(ctx, cs.db, now, missingUser, "test-tx-3", 10, user)
+			},
+			wantErr:     domain.ErrWalletNotFound,
+			wantBalance: 0,
+			wantPassive: 100,
+		},
+		{
+			name: "transfer passive wallet not found",
+			write: func() (*domain.Wallet, error) {
+
+				return cs.repo.Transfer(ctx, cs.db, now, passiveUser, "test-tx-3", 10, missingUser)
+			},
+			wantErr:     domain.ErrPassiveWalletNotFound,
+			wantBalance: 0,
+			wantPassive: 100,
+		},
+		{
+			name: "transfer not enough balance",
+			write: func() (*domain.Wallet, error) {
+
+				return cs.repo.Transfer(ctx, cs.db, now, user, "test-tx-3", 10, passiveUser)
+			},
+			wantErr:     domain.ErrNotEnoughBalance,
+			wantBalance: 0,
+			wantPassive: 100,
+		},
+		{
+			name: "transfer",
+			write: func() (*domain.Wallet, error) {
+
+				return cs.repo.Transfer(ctx, cs.db, now, passiveUser, "test-tx-3", 40, user)
+			},
+			want:        60,
+			wantBalance: 40,
+			wantPassive: 60,
+		},
+		{
+			name: "transfer replayed",
+			write: func() (*domain.Wallet, error) {
+
+				return cs.repo.Transfer(ctx, cs.db, now, passiveUser, "test-tx-3", 40, user)
+			},
+			want:        60,
+			wantBalance: 40,
+			wantPassive: 60,
+		},
+	}
+
+	for _, tt := range tests {
+		cs.Run(tt.name, func() {
+			got, err := tt.write()
+			if tt.wantErr != nil {
+				cs.ErrorIs(err, tt.wantErr)
+			} else if cs.NoError(err) {
+				cs.Equal(tt.want, got.Balance)
+			}
+			cs.Equal(tt.wantBalance, cs.balance(user))
+			cs.Equal(tt.wantPassive, cs.balance(passiveUser))
+		})
+	}
+}
+
+func (cs *ConformanceSuite) TestTransferLegs() {
+	ctx := context.Background()
+	user := domain.User{ID: "test-user-1"}
+	passiveUser := domain.User{ID: "test-user-2"}
+	cs.create(100, user, passiveUser)
+	now := repository.TimeToUTC(time.Now())
+
+	_, err := cs.repo.Transfer(ctx, cs.db, now, user, "test-tx-transfer", 30, passiveUser)
+	cs.Require().NoError(err)
+
+	out, err := cs.repo.GetTransactions(ctx, cs.db, user, time.Time{}, 0, 1)
+	cs.Require().NoError(err)
+	in, err := cs.repo.GetTransactions(ctx, cs.db, passiveUser, time.Time{}, 0, 1)
+	cs.Require().NoError(err)
+	cs.Require().Len(out, 1)
+	cs.Require().Len(in, 1)
+
+	cs.Equal(domain.TransactionID("test-tx-transfer"), out[0].TransactionID)
+	cs.Equal(domain.OperationTypeTransferOut, out[0].OperationType)
+	cs.Equal(passiveUser.ID, out[0].PassiveUserID)
+	cs.Equal(30, out[0].Amount)
+	cs.Equal(now, out[0].CreatedAt)
+
+	cs.Equal(domain.TransactionID("test-tx-transfer-passive"), in[0].TransactionID)
+	cs.Equal(domain.OperationTypeTransferIn, in[0].OperationType)
+	cs.Equal(user.ID, in[0].PassiveUserID)
+	cs.Equal(30, in[0].Amount)
+	cs.Equal(now, in[0].CreatedAt)
+	cs.Less(out[0].ID, in[0].ID)
+}
+
+func (cs *ConformanceSuite) TestGetTransactions() {
+	ctx := context.Background()
+	user := domain.User{ID: "test-user-1"}
+	passiveUser := domain.User{ID: "test-user-2"}
+	cs.create(0, user, passiveUser)
+
+	// deposits a minute apart, the two legs of the last transfer share its time
+	begin := repository.TimeToUTC(time.Now().Add(-time.Hour))
+	for i := 0; i < 5; i++ {
+		_, err := cs.repo.Deposit(ctx, cs.db, begin.Add(time.Duration(i)*time.Minute), user, domain.TransactionID(fmt.Sprintf("test-tx-%d", i)), 10)
+		cs.Require().NoError(err)
+	}
+	_, err := cs.repo.Transfer(ctx, cs.db, begin.Add(5*time.Minute), user, "test-tx-5", 10, passiveUser)
+	cs.Require().NoError(err)
+	_, err = cs.repo.Transfer(ctx, cs.db, begin.Add(5*time.Minute), passiveUser, "test-tx-6", 10, user)
+	cs.Require().NoError(err)
+
+	transactionIDs := func(transactions []*domain.Transaction) []domain.TransactionID {
+		ids := []domain.TransactionID{}
+		for _, transaction := range transactions {
+			ids = append(ids, transaction.TransactionID)
+		}
+
+		return ids
+	}
+
+	// newest first, ties broken by ID
+	all, err := cs.repo.GetTransactions(ctx, cs.db, user, time.Time{}, 0, 0)
+	cs.Require().NoError(err)
+	cs.Equal([]domain.TransactionID{"test-tx-6-passive", "test-tx-5", "test-tx-4", "test-tx-3", "test-tx-2", "test-tx-1", "test-tx-0"}, transactionIDs(all))
+
+	// pages resume from the last returned transaction
+	page, err := cs.repo.GetTransactions(ctx, cs.db, user, time.Time{}, 0, 3)
+	cs.Require().NoError(err)
+	cs.Equal(all[:3], page)
+	last := page[len(page)-1]
+	page, err = cs.repo.GetTransactions(ctx, cs.db, user, last.CreatedAt, last.ID, 3)
+	cs.Require().NoError(err)
+	cs.Equal(all[3:6], page)
+
+	page, err = cs.repo.GetTransactions(ctx, cs.db, user, begin.Add(2*time.Minute), 0, 0)
+	cs.Require().NoError(err)
+	cs.Equal([]domain.TransactionID{"test-tx-2", "test-tx-1", "test-tx-0"}, transactionIDs(page))
+
+	_, err = cs.repo.GetTransactions(ctx, cs.db, domain.User{ID: "test-user-missing"}, time.Time{}, 0, 0)
+	cs.ErrorIs(err, domain.ErrWalletNotFound)
+}
+
+func (cs *ConformanceSuite) TestGetEvents() {
+	ctx := context.Background()
+	now := time.Now()
+	user := domain.User{ID: "test-user-1"}
+	passiveUser := domain.User{ID: "test-user-2"}
+	cs.create(0, user, passiveUser)
+
+	_, err := cs.repo.Deposit(ctx, cs.db, now, user, "test-tx-1", 100)
+	cs.Require().NoError(err)
+	_, err = cs.repo.Transfer(ctx, cs.db, now, user, "test-tx-2", 30, passiveUser)
+	cs.Require().NoError(err)
+	_, err = cs.repo.Withdraw(ctx, cs.db, now, user, "test-tx-3", 20)
+	cs.Require().NoError(err)
+
+	// oldest first with the balance after each event
+	events, err := cs.repo.GetEvents(ctx, cs.db, user, 0, 0)
+	cs.Require().NoError(err)
+	cs.Require().Len(events, 3)
+	balances := []int{}
+	for _, event := range events {
+		cs.Equal(event.ID, event.Transaction.ID)
+		balances = append(balances, event.Balance)
+	}
+	cs.Equal([]int{100, 70, 50}, balances)
+
+	events, err = cs.repo.GetEvents(ctx, cs.db, user, events[0].ID, 1)
+	cs.Require().NoError(err)
+	cs.Require().Len(events, 1)
+	cs.Equal(domain.TransactionID("test-tx-2"), events[0].Transaction.TransactionID)
+
+	events, err = cs.repo.GetEvents(ctx, cs.db, passiveUser, 0, 0)
+	cs.Require().NoError(err)
+	cs.Require().Len(events, 1)
+	cs.Equal(30, events[0].Balance)
+
+	_, err = cs.repo.GetEvents(ctx, cs.db, domain.User{ID: "test-user-missing"}, 0, 0)
+	cs.ErrorIs(err, domain.ErrWalletNotFound)
+}
+
+func (cs *ConformanceSuite) TestLastEventID() {
+	ctx := context.Background()
+	now := time.Now()
+	user := domain.User{ID: "test-user-1"}
+	passiveUser := domain.User{ID: "test-user-2"}
+	cs.create(0, user, passiveUser)
+
+	ID, err := cs.repo.LastEventID(ctx, cs.db, user)
+	cs.Require().NoError(err)
+	cs.Equal(0, ID)
+
+	_, err = cs.repo.Deposit(ctx, cs.db, now, user, "test-tx-1", 100)
+	cs.Require().NoError(err)
+	_, err = cs.repo.Transfer(ctx, cs.db, now, user, "test-tx-2", 30, passiveUser)
+	cs.Require().NoError(err)
+
+	// nothing comes after the latest event
+	ID, err = cs.repo.LastEventID(ctx, cs.db, user)
+	cs.Require().NoError(err)
+	events, err := cs.repo.GetEvents(ctx, cs.db, user, 0, 0)
+	cs.Require().NoError(err)
+	cs.Require().Len(events, 2)
+	cs.Equal(events[1].ID, ID)
+	events, err = cs.repo.GetEvents(ctx, cs.db, user, ID, 0)
+	cs.Require().NoError(err)
+	cs.Empty(events)
+
+	_, err = cs.repo.LastEventID(ctx, cs.db, domain.User{ID: "test-user-missing"})
+	cs.ErrorIs(err, domain.ErrWalletNotFound)
+}
+
+func (cs *ConformanceSuite) TestUnitOfWork() {
+	ctx := context.Background()
+	now := time.Now()
+	user := domain.User{ID: "test-user-1"}
+	passiveUser := domain.User{ID: "test-user-2"}
+	cs.create(10, user, passiveUser)
+	// the memory repository has no database
+	db, _ := cs.db.(*sqlx.DB)
+
+	errAbort := errors.New("abort")
+	tests := []struct {
+		name        string
+		fn          func(tx *repository.Tx) error
+		wantErr     error
+		wantBalance int
+		wantPassive int
+		wantEvents  int
+	}{
+		{
+			name: "commit",
+			fn: func(tx *repository.Tx) error {
+				if _, err := cs.repo.Deposit(ctx, tx, now, user, "test-tx-deposit", 100); err != nil {
+
+					return err
+				}
+				_, err := cs.repo.Transfer(ctx, tx, now, user, "test-tx-transfer", 30, passiveUser)
+
+				return err
+			},
+			wantBalance: 80,
+			wantPassive: 40,
+			wantEvents:  3,
+		},
+		{
+			name: "rollback on error",
+			fn: func(tx *repository.Tx) error {
+				if _, err := cs.repo.Deposit(ctx, tx, now, user, "test-tx-rollback", 100); err != nil {
+
+					return err
+				}
+
+				return errAbort
+			},
+			wantErr:     errAbort,
+			wantBalance: 80,
+			wantPassive: 40,
+			wantEvents:  3,
+		},
+		{
+			name: "rollback on write error",
+			fn: func(tx *repository.Tx) error {
+				if _, err := cs.repo.Transfer(ctx, tx, now, user, "test-tx-partial", 50, passiveUser); err != nil {
+
+					return err
+				}
+				_, err := cs.repo.Withdraw(ctx, tx, now, passiveUser, "test-tx-withdraw", 1000)
+
+				return err
+			},
+			wantErr:     domain.ErrNotEnoughBalance,
+			wantBalance: 80,
+			wantPassive: 40,
+			wantEvents:  3,
+		},
+	}
+
+	for _, tt := range tests {
+		cs.Run(tt.name, func() {
+			err := cs.repo.UnitOfWork(ctx, db, nil, tt.fn)
+			cs.ErrorIs(err, tt.wantErr)
+
+			cs.Equal(tt.wantBalance, cs.balance(user))
+			cs.Equal(tt.wantPassive, cs.balance(passiveUser))
+			events, err := cs.repo.GetEvents(ctx, cs.db, user, 0, 0)
+			cs.Require().NoError(err)
+			cs.Len(events, tt.wantEvents)
+		})
+	}
+
+	// a rolled back transactionID is not taken
+	_, err := cs.repo.Deposit(ctx, cs.db, now, user, "test-tx-rollback", 1)
+	cs.Require().NoError(err)
+	cs.Equal(81, cs.balance(user))
+}
+
+func (cs *ConformanceSuite) TestConcurrentWrites() {
+	ctx := context.Background()
+	now := time.Now()
+	user := domain.User{ID: "test-user-1"}
+	passiveUser := domain.User{ID: "test-user-2"}
+	cs.create(100, user, passiveUser)
+
+	// 20 withdraws of 10 from 100 and retries of one transfer, only 10 withdraws and 1 transfer apply
+	withdrawn := make(chan struct{}, 20)
+	wg := sync.WaitGroup{}
+	for i := 0; i < 20; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			_, err := cs.repo.Withdraw(ctx, cs.db, now, user, domain.TransactionID(fmt.Sprintf("test-tx-withdraw-%d", i)), 10)
+			if err == nil {
+				withdrawn <- struct{}{}
+			} else {
+				assert.ErrorIs(cs.T(), err, domain.ErrNotEnoughBalance)
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			_, err := cs.repo.Transfer(ctx, cs.db, now, passiveUser, "test-tx-transfer", 50, user)
+			assert.NoError(cs.T(), err)
+		}()
+	}
+	wg.Wait()
+	close(withdrawn)
+
+	count := 0
+	for range withdrawn {
+		count++
+	}
+	cs.Equal(150-10*count, cs.balance(user))
+	cs.GreaterOrEqual(count, 10)
+	cs.LessOrEqual(count, 15)
+	cs.Equal(50, cs.balance(passiveUser))
+}
@@ -2,11 +2,16 @@ package repository
 
 import (
 	"context"
+	"database/sql"
+	"errors"
+	"fmt"
 	"math"
+	"math/rand"
 	"net/http"
 	"time"
 
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 	"github.com/sappy5678/cryptocom/pkg/domain"
 
 	"github.com/labstack/echo"
@@ -20,18 +25,36 @@ func TimeToUTC(t time.Time) time.Time {
 }
 
 // User represents the client for user table
-type Wallet struct{}
+type Wallet struct {
+	// QueryTimeout is the default deadline of every call without one, so a slow query cannot hold its connection forever
+	// calls are not bounded when 0
+	QueryTimeout time.Duration
+}
+
+// withTimeout applies QueryTimeout unless ctx already has a deadline
+func (w *Wallet) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); ok || w.QueryTimeout <= 0 {
+
+		return ctx, func() {}
+	}
+
+	return context.WithTimeout(ctx, w.QueryTimeout)
+}
 
 // Custom errors
 var (
 	ErrAlreadyExists = echo.NewHTTPError(http.StatusInternalServerError, "Username or email already exists.")
+	ErrInvalidShards = errors.New("invalid shards")
 )
 
 const existsQuery = `SELECT EXISTS(SELECT 1 FROM UserWallet WHERE userID = $1)`
 
-func (w *Wallet) Exists(ctx context.Context, db *sqlx.DB, user domain.User) (bool, error) {
+func (w *Wallet) Exists(ctx context.Context, db sqlx.ExtContext, user domain.User) (bool, error) {
+	ctx, cancel := w.withTimeout(ctx)
+	defer cancel()
+
 	var exists bool
-	if err := db.GetContext(ctx, &exists, existsQuery, user.ID); err != nil {
+	if err := sqlx.GetContext(ctx, db, &exists, existsQuery, user.ID); err != nil {
 
 		return false, err
 	}
@@ -39,11 +62,15 @@ func (w *Wallet) Exists(ctx context.Context, db *sqlx.DB, user domain.User) (boo
 	return exists, nil
 }
 
-const existsTransactionIDQuery = `SELECT EXISTS(SELECT 1 FROM UserWalletTransaction WHERE transactionID = $1)`
+// existsTransactionIDQuery reads the transactionID keys, which outlive the archived transactions
+const existsTransactionIDQuery = `SELECT EXISTS(SELECT 1 FROM UserWalletTransactionKey WHERE transactionID = $1)`
+
+func (w *Wallet) ExistsTransactionID(ctx context.Context, db sqlx.ExtContext, transactionID domain.TransactionID) (bool, error) {
+	ctx, cancel := w.withTimeout(ctx)
+	defer cancel()
 
-func (w *Wallet) ExistsTransactionID(ctx context.Context, db *sqlx.DB, transactionID domain.TransactionID) (bool, error) {
 	var exists bool
-	if err := db.GetContext(ctx, &exists, existsTransactionIDQuery, transactionID.ID()); err != nil {
+	if err := sqlx.GetContext(ctx, db, &exists, existsTransactionIDQuery, transactionID.ID()); err != nil {
 
 		return false, err
 	}
@@ -51,283 +78,321 @@ func (w *Wallet) ExistsTransactionID(ctx context.Context, db *sqlx.DB, transacti
 	return exists, nil
 }
 
-const createWalletQuery = `INSERT INTO UserWallet (userID, balance) VALUES ($1, $2)`
+// createWalletQuery inserts the wallet and records its created event in one statement,
+// the insert does nothing and no row is returned when the wallet exists, even when a concurrent create commits first
+const createWalletQuery = `WITH inserted AS (
+	INSERT INTO UserWallet (userID, balance, displayName, asset, tags) VALUES ($1, 0, $2, $3, COALESCE($4::TEXT[], '{}'))
+	ON CONFLICT (userID) DO NOTHING
+	RETURNING ID, userID, balance, displayName, asset, tags
+), outbox AS (
+	INSERT INTO Outbox (aggregateID, eventType, payload, createdAt)
+	SELECT userID, $5, jsonb_build_object('wallet', jsonb_build_object('userID', userID, 'balance', balance)), $6
+	FROM inserted
+)
+SELECT ID, userID, balance, displayName, asset, tags FROM inserted`
+
+// walletRow is a UserWallet row, the tags array is scanned by pq
+type walletRow struct {
+	domain.Wallet
+	Tags pq.StringArray `db:"tags"`
+}
 
-// Create creates a new user on database
-func (w *Wallet) Create(ctx context.Context, db *sqlx.DB, user domain.User) (*domain.Wallet, error) {
-	wallet := domain.Wallet{
-		UserID:  user.ID,
-		Balance: 0,
+func (r *walletRow) wallet() *domain.Wallet {
+	wallet := r.Wallet
+	if len(r.Tags) > 0 {
+		wallet.Tags = r.Tags
 	}
 
-	if exists, err := w.Exists(ctx, db, user); err != nil {
+	return &wallet
+}
 
-		return nil, err
-	} else if exists {
-		wallet, err := w.Get(ctx, db, user)
+// Create creates the wallet of the user with metadata, it returns the existing wallet, metadata unchanged, if any
+// it is an upsert, so concurrent creates of one user all succeed and only one of them reports Created
+func (w *Wallet) Create(ctx context.Context, db sqlx.ExtContext, user domain.User, metadata domain.WalletMetadata) (*domain.Wallet, error) {
+	ctx, cancel := w.withTimeout(ctx)
+	defer cancel()
 
-		return wallet, err
+	if err := metadata.Validate(); err != nil {
+
+		return nil, err
 	}
 
-	if _, err := db.ExecContext(ctx, createWalletQuery, wallet.UserID, wallet.Balance); err != nil {
+	row := walletRow{}
+	err := sqlx.GetContext(ctx, db, &row, createWalletQuery, user.ID, metadata.DisplayName, metadata.Asset,
+		pq.StringArray(metadata.Tags), domain.EventTypeWalletCreated, TimeToUTC(time.Now()))
+	if errors.Is(err, sql.ErrNoRows) {
+
+		return w.Get(ctx, db, user)
+	}
+	if err != nil {
 
 		return nil, err
 	}
 
-	return &wallet, nil
-}
+	wallet := row.wallet()
+	wallet.Created = true
 
-const getWalletQuery = `SELECT ID, userID, balance FROM UserWallet WHERE userID = $1`
+	return wallet, nil
+}
 
-func (w *Wallet) Get(ctx context.Context, db *sqlx.DB, user domain.User) (*domain.Wallet, error) {
-	wallet := domain.Wallet{}
+// getWalletQuery sums the balance over the shards of a sharded wallet
+const getWalletQuery = `SELECT ID, userID, walletBalance(userID) AS balance, displayName, asset, tags FROM UserWallet WHERE userID = $1`
 
-	if exists, err := w.Exists(ctx, db, user); err != nil {
+func (w *Wallet) Get(ctx context.Context, db sqlx.ExtContext, user domain.User) (*domain.Wallet, error) {
+	ctx, cancel := w.withTimeout(ctx)
+	defer cancel()
 
-		return nil, err
-	} else if !exists {
+	row := walletRow{}
+	if err := sqlx.GetContext(ctx, db, &row, getWalletQuery, user.ID); errors.Is(err, sql.ErrNoRows) {
 
 		return nil, domain.ErrWalletNotFound
-	}
-
-	if err := db.GetContext(ctx, &wallet, getWalletQuery, user.ID); err != nil {
+	} else if err != nil {
 
 		return nil, err
 	}
 
-	return &wallet, nil
+	return row.wallet(), nil
 }
 
-const depositQuery = `UPDATE UserWallet SET balance = balance + $2 WHERE userID = $1 RETURNING userID, balance`
-const insertTransactionQuery = `INSERT INTO UserWalletTransaction (userID, transactionID, operationType, amount, passiveUserID, createdAt) VALUES ($1, $2, $3, $4, $5, $6)`
+// WalletEventsChannel is the LISTEN/NOTIFY channel, the payload is the userID whose wallet changed
+// the write functions of deploy/db/migrations notify it, postgres delivers the notification when the transaction commits
+const WalletEventsChannel = "wallet_events"
 
-func (w *Wallet) Deposit(ctx context.Context, db *sqlx.DB, now time.Time, user domain.User, transactionID domain.TransactionID, amount int) (*domain.Wallet, error) {
-	if amount <= 0 {
+// transactionIDConstraint is the unique constraint of UserWalletTransaction.transactionID,
+// the primary key of UserWalletTransactionKey since the table is partitioned
+const transactionIDConstraint = "userwallettransaction_transactionid_key"
 
-		return nil, domain.ErrInvalidAmount
-	}
+// postgres error codes handled by write and UnitOfWork
+const (
+	deadlockDetected     = "40P01"
+	serializationFailure = "40001"
+	uniqueViolation      = "23505"
+)
 
-	// idempotent
-	if exists, err := w.ExistsTransactionID(ctx, db, transactionID); err != nil {
+// write and UnitOfWork retry, doubling from minTxRetryBackoff, until maxTxAttempts
+const (
+	maxTxAttempts     = 5
+	minTxRetryBackoff = 10 * time.Millisecond
+)
 
-		return nil, err
-	} else if exists {
+// statuses of the write functions
+const (
+	writeStatusOK                    = "ok"
+	writeStatusReplayed              = "replayed"
+	writeStatusWalletNotFound        = "wallet_not_found"
+	writeStatusPassiveWalletNotFound = "passive_wallet_not_found"
+	writeStatusNotEnoughBalance      = "not_enough_balance"
+)
 
-		return w.Get(ctx, db, user)
-	}
+// writeResult is the row returned by the write functions
+type writeResult struct {
+	Status  string
+	UserID  string
+	Balance int
+}
 
-	now = TimeToUTC(now)
+func (r *writeResult) wallet() (*domain.Wallet, error) {
+	switch r.Status {
+	case writeStatusOK, writeStatusReplayed:
 
-	tx, err := db.BeginTxx(ctx, nil)
-	if err != nil {
+		return &domain.Wallet{UserID: r.UserID, Balance: r.Balance}, nil
+	case writeStatusWalletNotFound:
 
-		return nil, err
-	}
-	defer tx.Rollback()
+		return nil, domain.ErrWalletNotFound
+	case writeStatusPassiveWalletNotFound:
 
-	// update wallet balance and get the new balance
-	rows, err := tx.QueryxContext(ctx, depositQuery, user.ID, amount)
-	if err != nil {
+		return nil, domain.ErrPassiveWalletNotFound
+	case writeStatusNotEnoughBalance:
 
-		return nil, err
+		return nil, domain.ErrNotEnoughBalance
 	}
-	defer rows.Close()
 
-	var wallet domain.Wallet
-	if !rows.Next() {
+	return nil, fmt.Errorf("unknown write status %q", r.Status)
+}
 
-		return nil, domain.ErrWalletNotFound
-	}
-	if err := rows.StructScan(&wallet); err != nil {
+// txError classifies the error of a statement or a transaction, retry is true when postgres aborted it
+// on a deadlock or a serialization failure, replay is true when a concurrent request with the same transactionID committed first
+func txError(err error) (retry bool, replay bool) {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
 
-		return nil, err
+		return false, false
 	}
-	rows.Close()
 
-	// insert transaction
-	_, err = tx.ExecContext(ctx, insertTransactionQuery, user.ID, transactionID.ID(), domain.OperationTypeDeposit, amount, "", now)
-	if err != nil {
+	return pqErr.Code == deadlockDetected || pqErr.Code == serializationFailure,
+		pqErr.Code == uniqueViolation && pqErr.Constraint == transactionIDConstraint
+}
 
-		return nil, err
-	}
-	if err := tx.Commit(); err != nil {
+// waitBackoff waits about backoff, jitter keeps the retries from colliding again,
+// it returns false when ctx is done first
+func waitBackoff(ctx context.Context, backoff time.Duration) bool {
+	select {
+	case <-ctx.Done():
 
-		return nil, err
-	}
+		return false
+	case <-time.After(backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)))):
 
-	return &wallet, nil
+		return true
+	}
 }
 
-const withdrawQuery = `UPDATE UserWallet SET balance = balance - $2 WHERE userID = $1 AND balance >= $2 RETURNING userID, balance`
-
-func (w *Wallet) Withdraw(ctx context.Context, db *sqlx.DB, now time.Time, user domain.User, transactionID domain.TransactionID, amount int) (*domain.Wallet, error) {
-	// check condition
-	if amount <= 0 {
+// write runs one of the write functions, each checks, locks, updates the balances, journals the transaction,
+// records its events and notifies subscribers in one statement, so an operation is one round trip
+// the statement is retried with backoff when postgres aborts it on a deadlock or a serialization failure,
+// and it replays the wallet of user when a concurrent request with the same transactionID commits first
+// in the Tx of a UnitOfWork the failed statement aborts the transaction, so the error is returned for the unit to run again
+func (w *Wallet) write(ctx context.Context, db sqlx.ExtContext, user domain.User, query string, args ...interface{}) (*domain.Wallet, error) {
+	_, inTx := db.(*Tx)
+	backoff := minTxRetryBackoff
+	for attempt := 1; ; attempt++ {
+		result := writeResult{}
+		err := sqlx.GetContext(ctx, db, &result, query, args...)
+		if err == nil {
 
-		return nil, domain.ErrInvalidAmount
-	}
-	if exists, err := w.Exists(ctx, db, user); err != nil {
+			return result.wallet()
+		}
 
-		return nil, err
-	} else if !exists {
+		retry, replay := txError(err)
+		switch {
+		case inTx:
 
-		return nil, domain.ErrWalletNotFound
-	}
+			return nil, err
+		case replay:
 
-	// idempotent
-	if exists, err := w.ExistsTransactionID(ctx, db, transactionID); err != nil {
+			return w.Get(ctx, db, user)
+		case !retry, attempt == maxTxAttempts:
 
-		return nil, err
-	} else if exists {
+			return nil, err
+		}
+		if !waitBackoff(ctx, backoff) {
 
-		return w.Get(ctx, db, user)
+			return nil, err
+		}
+		backoff *= 2
 	}
+}
 
-	now = TimeToUTC(now)
+// UnitOfWork runs fn in one transaction begun with opts, committed when fn returns nil and rolled back otherwise,
+// so the repository calls fn makes with tx are atomic
+// the whole transaction runs again, up to maxTxAttempts, when postgres aborts it on a deadlock or a serialization
+// failure, or when a concurrent request commits one of its transactionIDs first, then the write replays it,
+// so fn must not have effects outside tx
+func (w *Wallet) UnitOfWork(ctx context.Context, db *sqlx.DB, opts *sql.TxOptions, fn func(tx *Tx) error) error {
 
-	// start transaction
-	tx, err := db.BeginTxx(ctx, nil)
-	if err != nil {
+	return unitOfWork(ctx, db, opts, txError, fn)
+}
 
-		return nil, err
-	}
-	defer tx.Rollback()
+// unitOfWork runs fn in one transaction, again while classify reports the error as retry or replay
+func unitOfWork(ctx context.Context, db *sqlx.DB, opts *sql.TxOptions, classify func(err error) (retry bool, replay bool),
+	fn func(tx *Tx) error) error {
+	backoff := minTxRetryBackoff
+	for attempt := 1; ; attempt++ {
+		err := runTx(ctx, db, opts, fn)
+		if err == nil {
 
-	// update wallet balance and get the new balance
-	rows, err := tx.QueryxContext(ctx, withdrawQuery, user.ID, amount)
-	if err != nil {
+			return nil
+		}
 
-		return nil, err
-	}
-	defer rows.Close()
-
-	var wallet domain.Wallet
-	if !rows.Next() {
+		retry, replay := classify(err)
+		if !retry && !replay || attempt == maxTxAttempts {
 
-		return nil, domain.ErrNotEnoughBalance
-	}
-	if err := rows.StructScan(&wallet); err != nil {
+			return err
+		}
+		if !waitBackoff(ctx, backoff) {
 
-		return nil, err
+			return err
+		}
+		backoff *= 2
 	}
-	rows.Close()
+}
 
-	// insert transaction
-	_, err = tx.ExecContext(ctx, insertTransactionQuery, user.ID, transactionID.ID(), domain.OperationTypeWithdraw, amount, "", now)
+func runTx(ctx context.Context, db *sqlx.DB, opts *sql.TxOptions, fn func(tx *Tx) error) error {
+	tx, err := db.BeginTxx(ctx, opts)
 	if err != nil {
 
-		return nil, err
+		return err
 	}
+	defer tx.Rollback()
 
-	if err := tx.Commit(); err != nil {
+	if err := fn(&Tx{ExtContext: tx}); err != nil {
 
-		return nil, err
+		return err
 	}
 
-	return &wallet, nil
+	return tx.Commit()
 }
 
-const transferQuery = `UPDATE UserWallet SET balance = balance - $2 WHERE userID = $1 AND balance >= $2 RETURNING userID, balance`
-const passiveTransferQuery = `UPDATE UserWallet SET balance = balance + $2 WHERE userID = $1`
+const depositQuery = `SELECT status, userID, balance FROM walletDeposit($1, $2, $3, $4, $5, $6)`
+
+func (w *Wallet) Deposit(ctx context.Context, db sqlx.ExtContext, now time.Time, user domain.User, transactionID domain.TransactionID, amount int) (*domain.Wallet, error) {
+	ctx, cancel := w.withTimeout(ctx)
+	defer cancel()
 
-func (w *Wallet) Transfer(ctx context.Context, db *sqlx.DB, now time.Time, user domain.User, transactionID domain.TransactionID, amount int, passiveUser domain.User) (*domain.Wallet, error) {
-	// check condition
 	if amount <= 0 {
 
 		return nil, domain.ErrInvalidAmount
 	}
-	if user.ID == passiveUser.ID {
-
-		return nil, domain.ErrTransferToSelf
-	}
-	if exists, err := w.Exists(ctx, db, user); err != nil {
 
-		return nil, err
-	} else if !exists {
-
-		return nil, domain.ErrWalletNotFound
-	}
-	if exists, err := w.Exists(ctx, db, passiveUser); err != nil {
-
-		return nil, err
-	} else if !exists {
-
-		return nil, domain.ErrWalletNotFound
-	}
-
-	// idempotent
-	if exists, err := w.ExistsTransactionID(ctx, db, transactionID); err != nil {
-
-		return nil, err
-	} else if exists {
+	return w.write(ctx, db, user, depositQuery, user.ID, transactionID.ID(), amount, TimeToUTC(now),
+		domain.OperationTypeDeposit, domain.OperationTypeDeposit.EventType())
+}
 
-		return w.Get(ctx, db, user)
-	}
+const withdrawQuery = `SELECT status, userID, balance FROM walletWithdraw($1, $2, $3, $4, $5, $6)`
 
-	now = TimeToUTC(now)
+func (w *Wallet) Withdraw(ctx context.Context, db sqlx.ExtContext, now time.Time, user domain.User, transactionID domain.TransactionID, amount int) (*domain.Wallet, error) {
+	ctx, cancel := w.withTimeout(ctx)
+	defer cancel()
 
-	// start transaction
-	tx, err := db.BeginTxx(ctx, nil)
-	if err != nil {
+	if amount <= 0 {
 
-		return nil, err
+		return nil, domain.ErrInvalidAmount
 	}
-	defer tx.Rollback()
-
-	// update wallet balance and get the new balance
-	rows, err := tx.QueryxContext(ctx, withdrawQuery, user.ID, amount)
-	if err != nil {
 
-		return nil, err
-	}
-	if !rows.Next() {
+	return w.write(ctx, db, user, withdrawQuery, user.ID, transactionID.ID(), amount, TimeToUTC(now),
+		domain.OperationTypeWithdraw, domain.OperationTypeWithdraw.EventType())
+}
 
-		return nil, domain.ErrNotEnoughBalance
-	}
-	var wallet domain.Wallet
-	if err := rows.StructScan(&wallet); err != nil {
+const transferQuery = `SELECT status, userID, balance FROM walletTransfer($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`
 
-		return nil, err
-	}
-	rows.Close()
+func (w *Wallet) Transfer(ctx context.Context, db sqlx.ExtContext, now time.Time, user domain.User, transactionID domain.TransactionID, amount int, passiveUser domain.User) (*domain.Wallet, error) {
+	ctx, cancel := w.withTimeout(ctx)
+	defer cancel()
 
-	// update passive wallet balance
-	affected, err := tx.ExecContext(ctx, passiveTransferQuery, passiveUser.ID, amount)
-	if err != nil {
+	if amount <= 0 {
 
-		return nil, err
+		return nil, domain.ErrInvalidAmount
 	}
-	if _, err := affected.RowsAffected(); err != nil {
+	if user.ID == passiveUser.ID {
 
-		return nil, err
+		return nil, domain.ErrTransferToSelf
 	}
 
-	// insert transaction
-	_, err = tx.ExecContext(ctx, insertTransactionQuery, user.ID, transactionID.ID(),
-		domain.OperationTypeTransferOut, amount, passiveUser.ID, now)
-	if err != nil {
+	return w.write(ctx, db, user, transferQuery, user.ID, passiveUser.ID, transactionID.ID(), transactionID.PassiveID(), amount, TimeToUTC(now),
+		domain.OperationTypeTransferOut, domain.OperationTypeTransferOut.EventType(),
+		domain.OperationTypeTransferIn, domain.OperationTypeTransferIn.EventType())
+}
 
-		return nil, err
-	}
+const setShardsQuery = `SELECT status, userID, balance FROM walletSetShards($1, $2)`
 
-	// insert passive transaction
-	_, err = tx.ExecContext(ctx, insertTransactionQuery, passiveUser.ID, transactionID.PassiveID(),
-		domain.OperationTypeTransferIn, amount, user.ID, now)
-	if err != nil {
+// SetShards spreads the credits of the wallet over shards sub-rows so a hot wallet does not serialize on its row,
+// 0 turns sharding off, the balances of removed shards move back to the wallet row
+func (w *Wallet) SetShards(ctx context.Context, db sqlx.ExtContext, user domain.User, shards int) (*domain.Wallet, error) {
+	ctx, cancel := w.withTimeout(ctx)
+	defer cancel()
 
-		return nil, err
-	}
-	if err := tx.Commit(); err != nil {
+	if shards < 0 {
 
-		return nil, err
+		return nil, ErrInvalidShards
 	}
 
-	return &wallet, nil
+	return w.write(ctx, db, user, setShardsQuery, user.ID, shards)
 }
 
-const getTransactionsQuery = `SELECT ID, userID, transactionID, operationType, amount, passiveUserID, createdAt FROM UserWalletTransaction WHERE userID=$1 AND createdAt <= $2 AND ID < $3 ORDER BY createdAt DESC LIMIT $4`
+const getTransactionsQuery = `SELECT ID, userID, transactionID, operationType, amount, passiveUserID, createdAt FROM UserWalletTransaction WHERE userID=$1 AND createdAt <= $2 AND ID < $3 ORDER BY createdAt DESC, ID DESC LIMIT $4`
 
-func (w *Wallet) GetTransactions(ctx context.Context, db *sqlx.DB, user domain.User, createdBefore time.Time, IDBefore int, limit int) ([]*domain.Transaction, error) {
+func (w *Wallet) GetTransactions(ctx context.Context, db sqlx.ExtContext, user domain.User, createdBefore time.Time, IDBefore int, limit int) ([]*domain.Transaction, error) {
+	ctx, cancel := w.withTimeout(ctx)
+	defer cancel()
 
 	// default values
 	if createdBefore.IsZero() {
@@ -353,7 +418,7 @@ func (w *Wallet) GetTransactions(ctx context.Context, db *sqlx.DB, user domain.U
 	}
 	transactions := []*domain.Transaction{}
 
-	if err := db.SelectContext(ctx, &transactions, getTransactionsQuery, user.ID, createdBefore,
+	if err := sqlx.SelectContext(ctx, db, &transactions, getTransactionsQuery, user.ID, createdBefore,
 		IDBefore, limit); err != nil {
 
 		return nil, err
@@ -366,3 +431,78 @@ func (w *Wallet) GetTransactions(ctx context.Context, db *sqlx.DB, user domain.U
 
 	return transactions, nil
 }
+
+// getEventsQuery returns the transactions after the given ID in commit order,
+// the balance after each transaction is derived from the current balance minus all later transactions,
+// it is correct because every transaction of the user takes its ID under the wallet event lock, see walletLockEvents
+const getEventsQuery = `SELECT ID, userID, transactionID, operationType, amount, passiveUserID, createdAt, balance FROM (
+	SELECT t.ID, t.userID, t.transactionID, t.operationType, t.amount, t.passiveUserID, t.createdAt,
+		walletBalance(w.userID) - COALESCE(SUM(CASE WHEN t.operationType IN (1, 3) THEN t.amount ELSE -t.amount END)
+			OVER (ORDER BY t.ID DESC ROWS BETWEEN UNBOUNDED PRECEDING AND 1 PRECEDING), 0) AS balance
+	FROM UserWalletTransaction t JOIN UserWallet w ON w.userID = t.userID
+	WHERE t.userID = $1 AND t.ID > $2
+) events ORDER BY ID ASC LIMIT $3`
+
+type eventRow struct {
+	domain.Transaction
+	Balance int `db:"balance"`
+}
+
+// GetEvents returns the wallet events of the user after IDAfter, oldest first
+func (w *Wallet) GetEvents(ctx context.Context, db sqlx.ExtContext, user domain.User, IDAfter int, limit int) ([]*domain.WalletEvent, error) {
+	ctx, cancel := w.withTimeout(ctx)
+	defer cancel()
+
+	if limit <= 0 {
+		limit = 100
+	}
+
+	if exists, err := w.Exists(ctx, db, user); err != nil {
+
+		return nil, err
+	} else if !exists {
+
+		return nil, domain.ErrWalletNotFound
+	}
+
+	rows := []*eventRow{}
+	if err := sqlx.SelectContext(ctx, db, &rows, getEventsQuery, user.ID, IDAfter, limit); err != nil {
+
+		return nil, err
+	}
+
+	events := make([]*domain.WalletEvent, 0, len(rows))
+	for _, row := range rows {
+		transaction := row.Transaction
+		transaction.CreatedAt = TimeToUTC(transaction.CreatedAt)
+		events = append(events, &domain.WalletEvent{
+			ID:          transaction.ID,
+			UserID:      transaction.UserID,
+			Balance:     row.Balance,
+			Transaction: &transaction,
+		})
+	}
+
+	return events, nil
+}
+
+// lastEventIDQuery returns 0 for a wallet without transactions and no row for a missing wallet
+const lastEventIDQuery = `SELECT COALESCE((SELECT MAX(t.ID) FROM UserWalletTransaction t WHERE t.userID = w.userID), 0)
+	FROM UserWallet w WHERE w.userID = $1`
+
+// LastEventID returns the ID of the latest wallet event of the user, 0 when it has none
+func (w *Wallet) LastEventID(ctx context.Context, db sqlx.ExtContext, user domain.User) (int, error) {
+	ctx, cancel := w.withTimeout(ctx)
+	defer cancel()
+
+	var ID int
+	if err := sqlx.GetContext(ctx, db, &ID, lastEventIDQuery, user.ID); errors.Is(err, sql.ErrNoRows) {
+
+		return 0, domain.ErrWalletNotFound
+	} else if err != nil {
+
+		return 0, err
+	}
+
+	return ID, nil
+}
@@ -2,7 +2,11 @@ package repository_test
 
 import (
 	"context"
+	"database/sql"
+	"errors"
+	"fmt"
 	"math"
+	"sync"
 	"testing"
 	"time"
 
@@ -19,20 +23,51 @@ import (
 	"github.com/stretchr/testify/suite"
 )
 
+// TestSuite runs on the embedded postgres of TestWalletSuite, or on a sqlite database of each test
+// in TestSQLiteSuite, tests of postgres only features skip sqlite
 type TestSuite struct {
 	suite.Suite
+	sqlite       bool
 	dbConnection *sqlx.DB
 	pgdb         *embeddedpostgres.EmbeddedPostgres
 	driver       database.Driver
 	migrate      *migrate.Migrate
 }
 
+// testRepository is a WalletRepository backend with the lookups the tests check
+type testRepository interface {
+	repository.WalletRepository
+	Exists(ctx context.Context, db sqlx.ExtContext, user domain.User) (bool, error)
+	ExistsTransactionID(ctx context.Context, db sqlx.ExtContext, transactionID domain.TransactionID) (bool, error)
+}
+
+// repo returns the repository of the backend of the suite with queryTimeout
+func (ts *TestSuite) repo(queryTimeout time.Duration) testRepository {
+	if ts.sqlite {
+
+		return &repository.SQLite{QueryTimeout: queryTimeout}
+	}
+
+	return &repository.Wallet{QueryTimeout: queryTimeout}
+}
+
+// requirePostgres skips the test on sqlite
+func (ts *TestSuite) requirePostgres() {
+	if ts.sqlite {
+		ts.T().Skip("postgres only")
+	}
+}
+
 func cleanTransaction(want *domain.Transaction) {
 	want.ID = 0
 	want.CreatedAt = repository.TimeToUTC(time.Time{})
 }
 
 func (ts *TestSuite) SetupSuite() {
+	if ts.sqlite {
+
+		return
+	}
 	ts.pgdb = embeddedpostgres.NewDatabase(embeddedpostgres.DefaultConfig().
 		Password("password").
 		Port(3000).Logger(nil))
@@ -52,15 +87,29 @@ func (ts *TestSuite) SetupSuite() {
 }
 
 func (ts *TestSuite) SetupTest() {
+	if ts.sqlite {
+		ts.dbConnection = newSQLite(ts.T())
+
+		return
+	}
 	assert.NoError(ts.T(), ts.migrate.Up())
 }
 
 func (ts *TestSuite) TearDownTest() {
+	if ts.sqlite {
+		assert.NoError(ts.T(), ts.dbConnection.Close())
+
+		return
+	}
 	assert.NoError(ts.T(), ts.migrate.Down())
 
 }
 
 func (ts *TestSuite) TearDownSuite() {
+	if ts.sqlite {
+
+		return
+	}
 	err1, err2 := ts.migrate.Close()
 	assert.NoError(ts.T(), err1)
 	assert.NoError(ts.T(), err2)
@@ -72,57 +121,140 @@ func (ts *TestSuite) TestCreate() {
 
 	db := ts.dbConnection
 
-	wallet := repository.Wallet{}
+	wallet := ts.repo(0)
 	ctx := context.Background()
 
+	metadata := domain.WalletMetadata{DisplayName: "Shop", Asset: "USD", Tags: []string{"merchant", "vip"}}
 	tests := []struct {
-		name    string
-		user    domain.User
-		want    *domain.Wallet
-		wantErr bool
+		name     string
+		user     domain.User
+		metadata domain.WalletMetadata
+		want     *domain.Wallet
+		wantErr  error
 	}{
 		{
-			name: "normal",
-			user: domain.User{ID: "test-user-1"},
+			name:     "normal",
+			user:     domain.User{ID: "test-user-1"},
+			metadata: metadata,
 			want: &domain.Wallet{
-				UserID:  "test-user-1",
-				Balance: 0,
+				UserID:         "test-user-1",
+				Balance:        0,
+				WalletMetadata: metadata,
+				Created:        true,
+			},
+		},
+		{
+			name:     "duplicate keeps the metadata",
+			user:     domain.User{ID: "test-user-1"},
+			metadata: domain.WalletMetadata{DisplayName: "Other"},
+			want: &domain.Wallet{
+				UserID:         "test-user-1",
+				Balance:        0,
+				WalletMetadata: metadata,
 			},
 		},
 		{
-			name: "duplicate",
-			user: domain.User{ID: "test-user-1"},
+			name: "no metadata",
+			user: domain.User{ID: "test-user-2"},
 			want: &domain.Wallet{
-				UserID:  "test-user-1",
+				UserID:  "test-user-2",
 				Balance: 0,
+				Created: true,
 			},
 		},
+		{
+			name:     "invalid metadata",
+			user:     domain.User{ID: "test-user-3"},
+			metadata: domain.WalletMetadata{Tags: []string{""}},
+			wantErr:  domain.ErrInvalidMetadata,
+		},
 	}
 
 	for _, tt := range tests {
 		ts.Run(tt.name, func() {
-			got, err := wallet.Create(ctx, db, tt.user)
-			if tt.wantErr {
-				assert.Error(ts.T(), err)
+			got, err := wallet.Create(ctx, db, tt.user, tt.metadata)
+			if tt.wantErr != nil {
+				assert.ErrorIs(ts.T(), err, tt.wantErr)
 
 				return
 			}
 			assert.NoError(ts.T(), err)
-			assert.Equal(ts.T(), tt.want.UserID, got.UserID)
-			assert.Equal(ts.T(), tt.want.Balance, got.Balance)
+			got.ID = 0
+			assert.Equal(ts.T(), tt.want, got)
 		})
 	}
+
+	got, err := wallet.Get(ctx, db, domain.User{ID: "test-user-1"})
+	assert.NoError(ts.T(), err)
+	assert.Equal(ts.T(), metadata, got.WalletMetadata)
+	assert.False(ts.T(), got.Created)
+}
+
+func (ts *TestSuite) TestConcurrentCreate() {
+	db := ts.dbConnection
+
+	wallet := ts.repo(0)
+	ctx := context.Background()
+
+	// concurrent creates of one user all return the wallet, only one of them creates it
+	user := domain.User{ID: "test-user-concurrent"}
+	created := make(chan bool, 10)
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			got, err := wallet.Create(ctx, db, user, domain.WalletMetadata{})
+			if assert.NoError(ts.T(), err) {
+				assert.Equal(ts.T(), user.ID, got.UserID)
+				created <- got.Created
+			}
+		}()
+	}
+	wg.Wait()
+	close(created)
+
+	count := 0
+	for c := range created {
+		if c {
+			count++
+		}
+	}
+	assert.Equal(ts.T(), 1, count)
+
+	if ts.sqlite {
+
+		return
+	}
+	var events int
+	assert.NoError(ts.T(), db.Get(&events, "SELECT COUNT(*) FROM Outbox WHERE aggregateID = $1 AND eventType = $2",
+		user.ID, domain.EventTypeWalletCreated))
+	assert.Equal(ts.T(), 1, events)
+}
+
+func (ts *TestSuite) TestQueryTimeout() {
+	db := ts.dbConnection
+
+	wallet := ts.repo(time.Nanosecond)
+	_, err := wallet.Create(context.Background(), db, domain.User{ID: "test-user-1"}, domain.WalletMetadata{})
+	assert.ErrorIs(ts.T(), err, context.DeadlineExceeded)
+
+	// the deadline of the caller wins
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	_, err = wallet.Create(ctx, db, domain.User{ID: "test-user-1"}, domain.WalletMetadata{})
+	assert.NoError(ts.T(), err)
 }
 
 func (ts *TestSuite) TestGet() {
 	db := ts.dbConnection
 
-	wallet := repository.Wallet{}
+	wallet := ts.repo(0)
 	ctx := context.Background()
 
 	// create a wallet for test
 	testUser := domain.User{ID: "test-user-2"}
-	_, err := wallet.Create(ctx, db, testUser)
+	_, err := wallet.Create(ctx, db, testUser, domain.WalletMetadata{})
 	assert.NoError(ts.T(), err)
 
 	tests := []struct {
@@ -164,12 +296,12 @@ func (ts *TestSuite) TestGet() {
 func (ts *TestSuite) TestDeposit() {
 	db := ts.dbConnection
 
-	wallet := repository.Wallet{}
+	wallet := ts.repo(0)
 	ctx := context.Background()
 
 	// create a wallet for test
 	testUser := domain.User{ID: "test-user-3"}
-	_, err := wallet.Create(ctx, db, testUser)
+	_, err := wallet.Create(ctx, db, testUser, domain.WalletMetadata{})
 	assert.NoError(ts.T(), err)
 
 	mockNow := time.Now().UTC().Round(time.Microsecond)
@@ -264,13 +396,13 @@ func (ts *TestSuite) TestDeposit() {
 func (ts *TestSuite) TestWithdraw() {
 	db := ts.dbConnection
 
-	wallet := repository.Wallet{}
+	wallet := ts.repo(0)
 	ctx := context.Background()
 	mockNow := time.Now().UTC().Round(time.Microsecond)
 
 	// create a wallet for test, and deposit 1000 for test
 	testUser := domain.User{ID: "test-user-4"}
-	_, err := wallet.Create(ctx, db, testUser)
+	_, err := wallet.Create(ctx, db, testUser, domain.WalletMetadata{})
 	assert.NoError(ts.T(), err)
 	_, err = wallet.Deposit(ctx, db, mockNow, testUser, "test-tx-0", 1000)
 	assert.NoError(ts.T(), err)
@@ -386,19 +518,19 @@ func (ts *TestSuite) TestWithdraw() {
 func (ts *TestSuite) TestTransfer() {
 	db := ts.dbConnection
 
-	wallet := repository.Wallet{}
+	wallet := ts.repo(0)
 	ctx := context.Background()
 	mockNow := repository.TimeToUTC(time.Now())
 
 	// create a wallet for test, and deposit 1000 for test
 	testUser := domain.User{ID: "test-user-5"}
-	_, err := wallet.Create(ctx, db, testUser)
+	_, err := wallet.Create(ctx, db, testUser, domain.WalletMetadata{})
 	assert.NoError(ts.T(), err)
 	_, err = wallet.Deposit(ctx, db, repository.TimeToUTC(mockNow), testUser, "test-tx-0", 1000)
 	assert.NoError(ts.T(), err)
 
 	passiveUser := domain.User{ID: "test-user-6"}
-	_, err = wallet.Create(ctx, db, passiveUser)
+	_, err = wallet.Create(ctx, db, passiveUser, domain.WalletMetadata{})
 	assert.NoError(ts.T(), err)
 
 	tests := []struct {
@@ -585,7 +717,7 @@ func (ts *TestSuite) TestTransfer() {
 			amount:        100,
 			transactionID: "test-tx-6",
 			passiveUser:   domain.User{ID: "non-exist"},
-			wantErr:       domain.ErrWalletNotFound,
+			wantErr:       domain.ErrPassiveWalletNotFound,
 		},
 		{
 			name:          "transfer from non-exist user",
@@ -638,11 +770,288 @@ func (ts *TestSuite) TestTransfer() {
 	}
 }
 
-func (ts *TestSuite) TestGetTransactions() {
+func (ts *TestSuite) TestConcurrentTransfer() {
+	db := ts.dbConnection
+
+	wallet := ts.repo(0)
+	ctx := context.Background()
+	now := repository.TimeToUTC(time.Now())
+
+	userA := domain.User{ID: "test-user-a"}
+	userB := domain.User{ID: "test-user-b"}
+	for _, user := range []domain.User{userA, userB} {
+		_, err := wallet.Create(ctx, db, user, domain.WalletMetadata{})
+		assert.NoError(ts.T(), err)
+		_, err = wallet.Deposit(ctx, db, now, user, domain.TransactionID("test-tx-deposit-"+user.ID), 1000)
+		assert.NoError(ts.T(), err)
+	}
+
+	// A to B and B to A at the same time would deadlock without the lock ordering
+	wg := sync.WaitGroup{}
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			from, to := userA, userB
+			if i%2 == 1 {
+				from, to = userB, userA
+			}
+			_, err := wallet.Transfer(ctx, db, now, from, domain.TransactionID(fmt.Sprintf("test-tx-transfer-%d", i)), 10, to)
+			assert.NoError(ts.T(), err)
+		}(i)
+	}
+	wg.Wait()
+
+	a, err := wallet.Get(ctx, db, userA)
+	assert.NoError(ts.T(), err)
+	b, err := wallet.Get(ctx, db, userB)
+	assert.NoError(ts.T(), err)
+	assert.Equal(ts.T(), 1000, a.Balance)
+	assert.Equal(ts.T(), 1000, b.Balance)
+}
+
+func (ts *TestSuite) TestConcurrentReplay() {
+	db := ts.dbConnection
+
+	wallet := ts.repo(0)
+	ctx := context.Background()
+	now := repository.TimeToUTC(time.Now())
+
+	user := domain.User{ID: "test-user-replay"}
+	_, err := wallet.Create(ctx, db, user, domain.WalletMetadata{})
+	assert.NoError(ts.T(), err)
+
+	// retries of one deposit racing past the transactionID check, only one is applied and the others replay it
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := wallet.Deposit(ctx, db, now, user, "test-tx-replay", 100)
+			assert.NoError(ts.T(), err)
+		}()
+	}
+	wg.Wait()
+
+	got, err := wallet.Get(ctx, db, user)
+	assert.NoError(ts.T(), err)
+	assert.Equal(ts.T(), 100, got.Balance)
+}
+
+func (ts *TestSuite) TestShards() {
+	ts.requirePostgres()
 	db := ts.dbConnection
 
 	wallet := repository.Wallet{}
 	ctx := context.Background()
+	now := repository.TimeToUTC(time.Now())
+
+	merchant := domain.User{ID: "test-user-merchant"}
+	_, err := wallet.Create(ctx, db, merchant, domain.WalletMetadata{})
+	assert.NoError(ts.T(), err)
+	_, err = wallet.Deposit(ctx, db, now, merchant, "test-tx-merchant-deposit", 100)
+	assert.NoError(ts.T(), err)
+
+	_, err = wallet.SetShards(ctx, db, merchant, -1)
+	assert.ErrorIs(ts.T(), err, repository.ErrInvalidShards)
+	_, err = wallet.SetShards(ctx, db, domain.User{ID: "test-user-not-exists"}, 4)
+	assert.ErrorIs(ts.T(), err, domain.ErrWalletNotFound)
+	got, err := wallet.SetShards(ctx, db, merchant, 4)
+	assert.NoError(ts.T(), err)
+	assert.Equal(ts.T(), 100, got.Balance)
+
+	// customers pay the merchant concurrently, the credits land on the shards
+	customers := []domain.User{}
+	for i := 0; i < 10; i++ {
+		customer := domain.User{ID: fmt.Sprintf("test-user-customer-%d", i)}
+		_, err := wallet.Create(ctx, db, customer, domain.WalletMetadata{})
+		assert.NoError(ts.T(), err)
+		_, err = wallet.Deposit(ctx, db, now, customer, domain.TransactionID("test-tx-deposit-"+customer.ID), 100)
+		assert.NoError(ts.T(), err)
+		customers = append(customers, customer)
+	}
+	wg := sync.WaitGroup{}
+	for i, customer := range customers {
+		wg.Add(2)
+		go func(i int, customer domain.User) {
+			defer wg.Done()
+			_, err := wallet.Transfer(ctx, db, now, customer, domain.TransactionID(fmt.Sprintf("test-tx-pay-%d", i)), 50, merchant)
+			assert.NoError(ts.T(), err)
+		}(i, customer)
+		go func(i int) {
+			defer wg.Done()
+			_, err := wallet.Deposit(ctx, db, now, merchant, domain.TransactionID(fmt.Sprintf("test-tx-merchant-%d", i)), 10)
+			assert.NoError(ts.T(), err)
+		}(i)
+	}
+	wg.Wait()
+
+	got, err = wallet.Get(ctx, db, merchant)
+	assert.NoError(ts.T(), err)
+	assert.Equal(ts.T(), 700, got.Balance)
+	var rowBalance int
+	assert.NoError(ts.T(), db.Get(&rowBalance, "SELECT balance FROM UserWallet WHERE userID = $1", merchant.ID))
+	assert.Equal(ts.T(), 100, rowBalance)
+
+	// debits borrow across the shards, concurrent withdraws never overdraw
+	wg = sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := wallet.Withdraw(ctx, db, now, merchant, domain.TransactionID(fmt.Sprintf("test-tx-merchant-withdraw-%d", i)), 100)
+			if err != nil {
+				assert.ErrorIs(ts.T(), err, domain.ErrNotEnoughBalance)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	got, err = wallet.Get(ctx, db, merchant)
+	assert.NoError(ts.T(), err)
+	assert.Equal(ts.T(), 0, got.Balance)
+	_, err = wallet.Transfer(ctx, db, now, merchant, "test-tx-merchant-transfer", 1, customers[0])
+	assert.ErrorIs(ts.T(), err, domain.ErrNotEnoughBalance)
+
+	// the events carry the balance summed over the shards
+	got, err = wallet.Deposit(ctx, db, now, merchant, "test-tx-merchant-last", 30)
+	assert.NoError(ts.T(), err)
+	assert.Equal(ts.T(), 30, got.Balance)
+	events, err := wallet.GetEvents(ctx, db, merchant, 0, 100)
+	assert.NoError(ts.T(), err)
+	assert.Equal(ts.T(), 30, events[len(events)-1].Balance)
+	var payloadBalance int
+	assert.NoError(ts.T(), db.Get(&payloadBalance,
+		"SELECT (payload->'wallet'->>'balance')::BIGINT FROM Outbox WHERE aggregateID = $1 ORDER BY ID DESC LIMIT 1", merchant.ID))
+	assert.Equal(ts.T(), 30, payloadBalance)
+
+	// turning sharding off folds the shards back into the wallet row
+	got, err = wallet.SetShards(ctx, db, merchant, 0)
+	assert.NoError(ts.T(), err)
+	assert.Equal(ts.T(), 30, got.Balance)
+	assert.NoError(ts.T(), db.Get(&rowBalance, "SELECT balance FROM UserWallet WHERE userID = $1", merchant.ID))
+	assert.Equal(ts.T(), 30, rowBalance)
+	var shardRows int
+	assert.NoError(ts.T(), db.Get(&shardRows, "SELECT COUNT(*) FROM UserWalletShard WHERE userID = $1", merchant.ID))
+	assert.Equal(ts.T(), 0, shardRows)
+}
+
+func (ts *TestSuite) TestUnitOfWork() {
+	db := ts.dbConnection
+
+	wallet := ts.repo(0)
+	ctx := context.Background()
+	now := repository.TimeToUTC(time.Now())
+
+	user := domain.User{ID: "test-user-uow"}
+	passiveUser := domain.User{ID: "test-user-uow-passive"}
+	for _, u := range []domain.User{user, passiveUser} {
+		_, err := wallet.Create(ctx, db, u, domain.WalletMetadata{})
+		assert.NoError(ts.T(), err)
+	}
+	_, err := wallet.Deposit(ctx, db, now, user, "test-tx-uow-committed", 10)
+	assert.NoError(ts.T(), err)
+
+	errAbort := errors.New("abort")
+	tests := []struct {
+		name            string
+		opts            *sql.TxOptions
+		fn              func(tx *repository.Tx) error
+		wantErr         error
+		wantBalance     int
+		wantPassive     int
+		wantTransaction domain.TransactionID
+		wantExists      bool
+	}{
+		{
+			name: "commit",
+			opts: &sql.TxOptions{Isolation: sql.LevelSerializable},
+			fn: func(tx *repository.Tx) error {
+				if _, err := wallet.Deposit(ctx, tx, now, user, "test-tx-uow-deposit", 100); err != nil {
+
+					return err
+				}
+				_, err := wallet.Transfer(ctx, tx, now, user, "test-tx-uow-transfer", 30, passiveUser)
+
+				return err
+			},
+			wantBalance:     80,
+			wantPassive:     30,
+			wantTransaction: "test-tx-uow-transfer",
+			wantExists:      true,
+		},
+		{
+			name: "rollback on error",
+			fn: func(tx *repository.Tx) error {
+				if _, err := wallet.Deposit(ctx, tx, now, user, "test-tx-uow-rollback", 100); err != nil {
+
+					return err
+				}
+
+				return errAbort
+			},
+			wantErr:         errAbort,
+			wantBalance:     80,
+			wantPassive:     30,
+			wantTransaction: "test-tx-uow-rollback",
+		},
+		{
+			name: "rollback on write error",
+			fn: func(tx *repository.Tx) error {
+				if _, err := wallet.Deposit(ctx, tx, now, user, "test-tx-uow-partial", 100); err != nil {
+
+					return err
+				}
+				_, err := wallet.Withdraw(ctx, tx, now, passiveUser, "test-tx-uow-withdraw", 1000)
+
+				return err
+			},
+			wantErr:         domain.ErrNotEnoughBalance,
+			wantBalance:     80,
+			wantPassive:     30,
+			wantTransaction: "test-tx-uow-partial",
+		},
+		{
+			name: "replay",
+			fn: func(tx *repository.Tx) error {
+				got, err := wallet.Deposit(ctx, tx, now, user, "test-tx-uow-committed", 10)
+				if err == nil && got.Balance != 80 {
+
+					return fmt.Errorf("replayed balance %d", got.Balance)
+				}
+
+				return err
+			},
+			wantBalance:     80,
+			wantPassive:     30,
+			wantTransaction: "test-tx-uow-committed",
+			wantExists:      true,
+		},
+	}
+
+	for _, tt := range tests {
+		ts.Run(tt.name, func() {
+			err := wallet.UnitOfWork(ctx, db, tt.opts, tt.fn)
+			assert.ErrorIs(ts.T(), err, tt.wantErr)
+
+			got, err := wallet.Get(ctx, db, user)
+			assert.NoError(ts.T(), err)
+			assert.Equal(ts.T(), tt.wantBalance, got.Balance)
+			got, err = wallet.Get(ctx, db, passiveUser)
+			assert.NoError(ts.T(), err)
+			assert.Equal(ts.T(), tt.wantPassive, got.Balance)
+			exists, err := wallet.ExistsTransactionID(ctx, db, tt.wantTransaction)
+			assert.NoError(ts.T(), err)
+			assert.Equal(ts.T(), tt.wantExists, exists)
+		})
+	}
+}
+
+func (ts *TestSuite) TestGetTransactions() {
+	db := ts.dbConnection
+
+	wallet := ts.repo(0)
+	ctx := context.Background()
 	mockNow := time.Now()
 	t1 := repository.TimeToUTC(mockNow.Add(-40 * time.Second))
 	t2 := repository.TimeToUTC(mockNow.Add(-30 * time.Second))
@@ -653,9 +1062,9 @@ func (ts *TestSuite) TestGetTransactions() {
 	// create a wallet for test, and create transactions
 	testUser := domain.User{ID: "test-user-7"}
 	testPassiveUser := domain.User{ID: "test-user-8"}
-	_, err := wallet.Create(ctx, db, testUser)
+	_, err := wallet.Create(ctx, db, testUser, domain.WalletMetadata{})
 	assert.NoError(ts.T(), err)
-	_, err = wallet.Create(ctx, db, testPassiveUser)
+	_, err = wallet.Create(ctx, db, testPassiveUser, domain.WalletMetadata{})
 	assert.NoError(ts.T(), err)
 	_, err = wallet.Deposit(ctx, db, t1, testUser, "test-tx-1", 1000)
 	assert.NoError(ts.T(), err)
@@ -817,12 +1226,12 @@ func (ts *TestSuite) TestGetTransactions() {
 func (ts *TestSuite) TestExistsTransactionID() {
 	db := ts.dbConnection
 
-	wallet := repository.Wallet{}
+	wallet := ts.repo(0)
 	ctx := context.Background()
 	mockNow := repository.TimeToUTC(time.Now())
 	// create a wallet for test, and create transactions
 	testUser := domain.User{ID: "test-user-9"}
-	_, err := wallet.Create(ctx, db, testUser)
+	_, err := wallet.Create(ctx, db, testUser, domain.WalletMetadata{})
 	assert.NoError(ts.T(), err)
 	_, err = wallet.Deposit(ctx, db, mockNow, testUser, "test-tx-1", 1000)
 	assert.NoError(ts.T(), err)
@@ -857,11 +1266,11 @@ func (ts *TestSuite) TestExistsTransactionID() {
 func (ts *TestSuite) TestExists() {
 	db := ts.dbConnection
 
-	wallet := repository.Wallet{}
+	wallet := ts.repo(0)
 	ctx := context.Background()
 	// create a wallet for test
 	testUser := domain.User{ID: "test-user-10"}
-	_, err := wallet.Create(ctx, db, testUser)
+	_, err := wallet.Create(ctx, db, testUser, domain.WalletMetadata{})
 	assert.NoError(ts.T(), err)
 
 	tests := []struct {
@@ -891,6 +1300,109 @@ func (ts *TestSuite) TestExists() {
 	}
 }
 
+func (ts *TestSuite) TestGetEvents() {
+	db := ts.dbConnection
+
+	wallet := ts.repo(0)
+	ctx := context.Background()
+	mockNow := repository.TimeToUTC(time.Now())
+
+	// create wallets for test, and make a few transactions
+	testUser := domain.User{ID: "test-user-11"}
+	_, err := wallet.Create(ctx, db, testUser, domain.WalletMetadata{})
+	assert.NoError(ts.T(), err)
+	passiveUser := domain.User{ID: "test-user-12"}
+	_, err = wallet.Create(ctx, db, passiveUser, domain.WalletMetadata{})
+	assert.NoError(ts.T(), err)
+	_, err = wallet.Deposit(ctx, db, mockNow, testUser, "test-tx-1", 100)
+	assert.NoError(ts.T(), err)
+	_, err = wallet.Withdraw(ctx, db, mockNow, testUser, "test-tx-2", 30)
+	assert.NoError(ts.T(), err)
+	_, err = wallet.Transfer(ctx, db, mockNow, testUser, "test-tx-3", 20, passiveUser)
+	assert.NoError(ts.T(), err)
+
+	all, err := wallet.GetEvents(ctx, db, testUser, 0, 100)
+	assert.NoError(ts.T(), err)
+	assert.Len(ts.T(), all, 3)
+
+	tests := []struct {
+		name        string
+		user        domain.User
+		IDAfter     int
+		limit       int
+		wantBalance []int
+		wantType    []domain.OperationType
+		wantErr     error
+	}{
+		{
+			name:        "all events",
+			user:        testUser,
+			wantBalance: []int{100, 70, 50},
+			wantType:    []domain.OperationType{domain.OperationTypeDeposit, domain.OperationTypeWithdraw, domain.OperationTypeTransferOut},
+		},
+		{
+			name:        "resume after first event",
+			user:        testUser,
+			IDAfter:     all[0].ID,
+			wantBalance: []int{70, 50},
+			wantType:    []domain.OperationType{domain.OperationTypeWithdraw, domain.OperationTypeTransferOut},
+		},
+		{
+			name:        "limit",
+			user:        testUser,
+			limit:       1,
+			wantBalance: []int{100},
+			wantType:    []domain.OperationType{domain.OperationTypeDeposit},
+		},
+		{
+			name:        "passive user",
+			user:        passiveUser,
+			wantBalance: []int{20},
+			wantType:    []domain.OperationType{domain.OperationTypeTransferIn},
+		},
+		{
+			name:    "non-exist user",
+			user:    domain.User{ID: "non-exist"},
+			wantErr: domain.ErrWalletNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		ts.Run(tt.name, func() {
+			got, err := wallet.GetEvents(ctx, db, tt.user, tt.IDAfter, tt.limit)
+			if tt.wantErr != nil {
+				assert.ErrorIs(ts.T(), err, tt.wantErr)
+
+				return
+			}
+			assert.NoError(ts.T(), err)
+			gotBalance := []int{}
+			gotType := []domain.OperationType{}
+			for _, event := range got {
+				assert.Equal(ts.T(), event.ID, event.Transaction.ID)
+				assert.Equal(ts.T(), tt.user.ID, event.UserID)
+				gotBalance = append(gotBalance, event.Balance)
+				gotType = append(gotType, event.Transaction.OperationType)
+			}
+			assert.Equal(ts.T(), tt.wantBalance, gotBalance)
+			assert.Equal(ts.T(), tt.wantType, gotType)
+		})
+	}
+}
+
+func (ts *TestSuite) TestConformance() {
+	// TestSQLiteConformance runs it on sqlite
+	ts.requirePostgres()
+	suite.Run(ts.T(), &ConformanceSuite{
+		newRepo: func() (repository.WalletRepository, sqlx.ExtContext) {
+			assert.NoError(ts.T(), ts.migrate.Down())
+			assert.NoError(ts.T(), ts.migrate.Up())
+
+			return &repository.Wallet{}, ts.dbConnection
+		},
+	})
+}
+
 func TestWalletSuite(t *testing.T) {
 	// I believe goleak is not working well with sqlx/db sql/db
 	// since they maintain their own connection pool, and cannot be closed by our code
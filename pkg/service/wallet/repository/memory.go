@@ -0,0 +1,365 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"math"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/sappy5678/cryptocom/pkg/domain"
+)
+
+// Memory is a WalletRepository kept in process memory, for development and demos without postgres
+// it has the semantics of Wallet, the executor argument of every method is ignored except the Tx of a UnitOfWork,
+// data is lost on exit
+type Memory struct {
+	// Notify, when set, is called with the userID of every wallet change, like the wallet_events notifications,
+	// it runs holding the repository lock so it must not block or call back into the repository
+	Notify func(userID string)
+
+	mu             sync.Mutex
+	wallets        map[string]*domain.Wallet
+	transactions   []*memoryTransaction
+	transactionIDs map[domain.TransactionID]struct{}
+
+	// unit is the Tx of the UnitOfWork holding mu, its calls do not lock again
+	unit atomic.Pointer[Tx]
+	// notified are the changes of unit, notified when it commits
+	notified []string
+}
+
+// memoryTransaction is a journaled transaction with the balance of its wallet after it
+type memoryTransaction struct {
+	domain.Transaction
+	balance int
+}
+
+// NewMemory creates new empty in-memory wallet repository
+func NewMemory() *Memory {
+
+	return &Memory{
+		wallets:        map[string]*domain.Wallet{},
+		transactionIDs: map[domain.TransactionID]struct{}{},
+	}
+}
+
+// lock locks the repository for a call with db and returns the unlock,
+// the calls of the running UnitOfWork already hold the lock
+func (m *Memory) lock(db sqlx.ExtContext) func() {
+	if tx, ok := db.(*Tx); ok && tx == m.unit.Load() {
+
+		return func() {}
+	}
+	m.mu.Lock()
+
+	return m.mu.Unlock
+}
+
+// notify notifies the changes of userIDs, the caller holds mu,
+// the changes of a UnitOfWork are notified when it commits
+func (m *Memory) notify(userIDs ...string) {
+	if m.unit.Load() != nil {
+		m.notified = append(m.notified, userIDs...)
+
+		return
+	}
+	if m.Notify == nil {
+
+		return
+	}
+	for _, userID := range userIDs {
+		m.Notify(userID)
+	}
+}
+
+// wallet returns a copy of the wallet of userID, the caller holds mu
+func (m *Memory) wallet(userID string) *domain.Wallet {
+	wallet := *m.wallets[userID]
+	wallet.Tags = append([]string(nil), wallet.Tags...)
+
+	return &wallet
+}
+
+// journal appends a transaction of the wallet, the caller holds mu
+func (m *Memory) journal(now time.Time, userID string, transactionID domain.TransactionID, operationType domain.OperationType, amount int, passiveUserID string) {
+	m.transactionIDs[transactionID] = struct{}{}
+	m.transactions = append(m.transactions, &memoryTransaction{
+		Transaction: domain.Transaction{
+			ID:            len(m.transactions) + 1,
+			TransactionID: transactionID,
+			UserID:        userID,
+			Amount:        amount,
+			OperationType: operationType,
+			PassiveUserID: passiveUserID,
+			CreatedAt:     TimeToUTC(now),
+		},
+		balance: m.wallets[userID].Balance,
+	})
+}
+
+// Create creates the wallet of the user with metadata, it returns the existing wallet, metadata unchanged, if any
+func (m *Memory) Create(ctx context.Context, db sqlx.ExtContext, user domain.User, metadata domain.WalletMetadata) (*domain.Wallet, error) {
+	if err := metadata.Validate(); err != nil {
+
+		return nil, err
+	}
+
+	defer m.lock(db)()
+
+	if _, ok := m.wallets[user.ID]; ok {
+
+		return m.wallet(user.ID), nil
+	}
+
+	metadata.Tags = append([]string(nil), metadata.Tags...)
+	m.wallets[user.ID] = &domain.Wallet{
+		ID:             len(m.wallets) + 1,
+		UserID:         user.ID,
+		WalletMetadata: metadata,
+	}
+	wallet := m.wallet(user.ID)
+	wallet.Created = true
+
+	return wallet, nil
+}
+
+func (m *Memory) Get(ctx context.Context, db sqlx.ExtContext, user domain.User) (*domain.Wallet, error) {
+	defer m.lock(db)()
+
+	if _, ok := m.wallets[user.ID]; !ok {
+
+		return nil, domain.ErrWalletNotFound
+	}
+
+	return m.wallet(user.ID), nil
+}
+
+func (m *Memory) Deposit(ctx context.Context, db sqlx.ExtContext, now time.Time, user domain.User, transactionID domain.TransactionID, amount int) (*domain.Wallet, error) {
+	if amount <= 0 {
+
+		return nil, domain.ErrInvalidAmount
+	}
+
+	defer m.lock(db)()
+
+	wallet, ok := m.wallets[user.ID]
+	if !ok {
+
+		return nil, domain.ErrWalletNotFound
+	}
+	if _, ok := m.transactionIDs[transactionID]; ok {
+
+		return m.wallet(user.ID), nil
+	}
+
+	wallet.Balance += amount
+	m.journal(now, user.ID, transactionID, domain.OperationTypeDeposit, amount, "")
+	m.notify(user.ID)
+
+	return m.wallet(user.ID), nil
+}
+
+func (m *Memory) Withdraw(ctx context.Context, db sqlx.ExtContext, now time.Time, user domain.User, transactionID domain.TransactionID, amount int) (*domain.Wallet, error) {
+	if amount <= 0 {
+
+		return nil, domain.ErrInvalidAmount
+	}
+
+	defer m.lock(db)()
+
+	wallet, ok := m.wallets[user.ID]
+	if !ok {
+
+		return nil, domain.ErrWalletNotFound
+	}
+	if _, ok := m.transactionIDs[transactionID]; ok {
+
+		return m.wallet(user.ID), nil
+	}
+	if wallet.Balance < amount {
+
+		return nil, domain.ErrNotEnoughBalance
+	}
+
+	wallet.Balance -= amount
+	m.journal(now, user.ID, transactionID, domain.OperationTypeWithdraw, amount, "")
+	m.notify(user.ID)
+
+	return m.wallet(user.ID), nil
+}
+
+func (m *Memory) Transfer(ctx context.Context, db sqlx.ExtContext, now time.Time, user domain.User, transactionID domain.TransactionID, amount int, passiveUser domain.User) (*domain.Wallet, error) {
+	if amount <= 0 {
+
+		return nil, domain.ErrInvalidAmount
+	}
+	if user.ID == passiveUser.ID {
+
+		return nil, domain.ErrTransferToSelf
+	}
+
+	defer m.lock(db)()
+
+	wallet, ok := m.wallets[user.ID]
+	if !ok {
+
+		return nil, domain.ErrWalletNotFound
+	}
+	passiveWallet, ok := m.wallets[passiveUser.ID]
+	if !ok {
+
+		return nil, domain.ErrPassiveWalletNotFound
+	}
+	if _, ok := m.transactionIDs[transactionID]; ok {
+
+		return m.wallet(user.ID), nil
+	}
+	if wallet.Balance < amount {
+
+		return nil, domain.ErrNotEnoughBalance
+	}
+
+	wallet.Balance -= amount
+	passiveWallet.Balance += amount
+	m.journal(now, user.ID, transactionID, domain.OperationTypeTransferOut, amount, passiveUser.ID)
+	m.journal(now, passiveUser.ID, domain.TransactionID(transactionID.PassiveID()), domain.OperationTypeTransferIn, amount, user.ID)
+	m.notify(user.ID, passiveUser.ID)
+
+	return m.wallet(user.ID), nil
+}
+
+// GetTransactions returns the transactions of the user created at or before createdBefore with ID below IDBefore,
+// newest first, in the order of getTransactionsQuery
+func (m *Memory) GetTransactions(ctx context.Context, db sqlx.ExtContext, user domain.User, createdBefore time.Time, IDBefore int, limit int) ([]*domain.Transaction, error) {
+	if createdBefore.IsZero() {
+		createdBefore = time.Now()
+	}
+	createdBefore = TimeToUTC(createdBefore)
+	if IDBefore == 0 {
+		IDBefore = math.MaxInt64
+	}
+	if limit <= 0 {
+		limit = 100
+	}
+
+	defer m.lock(db)()
+
+	if _, ok := m.wallets[user.ID]; !ok {
+
+		return nil, domain.ErrWalletNotFound
+	}
+
+	transactions := []*domain.Transaction{}
+	for _, t := range m.transactions {
+		if t.UserID == user.ID && !t.CreatedAt.After(createdBefore) && t.ID < IDBefore {
+			transaction := t.Transaction
+			transactions = append(transactions, &transaction)
+		}
+	}
+	sort.Slice(transactions, func(i, j int) bool {
+		if !transactions[i].CreatedAt.Equal(transactions[j].CreatedAt) {
+
+			return transactions[i].CreatedAt.After(transactions[j].CreatedAt)
+		}
+
+		return transactions[i].ID > transactions[j].ID
+	})
+	if len(transactions) > limit {
+		transactions = transactions[:limit]
+	}
+
+	return transactions, nil
+}
+
+// GetEvents returns the wallet events of the user after IDAfter, oldest first
+func (m *Memory) GetEvents(ctx context.Context, db sqlx.ExtContext, user domain.User, IDAfter int, limit int) ([]*domain.WalletEvent, error) {
+	if limit <= 0 {
+		limit = 100
+	}
+
+	defer m.lock(db)()
+
+	if _, ok := m.wallets[user.ID]; !ok {
+
+		return nil, domain.ErrWalletNotFound
+	}
+
+	events := []*domain.WalletEvent{}
+	for _, t := range m.transactions {
+		if len(events) == limit {
+			break
+		}
+		if t.UserID != user.ID || t.ID <= IDAfter {
+			continue
+		}
+		transaction := t.Transaction
+		events = append(events, &domain.WalletEvent{
+			ID:          transaction.ID,
+			UserID:      transaction.UserID,
+			Balance:     t.balance,
+			Transaction: &transaction,
+		})
+	}
+
+	return events, nil
+}
+
+// LastEventID returns the ID of the latest wallet event of the user, 0 when it has none
+func (m *Memory) LastEventID(ctx context.Context, db sqlx.ExtContext, user domain.User) (int, error) {
+	defer m.lock(db)()
+
+	if _, ok := m.wallets[user.ID]; !ok {
+
+		return 0, domain.ErrWalletNotFound
+	}
+
+	ID := 0
+	for _, t := range m.transactions {
+		if t.UserID == user.ID {
+			ID = t.ID
+		}
+	}
+
+	return ID, nil
+}
+
+// UnitOfWork runs fn holding the repository lock, so its calls are isolated from the others,
+// the wallets and transactions are restored when fn returns an error, opts are ignored,
+// the Tx given to fn has no executor, it is only passed to the calls of the repository
+func (m *Memory) UnitOfWork(ctx context.Context, _ *sqlx.DB, _ *sql.TxOptions, fn func(tx *Tx) error) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	wallets := make(map[string]*domain.Wallet, len(m.wallets))
+	for userID, wallet := range m.wallets {
+		wallet := *wallet
+		wallets[userID] = &wallet
+	}
+	journaled := len(m.transactions)
+
+	err := func() error {
+		tx := &Tx{}
+		m.unit.Store(tx)
+		defer m.unit.Store(nil)
+
+		return fn(tx)
+	}()
+	notified := m.notified
+	m.notified = nil
+	if err != nil {
+		for _, t := range m.transactions[journaled:] {
+			delete(m.transactionIDs, t.TransactionID)
+		}
+		m.transactions = m.transactions[:journaled]
+		m.wallets = wallets
+
+		return err
+	}
+	m.notify(notified...)
+
+	return nil
+}
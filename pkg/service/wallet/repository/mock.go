@@ -2,6 +2,7 @@ package repository
 
 import (
 	"context"
+	"database/sql"
 	"time"
 
 	"github.com/jmoiron/sqlx"
@@ -9,40 +10,58 @@ import (
 )
 
 type MockWalletRepository struct {
-	CreateFunc          func(ctx context.Context, db *sqlx.DB, user domain.User) (*domain.Wallet, error)
-	GetFunc             func(ctx context.Context, db *sqlx.DB, user domain.User) (*domain.Wallet, error)
-	WithdrawFunc        func(ctx context.Context, db *sqlx.DB, time time.Time, user domain.User, transactionID domain.TransactionID, amount int) (*domain.Wallet, error)
-	DepositFunc         func(ctx context.Context, db *sqlx.DB, time time.Time, user domain.User, transactionID domain.TransactionID, amount int) (*domain.Wallet, error)
-	GetTransactionsFunc func(ctx context.Context, db *sqlx.DB, user domain.User, createdBefore time.Time, IDBefore int, limit int) ([]*domain.Transaction, error)
-	TransferFunc        func(ctx context.Context, db *sqlx.DB, time time.Time, user domain.User, transactionID domain.TransactionID, amount int, passiveUser domain.User) (*domain.Wallet, error)
+	CreateFunc          func(ctx context.Context, db sqlx.ExtContext, user domain.User, metadata domain.WalletMetadata) (*domain.Wallet, error)
+	GetFunc             func(ctx context.Context, db sqlx.ExtContext, user domain.User) (*domain.Wallet, error)
+	WithdrawFunc        func(ctx context.Context, db sqlx.ExtContext, time time.Time, user domain.User, transactionID domain.TransactionID, amount int) (*domain.Wallet, error)
+	DepositFunc         func(ctx context.Context, db sqlx.ExtContext, time time.Time, user domain.User, transactionID domain.TransactionID, amount int) (*domain.Wallet, error)
+	GetTransactionsFunc func(ctx context.Context, db sqlx.ExtContext, user domain.User, createdBefore time.Time, IDBefore int, limit int) ([]*domain.Transaction, error)
+	TransferFunc        func(ctx context.Context, db sqlx.ExtContext, time time.Time, user domain.User, transactionID domain.TransactionID, amount int, passiveUser domain.User) (*domain.Wallet, error)
+	GetEventsFunc       func(ctx context.Context, db sqlx.ExtContext, user domain.User, IDAfter int, limit int) ([]*domain.WalletEvent, error)
+	LastEventIDFunc     func(ctx context.Context, db sqlx.ExtContext, user domain.User) (int, error)
+	UnitOfWorkFunc      func(ctx context.Context, db *sqlx.DB, opts *sql.TxOptions, fn func(tx *Tx) error) error
 }
 
-func (m *MockWalletRepository) Create(ctx context.Context, db *sqlx.DB, user domain.User) (*domain.Wallet, error) {
+func (m *MockWalletRepository) Create(ctx context.Context, db sqlx.ExtContext, user domain.User, metadata domain.WalletMetadata) (*domain.Wallet, error) {
 
-	return m.CreateFunc(ctx, db, user)
+	return m.CreateFunc(ctx, db, user, metadata)
 }
 
-func (m *MockWalletRepository) Get(ctx context.Context, db *sqlx.DB, user domain.User) (*domain.Wallet, error) {
+func (m *MockWalletRepository) Get(ctx context.Context, db sqlx.ExtContext, user domain.User) (*domain.Wallet, error) {
 
 	return m.GetFunc(ctx, db, user)
 }
 
-func (m *MockWalletRepository) Withdraw(ctx context.Context, db *sqlx.DB, time time.Time, user domain.User, transactionID domain.TransactionID, amount int) (*domain.Wallet, error) {
+func (m *MockWalletRepository) Withdraw(ctx context.Context, db sqlx.ExtContext, time time.Time, user domain.User, transactionID domain.TransactionID, amount int) (*domain.Wallet, error) {
 
 	return m.WithdrawFunc(ctx, db, time, user, transactionID, amount)
 }
 
-func (m *MockWalletRepository) Deposit(ctx context.Context, db *sqlx.DB, time time.Time, user domain.User, transactionID domain.TransactionID, amount int) (*domain.Wallet, error) {
+func (m *MockWalletRepository) Deposit(ctx context.Context, db sqlx.ExtContext, time time.Time, user domain.User, transactionID domain.TransactionID, amount int) (*domain.Wallet, error) {
 
 	return m.DepositFunc(ctx, db, time, user, transactionID, amount)
 }
 
-func (m *MockWalletRepository) GetTransactions(ctx context.Context, db *sqlx.DB, user domain.User, createdBefore time.Time, IDBefore int, limit int) ([]*domain.Transaction, error) {
+func (m *MockWalletRepository) GetTransactions(ctx context.Context, db sqlx.ExtContext, user domain.User, createdBefore time.Time, IDBefore int, limit int) ([]*domain.Transaction, error) {
 
 	return m.GetTransactionsFunc(ctx, db, user, createdBefore, IDBefore, limit)
 }
 
-func (m *MockWalletRepository) Transfer(ctx context.Context, db *sqlx.DB, time time.Time, user domain.User, transactionID domain.TransactionID, amount int, passiveUser domain.User) (*domain.Wallet, error) {
+func (m *MockWalletRepository) Transfer(ctx context.Context, db sqlx.ExtContext, time time.Time, user domain.User, transactionID domain.TransactionID, amount int, passiveUser domain.User) (*domain.Wallet, error) {
 
 	return m.TransferFunc(ctx, db, time, user, transactionID, amount, passiveUser)
 }
+
+func (m *MockWalletRepository) GetEvents(ctx context.Context, db sqlx.ExtContext, user domain.User, IDAfter int, limit int) ([]*domain.WalletEvent, error) {
+
+	return m.GetEventsFunc(ctx, db, user, IDAfter, limit)
+}
+
+func (m *MockWalletRepository) LastEventID(ctx context.Context, db sqlx.ExtContext, user domain.User) (int, error) {
+
+	return m.LastEventIDFunc(ctx, db, user)
+}
+
+func (m *MockWalletRepository) UnitOfWork(ctx context.Context, db *sqlx.DB, opts *sql.TxOptions, fn func(tx *Tx) error) error {
+
+	return m.UnitOfWorkFunc(ctx, db, opts, fn)
+}
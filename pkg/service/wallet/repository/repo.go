@@ -2,6 +2,7 @@ package repository
 
 import (
 	"context"
+	"database/sql"
 	"time"
 
 	"github.com/jmoiron/sqlx"
@@ -10,10 +11,25 @@ import (
 
 // WalletRepository represents wallet repository interface
 type WalletRepository interface {
-	Create(ctx context.Context, db *sqlx.DB, user domain.User) (*domain.Wallet, error)
-	Get(ctx context.Context, db *sqlx.DB, user domain.User) (*domain.Wallet, error)
-	Withdraw(ctx context.Context, db *sqlx.DB, now time.Time, user domain.User, transactionID domain.TransactionID, amount int) (*domain.Wallet, error)
-	Deposit(ctx context.Context, db *sqlx.DB, now time.Time, user domain.User, transactionID domain.TransactionID, amount int) (*domain.Wallet, error)
-	GetTransactions(ctx context.Context, db *sqlx.DB, user domain.User, createdBefore time.Time, IDBefore int, limit int) ([]*domain.Transaction, error)
-	Transfer(ctx context.Context, db *sqlx.DB, now time.Time, user domain.User, transactionID domain.TransactionID, amount int, passiveUser domain.User) (*domain.Wallet, error)
+	Create(ctx context.Context, db sqlx.ExtContext, user domain.User, metadata domain.WalletMetadata) (*domain.Wallet, error)
+	Get(ctx context.Context, db sqlx.ExtContext, user domain.User) (*domain.Wallet, error)
+	Withdraw(ctx context.Context, db sqlx.ExtContext, now time.Time, user domain.User, transactionID domain.TransactionID, amount int) (*domain.Wallet, error)
+	Deposit(ctx context.Context, db sqlx.ExtContext, now time.Time, user domain.User, transactionID domain.TransactionID, amount int) (*domain.Wallet, error)
+	GetTransactions(ctx context.Context, db sqlx.ExtContext, user domain.User, createdBefore time.Time, IDBefore int, limit int) ([]*domain.Transaction, error)
+	Transfer(ctx context.Context, db sqlx.ExtContext, now time.Time, user domain.User, transactionID domain.TransactionID, amount int, passiveUser domain.User) (*domain.Wallet, error)
+	GetEvents(ctx context.Context, db sqlx.ExtContext, user domain.User, IDAfter int, limit int) ([]*domain.WalletEvent, error)
+	LastEventID(ctx context.Context, db sqlx.ExtContext, user domain.User) (int, error)
+	UnitOfWork(ctx context.Context, db *sqlx.DB, opts *sql.TxOptions, fn func(tx *Tx) error) error
 }
+
+// Tx is the executor UnitOfWork gives fn, the calls of the repository given it run in the transaction of the unit,
+// they do not begin their own nor retry, the unit does
+type Tx struct {
+	sqlx.ExtContext
+}
+
+var (
+	_ WalletRepository = (*Wallet)(nil)
+	_ WalletRepository = (*SQLite)(nil)
+	_ WalletRepository = (*Memory)(nil)
+)
@@ -0,0 +1,497 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/mattn/go-sqlite3"
+	"github.com/sappy5678/cryptocom/pkg/domain"
+)
+
+// SQLite is a WalletRepository on a sqlite database opened by pkg/utl/sqlite, for small deployments and edge installs,
+// the schema is deploy/db/sqlite/migrations, it has no outbox and no sharded balances
+//
+// sqlite has a single writer, every write runs in a transaction begun with BEGIN IMMEDIATE, so it holds the database
+// lock from its checks to its updates, and the balanceNonnegative constraint backs the balance checks
+// the queries alias their columns in lower case, sqlite names them as declared and sqlx maps lower case names
+type SQLite struct {
+	// QueryTimeout is the default deadline of every call without one, calls are not bounded when 0
+	QueryTimeout time.Duration
+
+	// Notify, when set, is called with the userID of every wallet change after its transaction commits,
+	// like the wallet_events notifications, writes inside a UnitOfWork are not notified,
+	// subscribers poll them
+	Notify func(userID string)
+}
+
+// withTimeout applies QueryTimeout unless ctx already has a deadline
+func (s *SQLite) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); ok || s.QueryTimeout <= 0 {
+
+		return ctx, func() {}
+	}
+
+	return context.WithTimeout(ctx, s.QueryTimeout)
+}
+
+// sqliteTags is the tags column, a JSON array of strings
+type sqliteTags []string
+
+func (t sqliteTags) Value() (driver.Value, error) {
+	if t == nil {
+
+		return "[]", nil
+	}
+	b, err := json.Marshal([]string(t))
+
+	return string(b), err
+}
+
+func (t *sqliteTags) Scan(src interface{}) error {
+	switch src := src.(type) {
+	case string:
+
+		return json.Unmarshal([]byte(src), (*[]string)(t))
+	case []byte:
+
+		return json.Unmarshal(src, (*[]string)(t))
+	}
+
+	return fmt.Errorf("unsupported tags %T", src)
+}
+
+// sqliteWalletRow is a UserWallet row, the tags array is decoded from JSON
+type sqliteWalletRow struct {
+	domain.Wallet
+	Tags sqliteTags `db:"tags"`
+}
+
+func (r *sqliteWalletRow) wallet() *domain.Wallet {
+	wallet := r.Wallet
+	if len(r.Tags) > 0 {
+		wallet.Tags = r.Tags
+	}
+
+	return &wallet
+}
+
+const sqliteExistsQuery = `SELECT EXISTS(SELECT 1 FROM UserWallet WHERE userID = ?)`
+
+func (s *SQLite) Exists(ctx context.Context, db sqlx.ExtContext, user domain.User) (bool, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	var exists bool
+	if err := sqlx.GetContext(ctx, db, &exists, sqliteExistsQuery, user.ID); err != nil {
+
+		return false, err
+	}
+
+	return exists, nil
+}
+
+const sqliteExistsTransactionIDQuery = `SELECT EXISTS(SELECT 1 FROM UserWalletTransaction WHERE transactionID = ?)`
+
+func (s *SQLite) ExistsTransactionID(ctx context.Context, db sqlx.ExtContext, transactionID domain.TransactionID) (bool, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	var exists bool
+	if err := sqlx.GetContext(ctx, db, &exists, sqliteExistsTransactionIDQuery, transactionID.ID()); err != nil {
+
+		return false, err
+	}
+
+	return exists, nil
+}
+
+// sqliteCreateWalletQuery inserts the wallet, no row is returned when the wallet exists
+const sqliteCreateWalletQuery = `INSERT INTO UserWallet (userID, balance, displayName, asset, tags) VALUES (?, 0, ?, ?, ?)
+	ON CONFLICT (userID) DO NOTHING
+	RETURNING ID AS id, userID AS userid, balance, displayName AS displayname, asset, tags`
+
+// Create creates the wallet of the user with metadata, it returns the existing wallet, metadata unchanged, if any
+func (s *SQLite) Create(ctx context.Context, db sqlx.ExtContext, user domain.User, metadata domain.WalletMetadata) (*domain.Wallet, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	if err := metadata.Validate(); err != nil {
+
+		return nil, err
+	}
+
+	row := sqliteWalletRow{}
+	err := sqlx.GetContext(ctx, db, &row, sqliteCreateWalletQuery, user.ID, metadata.DisplayName, metadata.Asset,
+		sqliteTags(metadata.Tags))
+	if errors.Is(err, sql.ErrNoRows) {
+
+		return s.Get(ctx, db, user)
+	}
+	if err != nil {
+
+		return nil, err
+	}
+
+	wallet := row.wallet()
+	wallet.Created = true
+
+	return wallet, nil
+}
+
+const sqliteGetWalletQuery = `SELECT ID AS id, userID AS userid, balance, displayName AS displayname, asset, tags FROM UserWallet WHERE userID = ?`
+
+func (s *SQLite) Get(ctx context.Context, db sqlx.ExtContext, user domain.User) (*domain.Wallet, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	row := sqliteWalletRow{}
+	if err := sqlx.GetContext(ctx, db, &row, sqliteGetWalletQuery, user.ID); errors.Is(err, sql.ErrNoRows) {
+
+		return nil, domain.ErrWalletNotFound
+	} else if err != nil {
+
+		return nil, err
+	}
+
+	return row.wallet(), nil
+}
+
+// write runs fn in its own transaction, retried while the database is busy, and notifies the users whose wallets
+// fn changed after the commit, or in the transaction of the caller when db is the Tx of a UnitOfWork
+func (s *SQLite) write(ctx context.Context, db sqlx.ExtContext, fn func(tx sqlx.ExtContext) (*domain.Wallet, []string, error)) (*domain.Wallet, error) {
+	var pool *sqlx.DB
+	switch db := db.(type) {
+	case *Tx:
+		wallet, _, err := fn(db)
+
+		return wallet, err
+	case *sqlx.DB:
+		pool = db
+	default:
+
+		return nil, fmt.Errorf("sqlite writes run on a *sqlx.DB or the Tx of a UnitOfWork, not %T", db)
+	}
+
+	var wallet *domain.Wallet
+	var changed []string
+	err := unitOfWork(ctx, pool, nil, sqliteTxError, func(tx *Tx) error {
+		var err error
+		wallet, changed, err = fn(tx)
+
+		return err
+	})
+	if err != nil {
+
+		return nil, err
+	}
+	if s.Notify != nil {
+		for _, userID := range changed {
+			s.Notify(userID)
+		}
+	}
+
+	return wallet, nil
+}
+
+// UnitOfWork runs fn in one transaction of db begun with opts, like Wallet.UnitOfWork,
+// the whole transaction runs again when sqlite finds the database busy or a table locked, its writes are not notified
+func (s *SQLite) UnitOfWork(ctx context.Context, db *sqlx.DB, opts *sql.TxOptions, fn func(tx *Tx) error) error {
+
+	return unitOfWork(ctx, db, opts, sqliteTxError, fn)
+}
+
+// sqliteTxError classifies the error of a transaction, retry is true when sqlite found the database busy
+// or a table locked past its busy timeout, replay is always false, a write holds the database lock
+// from its transactionID check to its commit, so no concurrent request commits the same transactionID first
+func sqliteTxError(err error) (retry bool, replay bool) {
+	var sqliteErr sqlite3.Error
+	if !errors.As(err, &sqliteErr) {
+
+		return false, false
+	}
+
+	return sqliteErr.Code == sqlite3.ErrBusy || sqliteErr.Code == sqlite3.ErrLocked, false
+}
+
+const (
+	sqliteCreditQuery = `UPDATE UserWallet SET balance = balance + ? WHERE userID = ? RETURNING balance`
+	// sqliteDebitQuery returns no row when the balance is not enough
+	sqliteDebitQuery = `UPDATE UserWallet SET balance = balance - ? WHERE userID = ? AND balance >= ? RETURNING balance`
+)
+
+func (s *SQLite) credit(ctx context.Context, tx sqlx.ExtContext, userID string, amount int) (int, error) {
+	var balance int
+	if err := sqlx.GetContext(ctx, tx, &balance, sqliteCreditQuery, amount, userID); err != nil {
+
+		return 0, err
+	}
+
+	return balance, nil
+}
+
+func (s *SQLite) debit(ctx context.Context, tx sqlx.ExtContext, userID string, amount int) (int, error) {
+	var balance int
+	if err := sqlx.GetContext(ctx, tx, &balance, sqliteDebitQuery, amount, userID, amount); errors.Is(err, sql.ErrNoRows) {
+
+		return 0, domain.ErrNotEnoughBalance
+	} else if err != nil {
+
+		return 0, err
+	}
+
+	return balance, nil
+}
+
+const sqliteJournalQuery = `INSERT INTO UserWalletTransaction (userID, transactionID, operationType, amount, passiveUserID, balance, createdAt)
+	VALUES (?, ?, ?, ?, ?, ?, ?)`
+
+// journal records a transaction of the wallet with its balance after it
+func (s *SQLite) journal(ctx context.Context, tx sqlx.ExtContext, now time.Time, userID string, transactionID string, operationType domain.OperationType, amount int, passiveUserID string, balance int) error {
+	_, err := tx.ExecContext(ctx, sqliteJournalQuery, userID, transactionID, operationType, amount, passiveUserID, balance, TimeToUTC(now))
+
+	return err
+}
+
+// replayable returns the wallet of user, and whether transactionID is already journaled and the write is a replay
+func (s *SQLite) replayable(ctx context.Context, tx sqlx.ExtContext, user domain.User, transactionID domain.TransactionID) (*domain.Wallet, bool, error) {
+	wallet, err := s.Get(ctx, tx, user)
+	if err != nil {
+
+		return nil, false, err
+	}
+	replay, err := s.ExistsTransactionID(ctx, tx, transactionID)
+	if err != nil {
+
+		return nil, false, err
+	}
+
+	return wallet, replay, nil
+}
+
+func (s *SQLite) Deposit(ctx context.Context, db sqlx.ExtContext, now time.Time, user domain.User, transactionID domain.TransactionID, amount int) (*domain.Wallet, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	if amount <= 0 {
+
+		return nil, domain.ErrInvalidAmount
+	}
+
+	return s.write(ctx, db, func(tx sqlx.ExtContext) (*domain.Wallet, []string, error) {
+		wallet, replay, err := s.replayable(ctx, tx, user, transactionID)
+		if err != nil || replay {
+
+			return wallet, nil, err
+		}
+
+		if wallet.Balance, err = s.credit(ctx, tx, user.ID, amount); err != nil {
+
+			return nil, nil, err
+		}
+		if err := s.journal(ctx, tx, now, user.ID, transactionID.ID(), domain.OperationTypeDeposit, amount, "", wallet.Balance); err != nil {
+
+			return nil, nil, err
+		}
+
+		return wallet, []string{user.ID}, nil
+	})
+}
+
+func (s *SQLite) Withdraw(ctx context.Context, db sqlx.ExtContext, now time.Time, user domain.User, transactionID domain.TransactionID, amount int) (*domain.Wallet, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	if amount <= 0 {
+
+		return nil, domain.ErrInvalidAmount
+	}
+
+	return s.write(ctx, db, func(tx sqlx.ExtContext) (*domain.Wallet, []string, error) {
+		wallet, replay, err := s.replayable(ctx, tx, user, transactionID)
+		if err != nil || replay {
+
+			return wallet, nil, err
+		}
+
+		if wallet.Balance, err = s.debit(ctx, tx, user.ID, amount); err != nil {
+
+			return nil, nil, err
+		}
+		if err := s.journal(ctx, tx, now, user.ID, transactionID.ID(), domain.OperationTypeWithdraw, amount, "", wallet.Balance); err != nil {
+
+			return nil, nil, err
+		}
+
+		return wallet, []string{user.ID}, nil
+	})
+}
+
+func (s *SQLite) Transfer(ctx context.Context, db sqlx.ExtContext, now time.Time, user domain.User, transactionID domain.TransactionID, amount int, passiveUser domain.User) (*domain.Wallet, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	if amount <= 0 {
+
+		return nil, domain.ErrInvalidAmount
+	}
+	if user.ID == passiveUser.ID {
+
+		return nil, domain.ErrTransferToSelf
+	}
+
+	return s.write(ctx, db, func(tx sqlx.ExtContext) (*domain.Wallet, []string, error) {
+		wallet, err := s.Get(ctx, tx, user)
+		if err != nil {
+
+			return nil, nil, err
+		}
+		if exists, err := s.Exists(ctx, tx, passiveUser); err != nil {
+
+			return nil, nil, err
+		} else if !exists {
+
+			return nil, nil, domain.ErrPassiveWalletNotFound
+		}
+		if replay, err := s.ExistsTransactionID(ctx, tx, transactionID); err != nil || replay {
+
+			return wallet, nil, err
+		}
+
+		if wallet.Balance, err = s.debit(ctx, tx, user.ID, amount); err != nil {
+
+			return nil, nil, err
+		}
+		passiveBalance, err := s.credit(ctx, tx, passiveUser.ID, amount)
+		if err != nil {
+
+			return nil, nil, err
+		}
+		if err := s.journal(ctx, tx, now, user.ID, transactionID.ID(), domain.OperationTypeTransferOut, amount, passiveUser.ID, wallet.Balance); err != nil {
+
+			return nil, nil, err
+		}
+		if err := s.journal(ctx, tx, now, passiveUser.ID, transactionID.PassiveID(), domain.OperationTypeTransferIn, amount, user.ID, passiveBalance); err != nil {
+
+			return nil, nil, err
+		}
+
+		return wallet, []string{user.ID, passiveUser.ID}, nil
+	})
+}
+
+const sqliteGetTransactionsQuery = `SELECT ID AS id, userID AS userid, transactionID AS transactionid, operationType AS operationtype, amount,
+	passiveUserID AS passiveuserid, createdAt AS createdat FROM UserWalletTransaction
+	WHERE userID = ? AND createdAt <= ? AND ID < ? ORDER BY createdAt DESC, ID DESC LIMIT ?`
+
+func (s *SQLite) GetTransactions(ctx context.Context, db sqlx.ExtContext, user domain.User, createdBefore time.Time, IDBefore int, limit int) ([]*domain.Transaction, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	// default values
+	if createdBefore.IsZero() {
+		createdBefore = time.Now()
+	}
+
+	createdBefore = TimeToUTC(createdBefore)
+
+	if IDBefore == 0 {
+		IDBefore = math.MaxInt64
+	}
+
+	if limit <= 0 {
+		limit = 100
+	}
+
+	if exists, err := s.Exists(ctx, db, user); err != nil {
+
+		return nil, err
+	} else if !exists {
+
+		return nil, domain.ErrWalletNotFound
+	}
+	transactions := []*domain.Transaction{}
+
+	if err := sqlx.SelectContext(ctx, db, &transactions, sqliteGetTransactionsQuery, user.ID, createdBefore,
+		IDBefore, limit); err != nil {
+
+		return nil, err
+	}
+
+	// remove timezone information
+	for _, transaction := range transactions {
+		transaction.CreatedAt = TimeToUTC(transaction.CreatedAt)
+	}
+
+	return transactions, nil
+}
+
+// sqliteGetEventsQuery reads the balance journaled with each transaction,
+// writes hold the database lock so IDs commit in order
+const sqliteGetEventsQuery = `SELECT ID AS id, userID AS userid, transactionID AS transactionid, operationType AS operationtype, amount,
+	passiveUserID AS passiveuserid, createdAt AS createdat, balance FROM UserWalletTransaction
+	WHERE userID = ? AND ID > ? ORDER BY ID ASC LIMIT ?`
+
+// GetEvents returns the wallet events of the user after IDAfter, oldest first
+func (s *SQLite) GetEvents(ctx context.Context, db sqlx.ExtContext, user domain.User, IDAfter int, limit int) ([]*domain.WalletEvent, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	if limit <= 0 {
+		limit = 100
+	}
+
+	if exists, err := s.Exists(ctx, db, user); err != nil {
+
+		return nil, err
+	} else if !exists {
+
+		return nil, domain.ErrWalletNotFound
+	}
+
+	rows := []*eventRow{}
+	if err := sqlx.SelectContext(ctx, db, &rows, sqliteGetEventsQuery, user.ID, IDAfter, limit); err != nil {
+
+		return nil, err
+	}
+
+	events := make([]*domain.WalletEvent, 0, len(rows))
+	for _, row := range rows {
+		transaction := row.Transaction
+		transaction.CreatedAt = TimeToUTC(transaction.CreatedAt)
+		events = append(events, &domain.WalletEvent{
+			ID:          transaction.ID,
+			UserID:      transaction.UserID,
+			Balance:     row.Balance,
+			Transaction: &transaction,
+		})
+	}
+
+	return events, nil
+}
+
+const sqliteLastEventIDQuery = `SELECT COALESCE((SELECT MAX(t.ID) FROM UserWalletTransaction t WHERE t.userID = w.userID), 0)
+	FROM UserWallet w WHERE w.userID = ?`
+
+// LastEventID returns the ID of the latest wallet event of the user, 0 when it has none
+func (s *SQLite) LastEventID(ctx context.Context, db sqlx.ExtContext, user domain.User) (int, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	var ID int
+	if err := sqlx.GetContext(ctx, db, &ID, sqliteLastEventIDQuery, user.ID); errors.Is(err, sql.ErrNoRows) {
+
+		return 0, domain.ErrWalletNotFound
+	} else if err != nil {
+
+		return 0, err
+	}
+
+	return ID, nil
+}
@@ -0,0 +1,195 @@
+package repository_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	sqlitemigrations "github.com/sappy5678/cryptocom/deploy/db/sqlite/migrations"
+	"github.com/sappy5678/cryptocom/pkg/domain"
+	"github.com/sappy5678/cryptocom/pkg/service/wallet/repository"
+	"github.com/sappy5678/cryptocom/pkg/utl/migration"
+	"github.com/sappy5678/cryptocom/pkg/utl/sqlite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"go.uber.org/goleak"
+)
+
+// newSQLite opens a migrated sqlite database in a temporary folder of t
+func newSQLite(t *testing.T) *sqlx.DB {
+	db, err := sqlite.New(&sqlite.Config{DSN: filepath.Join(t.TempDir(), "wallet.db")})
+	require.NoError(t, err)
+	require.NoError(t, migration.NewSQLite(db, sqlitemigrations.FS).Up(context.Background()))
+
+	return db
+}
+
+func TestSQLiteConformance(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	var db *sqlx.DB
+	defer func() { db.Close() }()
+	suite.Run(t, &ConformanceSuite{
+		newRepo: func() (repository.WalletRepository, sqlx.ExtContext) {
+			if db != nil {
+				db.Close()
+			}
+			db = newSQLite(t)
+
+			return &repository.SQLite{}, db
+		},
+	})
+}
+
+func TestSQLiteSuite(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	suite.Run(t, &TestSuite{sqlite: true})
+}
+
+func TestSQLiteUnitOfWork(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	db := newSQLite(t)
+	defer db.Close()
+
+	notified := []string{}
+	wallet := repository.SQLite{Notify: func(userID string) { notified = append(notified, userID) }}
+	ctx := context.Background()
+	now := time.Now()
+	user := domain.User{ID: "test-user-uow"}
+	passiveUser := domain.User{ID: "test-user-uow-passive"}
+	for _, u := range []domain.User{user, passiveUser} {
+		_, err := wallet.Create(ctx, db, u, domain.WalletMetadata{})
+		require.NoError(t, err)
+	}
+	_, err := wallet.Deposit(ctx, db, now, user, "test-tx-uow-committed", 10)
+	require.NoError(t, err)
+	assert.Equal(t, []string{user.ID}, notified)
+
+	errAbort := errors.New("abort")
+	tests := []struct {
+		name        string
+		fn          func(tx *repository.Tx) error
+		wantErr     error
+		wantBalance int
+		wantPassive int
+	}{
+		{
+			name: "commit",
+			fn: func(tx *repository.Tx) error {
+				if _, err := wallet.Deposit(ctx, tx, now, user, "test-tx-uow-deposit", 100); err != nil {
+
+					return err
+				}
+				_, err := wallet.Transfer(ctx, tx, now, user, "test-tx-uow-transfer", 30, passiveUser)
+
+				return err
+			},
+			wantBalance: 80,
+			wantPassive: 30,
+		},
+		{
+			name: "rollback on error",
+			fn: func(tx *repository.Tx) error {
+				if _, err := wallet.Deposit(ctx, tx, now, user, "test-tx-uow-rollback", 100); err != nil {
+
+					return err
+				}
+
+				return errAbort
+			},
+			wantErr:     errAbort,
+			wantBalance: 80,
+			wantPassive: 30,
+		},
+		{
+			name: "rollback on write error",
+			fn: func(tx *repository.Tx) error {
+				if _, err := wallet.Deposit(ctx, tx, now, user, "test-tx-uow-partial", 100); err != nil {
+
+					return err
+				}
+				_, err := wallet.Withdraw(ctx, tx, now, passiveUser, "test-tx-uow-withdraw", 1000)
+
+				return err
+			},
+			wantErr:     domain.ErrNotEnoughBalance,
+			wantBalance: 80,
+			wantPassive: 30,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := wallet.UnitOfWork(ctx, db, nil, tt.fn)
+			assert.ErrorIs(t, err, tt.wantErr)
+
+			got, err := wallet.Get(ctx, db, user)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantBalance, got.Balance)
+			got, err = wallet.Get(ctx, db, passiveUser)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantPassive, got.Balance)
+		})
+	}
+
+	// writes inside a transaction are not notified
+	assert.Equal(t, []string{user.ID}, notified)
+}
+
+func TestSQLiteBalanceConstraint(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	db := newSQLite(t)
+	defer db.Close()
+
+	_, err := (&repository.SQLite{}).Create(context.Background(), db, domain.User{ID: "test-user-1"}, domain.WalletMetadata{})
+	require.NoError(t, err)
+
+	_, err = db.Exec(`UPDATE UserWallet SET balance = -1 WHERE userID = ?`, "test-user-1")
+	assert.ErrorContains(t, err, "CHECK constraint failed")
+}
+
+func TestSQLiteBusyRetry(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	path := filepath.Join(t.TempDir(), "wallet.db")
+	db, err := sqlite.New(&sqlite.Config{DSN: path, BusyTimeout: time.Millisecond})
+	require.NoError(t, err)
+	defer db.Close()
+	require.NoError(t, migration.NewSQLite(db, sqlitemigrations.FS).Up(context.Background()))
+
+	wallet := repository.SQLite{}
+	ctx := context.Background()
+	user := domain.User{ID: "test-user-busy"}
+	_, err = wallet.Create(ctx, db, user, domain.WalletMetadata{})
+	require.NoError(t, err)
+
+	// another writer holds the lock past the busy timeout, the write runs again once it is released
+	lock, err := db.Beginx()
+	require.NoError(t, err)
+	released := time.AfterFunc(30*time.Millisecond, func() { lock.Rollback() })
+	defer released.Stop()
+
+	got, err := wallet.Deposit(ctx, db, time.Now(), user, "test-tx-busy", 10)
+	require.NoError(t, err)
+	assert.Equal(t, 10, got.Balance)
+
+	lock, err = db.Beginx()
+	require.NoError(t, err)
+	released = time.AfterFunc(30*time.Millisecond, func() { lock.Rollback() })
+	err = wallet.UnitOfWork(ctx, db, nil, func(tx *repository.Tx) error {
+		_, err := wallet.Withdraw(ctx, tx, time.Now(), user, "test-tx-busy-uow", 10)
+
+		return err
+	})
+	require.NoError(t, err)
+	got, err = wallet.Get(ctx, db, user)
+	require.NoError(t, err)
+	assert.Equal(t, 0, got.Balance)
+}
@@ -1,6 +1,9 @@
 package wallet
 
 import (
+	"context"
+	"database/sql"
+
 	"github.com/jmoiron/sqlx"
 
 	"github.com/sappy5678/cryptocom/pkg/domain"
@@ -15,14 +18,45 @@ func New(db *sqlx.DB, walletRepo repository.WalletRepository) domain.WalletServi
 	return &Wallet{db: db, walletRepo: walletRepo}
 }
 
+// NewWithReader creates new wallet application service whose read-only calls, Get and GetTransactions,
+// run on the executor chosen by reader
+func NewWithReader(db *sqlx.DB, reader Reader, walletRepo repository.WalletRepository) domain.WalletService {
+
+	return &Wallet{db: db, reader: reader, walletRepo: walletRepo}
+}
+
 // Initialize initalizes Wallet application service with defaults
 func Initialize(db *sqlx.DB) domain.WalletService {
 
 	return New(db, &repository.Wallet{})
 }
 
+// Reader chooses the executor of read-only repository calls, like postgres.Replicas routing them to replicas
+type Reader interface {
+	Reader(ctx context.Context) sqlx.ExtContext
+}
+
 // Wallet represents wallet application service
 type Wallet struct {
 	db         *sqlx.DB
+	reader     Reader
 	walletRepo repository.WalletRepository
 }
+
+// readDB is the executor of read-only calls, the database when there is no reader or ctx reads the primary
+func (w *Wallet) readDB(ctx context.Context) sqlx.ExtContext {
+	if w.reader == nil || domain.PrimaryRead(ctx) {
+
+		return w.db
+	}
+
+	return w.reader.Reader(ctx)
+}
+
+// UnitOfWork runs fn in one database transaction with the isolation level of opts, nil is the database default,
+// operations pass tx to the repository calls they combine, like a transfer, its fee and their events,
+// see the UnitOfWork of the repository for the retries
+func (w *Wallet) UnitOfWork(ctx context.Context, opts *sql.TxOptions, fn func(tx *repository.Tx) error) error {
+
+	return w.walletRepo.UnitOfWork(ctx, w.db, opts, fn)
+}
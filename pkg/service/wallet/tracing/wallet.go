@@ -0,0 +1,107 @@
+package wallet
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/sappy5678/cryptocom/pkg/domain"
+)
+
+const name = "github.com/sappy5678/cryptocom/pkg/service/wallet"
+
+// New creates new wallet tracing service
+func New(svc domain.WalletService, tp trace.TracerProvider) *TraceService {
+
+	return &TraceService{
+		WalletService: svc,
+		tracer:        tp.Tracer(name),
+	}
+}
+
+// TraceService represents wallet tracing service
+type TraceService struct {
+	domain.WalletService
+	tracer trace.Tracer
+}
+
+const (
+	userIDKey        = attribute.Key("wallet.user_id")
+	passiveUserIDKey = attribute.Key("wallet.passive_user_id")
+	transactionIDKey = attribute.Key("wallet.transaction_id")
+	amountKey        = attribute.Key("wallet.amount")
+)
+
+func end(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Create tracing
+func (ts *TraceService) Create(c context.Context, req domain.User, metadata domain.WalletMetadata) (wallet *domain.Wallet, err error) {
+	c, span := ts.tracer.Start(c, "WalletService.Create", trace.WithAttributes(userIDKey.String(req.ID)))
+	defer func() { end(span, err) }()
+
+	return ts.WalletService.Create(c, req, metadata)
+}
+
+func (ts *TraceService) Get(c context.Context, req domain.User) (wallet *domain.Wallet, err error) {
+	c, span := ts.tracer.Start(c, "WalletService.Get", trace.WithAttributes(userIDKey.String(req.ID)))
+	defer func() { end(span, err) }()
+
+	return ts.WalletService.Get(c, req)
+}
+
+func (ts *TraceService) Withdraw(c context.Context, req domain.User, transactionID domain.TransactionID, amount int) (wallet *domain.Wallet, err error) {
+	c, span := ts.tracer.Start(c, "WalletService.Withdraw", trace.WithAttributes(
+		userIDKey.String(req.ID),
+		transactionIDKey.String(transactionID.ID()),
+		amountKey.Int(amount),
+	))
+	defer func() { end(span, err) }()
+
+	return ts.WalletService.Withdraw(c, req, transactionID, amount)
+}
+
+func (ts *TraceService) Deposit(c context.Context, req domain.User, transactionID domain.TransactionID, amount int) (wallet *domain.Wallet, err error) {
+	c, span := ts.tracer.Start(c, "WalletService.Deposit", trace.WithAttributes(
+		userIDKey.String(req.ID),
+		transactionIDKey.String(transactionID.ID()),
+		amountKey.Int(amount),
+	))
+	defer func() { end(span, err) }()
+
+	return ts.WalletService.Deposit(c, req, transactionID, amount)
+}
+
+func (ts *TraceService) GetTransactions(c context.Context, req domain.User, createdAt time.Time, lastReturnedID int, limit int) (transactions []*domain.Transaction, err error) {
+	c, span := ts.tracer.Start(c, "WalletService.GetTransactions", trace.WithAttributes(userIDKey.String(req.ID)))
+	defer func() { end(span, err) }()
+
+	return ts.WalletService.GetTransactions(c, req, createdAt, lastReturnedID, limit)
+}
+
+func (ts *TraceService) Transfer(c context.Context, req domain.User, transactionID domain.TransactionID, amount int, passiveUser domain.User) (wallet *domain.Wallet, err error) {
+	c, span := ts.tracer.Start(c, "WalletService.Transfer", trace.WithAttributes(
+		userIDKey.String(req.ID),
+		passiveUserIDKey.String(passiveUser.ID),
+		transactionIDKey.String(transactionID.ID()),
+		amountKey.Int(amount),
+	))
+	defer func() { end(span, err) }()
+
+	return ts.WalletService.Transfer(c, req, transactionID, amount, passiveUser)
+}
+
+func (ts *TraceService) CreateTransactionID(c context.Context) domain.TransactionID {
+	c, span := ts.tracer.Start(c, "WalletService.CreateTransactionID")
+	defer span.End()
+
+	return ts.WalletService.CreateTransactionID(c)
+}
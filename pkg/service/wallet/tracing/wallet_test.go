@@ -0,0 +1,171 @@
+package wallet_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.uber.org/goleak"
+
+	"github.com/sappy5678/cryptocom/pkg/domain"
+	"github.com/sappy5678/cryptocom/pkg/service/wallet"
+	wt "github.com/sappy5678/cryptocom/pkg/service/wallet/tracing"
+	"github.com/sappy5678/cryptocom/pkg/utl/tracing/tracingtest"
+)
+
+var mockWalletService = &wallet.MockWalletService{
+	CreateFunc: func(ctx context.Context, user domain.User, metadata domain.WalletMetadata) (*domain.Wallet, error) {
+
+		return &domain.Wallet{UserID: user.ID, Balance: 0}, nil
+	},
+	GetFunc: func(ctx context.Context, user domain.User) (*domain.Wallet, error) {
+
+		return &domain.Wallet{UserID: user.ID, Balance: 0}, nil
+	},
+	WithdrawFunc: func(ctx context.Context, user domain.User, transactionID domain.TransactionID, amount int) (*domain.Wallet, error) {
+
+		return nil, domain.ErrNotEnoughBalance
+	},
+	DepositFunc: func(ctx context.Context, user domain.User, transactionID domain.TransactionID, amount int) (*domain.Wallet, error) {
+
+		return &domain.Wallet{UserID: user.ID, Balance: amount}, nil
+	},
+	GetTransactionsFunc: func(ctx context.Context, user domain.User, createdAt time.Time, lastReturnedID int, limit int) ([]*domain.Transaction, error) {
+
+		return []*domain.Transaction{}, nil
+	},
+	CreateTransactionIDFunc: func(ctx context.Context) domain.TransactionID {
+
+		return domain.TransactionID("test-transaction-id")
+	},
+	TransferFunc: func(ctx context.Context, user domain.User, transactionID domain.TransactionID, amount int, passiveUser domain.User) (*domain.Wallet, error) {
+
+		return &domain.Wallet{UserID: user.ID, Balance: 0}, nil
+	},
+}
+
+func TestTraceService(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	user := domain.User{ID: "test-user-id"}
+	tests := []struct {
+		name      string
+		call      func(ctx context.Context, svc domain.WalletService) error
+		wantName  string
+		wantAttrs []attribute.KeyValue
+		wantErr   error
+	}{
+		{
+			name: "create",
+			call: func(ctx context.Context, svc domain.WalletService) error {
+				_, err := svc.Create(ctx, user, domain.WalletMetadata{})
+
+				return err
+			},
+			wantName:  "WalletService.Create",
+			wantAttrs: []attribute.KeyValue{attribute.String("wallet.user_id", user.ID)},
+		},
+		{
+			name: "get",
+			call: func(ctx context.Context, svc domain.WalletService) error {
+				_, err := svc.Get(ctx, user)
+
+				return err
+			},
+			wantName:  "WalletService.Get",
+			wantAttrs: []attribute.KeyValue{attribute.String("wallet.user_id", user.ID)},
+		},
+		{
+			name: "create transaction ID",
+			call: func(ctx context.Context, svc domain.WalletService) error {
+				svc.CreateTransactionID(ctx)
+
+				return nil
+			},
+			wantName: "WalletService.CreateTransactionID",
+		},
+		{
+			name: "deposit",
+			call: func(ctx context.Context, svc domain.WalletService) error {
+				_, err := svc.Deposit(ctx, user, "txn-1", 100)
+
+				return err
+			},
+			wantName: "WalletService.Deposit",
+			wantAttrs: []attribute.KeyValue{
+				attribute.String("wallet.user_id", user.ID),
+				attribute.String("wallet.transaction_id", "txn-1"),
+				attribute.Int("wallet.amount", 100),
+			},
+		},
+		{
+			name: "withdraw error",
+			call: func(ctx context.Context, svc domain.WalletService) error {
+				_, err := svc.Withdraw(ctx, user, "txn-2", 100)
+
+				return err
+			},
+			wantName: "WalletService.Withdraw",
+			wantAttrs: []attribute.KeyValue{
+				attribute.String("wallet.user_id", user.ID),
+				attribute.String("wallet.transaction_id", "txn-2"),
+				attribute.Int("wallet.amount", 100),
+			},
+			wantErr: domain.ErrNotEnoughBalance,
+		},
+		{
+			name: "transfer",
+			call: func(ctx context.Context, svc domain.WalletService) error {
+				_, err := svc.Transfer(ctx, user, "txn-3", 10, domain.User{ID: "test-user-2"})
+
+				return err
+			},
+			wantName: "WalletService.Transfer",
+			wantAttrs: []attribute.KeyValue{
+				attribute.String("wallet.user_id", user.ID),
+				attribute.String("wallet.passive_user_id", "test-user-2"),
+				attribute.String("wallet.transaction_id", "txn-3"),
+				attribute.Int("wallet.amount", 10),
+			},
+		},
+		{
+			name: "get transactions",
+			call: func(ctx context.Context, svc domain.WalletService) error {
+				_, err := svc.GetTransactions(ctx, user, time.Now(), 0, 10)
+
+				return err
+			},
+			wantName:  "WalletService.GetTransactions",
+			wantAttrs: []attribute.KeyValue{attribute.String("wallet.user_id", user.ID)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tp, exporter := tracingtest.NewInMemory()
+			defer tp.Shutdown(context.Background())
+
+			// the span is a child of the caller span
+			ctx, parent := tp.Tracer("test").Start(context.Background(), "parent")
+			err := tt.call(ctx, wt.New(mockWalletService, tp))
+			parent.End()
+			assert.ErrorIs(t, err, tt.wantErr)
+
+			spans := exporter.GetSpans()
+			assert.Len(t, spans, 2)
+			span := spans[0]
+			assert.Equal(t, tt.wantName, span.Name)
+			assert.Equal(t, parent.SpanContext().SpanID(), span.Parent.SpanID())
+			assert.ElementsMatch(t, tt.wantAttrs, span.Attributes)
+			if tt.wantErr != nil {
+				assert.Equal(t, codes.Error, span.Status.Code)
+				assert.Equal(t, tt.wantErr.Error(), span.Status.Description)
+			} else {
+				assert.Equal(t, codes.Unset, span.Status.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,259 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/sappy5678/cryptocom/pkg/domain"
+	"github.com/sappy5678/cryptocom/pkg/service/wallet/transport/grpc/walletpb"
+)
+
+// defaultPageSize is used when GetTransactions request does not set page_size
+const defaultPageSize = 100
+
+// metadataMoreArchived is the trailer of GetTransactions streams stopping before archived transactions
+const metadataMoreArchived = "x-more-archived"
+
+// WriteMethods are the methods changing wallets, they return a consistency token, see server.ReadYourWritesUnary
+var WriteMethods = []string{
+	walletpb.WalletService_Create_FullMethodName,
+	walletpb.WalletService_Deposit_FullMethodName,
+	walletpb.WalletService_Withdraw_FullMethodName,
+	walletpb.WalletService_Transfer_FullMethodName,
+}
+
+// GRPC represents wallet grpc service
+type GRPC struct {
+	walletpb.UnimplementedWalletServiceServer
+	Service domain.WalletService
+}
+
+// NewGRPC creates new wallet grpc service and registers it on the server
+func NewGRPC(svc domain.WalletService, s *grpc.Server) {
+	h := &GRPC{Service: svc}
+	walletpb.RegisterWalletServiceServer(s, h)
+}
+
+// statusError maps domain errors to grpc status errors
+func statusError(err error) error {
+	switch {
+	case errors.Is(err, domain.ErrUserIDRequired),
+		errors.Is(err, domain.ErrInvalidAmount),
+		errors.Is(err, domain.ErrTransferToSelf),
+		errors.Is(err, domain.ErrInvalidMetadata):
+
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, domain.ErrWalletNotFound):
+
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, domain.ErrNotEnoughBalance),
+		errors.Is(err, domain.ErrTransactionsArchived):
+
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, domain.ErrArchiveOffline):
+
+		return status.Error(codes.Unavailable, err.Error())
+	case errors.Is(err, context.Canceled):
+
+		return status.Error(codes.Canceled, err.Error())
+	case errors.Is(err, context.DeadlineExceeded):
+
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	}
+
+	return status.Error(codes.Internal, err.Error())
+}
+
+func toWallet(wallet *domain.Wallet) *walletpb.Wallet {
+
+	return &walletpb.Wallet{
+		UserId:      wallet.UserID,
+		Balance:     int64(wallet.Balance),
+		DisplayName: wallet.DisplayName,
+		Asset:       wallet.Asset,
+		Tags:        wallet.Tags,
+		Created:     wallet.Created,
+	}
+}
+
+func toTransaction(transaction *domain.Transaction) *walletpb.Transaction {
+
+	return &walletpb.Transaction{
+		Id:            int64(transaction.ID),
+		TransactionId: transaction.TransactionID.ID(),
+		UserId:        transaction.UserID,
+		Amount:        int64(transaction.Amount),
+		OperationType: walletpb.OperationType(transaction.OperationType),
+		PassiveUserId: transaction.PassiveUserID,
+		CreatedAt:     timestamppb.New(transaction.CreatedAt),
+	}
+}
+
+func (h *GRPC) Create(ctx context.Context, req *walletpb.CreateRequest) (*walletpb.Wallet, error) {
+	if req.GetUserId() == "" {
+
+		return nil, statusError(domain.ErrUserIDRequired)
+	}
+
+	wallet, err := h.Service.Create(ctx, domain.User{ID: req.GetUserId()}, domain.WalletMetadata{
+		DisplayName: req.GetDisplayName(),
+		Asset:       req.GetAsset(),
+		Tags:        req.GetTags(),
+	})
+	if err != nil {
+
+		return nil, statusError(err)
+	}
+
+	return toWallet(wallet), nil
+}
+
+func (h *GRPC) Get(ctx context.Context, req *walletpb.GetRequest) (*walletpb.Wallet, error) {
+	if req.GetUserId() == "" {
+
+		return nil, statusError(domain.ErrUserIDRequired)
+	}
+
+	wallet, err := h.Service.Get(ctx, domain.User{ID: req.GetUserId()})
+	if err != nil {
+
+		return nil, statusError(err)
+	}
+
+	return toWallet(wallet), nil
+}
+
+func (h *GRPC) CreateTransactionID(ctx context.Context, _ *walletpb.CreateTransactionIDRequest) (*walletpb.CreateTransactionIDResponse, error) {
+	transactionID := h.Service.CreateTransactionID(ctx)
+
+	return &walletpb.CreateTransactionIDResponse{TransactionId: transactionID.ID()}, nil
+}
+
+func (h *GRPC) Deposit(ctx context.Context, req *walletpb.DepositRequest) (*walletpb.Wallet, error) {
+	if req.GetUserId() == "" {
+
+		return nil, statusError(domain.ErrUserIDRequired)
+	}
+
+	wallet, err := h.Service.Deposit(ctx, domain.User{ID: req.GetUserId()},
+		domain.TransactionID(req.GetTransactionId()), int(req.GetAmount()))
+	if err != nil {
+
+		return nil, statusError(err)
+	}
+
+	return toWallet(wallet), nil
+}
+
+func (h *GRPC) Withdraw(ctx context.Context, req *walletpb.WithdrawRequest) (*walletpb.Wallet, error) {
+	if req.GetUserId() == "" {
+
+		return nil, statusError(domain.ErrUserIDRequired)
+	}
+
+	wallet, err := h.Service.Withdraw(ctx, domain.User{ID: req.GetUserId()},
+		domain.TransactionID(req.GetTransactionId()), int(req.GetAmount()))
+	if err != nil {
+
+		return nil, statusError(err)
+	}
+
+	return toWallet(wallet), nil
+}
+
+func (h *GRPC) Transfer(ctx context.Context, req *walletpb.TransferRequest) (*walletpb.Wallet, error) {
+	if req.GetUserId() == "" {
+
+		return nil, statusError(domain.ErrUserIDRequired)
+	}
+
+	wallet, err := h.Service.Transfer(ctx, domain.User{ID: req.GetUserId()},
+		domain.TransactionID(req.GetTransactionId()), int(req.GetAmount()), domain.User{ID: req.GetPassiveUserId()})
+	if err != nil {
+
+		return nil, statusError(err)
+	}
+
+	return toWallet(wallet), nil
+}
+
+// GetTransactions pages through the transaction history and streams every transaction
+// until the history is exhausted or the requested limit is reached,
+// the x-more-archived trailer is true when the stream stops before archived transactions, see include_archived
+func (h *GRPC) GetTransactions(req *walletpb.GetTransactionsRequest, stream grpc.ServerStreamingServer[walletpb.Transaction]) error {
+	if req.GetUserId() == "" {
+
+		return statusError(domain.ErrUserIDRequired)
+	}
+
+	ctx := stream.Context()
+	if req.GetIncludeArchived() {
+		ctx = domain.WithArchivedTransactions(ctx)
+	}
+	user := domain.User{ID: req.GetUserId()}
+
+	createdBefore := time.Time{}
+	if req.GetCreatedBefore() != nil {
+		createdBefore = req.GetCreatedBefore().AsTime()
+	}
+	IDBefore := int(req.GetIdBefore())
+
+	pageSize := int(req.GetPageSize())
+	if pageSize <= 0 {
+		pageSize = defaultPageSize
+	}
+	remaining := int(req.GetLimit())
+
+	// continued is true once the stream pages on its own
+	continued := false
+	for {
+		limit := pageSize
+		if remaining > 0 && remaining < limit {
+			limit = remaining
+		}
+
+		more := false
+		transactions, err := h.Service.GetTransactions(domain.WithMoreArchived(ctx, &more), user, createdBefore, IDBefore, limit)
+		if errors.Is(err, domain.ErrTransactionsArchived) && continued {
+			// the live transactions ended with the previous page
+			more = true
+		} else if err != nil {
+
+			return statusError(err)
+		}
+		if more {
+			stream.SetTrailer(metadata.Pairs(metadataMoreArchived, "true"))
+		}
+
+		for _, transaction := range transactions {
+			if err := stream.Send(toTransaction(transaction)); err != nil {
+
+				return err
+			}
+		}
+
+		if req.GetLimit() > 0 {
+			remaining -= len(transactions)
+			if remaining <= 0 {
+
+				return nil
+			}
+		}
+		if len(transactions) < limit {
+
+			return nil
+		}
+
+		last := transactions[len(transactions)-1]
+		createdBefore = last.CreatedAt
+		IDBefore = last.ID
+		continued = true
+	}
+}
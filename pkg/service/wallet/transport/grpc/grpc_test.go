@@ -0,0 +1,559 @@
+package grpc_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/sappy5678/cryptocom/pkg/domain"
+	"github.com/sappy5678/cryptocom/pkg/service/wallet"
+	wg "github.com/sappy5678/cryptocom/pkg/service/wallet/transport/grpc"
+	"github.com/sappy5678/cryptocom/pkg/service/wallet/transport/grpc/walletpb"
+	"github.com/sappy5678/cryptocom/pkg/utl/server"
+)
+
+var mockWalletService = &wallet.MockWalletService{
+	CreateFunc: func(ctx context.Context, user domain.User, metadata domain.WalletMetadata) (*domain.Wallet, error) {
+		if err := metadata.Validate(); err != nil {
+			return nil, err
+		}
+		return &domain.Wallet{UserID: user.ID, Balance: 0, WalletMetadata: metadata, Created: true}, nil
+	},
+	GetFunc: func(ctx context.Context, user domain.User) (*domain.Wallet, error) {
+		return &domain.Wallet{UserID: user.ID, Balance: 10}, nil
+	},
+	WithdrawFunc: func(ctx context.Context, user domain.User, transactionID domain.TransactionID, amount int) (*domain.Wallet, error) {
+		return &domain.Wallet{UserID: user.ID, Balance: 100 - amount}, nil
+	},
+	DepositFunc: func(ctx context.Context, user domain.User, transactionID domain.TransactionID, amount int) (*domain.Wallet, error) {
+		return &domain.Wallet{UserID: user.ID, Balance: amount}, nil
+	},
+	GetTransactionsFunc: func(ctx context.Context, user domain.User, createdAt time.Time, lastReturnedID int, limit int) ([]*domain.Transaction, error) {
+		return []*domain.Transaction{}, nil
+	},
+	CreateTransactionIDFunc: func(ctx context.Context) domain.TransactionID {
+		return domain.TransactionID("test-transaction-id")
+	},
+	TransferFunc: func(ctx context.Context, user domain.User, transactionID domain.TransactionID, amount int, passiveUser domain.User) (*domain.Wallet, error) {
+		return &domain.Wallet{UserID: user.ID, Balance: 100 - amount}, nil
+	},
+}
+
+var mockError = errors.New("error")
+var mockErrorWalletService = &wallet.MockWalletService{
+	CreateFunc: func(ctx context.Context, user domain.User, metadata domain.WalletMetadata) (*domain.Wallet, error) {
+		return nil, mockError
+	},
+	GetFunc: func(ctx context.Context, user domain.User) (*domain.Wallet, error) {
+		return nil, domain.ErrWalletNotFound
+	},
+	WithdrawFunc: func(ctx context.Context, user domain.User, transactionID domain.TransactionID, amount int) (*domain.Wallet, error) {
+		return nil, domain.ErrNotEnoughBalance
+	},
+	DepositFunc: func(ctx context.Context, user domain.User, transactionID domain.TransactionID, amount int) (*domain.Wallet, error) {
+		return nil, domain.ErrInvalidAmount
+	},
+	GetTransactionsFunc: func(ctx context.Context, user domain.User, createdAt time.Time, lastReturnedID int, limit int) ([]*domain.Transaction, error) {
+		return nil, domain.ErrWalletNotFound
+	},
+	CreateTransactionIDFunc: func(ctx context.Context) domain.TransactionID {
+		return domain.TransactionID("test-transaction-id")
+	},
+	TransferFunc: func(ctx context.Context, user domain.User, transactionID domain.TransactionID, amount int, passiveUser domain.User) (*domain.Wallet, error) {
+		return nil, domain.ErrTransferToSelf
+	},
+}
+
+func newClient(t *testing.T, svc domain.WalletService) (walletpb.WalletServiceClient, func()) {
+	lis := bufconn.Listen(1024 * 1024)
+	s := server.NewGRPC()
+	wg.NewGRPC(svc, s)
+	go func() {
+		_ = s.Serve(lis)
+	}()
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	assert.NoError(t, err)
+
+	return walletpb.NewWalletServiceClient(conn), func() {
+		conn.Close()
+		s.Stop()
+	}
+}
+
+func TestCreate(t *testing.T) {
+	defer goleak.VerifyNone(t)
+	tests := []struct {
+		name     string
+		req      *walletpb.CreateRequest
+		svc      domain.WalletService
+		want     *walletpb.Wallet
+		wantCode codes.Code
+	}{
+		{
+			name:     "success",
+			req:      &walletpb.CreateRequest{UserId: "1"},
+			svc:      mockWalletService,
+			want:     &walletpb.Wallet{UserId: "1", Balance: 0, Created: true},
+			wantCode: codes.OK,
+		},
+		{
+			name:     "metadata",
+			req:      &walletpb.CreateRequest{UserId: "1", DisplayName: "Shop", Asset: "USD", Tags: []string{"merchant"}},
+			svc:      mockWalletService,
+			want:     &walletpb.Wallet{UserId: "1", Balance: 0, DisplayName: "Shop", Asset: "USD", Tags: []string{"merchant"}, Created: true},
+			wantCode: codes.OK,
+		},
+		{
+			name:     "invalid metadata",
+			req:      &walletpb.CreateRequest{UserId: "1", Tags: []string{""}},
+			svc:      mockWalletService,
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name:     "userID is empty",
+			req:      &walletpb.CreateRequest{},
+			svc:      mockWalletService,
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name:     "error",
+			req:      &walletpb.CreateRequest{UserId: "1"},
+			svc:      mockErrorWalletService,
+			wantCode: codes.Internal,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, closeFn := newClient(t, tt.svc)
+			defer closeFn()
+			got, err := client.Create(context.Background(), tt.req)
+			assert.Equal(t, tt.wantCode, status.Code(err))
+			if tt.want != nil {
+				assert.Equal(t, tt.want.GetUserId(), got.GetUserId())
+				assert.Equal(t, tt.want.GetBalance(), got.GetBalance())
+				assert.Equal(t, tt.want.GetDisplayName(), got.GetDisplayName())
+				assert.Equal(t, tt.want.GetAsset(), got.GetAsset())
+				assert.Equal(t, tt.want.GetTags(), got.GetTags())
+				assert.Equal(t, tt.want.GetCreated(), got.GetCreated())
+			}
+		})
+	}
+}
+
+func TestGet(t *testing.T) {
+	defer goleak.VerifyNone(t)
+	tests := []struct {
+		name     string
+		userID   string
+		svc      domain.WalletService
+		want     *walletpb.Wallet
+		wantCode codes.Code
+	}{
+		{
+			name:     "success",
+			userID:   "1",
+			svc:      mockWalletService,
+			want:     &walletpb.Wallet{UserId: "1", Balance: 10},
+			wantCode: codes.OK,
+		},
+		{
+			name:     "userID is empty",
+			userID:   "",
+			svc:      mockWalletService,
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name:     "wallet not found",
+			userID:   "1",
+			svc:      mockErrorWalletService,
+			wantCode: codes.NotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, closeFn := newClient(t, tt.svc)
+			defer closeFn()
+			got, err := client.Get(context.Background(), &walletpb.GetRequest{UserId: tt.userID})
+			assert.Equal(t, tt.wantCode, status.Code(err))
+			if tt.want != nil {
+				assert.Equal(t, tt.want.GetUserId(), got.GetUserId())
+				assert.Equal(t, tt.want.GetBalance(), got.GetBalance())
+			}
+		})
+	}
+}
+
+func TestCreateTransactionID(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	client, closeFn := newClient(t, mockWalletService)
+	defer closeFn()
+	got, err := client.CreateTransactionID(context.Background(), &walletpb.CreateTransactionIDRequest{})
+	assert.NoError(t, err)
+	assert.Equal(t, "test-transaction-id", got.GetTransactionId())
+}
+
+func TestDeposit(t *testing.T) {
+	defer goleak.VerifyNone(t)
+	tests := []struct {
+		name     string
+		req      *walletpb.DepositRequest
+		svc      domain.WalletService
+		want     *walletpb.Wallet
+		wantCode codes.Code
+	}{
+		{
+			name:     "success",
+			req:      &walletpb.DepositRequest{UserId: "1", TransactionId: "txn-1", Amount: 100},
+			svc:      mockWalletService,
+			want:     &walletpb.Wallet{UserId: "1", Balance: 100},
+			wantCode: codes.OK,
+		},
+		{
+			name:     "userID is empty",
+			req:      &walletpb.DepositRequest{TransactionId: "txn-1", Amount: 100},
+			svc:      mockWalletService,
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name:     "invalid amount",
+			req:      &walletpb.DepositRequest{UserId: "1", TransactionId: "txn-1", Amount: -1},
+			svc:      mockErrorWalletService,
+			wantCode: codes.InvalidArgument,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, closeFn := newClient(t, tt.svc)
+			defer closeFn()
+			got, err := client.Deposit(context.Background(), tt.req)
+			assert.Equal(t, tt.wantCode, status.Code(err))
+			if tt.want != nil {
+				assert.Equal(t, tt.want.GetUserId(), got.GetUserId())
+				assert.Equal(t, tt.want.GetBalance(), got.GetBalance())
+			}
+		})
+	}
+}
+
+func TestWithdraw(t *testing.T) {
+	defer goleak.VerifyNone(t)
+	tests := []struct {
+		name     string
+		req      *walletpb.WithdrawRequest
+		svc      domain.WalletService
+		want     *walletpb.Wallet
+		wantCode codes.Code
+	}{
+		{
+			name:     "success",
+			req:      &walletpb.WithdrawRequest{UserId: "1", TransactionId: "txn-1", Amount: 40},
+			svc:      mockWalletService,
+			want:     &walletpb.Wallet{UserId: "1", Balance: 60},
+			wantCode: codes.OK,
+		},
+		{
+			name:     "userID is empty",
+			req:      &walletpb.WithdrawRequest{TransactionId: "txn-1", Amount: 40},
+			svc:      mockWalletService,
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name:     "not enough balance",
+			req:      &walletpb.WithdrawRequest{UserId: "1", TransactionId: "txn-1", Amount: 400},
+			svc:      mockErrorWalletService,
+			wantCode: codes.FailedPrecondition,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, closeFn := newClient(t, tt.svc)
+			defer closeFn()
+			got, err := client.Withdraw(context.Background(), tt.req)
+			assert.Equal(t, tt.wantCode, status.Code(err))
+			if tt.want != nil {
+				assert.Equal(t, tt.want.GetUserId(), got.GetUserId())
+				assert.Equal(t, tt.want.GetBalance(), got.GetBalance())
+			}
+		})
+	}
+}
+
+func TestTransfer(t *testing.T) {
+	defer goleak.VerifyNone(t)
+	tests := []struct {
+		name     string
+		req      *walletpb.TransferRequest
+		svc      domain.WalletService
+		want     *walletpb.Wallet
+		wantCode codes.Code
+	}{
+		{
+			name:     "success",
+			req:      &walletpb.TransferRequest{UserId: "1", TransactionId: "txn-1", Amount: 40, PassiveUserId: "2"},
+			svc:      mockWalletService,
+			want:     &walletpb.Wallet{UserId: "1", Balance: 60},
+			wantCode: codes.OK,
+		},
+		{
+			name:     "userID is empty",
+			req:      &walletpb.TransferRequest{TransactionId: "txn-1", Amount: 40, PassiveUserId: "2"},
+			svc:      mockWalletService,
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name:     "transfer to self",
+			req:      &walletpb.TransferRequest{UserId: "1", TransactionId: "txn-1", Amount: 40, PassiveUserId: "1"},
+			svc:      mockErrorWalletService,
+			wantCode: codes.InvalidArgument,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, closeFn := newClient(t, tt.svc)
+			defer closeFn()
+			got, err := client.Transfer(context.Background(), tt.req)
+			assert.Equal(t, tt.wantCode, status.Code(err))
+			if tt.want != nil {
+				assert.Equal(t, tt.want.GetUserId(), got.GetUserId())
+				assert.Equal(t, tt.want.GetBalance(), got.GetBalance())
+			}
+		})
+	}
+}
+
+// historyService serves a fixed history newest first and honors the cursor
+func historyService(history []*domain.Transaction, calls *int) *wallet.MockWalletService {
+
+	return &wallet.MockWalletService{
+		GetTransactionsFunc: func(ctx context.Context, user domain.User, createdAt time.Time, lastReturnedID int, limit int) ([]*domain.Transaction, error) {
+			*calls++
+			transactions := []*domain.Transaction{}
+			for _, transaction := range history {
+				if lastReturnedID != 0 && transaction.ID >= lastReturnedID {
+					continue
+				}
+				if len(transactions) == limit {
+					break
+				}
+				transactions = append(transactions, transaction)
+			}
+
+			return transactions, nil
+		},
+	}
+}
+
+func TestGetTransactions(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	now := time.Now().UTC()
+	history := []*domain.Transaction{}
+	for i := 5; i > 0; i-- {
+		history = append(history, &domain.Transaction{
+			ID:            i,
+			TransactionID: domain.TransactionID("txn"),
+			UserID:        "1",
+			Amount:        i,
+			OperationType: domain.OperationTypeDeposit,
+			CreatedAt:     now.Add(time.Duration(i) * time.Second),
+		})
+	}
+
+	tests := []struct {
+		name      string
+		req       *walletpb.GetTransactionsRequest
+		wantIDs   []int64
+		wantCalls int
+		wantCode  codes.Code
+	}{
+		{
+			name:      "stream whole history in pages",
+			req:       &walletpb.GetTransactionsRequest{UserId: "1", PageSize: 2},
+			wantIDs:   []int64{5, 4, 3, 2, 1},
+			wantCalls: 3,
+		},
+		{
+			name:      "stream up to limit",
+			req:       &walletpb.GetTransactionsRequest{UserId: "1", PageSize: 2, Limit: 3},
+			wantIDs:   []int64{5, 4, 3},
+			wantCalls: 2,
+		},
+		{
+			name:      "stream from cursor",
+			req:       &walletpb.GetTransactionsRequest{UserId: "1", IdBefore: 3, CreatedBefore: timestamppb.New(now.Add(time.Hour))},
+			wantIDs:   []int64{2, 1},
+			wantCalls: 1,
+		},
+		{
+			name:     "userID is empty",
+			req:      &walletpb.GetTransactionsRequest{},
+			wantCode: codes.InvalidArgument,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			client, closeFn := newClient(t, historyService(history, &calls))
+			defer closeFn()
+			stream, err := client.GetTransactions(context.Background(), tt.req)
+			assert.NoError(t, err)
+
+			gotIDs := []int64{}
+			for {
+				transaction, err := stream.Recv()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					assert.Equal(t, tt.wantCode, status.Code(err))
+
+					return
+				}
+				assert.Equal(t, walletpb.OperationType_OPERATION_TYPE_DEPOSIT, transaction.GetOperationType())
+				gotIDs = append(gotIDs, transaction.GetId())
+			}
+
+			assert.Equal(t, codes.OK, tt.wantCode)
+			assert.Equal(t, tt.wantIDs, gotIDs)
+			assert.Equal(t, tt.wantCalls, calls)
+		})
+	}
+}
+
+func TestGetTransactionsError(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	client, closeFn := newClient(t, mockErrorWalletService)
+	defer closeFn()
+	stream, err := client.GetTransactions(context.Background(), &walletpb.GetTransactionsRequest{UserId: "1"})
+	assert.NoError(t, err)
+
+	_, err = stream.Recv()
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestGetTransactionsArchived(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	history := []*domain.Transaction{}
+	for i := 5; i > 0; i-- {
+		history = append(history, &domain.Transaction{ID: i, UserID: "1", OperationType: domain.OperationTypeDeposit})
+	}
+	calls := 0
+	// the transactions up to ID 2 are archived
+	live := historyService(history[:3], &calls)
+	all := historyService(history, &calls)
+	archiveService := func(archiveErr error) *wallet.MockWalletService {
+
+		return &wallet.MockWalletService{
+			GetTransactionsFunc: func(ctx context.Context, user domain.User, createdAt time.Time, lastReturnedID int, limit int) ([]*domain.Transaction, error) {
+				transactions, err := live.GetTransactions(ctx, user, createdAt, lastReturnedID, limit)
+				if err != nil || len(transactions) == limit {
+
+					return transactions, err
+				}
+				if !domain.ArchivedTransactions(ctx) {
+					if len(transactions) == 0 && lastReturnedID != 0 {
+
+						return nil, domain.ErrTransactionsArchived
+					}
+					domain.SetMoreArchived(ctx)
+
+					return transactions, nil
+				}
+				if archiveErr != nil {
+
+					return nil, archiveErr
+				}
+
+				return all.GetTransactions(ctx, user, createdAt, lastReturnedID, limit)
+			},
+		}
+	}
+
+	tests := []struct {
+		name       string
+		req        *walletpb.GetTransactionsRequest
+		archiveErr error
+		wantIDs    []int64
+		wantMore   bool
+		wantCode   codes.Code
+	}{
+		{
+			name:    "include archived",
+			req:     &walletpb.GetTransactionsRequest{UserId: "1", PageSize: 2, IncludeArchived: true},
+			wantIDs: []int64{5, 4, 3, 2, 1},
+		},
+		{
+			name:     "archived",
+			req:      &walletpb.GetTransactionsRequest{UserId: "1", PageSize: 2},
+			wantIDs:  []int64{5, 4, 3},
+			wantMore: true,
+		},
+		{
+			name:     "live transactions end with a page",
+			req:      &walletpb.GetTransactionsRequest{UserId: "1", PageSize: 3},
+			wantIDs:  []int64{5, 4, 3},
+			wantMore: true,
+		},
+		{
+			name:     "paging into archived",
+			req:      &walletpb.GetTransactionsRequest{UserId: "1", PageSize: 2, IdBefore: 3},
+			wantIDs:  []int64{},
+			wantCode: codes.FailedPrecondition,
+		},
+		{
+			name:       "archive offline",
+			req:        &walletpb.GetTransactionsRequest{UserId: "1", PageSize: 2, IncludeArchived: true},
+			archiveErr: domain.ErrArchiveOffline,
+			wantIDs:    []int64{5, 4},
+			wantCode:   codes.Unavailable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, closeFn := newClient(t, archiveService(tt.archiveErr))
+			defer closeFn()
+			stream, err := client.GetTransactions(context.Background(), tt.req)
+			assert.NoError(t, err)
+
+			gotIDs := []int64{}
+			for {
+				transaction, err := stream.Recv()
+				if err != nil {
+					assert.True(t, err == io.EOF && tt.wantCode == codes.OK || status.Code(err) == tt.wantCode, err)
+
+					break
+				}
+				gotIDs = append(gotIDs, transaction.GetId())
+			}
+			assert.Equal(t, tt.wantIDs, gotIDs)
+			assert.Equal(t, tt.wantMore, len(stream.Trailer().Get("x-more-archived")) > 0)
+		})
+	}
+}
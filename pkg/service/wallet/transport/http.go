@@ -5,10 +5,14 @@ import (
 	"time"
 
 	"github.com/sappy5678/cryptocom/pkg/domain"
+	"github.com/sappy5678/cryptocom/pkg/utl/server"
 
 	"github.com/labstack/echo"
 )
 
+// HeaderMoreArchived is true when a page of transactions stops before archived ones, read them with archived=true
+const HeaderMoreArchived = "X-More-Archived"
+
 // HTTP represents user http service
 type HTTP struct {
 	Service domain.WalletService
@@ -48,17 +52,36 @@ func NewHTTP(svc domain.WalletService, r *echo.Group) {
 	ur.PUT("/transfer", h.transfer)
 }
 
-// User create request
+// User create request, the body is optional
 // swagger:model userCreate
 type createReq struct {
-	UserID string
+	UserID string `json:"-"`
+	domain.WalletMetadata
+}
+
+// CreateResp is the wallet, created is false when it already existed
+type CreateResp struct {
+	*domain.Wallet
+	Created bool `json:"created"`
 }
 
 func (h HTTP) create(c echo.Context) error {
 	r := createReq{}
+	if c.Request().ContentLength != 0 {
+		if err := c.Bind(&r); err != nil {
+			err := c.JSON(http.StatusBadRequest, server.ErrorRespond(c, err))
+
+			if err != nil {
+				c.Logger().Error(err)
+			}
+
+			return err
+		}
+	}
+
 	userID := c.Param("userID")
 	if userID == "" {
-		err := c.JSON(http.StatusBadRequest, domain.ErrorRespond{Error: domain.ErrUserIDRequired.Error()})
+		err := c.JSON(http.StatusBadRequest, server.ErrorRespond(c, domain.ErrUserIDRequired))
 
 		if err != nil {
 			c.Logger().Error(err)
@@ -70,10 +93,10 @@ func (h HTTP) create(c echo.Context) error {
 
 	wallet, err := h.Service.Create(c.Request().Context(), domain.User{
 		ID: r.UserID,
-	})
+	}, r.WalletMetadata)
 
 	if err != nil {
-		err := c.JSON(http.StatusBadRequest, domain.ErrorRespond{Error: err.Error()})
+		err := c.JSON(http.StatusBadRequest, server.ErrorRespond(c, err))
 
 		if err != nil {
 			c.Logger().Error(err)
@@ -82,7 +105,7 @@ func (h HTTP) create(c echo.Context) error {
 		return err
 	}
 
-	return c.JSON(http.StatusOK, wallet)
+	return c.JSON(http.StatusOK, CreateResp{Wallet: wallet, Created: wallet.Created})
 }
 
 func (h HTTP) get(c echo.Context) error {
@@ -91,7 +114,7 @@ func (h HTTP) get(c echo.Context) error {
 
 	if userID == "" {
 
-		err := c.JSON(http.StatusBadRequest, domain.ErrorRespond{Error: domain.ErrUserIDRequired.Error()})
+		err := c.JSON(http.StatusBadRequest, server.ErrorRespond(c, domain.ErrUserIDRequired))
 		if err != nil {
 			c.Logger().Error(err)
 		}
@@ -106,7 +129,7 @@ func (h HTTP) get(c echo.Context) error {
 
 	if err != nil {
 
-		err := c.JSON(http.StatusBadRequest, domain.ErrorRespond{Error: err.Error()})
+		err := c.JSON(http.StatusBadRequest, server.ErrorRespond(c, err))
 		if err != nil {
 			c.Logger().Error(err)
 		}
@@ -139,7 +162,7 @@ func (h HTTP) deposit(c echo.Context) error {
 	if err := c.Bind(&r); err != nil {
 		c.Logger().Error(err)
 
-		err := c.JSON(http.StatusBadRequest, domain.ErrorRespond{Error: err.Error()})
+		err := c.JSON(http.StatusBadRequest, server.ErrorRespond(c, err))
 		if err != nil {
 			c.Logger().Error(err)
 		}
@@ -150,7 +173,7 @@ func (h HTTP) deposit(c echo.Context) error {
 	userID := c.Param("userID")
 	if userID == "" {
 		c.Logger().Error("userID is required")
-		err := c.JSON(http.StatusBadRequest, domain.ErrorRespond{Error: domain.ErrUserIDRequired.Error()})
+		err := c.JSON(http.StatusBadRequest, server.ErrorRespond(c, domain.ErrUserIDRequired))
 		if err != nil {
 			c.Logger().Error(err)
 		}
@@ -166,7 +189,7 @@ func (h HTTP) deposit(c echo.Context) error {
 	if err != nil {
 		c.Logger().Error(err)
 
-		err := c.JSON(http.StatusBadRequest, domain.ErrorRespond{Error: err.Error()})
+		err := c.JSON(http.StatusBadRequest, server.ErrorRespond(c, err))
 		if err != nil {
 			c.Logger().Error(err)
 		}
@@ -187,7 +210,7 @@ func (h HTTP) withdraw(c echo.Context) error {
 	r := WithdrawReq{}
 
 	if err := c.Bind(&r); err != nil {
-		err := c.JSON(http.StatusBadRequest, domain.ErrorRespond{Error: err.Error()})
+		err := c.JSON(http.StatusBadRequest, server.ErrorRespond(c, err))
 		if err != nil {
 			c.Logger().Error(err)
 		}
@@ -198,7 +221,7 @@ func (h HTTP) withdraw(c echo.Context) error {
 	userID := c.Param("userID")
 
 	if userID == "" {
-		err := c.JSON(http.StatusBadRequest, domain.ErrorRespond{Error: domain.ErrUserIDRequired.Error()})
+		err := c.JSON(http.StatusBadRequest, server.ErrorRespond(c, domain.ErrUserIDRequired))
 		if err != nil {
 			c.Logger().Error(err)
 		}
@@ -212,7 +235,7 @@ func (h HTTP) withdraw(c echo.Context) error {
 	}, domain.TransactionID(r.TransactionID), r.Amount)
 
 	if err != nil {
-		err := c.JSON(http.StatusBadRequest, domain.ErrorRespond{Error: err.Error()})
+		err := c.JSON(http.StatusBadRequest, server.ErrorRespond(c, err))
 
 		if err != nil {
 			c.Logger().Error(err)
@@ -229,6 +252,9 @@ type GetTransactionsReq struct {
 	CreatedBeforeStr string `query:"createdBefore"`
 	IDBefore         int    `query:"IDBefore"`
 	Limit            int    `query:"limit"`
+	// Archived continues the page in the archived months, without it a page stops before them with HeaderMoreArchived
+	// and a page starting past the live transactions fails
+	Archived bool `query:"archived"`
 }
 
 func (h HTTP) getTransactions(c echo.Context) error {
@@ -236,7 +262,7 @@ func (h HTTP) getTransactions(c echo.Context) error {
 
 	if err := c.Bind(&r); err != nil {
 
-		err := c.JSON(http.StatusBadRequest, domain.ErrorRespond{Error: err.Error()})
+		err := c.JSON(http.StatusBadRequest, server.ErrorRespond(c, err))
 		if err != nil {
 			c.Logger().Error(err)
 		}
@@ -246,7 +272,7 @@ func (h HTTP) getTransactions(c echo.Context) error {
 	userID := c.Param("userID")
 
 	if userID == "" {
-		err := c.JSON(http.StatusBadRequest, domain.ErrorRespond{Error: domain.ErrUserIDRequired.Error()})
+		err := c.JSON(http.StatusBadRequest, server.ErrorRespond(c, domain.ErrUserIDRequired))
 
 		if err != nil {
 			c.Logger().Error(err)
@@ -261,7 +287,7 @@ func (h HTTP) getTransactions(c echo.Context) error {
 		var err error
 		createdBefore, err = time.Parse(time.RFC3339, r.CreatedBeforeStr)
 		if err != nil {
-			err := c.JSON(http.StatusBadRequest, domain.ErrorRespond{Error: err.Error()})
+			err := c.JSON(http.StatusBadRequest, server.ErrorRespond(c, err))
 			if err != nil {
 				c.Logger().Error(err)
 			}
@@ -271,12 +297,18 @@ func (h HTTP) getTransactions(c echo.Context) error {
 	}
 
 	r.UserID = userID
-	transactions, err := h.Service.GetTransactions(c.Request().Context(), domain.User{
+	ctx := c.Request().Context()
+	if r.Archived {
+		ctx = domain.WithArchivedTransactions(ctx)
+	}
+	more := false
+	ctx = domain.WithMoreArchived(ctx, &more)
+	transactions, err := h.Service.GetTransactions(ctx, domain.User{
 		ID: r.UserID,
 	}, createdBefore, r.IDBefore, r.Limit)
 
 	if err != nil {
-		err := c.JSON(http.StatusBadRequest, domain.ErrorRespond{Error: err.Error()})
+		err := c.JSON(http.StatusBadRequest, server.ErrorRespond(c, err))
 
 		if err != nil {
 			c.Logger().Error(err)
@@ -284,6 +316,9 @@ func (h HTTP) getTransactions(c echo.Context) error {
 
 		return err
 	}
+	if more {
+		c.Response().Header().Set(HeaderMoreArchived, "true")
+	}
 
 	return c.JSON(http.StatusOK, transactions)
 }
@@ -298,7 +333,7 @@ type TransferReq struct {
 func (h HTTP) transfer(c echo.Context) error {
 	r := TransferReq{}
 	if err := c.Bind(&r); err != nil {
-		err := c.JSON(http.StatusBadRequest, domain.ErrorRespond{Error: err.Error()})
+		err := c.JSON(http.StatusBadRequest, server.ErrorRespond(c, err))
 
 		if err != nil {
 			c.Logger().Error(err)
@@ -308,7 +343,7 @@ func (h HTTP) transfer(c echo.Context) error {
 	}
 	userID := c.Param("userID")
 	if userID == "" {
-		err := c.JSON(http.StatusBadRequest, domain.ErrorRespond{Error: domain.ErrUserIDRequired.Error()})
+		err := c.JSON(http.StatusBadRequest, server.ErrorRespond(c, domain.ErrUserIDRequired))
 
 		if err != nil {
 			c.Logger().Error(err)
@@ -320,7 +355,7 @@ func (h HTTP) transfer(c echo.Context) error {
 	wallet, err := h.Service.Transfer(c.Request().Context(), domain.User{ID: r.UserID},
 		domain.TransactionID(r.TransactionID), r.Amount, domain.User{ID: r.PassiveUserID})
 	if err != nil {
-		err := c.JSON(http.StatusBadRequest, domain.ErrorRespond{Error: err.Error()})
+		err := c.JSON(http.StatusBadRequest, server.ErrorRespond(c, err))
 
 		if err != nil {
 			c.Logger().Error(err)
@@ -21,8 +21,8 @@ import (
 )
 
 var mockWalletService = &wallet.MockWalletService{
-	CreateFunc: func(ctx context.Context, user domain.User) (*domain.Wallet, error) {
-		return &domain.Wallet{UserID: user.ID, Balance: 0}, nil
+	CreateFunc: func(ctx context.Context, user domain.User, metadata domain.WalletMetadata) (*domain.Wallet, error) {
+		return &domain.Wallet{UserID: user.ID, Balance: 0, WalletMetadata: metadata, Created: true}, nil
 	},
 	GetFunc: func(ctx context.Context, user domain.User) (*domain.Wallet, error) {
 		return &domain.Wallet{UserID: user.ID, Balance: 0}, nil
@@ -46,7 +46,7 @@ var mockWalletService = &wallet.MockWalletService{
 
 var mockError = errors.New("error")
 var mockErrorWalletService = &wallet.MockWalletService{
-	CreateFunc: func(ctx context.Context, user domain.User) (*domain.Wallet, error) {
+	CreateFunc: func(ctx context.Context, user domain.User, metadata domain.WalletMetadata) (*domain.Wallet, error) {
 		return nil, mockError
 	},
 	GetFunc: func(ctx context.Context, user domain.User) (*domain.Wallet, error) {
@@ -74,24 +74,73 @@ func TestCreate(t *testing.T) {
 	tests := []struct {
 		name        string
 		userID      string
+		body        string
 		wantStatus  int
-		wantResp    *domain.Wallet
+		wantResp    *transport.CreateResp
 		wantErrResp *domain.ErrorRespond
+		// wantErrType is the kind of error the response names, its details come from the json decoder
+		wantErrType string
 		svc         domain.WalletService
 	}{
 		{
 			name:       "success",
 			userID:     "1",
+			body:       "{}",
 			wantStatus: http.StatusOK,
-			wantResp: &domain.Wallet{
-				UserID:  "1",
-				Balance: 0,
+			wantResp: &transport.CreateResp{
+				Wallet: &domain.Wallet{
+					UserID:  "1",
+					Balance: 0,
+				},
+				Created: true,
+			},
+			svc: mockWalletService,
+		},
+		{
+			name:       "no body",
+			userID:     "1",
+			wantStatus: http.StatusOK,
+			wantResp: &transport.CreateResp{
+				Wallet: &domain.Wallet{
+					UserID:  "1",
+					Balance: 0,
+				},
+				Created: true,
+			},
+			svc: mockWalletService,
+		},
+		{
+			name:       "metadata",
+			userID:     "1",
+			body:       `{"displayName": "Shop", "asset": "USD", "tags": ["merchant"]}`,
+			wantStatus: http.StatusOK,
+			wantResp: &transport.CreateResp{
+				Wallet: &domain.Wallet{
+					UserID:  "1",
+					Balance: 0,
+					WalletMetadata: domain.WalletMetadata{
+						DisplayName: "Shop",
+						Asset:       "USD",
+						Tags:        []string{"merchant"},
+					},
+				},
+				Created: true,
 			},
 			svc: mockWalletService,
 		},
+		{
+			name:        "invalid body",
+			userID:      "1",
+			body:        `{"tags": "merchant"}`,
+			wantStatus:  http.StatusBadRequest,
+			wantResp:    nil,
+			wantErrType: "Unmarshal type error",
+			svc:         mockWalletService,
+		},
 		{
 			name:       "userID is empty",
 			userID:     "",
+			body:       "{}",
 			wantStatus: http.StatusBadRequest,
 			wantResp:   nil,
 			wantErrResp: &domain.ErrorRespond{
@@ -102,6 +151,7 @@ func TestCreate(t *testing.T) {
 		{
 			name:       "error",
 			userID:     "1",
+			body:       "{}",
 			wantStatus: http.StatusBadRequest,
 			wantResp:   nil,
 			wantErrResp: &domain.ErrorRespond{
@@ -119,7 +169,7 @@ func TestCreate(t *testing.T) {
 			ts := httptest.NewServer(r)
 			defer ts.Close()
 			path := ts.URL + "/v1/user/" + tt.userID + "/wallet/create"
-			req, err := http.NewRequest(http.MethodPut, path, bytes.NewBufferString("{}"))
+			req, err := http.NewRequest(http.MethodPut, path, bytes.NewBufferString(tt.body))
 			if err != nil {
 				t.Fatal(err)
 			}
@@ -130,7 +180,7 @@ func TestCreate(t *testing.T) {
 			}
 			defer res.Body.Close()
 			if tt.wantResp != nil {
-				response := new(domain.Wallet)
+				response := new(transport.CreateResp)
 				if err := json.NewDecoder(res.Body).Decode(response); err != nil {
 					t.Fatal(err)
 				}
@@ -140,7 +190,11 @@ func TestCreate(t *testing.T) {
 				if err := json.NewDecoder(res.Body).Decode(response); err != nil {
 					t.Fatal(err)
 				}
-				assert.Equal(t, tt.wantErrResp, response)
+				if tt.wantErrType != "" {
+					assert.Contains(t, response.Error, tt.wantErrType)
+				} else {
+					assert.Equal(t, tt.wantErrResp, response)
+				}
 			}
 			assert.Equal(t, tt.wantStatus, res.StatusCode)
 		})
@@ -460,6 +514,7 @@ func TestGetTransactions(t *testing.T) {
 		wantStatus  int
 		wantResp    []*domain.Transaction
 		wantErrResp *domain.ErrorRespond
+		wantMore    string
 		svc         domain.WalletService
 	}{
 		{
@@ -504,6 +559,60 @@ func TestGetTransactions(t *testing.T) {
 			},
 			svc: mockErrorWalletService,
 		},
+		{
+			name:   "archived",
+			userID: "1",
+			req: transport.GetTransactionsReq{
+				Limit:    10,
+				Archived: true,
+			},
+			wantStatus: http.StatusOK,
+			wantResp:   []*domain.Transaction{{ID: 1, UserID: "1"}},
+			svc: &wallet.MockWalletService{
+				GetTransactionsFunc: func(ctx context.Context, user domain.User, createdAt time.Time, lastReturnedID int, limit int) ([]*domain.Transaction, error) {
+					if !domain.ArchivedTransactions(ctx) {
+						return nil, domain.ErrTransactionsArchived
+					}
+					return []*domain.Transaction{{ID: 1, UserID: user.ID}}, nil
+				},
+			},
+		},
+		{
+			name:   "stops before archived",
+			userID: "1",
+			req: transport.GetTransactionsReq{
+				Limit: 10,
+			},
+			wantStatus: http.StatusOK,
+			wantResp:   []*domain.Transaction{{ID: 2, UserID: "1"}},
+			wantMore:   "true",
+			svc: &wallet.MockWalletService{
+				GetTransactionsFunc: func(ctx context.Context, user domain.User, createdAt time.Time, lastReturnedID int, limit int) ([]*domain.Transaction, error) {
+					domain.SetMoreArchived(ctx)
+					return []*domain.Transaction{{ID: 2, UserID: user.ID}}, nil
+				},
+			},
+		},
+		{
+			name:   "paging into archived without the query",
+			userID: "1",
+			req: transport.GetTransactionsReq{
+				IDBefore: 2,
+				Limit:    10,
+			},
+			wantStatus: http.StatusBadRequest,
+			wantErrResp: &domain.ErrorRespond{
+				Error: domain.ErrTransactionsArchived.Error(),
+			},
+			svc: &wallet.MockWalletService{
+				GetTransactionsFunc: func(ctx context.Context, user domain.User, createdAt time.Time, lastReturnedID int, limit int) ([]*domain.Transaction, error) {
+					if !domain.ArchivedTransactions(ctx) {
+						return nil, domain.ErrTransactionsArchived
+					}
+					return []*domain.Transaction{}, nil
+				},
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -518,6 +627,9 @@ func TestGetTransactions(t *testing.T) {
 			query.Add("createdBefore", tt.req.CreatedBeforeStr)
 			query.Add("IDBefore", strconv.Itoa(tt.req.IDBefore))
 			query.Add("limit", strconv.Itoa(tt.req.Limit))
+			if tt.req.Archived {
+				query.Add("archived", "true")
+			}
 
 			req, err := http.NewRequest(http.MethodGet, path+"?"+query.Encode(), nil)
 			if err != nil {
@@ -544,6 +656,7 @@ func TestGetTransactions(t *testing.T) {
 				assert.Equal(t, tt.wantErrResp, response)
 			}
 			assert.Equal(t, tt.wantStatus, res.StatusCode)
+			assert.Equal(t, tt.wantMore, res.Header.Get(transport.HeaderMoreArchived))
 		})
 	}
 }
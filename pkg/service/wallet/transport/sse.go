@@ -0,0 +1,131 @@
+package transport
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo"
+
+	"github.com/sappy5678/cryptocom/pkg/domain"
+	"github.com/sappy5678/cryptocom/pkg/utl/server"
+)
+
+// keepAliveInterval sends a comment to keep idle connections open through proxies
+const keepAliveInterval = 15 * time.Second
+
+// SSE represents wallet server-sent events service
+type SSE struct {
+	Service domain.WalletEventService
+}
+
+// NewSSE creates new wallet server-sent events service
+func NewSSE(svc domain.WalletEventService, r *echo.Group) {
+	h := SSE{Service: svc}
+	ur := r.Group("/user/:userID/wallet")
+
+	// Subscribe wallet events
+	// GET /v1/users/{userID}/wallet/events
+	ur.GET("/events", h.events)
+}
+
+type EventsReq struct {
+	UserID      string
+	LastEventID int `query:"lastEventID"`
+}
+
+func (h SSE) events(c echo.Context) error {
+	r := EventsReq{}
+
+	if err := c.Bind(&r); err != nil {
+		err := c.JSON(http.StatusBadRequest, server.ErrorRespond(c, err))
+		if err != nil {
+			c.Logger().Error(err)
+		}
+
+		return err
+	}
+
+	userID := c.Param("userID")
+	if userID == "" {
+		err := c.JSON(http.StatusBadRequest, server.ErrorRespond(c, domain.ErrUserIDRequired))
+		if err != nil {
+			c.Logger().Error(err)
+		}
+
+		return err
+	}
+	r.UserID = userID
+
+	// the header is sent by EventSource on reconnect and wins over the query parameter
+	if lastEventID := c.Request().Header.Get("Last-Event-ID"); lastEventID != "" {
+		id, err := strconv.Atoi(lastEventID)
+		if err != nil {
+			err := c.JSON(http.StatusBadRequest, server.ErrorRespond(c, err))
+			if err != nil {
+				c.Logger().Error(err)
+			}
+
+			return err
+		}
+		r.LastEventID = id
+	}
+
+	ctx := c.Request().Context()
+	events, err := h.Service.Subscribe(ctx, domain.User{ID: r.UserID}, r.LastEventID)
+	if err != nil {
+		err := c.JSON(http.StatusBadRequest, server.ErrorRespond(c, err))
+		if err != nil {
+			c.Logger().Error(err)
+		}
+
+		return err
+	}
+
+	// the stream outlives the server write timeout
+	if err := http.NewResponseController(c.Response().Writer).SetWriteDeadline(time.Time{}); err != nil {
+		c.Logger().Warn(err)
+	}
+
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, "text/event-stream")
+	res.Header().Set("Cache-Control", "no-cache")
+	res.Header().Set("Connection", "keep-alive")
+	res.WriteHeader(http.StatusOK)
+	res.Flush()
+
+	keepAlive := time.NewTicker(keepAliveInterval)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+
+			return nil
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(res, ": keep-alive\n\n"); err != nil {
+
+				return nil
+			}
+			res.Flush()
+		case event, ok := <-events:
+			if !ok {
+
+				return nil
+			}
+			data, err := json.Marshal(event)
+			if err != nil {
+				c.Logger().Error(err)
+
+				return nil
+			}
+			if _, err := fmt.Fprintf(res, "id: %d\nevent: wallet\ndata: %s\n\n", event.ID, data); err != nil {
+
+				return nil
+			}
+			res.Flush()
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package transport_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
+
+	"github.com/sappy5678/cryptocom/pkg/domain"
+	"github.com/sappy5678/cryptocom/pkg/service/wallet/events"
+	"github.com/sappy5678/cryptocom/pkg/service/wallet/transport"
+	"github.com/sappy5678/cryptocom/pkg/utl/server"
+)
+
+func TestEvents(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	var gotLastEventID int
+	mockEventService := &events.MockWalletEventService{
+		SubscribeFunc: func(ctx context.Context, user domain.User, lastEventID int) (<-chan *domain.WalletEvent, error) {
+			if user.ID != "1" {
+
+				return nil, domain.ErrWalletNotFound
+			}
+			gotLastEventID = lastEventID
+			ch := make(chan *domain.WalletEvent, 2)
+			ch <- &domain.WalletEvent{ID: lastEventID + 1, UserID: user.ID, Balance: 100}
+			ch <- &domain.WalletEvent{ID: lastEventID + 2, UserID: user.ID, Balance: 50}
+			close(ch)
+
+			return ch, nil
+		},
+	}
+
+	tests := []struct {
+		name            string
+		userID          string
+		query           string
+		lastEventID     string
+		wantStatus      int
+		wantLastEventID int
+		wantIDs         []string
+		wantErrResp     *domain.ErrorRespond
+	}{
+		{
+			name:       "success",
+			userID:     "1",
+			wantStatus: http.StatusOK,
+			wantIDs:    []string{"1", "2"},
+		},
+		{
+			name:            "resume from query",
+			userID:          "1",
+			query:           "?lastEventID=5",
+			wantStatus:      http.StatusOK,
+			wantLastEventID: 5,
+			wantIDs:         []string{"6", "7"},
+		},
+		{
+			name:            "resume from header",
+			userID:          "1",
+			query:           "?lastEventID=5",
+			lastEventID:     "9",
+			wantStatus:      http.StatusOK,
+			wantLastEventID: 9,
+			wantIDs:         []string{"10", "11"},
+		},
+		{
+			name:        "invalid header",
+			userID:      "1",
+			lastEventID: "abc",
+			wantStatus:  http.StatusBadRequest,
+			wantErrResp: &domain.ErrorRespond{Error: `strconv.Atoi: parsing "abc": invalid syntax`},
+		},
+		{
+			name:        "wallet not found",
+			userID:      "2",
+			wantStatus:  http.StatusBadRequest,
+			wantErrResp: &domain.ErrorRespond{Error: domain.ErrWalletNotFound.Error()},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := server.New()
+			rg := r.Group("v1")
+			transport.NewSSE(mockEventService, rg)
+			ts := httptest.NewServer(r)
+			defer ts.Close()
+
+			req, err := http.NewRequest(http.MethodGet, ts.URL+"/v1/user/"+tt.userID+"/wallet/events"+tt.query, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.lastEventID != "" {
+				req.Header.Set("Last-Event-ID", tt.lastEventID)
+			}
+			res, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+			assert.Equal(t, tt.wantStatus, res.StatusCode)
+
+			if tt.wantErrResp != nil {
+				response := new(domain.ErrorRespond)
+				if err := json.NewDecoder(res.Body).Decode(response); err != nil {
+					t.Fatal(err)
+				}
+				assert.Equal(t, tt.wantErrResp, response)
+
+				return
+			}
+
+			assert.Equal(t, "text/event-stream", res.Header.Get("Content-Type"))
+			gotIDs := []string{}
+			scanner := bufio.NewScanner(res.Body)
+			for scanner.Scan() {
+				line := scanner.Text()
+				if strings.HasPrefix(line, "id: ") {
+					gotIDs = append(gotIDs, strings.TrimPrefix(line, "id: "))
+				}
+				if strings.HasPrefix(line, "data: ") {
+					event := new(domain.WalletEvent)
+					assert.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), event))
+					assert.Equal(t, tt.userID, event.UserID)
+				}
+			}
+			assert.Equal(t, tt.wantIDs, gotIDs)
+			assert.Equal(t, tt.wantLastEventID, gotLastEventID)
+		})
+	}
+}
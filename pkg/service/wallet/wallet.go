@@ -9,9 +9,9 @@ import (
 	"github.com/sappy5678/cryptocom/pkg/domain"
 )
 
-// Create creates a new user account
-func (w *Wallet) Create(ctx context.Context, user domain.User) (*domain.Wallet, error) {
-	wallet, err := w.walletRepo.Create(ctx, w.db, user)
+// Create creates the wallet of the user, or returns the existing one
+func (w *Wallet) Create(ctx context.Context, user domain.User, metadata domain.WalletMetadata) (*domain.Wallet, error) {
+	wallet, err := w.walletRepo.Create(ctx, w.db, user, metadata)
 	if err != nil {
 
 		return nil, err
@@ -21,7 +21,7 @@ func (w *Wallet) Create(ctx context.Context, user domain.User) (*domain.Wallet,
 }
 
 func (w *Wallet) Get(ctx context.Context, user domain.User) (*domain.Wallet, error) {
-	wallet, err := w.walletRepo.Get(ctx, w.db, user)
+	wallet, err := w.walletRepo.Get(ctx, w.readDB(ctx), user)
 	if err != nil {
 
 		return nil, err
@@ -58,7 +58,7 @@ func (w *Wallet) Deposit(ctx context.Context, user domain.User, transactionID do
 }
 
 func (w *Wallet) GetTransactions(ctx context.Context, user domain.User, createdAt time.Time, lastReturnedID int, limit int) ([]*domain.Transaction, error) {
-	transactions, err := w.walletRepo.GetTransactions(ctx, w.db, user, createdAt, lastReturnedID, limit)
+	transactions, err := w.walletRepo.GetTransactions(ctx, w.readDB(ctx), user, createdAt, lastReturnedID, limit)
 	if err != nil {
 
 		return nil, err
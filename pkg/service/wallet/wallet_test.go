@@ -16,54 +16,54 @@ import (
 )
 
 var mockWalletRepository = &repository.MockWalletRepository{
-	CreateFunc: func(ctx context.Context, db *sqlx.DB, user domain.User) (*domain.Wallet, error) {
+	CreateFunc: func(ctx context.Context, db sqlx.ExtContext, user domain.User, metadata domain.WalletMetadata) (*domain.Wallet, error) {
 
 		return &domain.Wallet{UserID: "1"}, nil
 	},
-	GetFunc: func(ctx context.Context, db *sqlx.DB, user domain.User) (*domain.Wallet, error) {
+	GetFunc: func(ctx context.Context, db sqlx.ExtContext, user domain.User) (*domain.Wallet, error) {
 
 		return &domain.Wallet{UserID: "1"}, nil
 	},
-	WithdrawFunc: func(ctx context.Context, db *sqlx.DB, time time.Time, user domain.User, transactionID domain.TransactionID, amount int) (*domain.Wallet, error) {
+	WithdrawFunc: func(ctx context.Context, db sqlx.ExtContext, time time.Time, user domain.User, transactionID domain.TransactionID, amount int) (*domain.Wallet, error) {
 
 		return &domain.Wallet{UserID: "1"}, nil
 	},
-	DepositFunc: func(ctx context.Context, db *sqlx.DB, time time.Time, user domain.User, transactionID domain.TransactionID, amount int) (*domain.Wallet, error) {
+	DepositFunc: func(ctx context.Context, db sqlx.ExtContext, time time.Time, user domain.User, transactionID domain.TransactionID, amount int) (*domain.Wallet, error) {
 
 		return &domain.Wallet{UserID: "1"}, nil
 	},
-	GetTransactionsFunc: func(ctx context.Context, db *sqlx.DB, user domain.User, createdBefore time.Time, IDBefore int, limit int) ([]*domain.Transaction, error) {
+	GetTransactionsFunc: func(ctx context.Context, db sqlx.ExtContext, user domain.User, createdBefore time.Time, IDBefore int, limit int) ([]*domain.Transaction, error) {
 
 		return []*domain.Transaction{{UserID: "1"}}, nil
 	},
-	TransferFunc: func(ctx context.Context, db *sqlx.DB, time time.Time, user domain.User, transactionID domain.TransactionID, amount int, passiveUser domain.User) (*domain.Wallet, error) {
+	TransferFunc: func(ctx context.Context, db sqlx.ExtContext, time time.Time, user domain.User, transactionID domain.TransactionID, amount int, passiveUser domain.User) (*domain.Wallet, error) {
 
 		return &domain.Wallet{UserID: "1"}, nil
 	},
 }
 
 var mockErrorWalletRepository = &repository.MockWalletRepository{
-	CreateFunc: func(ctx context.Context, db *sqlx.DB, user domain.User) (*domain.Wallet, error) {
+	CreateFunc: func(ctx context.Context, db sqlx.ExtContext, user domain.User, metadata domain.WalletMetadata) (*domain.Wallet, error) {
 
 		return nil, errors.New("error")
 	},
-	GetFunc: func(ctx context.Context, db *sqlx.DB, user domain.User) (*domain.Wallet, error) {
+	GetFunc: func(ctx context.Context, db sqlx.ExtContext, user domain.User) (*domain.Wallet, error) {
 
 		return nil, errors.New("error")
 	},
-	WithdrawFunc: func(ctx context.Context, db *sqlx.DB, time time.Time, user domain.User, transactionID domain.TransactionID, amount int) (*domain.Wallet, error) {
+	WithdrawFunc: func(ctx context.Context, db sqlx.ExtContext, time time.Time, user domain.User, transactionID domain.TransactionID, amount int) (*domain.Wallet, error) {
 
 		return nil, errors.New("error")
 	},
-	DepositFunc: func(ctx context.Context, db *sqlx.DB, time time.Time, user domain.User, transactionID domain.TransactionID, amount int) (*domain.Wallet, error) {
+	DepositFunc: func(ctx context.Context, db sqlx.ExtContext, time time.Time, user domain.User, transactionID domain.TransactionID, amount int) (*domain.Wallet, error) {
 
 		return nil, errors.New("error")
 	},
-	GetTransactionsFunc: func(ctx context.Context, db *sqlx.DB, user domain.User, createdBefore time.Time, IDBefore int, limit int) ([]*domain.Transaction, error) {
+	GetTransactionsFunc: func(ctx context.Context, db sqlx.ExtContext, user domain.User, createdBefore time.Time, IDBefore int, limit int) ([]*domain.Transaction, error) {
 
 		return nil, errors.New("error")
 	},
-	TransferFunc: func(ctx context.Context, db *sqlx.DB, time time.Time, user domain.User, transactionID domain.TransactionID, amount int, passiveUser domain.User) (*domain.Wallet, error) {
+	TransferFunc: func(ctx context.Context, db sqlx.ExtContext, time time.Time, user domain.User, transactionID domain.TransactionID, amount int, passiveUser domain.User) (*domain.Wallet, error) {
 
 		return nil, errors.New("error")
 	},
@@ -141,7 +141,7 @@ func TestCreate(t *testing.T) {
 	for _, tt := range cases {
 		t.Run(tt.name, func(t *testing.T) {
 			svc := wallet.New(tt.db, tt.mockRepo)
-			_, err := svc.Create(context.Background(), domain.User{ID: "1"})
+			_, err := svc.Create(context.Background(), domain.User{ID: "1"}, domain.WalletMetadata{})
 
 			if tt.wantErr {
 				assert.NotNil(t, err)
@@ -360,3 +360,100 @@ func TestCreateTransactionID(t *testing.T) {
 		})
 	}
 }
+
+// readerFunc chooses the executor of reads with a function
+type readerFunc func(ctx context.Context) sqlx.ExtContext
+
+func (f readerFunc) Reader(ctx context.Context) sqlx.ExtContext {
+
+	return f(ctx)
+}
+
+func TestNewWithReader(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	primary, replica := &sqlx.DB{}, &sqlx.DB{}
+	got := map[string]sqlx.ExtContext{}
+	repo := &repository.MockWalletRepository{
+		GetFunc: func(ctx context.Context, db sqlx.ExtContext, user domain.User) (*domain.Wallet, error) {
+			got["get"] = db
+
+			return &domain.Wallet{UserID: "1"}, nil
+		},
+		GetTransactionsFunc: func(ctx context.Context, db sqlx.ExtContext, user domain.User, createdBefore time.Time, IDBefore int, limit int) ([]*domain.Transaction, error) {
+			got["getTransactions"] = db
+
+			return []*domain.Transaction{}, nil
+		},
+		DepositFunc: func(ctx context.Context, db sqlx.ExtContext, time time.Time, user domain.User, transactionID domain.TransactionID, amount int) (*domain.Wallet, error) {
+			got["deposit"] = db
+
+			return &domain.Wallet{UserID: "1"}, nil
+		},
+	}
+	svc := wallet.NewWithReader(primary, readerFunc(func(ctx context.Context) sqlx.ExtContext {
+
+		return replica
+	}), repo)
+
+	ctx := context.Background()
+	user := domain.User{ID: "1"}
+	_, err := svc.Get(ctx, user)
+	assert.NoError(t, err)
+	_, err = svc.GetTransactions(ctx, user, time.Time{}, 0, 0)
+	assert.NoError(t, err)
+	_, err = svc.Deposit(ctx, user, "test-tx", 10)
+	assert.NoError(t, err)
+
+	// reads go to the reader, writes to the primary
+	assert.Same(t, replica, got["get"])
+	assert.Same(t, replica, got["getTransactions"])
+	assert.Same(t, primary, got["deposit"])
+
+	// reads of a cache miss go to the primary
+	ctx = domain.WithPrimaryRead(ctx)
+	_, err = svc.Get(ctx, user)
+	assert.NoError(t, err)
+	_, err = svc.GetTransactions(ctx, user, time.Time{}, 0, 0)
+	assert.NoError(t, err)
+	assert.Same(t, primary, got["get"])
+	assert.Same(t, primary, got["getTransactions"])
+}
+
+func TestUnitOfWork(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	// the memory repository runs without a database
+	notified := []string{}
+	repo := repository.NewMemory()
+	repo.Notify = func(userID string) { notified = append(notified, userID) }
+	svc := wallet.New(nil, repo).(*wallet.Wallet)
+
+	ctx := context.Background()
+	user := domain.User{ID: "1"}
+	_, err := svc.Create(ctx, user, domain.WalletMetadata{})
+	assert.NoError(t, err)
+
+	errAbort := errors.New("abort")
+	err = svc.UnitOfWork(ctx, nil, func(tx *repository.Tx) error {
+		if _, err := repo.Deposit(ctx, tx, time.Now(), user, "tx-1", 10); err != nil {
+
+			return err
+		}
+
+		return errAbort
+	})
+	assert.ErrorIs(t, err, errAbort)
+	assert.Empty(t, notified)
+
+	err = svc.UnitOfWork(ctx, nil, func(tx *repository.Tx) error {
+		_, err := repo.Deposit(ctx, tx, time.Now(), user, "tx-1", 10)
+
+		return err
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{user.ID}, notified)
+	got, err := svc.Get(ctx, user)
+	assert.NoError(t, err)
+	assert.Equal(t, 10, got.Balance)
+}
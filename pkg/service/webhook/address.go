@@ -0,0 +1,80 @@
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+
+	"github.com/sappy5678/cryptocom/pkg/domain"
+)
+
+// publicIP reports whether webhooks may be sent to ip, loopback, private, link-local, unspecified and multicast
+// addresses reach the network of the service, like the cloud metadata at 169.254.169.254, so they are refused
+func publicIP(ip net.IP) bool {
+
+	return !ip.IsLoopback() && !ip.IsPrivate() && !ip.IsLinkLocalUnicast() && !ip.IsLinkLocalMulticast() &&
+		!ip.IsInterfaceLocalMulticast() && !ip.IsMulticast() && !ip.IsUnspecified()
+}
+
+// checkHost refuses a host which is, or resolves to, an address that is not public
+func checkHost(ctx context.Context, lookupIPAddr func(ctx context.Context, host string) ([]net.IPAddr, error), host string) error {
+	ips := []net.IP{}
+	if ip := net.ParseIP(host); ip != nil {
+		ips = append(ips, ip)
+	} else {
+		addrs, err := lookupIPAddr(ctx, host)
+		if err != nil {
+
+			return fmt.Errorf("%w: %v", domain.ErrInvalidWebhookURL, err)
+		}
+		for _, addr := range addrs {
+			ips = append(ips, addr.IP)
+		}
+	}
+
+	for _, ip := range ips {
+		if !publicIP(ip) {
+
+			return fmt.Errorf("%w: %s", domain.ErrForbiddenWebhookAddress, ip)
+		}
+	}
+
+	return nil
+}
+
+// dialControl refuses to connect to an address that is not public, it runs on the resolved address,
+// so a host resolving to another address since its registration, or a redirect, is refused as well
+func dialControl(_ string, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || !publicIP(ip) {
+
+		return fmt.Errorf("%w: %s", domain.ErrForbiddenWebhookAddress, host)
+	}
+
+	return nil
+}
+
+// newClient creates the client of the dispatcher, it dials public addresses only and ignores the proxy environment,
+// a proxy would be dialed instead of the endpoint
+func newClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second, Control: dialControl}
+
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext:           dialer.DialContext,
+			ForceAttemptHTTP2:     true,
+			MaxIdleConns:          100,
+			IdleConnTimeout:       90 * time.Second,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ExpectContinueTimeout: time.Second,
+		},
+	}
+}
@@ -0,0 +1,218 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/sappy5678/cryptocom/pkg/domain"
+	"github.com/sappy5678/cryptocom/pkg/service/webhook/repository"
+)
+
+const source = "webhook"
+
+// NewDispatcher creates new webhook dispatcher with defaults
+func NewDispatcher(db *sqlx.DB, webhookRepo repository.WebhookRepository, logger domain.Logger) *Dispatcher {
+
+	return &Dispatcher{
+		db:           db,
+		webhookRepo:  webhookRepo,
+		logger:       logger,
+		Client:       newClient(10 * time.Second),
+		BatchSize:    50,
+		Workers:      10,
+		MaxAttempts:  10,
+		PollInterval: time.Second,
+		Lease:        time.Minute,
+		BaseBackoff:  10 * time.Second,
+		MaxBackoff:   6 * time.Hour,
+	}
+}
+
+// Dispatcher delivers pending webhook deliveries,
+// failed deliveries are retried with exponential backoff until MaxAttempts, then they are dead
+type Dispatcher struct {
+	db          *sqlx.DB
+	webhookRepo repository.WebhookRepository
+	logger      domain.Logger
+
+	// Client sends the deliveries, the default one refuses the addresses which are not public
+	Client    *http.Client
+	BatchSize int
+	// Workers is the number of deliveries of a batch sent concurrently
+	Workers      int
+	MaxAttempts  int
+	PollInterval time.Duration
+	// Lease is how long a claimed delivery is hidden from other dispatchers, a batch is capped to what Workers
+	// can send within it, one Client.Timeout is kept to mark the results, and sends still running when it ends are cut
+	Lease       time.Duration
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+}
+
+// Run dispatches deliveries until ctx is done
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		// drain the queue before waiting for the next tick
+		if _, err := d.Drain(ctx); err != nil {
+			d.logger.Log(ctx, source, "Dispatch webhook deliveries", err, nil)
+		}
+
+		select {
+		case <-ctx.Done():
+
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Drain dispatches batches of due deliveries until a batch is not full, it returns the number of deliveries,
+// the job runner calls it every PollInterval on its leader
+func (d *Dispatcher) Drain(ctx context.Context) (int, error) {
+	dispatched := 0
+	for {
+		n, err := d.DispatchOnce(ctx, time.Now())
+		dispatched += n
+		if err != nil || n < d.batchSize() || ctx.Err() != nil {
+
+			return dispatched, err
+		}
+	}
+}
+
+// DispatchOnce claims one batch of due deliveries and delivers them concurrently, it returns the batch size
+func (d *Dispatcher) DispatchOnce(ctx context.Context, now time.Time) (int, error) {
+	leaseUntil := now.Add(d.Lease)
+	dispatches, err := d.webhookRepo.ClaimDeliveries(ctx, d.db, now, leaseUntil, d.batchSize())
+	if err != nil {
+
+		return 0, err
+	}
+
+	// another dispatcher claims the deliveries again once the lease ends, so no send outlives it
+	sendCtx, cancel := context.WithDeadline(ctx, leaseUntil)
+	defer cancel()
+
+	queue := make(chan *repository.Dispatch, len(dispatches))
+	for _, dispatch := range dispatches {
+		queue <- dispatch
+	}
+	close(queue)
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+	)
+	for i := 0; i < d.Workers && i < len(dispatches); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for dispatch := range queue {
+				if err := d.dispatch(ctx, sendCtx, dispatch); err != nil {
+					mu.Lock()
+					if firstErr == nil {
+						firstErr = err
+					}
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	return len(dispatches), firstErr
+}
+
+// batchSize caps BatchSize to the deliveries Workers can send within the lease, keeping one Client.Timeout to mark them
+func (d *Dispatcher) batchSize() int {
+	if d.Client.Timeout <= 0 {
+
+		return d.BatchSize
+	}
+	rounds := int(d.Lease/d.Client.Timeout) - 1
+	if rounds < 1 {
+		rounds = 1
+	}
+
+	return min(d.BatchSize, rounds*d.Workers)
+}
+
+// dispatch sends the delivery within sendCtx and records the result with ctx, which outlives the lease
+func (d *Dispatcher) dispatch(ctx context.Context, sendCtx context.Context, dispatch *repository.Dispatch) error {
+	if err := d.deliver(sendCtx, dispatch, time.Now()); err != nil {
+
+		return d.fail(ctx, dispatch, err, time.Now())
+	}
+
+	return d.webhookRepo.MarkDelivered(ctx, d.db, dispatch.ID, dispatch.Attempts)
+}
+
+// deliver posts the delivery signed at now, the time it is sent
+func (d *Dispatcher) deliver(ctx context.Context, dispatch *repository.Dispatch, now time.Time) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, dispatch.URL, bytes.NewReader(dispatch.Payload))
+	if err != nil {
+
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Webhook-ID", strconv.Itoa(dispatch.ID))
+	req.Header.Set("X-Webhook-Event", dispatch.EventType)
+	req.Header.Set(SignatureHeader, Sign(dispatch.Secret, now, dispatch.Payload))
+
+	res, err := d.Client.Do(req)
+	if err != nil {
+
+		return err
+	}
+	defer res.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(res.Body, 1<<16))
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+
+		return fmt.Errorf("unexpected status code %d", res.StatusCode)
+	}
+
+	return nil
+}
+
+func (d *Dispatcher) fail(ctx context.Context, dispatch *repository.Dispatch, deliverErr error, now time.Time) error {
+	status := domain.WebhookDeliveryStatusPending
+	if dispatch.Attempts >= d.MaxAttempts {
+		status = domain.WebhookDeliveryStatusDead
+	}
+
+	d.logger.Log(ctx, source, "Deliver webhook", deliverErr, map[string]interface{}{
+		"deliveryID": dispatch.ID,
+		"attempts":   dispatch.Attempts,
+		"dead":       status == domain.WebhookDeliveryStatusDead,
+	})
+
+	return d.webhookRepo.MarkFailed(ctx, d.db, dispatch.ID, dispatch.Attempts, deliverErr.Error(),
+		now.Add(d.Backoff(dispatch.Attempts)), status)
+}
+
+// Backoff returns the delay before the next attempt, it doubles on every attempt up to MaxBackoff
+func (d *Dispatcher) Backoff(attempts int) time.Duration {
+	backoff := d.BaseBackoff
+	for i := 1; i < attempts; i++ {
+		backoff *= 2
+		if backoff >= d.MaxBackoff {
+
+			return d.MaxBackoff
+		}
+	}
+
+	return backoff
+}
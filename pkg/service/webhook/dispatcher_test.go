@@ -0,0 +1,249 @@
+package webhook_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/sappy5678/cryptocom/pkg/domain"
+	"github.com/sappy5678/cryptocom/pkg/service/webhook"
+	"github.com/sappy5678/cryptocom/pkg/service/webhook/repository"
+	"github.com/sappy5678/cryptocom/pkg/utl/zlog"
+)
+
+type result struct {
+	mu        sync.Mutex
+	limit     int
+	delivered map[int]int
+	failed    map[int]domain.WebhookDeliveryStatus
+	next      map[int]time.Time
+	errors    map[int]string
+}
+
+func newResult() *result {
+
+	return &result{
+		delivered: map[int]int{},
+		failed:    map[int]domain.WebhookDeliveryStatus{},
+		next:      map[int]time.Time{},
+		errors:    map[int]string{},
+	}
+}
+
+func dispatchRepository(dispatches []*repository.Dispatch, res *result) *repository.MockWebhookRepository {
+
+	return &repository.MockWebhookRepository{
+		ClaimDeliveriesFunc: func(ctx context.Context, db *sqlx.DB, now time.Time, leaseUntil time.Time, limit int) ([]*repository.Dispatch, error) {
+			res.limit = limit
+
+			return dispatches, nil
+		},
+		MarkDeliveredFunc: func(ctx context.Context, db *sqlx.DB, deliveryID int, attempts int) error {
+			res.mu.Lock()
+			defer res.mu.Unlock()
+			res.delivered[deliveryID] = attempts
+
+			return nil
+		},
+		MarkFailedFunc: func(ctx context.Context, db *sqlx.DB, deliveryID int, attempts int, lastError string, nextAttemptAt time.Time, status domain.WebhookDeliveryStatus) error {
+			res.mu.Lock()
+			defer res.mu.Unlock()
+			res.failed[deliveryID] = status
+			res.next[deliveryID] = nextAttemptAt
+			res.errors[deliveryID] = lastError
+
+			return nil
+		},
+	}
+}
+
+func TestDispatchOnce(t *testing.T) {
+	now := time.Now()
+	payload := []byte(`{"eventType":1}`)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		// signed when sent
+		if err := webhook.Verify("secret", r.Header.Get(webhook.SignatureHeader), body, time.Now(), time.Second); err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+
+			return
+		}
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ts.Close()
+
+	dispatches := []*repository.Dispatch{
+		{WebhookDelivery: domain.WebhookDelivery{ID: 1, Payload: payload, Attempts: 1}, URL: ts.URL + "/ok", Secret: "secret"},
+		{WebhookDelivery: domain.WebhookDelivery{ID: 2, Payload: payload, Attempts: 3}, URL: ts.URL + "/fail", Secret: "secret"},
+		{WebhookDelivery: domain.WebhookDelivery{ID: 3, Payload: payload, Attempts: 10}, URL: ts.URL + "/fail", Secret: "secret"},
+		{WebhookDelivery: domain.WebhookDelivery{ID: 4, Payload: payload, Attempts: 1}, URL: ts.URL + "/ok", Secret: "wrong"},
+	}
+	res := newResult()
+
+	dispatcher := webhook.NewDispatcher(&sqlx.DB{}, dispatchRepository(dispatches, res), zlog.New())
+	// the default client refuses the loopback test server
+	dispatcher.Client = ts.Client()
+	n, err := dispatcher.DispatchOnce(context.Background(), now)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, n)
+
+	// the marks carry the attempt of the claim
+	assert.Equal(t, map[int]int{1: 1}, res.delivered)
+	assert.Equal(t, map[int]domain.WebhookDeliveryStatus{
+		2: domain.WebhookDeliveryStatusPending,
+		3: domain.WebhookDeliveryStatusDead,
+		4: domain.WebhookDeliveryStatusPending,
+	}, res.failed)
+	// backed off from the failure, not the claim
+	assert.WithinDuration(t, time.Now().Add(40*time.Second), res.next[2], time.Second)
+	assert.False(t, res.next[2].Before(now.Add(40*time.Second)))
+}
+
+func TestDispatchOnceLease(t *testing.T) {
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ts.Close()
+	defer close(release)
+
+	dispatches := []*repository.Dispatch{}
+	for i := 1; i <= 4; i++ {
+		dispatches = append(dispatches, &repository.Dispatch{
+			WebhookDelivery: domain.WebhookDelivery{ID: i, Payload: []byte(`{}`), Attempts: 1},
+			URL:             ts.URL,
+			Secret:          "secret",
+		})
+	}
+	res := newResult()
+
+	dispatcher := webhook.NewDispatcher(&sqlx.DB{}, dispatchRepository(dispatches, res), zlog.New())
+	dispatcher.Workers = 4
+	dispatcher.Lease = 200 * time.Millisecond
+	dispatcher.Client = ts.Client()
+	dispatcher.Client.Timeout = time.Minute
+
+	// the hanging sends run concurrently and are cut when the lease ends instead of one after another
+	start := time.Now()
+	n, err := dispatcher.DispatchOnce(context.Background(), start)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, n)
+	assert.Less(t, time.Since(start), 2*time.Second)
+	assert.Len(t, res.failed, 4)
+	assert.Contains(t, res.errors[1], "deadline exceeded")
+	// a lease shorter than two timeouts leaves one round to the workers
+	assert.Equal(t, 4, res.limit)
+}
+
+func TestDispatchOnceForbiddenAddress(t *testing.T) {
+	hit := false
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hit = true
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ts.Close()
+
+	// a host registered with a public address may resolve to a loopback one later
+	dispatches := []*repository.Dispatch{
+		{WebhookDelivery: domain.WebhookDelivery{ID: 1, Payload: []byte(`{}`), Attempts: 1}, URL: ts.URL, Secret: "secret"},
+	}
+	res := newResult()
+
+	dispatcher := webhook.NewDispatcher(&sqlx.DB{}, dispatchRepository(dispatches, res), zlog.New())
+	_, err := dispatcher.DispatchOnce(context.Background(), time.Now())
+	assert.NoError(t, err)
+	assert.False(t, hit)
+	assert.Equal(t, map[int]domain.WebhookDeliveryStatus{1: domain.WebhookDeliveryStatusPending}, res.failed)
+	assert.Contains(t, res.errors[1], domain.ErrForbiddenWebhookAddress.Error())
+}
+
+func TestDispatchOnceBatchSize(t *testing.T) {
+	res := newResult()
+	dispatcher := webhook.NewDispatcher(&sqlx.DB{}, dispatchRepository(nil, res), zlog.New())
+
+	// 10 workers send 5 rounds of 10s requests within the 1 minute lease, keeping 10s to mark them
+	dispatcher.BatchSize = 100
+	_, err := dispatcher.DispatchOnce(context.Background(), time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, 50, res.limit)
+
+	dispatcher.BatchSize = 20
+	_, err = dispatcher.DispatchOnce(context.Background(), time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, 20, res.limit)
+}
+
+func TestDispatchOnceClaimError(t *testing.T) {
+	dispatcher := webhook.NewDispatcher(&sqlx.DB{}, &repository.MockWebhookRepository{
+		ClaimDeliveriesFunc: func(ctx context.Context, db *sqlx.DB, now time.Time, leaseUntil time.Time, limit int) ([]*repository.Dispatch, error) {
+
+			return nil, errors.New("error")
+		},
+	}, zlog.New())
+
+	_, err := dispatcher.DispatchOnce(context.Background(), time.Now())
+	assert.Error(t, err)
+}
+
+func TestDrain(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ts.Close()
+
+	pending := []*repository.Dispatch{}
+	for i := 1; i <= 3; i++ {
+		pending = append(pending, &repository.Dispatch{
+			WebhookDelivery: domain.WebhookDelivery{ID: i, Payload: []byte(`{}`), Attempts: 1},
+			URL:             ts.URL,
+			Secret:          "secret",
+		})
+	}
+	res := newResult()
+	repo := dispatchRepository(nil, res)
+	repo.ClaimDeliveriesFunc = func(ctx context.Context, db *sqlx.DB, now time.Time, leaseUntil time.Time, limit int) ([]*repository.Dispatch, error) {
+		claimed := pending[:min(limit, len(pending))]
+		pending = pending[len(claimed):]
+
+		return claimed, nil
+	}
+
+	// full batches are followed by the next one
+	dispatcher := webhook.NewDispatcher(&sqlx.DB{}, repo, zlog.New())
+	dispatcher.Client = ts.Client()
+	dispatcher.BatchSize = 2
+	n, err := dispatcher.Drain(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 3, n)
+	assert.Equal(t, map[int]int{1: 1, 2: 1, 3: 1}, res.delivered)
+}
+
+func TestBackoff(t *testing.T) {
+	dispatcher := webhook.NewDispatcher(&sqlx.DB{}, nil, nil)
+	dispatcher.BaseBackoff = time.Second
+	dispatcher.MaxBackoff = 10 * time.Second
+
+	assert.Equal(t, time.Second, dispatcher.Backoff(1))
+	assert.Equal(t, 2*time.Second, dispatcher.Backoff(2))
+	assert.Equal(t, 8*time.Second, dispatcher.Backoff(4))
+	assert.Equal(t, 10*time.Second, dispatcher.Backoff(5))
+	assert.Equal(t, 10*time.Second, dispatcher.Backoff(50))
+}
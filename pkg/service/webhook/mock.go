@@ -0,0 +1,58 @@
+package webhook
+
+import (
+	"context"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/sappy5678/cryptocom/pkg/domain"
+)
+
+type MockWebhookService struct {
+	RegisterFunc      func(ctx context.Context, user domain.User, url string, eventTypes []string) (*domain.WebhookEndpoint, error)
+	ListFunc          func(ctx context.Context, user domain.User) ([]*domain.WebhookEndpoint, error)
+	DeleteFunc        func(ctx context.Context, user domain.User, endpointID int) error
+	GetDeliveriesFunc func(ctx context.Context, user domain.User, endpointID int, status *domain.WebhookDeliveryStatus, IDBefore int, limit int) ([]*domain.WebhookDelivery, error)
+	RedeliverFunc     func(ctx context.Context, user domain.User, deliveryID int) (*domain.WebhookDelivery, error)
+	RedeliverDeadFunc func(ctx context.Context, user domain.User, endpointID int) (*domain.Job, error)
+}
+
+func (m *MockWebhookService) Register(ctx context.Context, user domain.User, url string, eventTypes []string) (*domain.WebhookEndpoint, error) {
+
+	return m.RegisterFunc(ctx, user, url, eventTypes)
+}
+
+func (m *MockWebhookService) List(ctx context.Context, user domain.User) ([]*domain.WebhookEndpoint, error) {
+
+	return m.ListFunc(ctx, user)
+}
+
+func (m *MockWebhookService) Delete(ctx context.Context, user domain.User, endpointID int) error {
+
+	return m.DeleteFunc(ctx, user, endpointID)
+}
+
+func (m *MockWebhookService) GetDeliveries(ctx context.Context, user domain.User, endpointID int, status *domain.WebhookDeliveryStatus, IDBefore int, limit int) ([]*domain.WebhookDelivery, error) {
+
+	return m.GetDeliveriesFunc(ctx, user, endpointID, status, IDBefore, limit)
+}
+
+func (m *MockWebhookService) Redeliver(ctx context.Context, user domain.User, deliveryID int) (*domain.WebhookDelivery, error) {
+
+	return m.RedeliverFunc(ctx, user, deliveryID)
+}
+
+func (m *MockWebhookService) RedeliverDead(ctx context.Context, user domain.User, endpointID int) (*domain.Job, error) {
+
+	return m.RedeliverDeadFunc(ctx, user, endpointID)
+}
+
+type MockQueue struct {
+	EnqueueFunc func(ctx context.Context, db sqlx.ExtContext, jobType string, payload interface{}, runAt time.Time) (*domain.Job, error)
+}
+
+func (m *MockQueue) Enqueue(ctx context.Context, db sqlx.ExtContext, jobType string, payload interface{}, runAt time.Time) (*domain.Job, error) {
+
+	return m.EnqueueFunc(ctx, db, jobType, payload, runAt)
+}
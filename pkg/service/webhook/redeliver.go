@@ -0,0 +1,44 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/sappy5678/cryptocom/pkg/domain"
+	"github.com/sappy5678/cryptocom/pkg/service/webhook/repository"
+)
+
+// RedeliverDeadJob is the job type putting the dead deliveries of an endpoint back to the queue
+const RedeliverDeadJob = "webhook.redeliver_dead"
+
+// redeliverDeadBatch is how many deliveries one statement of the job puts back, so no statement holds many row locks
+const redeliverDeadBatch = 1000
+
+type redeliverDeadPayload struct {
+	UserID     string `json:"userID"`
+	EndpointID int    `json:"endpointID"`
+}
+
+// RedeliverDeadHandler returns the job handler of RedeliverDeadJob, it puts the dead deliveries back batch by batch
+// until a batch is not full, a retried job goes on with the deliveries still dead
+func RedeliverDeadHandler(db *sqlx.DB, webhookRepo repository.WebhookRepository) func(ctx context.Context, job *domain.Job) error {
+
+	return func(ctx context.Context, job *domain.Job) error {
+		payload := redeliverDeadPayload{}
+		if err := json.Unmarshal(job.Payload, &payload); err != nil {
+
+			return err
+		}
+
+		for {
+			n, err := webhookRepo.RedeliverDead(ctx, db, time.Now(), domain.User{ID: payload.UserID}, payload.EndpointID, redeliverDeadBatch)
+			if err != nil || n < redeliverDeadBatch {
+
+				return err
+			}
+		}
+	}
+}
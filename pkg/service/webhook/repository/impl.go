@@ -0,0 +1,235 @@
+package repository
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+
+	"github.com/sappy5678/cryptocom/pkg/domain"
+	wr "github.com/sappy5678/cryptocom/pkg/service/wallet/repository"
+)
+
+// Webhook represents the client for webhook tables
+type Webhook struct{}
+
+type endpointRow struct {
+	ID         int            `db:"id"`
+	UserID     string         `db:"userid"`
+	URL        string         `db:"url"`
+	Secret     string         `db:"secret"`
+	EventTypes pq.StringArray `db:"eventtypes"`
+	CreatedAt  time.Time      `db:"createdat"`
+}
+
+func (r *endpointRow) toEndpoint() *domain.WebhookEndpoint {
+	eventTypes := append([]string{}, r.EventTypes...)
+
+	return &domain.WebhookEndpoint{
+		ID:         r.ID,
+		UserID:     r.UserID,
+		URL:        r.URL,
+		Secret:     r.Secret,
+		EventTypes: eventTypes,
+		CreatedAt:  wr.TimeToUTC(r.CreatedAt),
+	}
+}
+
+func cleanDelivery(delivery *domain.WebhookDelivery) {
+	delivery.NextAttemptAt = wr.TimeToUTC(delivery.NextAttemptAt)
+	delivery.CreatedAt = wr.TimeToUTC(delivery.CreatedAt)
+}
+
+const createEndpointQuery = `INSERT INTO WebhookEndpoint (userID, url, secret, eventTypes, createdAt) VALUES ($1, $2, $3, $4, $5) RETURNING ID, userID, url, secret, eventTypes, createdAt`
+
+func (w *Webhook) CreateEndpoint(ctx context.Context, db *sqlx.DB, now time.Time, endpoint *domain.WebhookEndpoint) (*domain.WebhookEndpoint, error) {
+	// an empty array, not NULL, subscribes to every event type
+	eventTypes := append(pq.StringArray{}, endpoint.EventTypes...)
+
+	row := endpointRow{}
+	if err := db.GetContext(ctx, &row, createEndpointQuery, endpoint.UserID, endpoint.URL, endpoint.Secret,
+		eventTypes, wr.TimeToUTC(now)); err != nil {
+
+		return nil, err
+	}
+
+	return row.toEndpoint(), nil
+}
+
+const listEndpointsQuery = `SELECT ID, userID, url, secret, eventTypes, createdAt FROM WebhookEndpoint WHERE userID = $1 ORDER BY ID`
+
+func (w *Webhook) ListEndpoints(ctx context.Context, db *sqlx.DB, user domain.User) ([]*domain.WebhookEndpoint, error) {
+	rows := []*endpointRow{}
+	if err := db.SelectContext(ctx, &rows, listEndpointsQuery, user.ID); err != nil {
+
+		return nil, err
+	}
+
+	endpoints := make([]*domain.WebhookEndpoint, 0, len(rows))
+	for _, row := range rows {
+		endpoints = append(endpoints, row.toEndpoint())
+	}
+
+	return endpoints, nil
+}
+
+const deleteEndpointQuery = `DELETE FROM WebhookEndpoint WHERE ID = $1 AND userID = $2`
+
+func (w *Webhook) DeleteEndpoint(ctx context.Context, db *sqlx.DB, user domain.User, endpointID int) error {
+	result, err := db.ExecContext(ctx, deleteEndpointQuery, endpointID, user.ID)
+	if err != nil {
+
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+
+		return err
+	}
+	if affected == 0 {
+
+		return domain.ErrWebhookNotFound
+	}
+
+	return nil
+}
+
+const existsEndpointQuery = `SELECT EXISTS(SELECT 1 FROM WebhookEndpoint WHERE ID = $1 AND userID = $2)`
+
+const getDeliveriesQuery = `SELECT ID, endpointID, transactionID, eventType, payload, status, attempts, nextAttemptAt, lastError, createdAt FROM WebhookDelivery
+WHERE endpointID = $1 AND ($2::INT IS NULL OR status = $2) AND ID < $3 ORDER BY ID DESC LIMIT $4`
+
+func (w *Webhook) GetDeliveries(ctx context.Context, db *sqlx.DB, user domain.User, endpointID int, status *domain.WebhookDeliveryStatus, IDBefore int, limit int) ([]*domain.WebhookDelivery, error) {
+	// default values
+	if IDBefore == 0 {
+		IDBefore = math.MaxInt64
+	}
+
+	if limit <= 0 {
+		limit = 100
+	}
+
+	var exists bool
+	if err := db.GetContext(ctx, &exists, existsEndpointQuery, endpointID, user.ID); err != nil {
+
+		return nil, err
+	} else if !exists {
+
+		return nil, domain.ErrWebhookNotFound
+	}
+
+	deliveries := []*domain.WebhookDelivery{}
+	if err := db.SelectContext(ctx, &deliveries, getDeliveriesQuery, endpointID, status, IDBefore, limit); err != nil {
+
+		return nil, err
+	}
+
+	for _, delivery := range deliveries {
+		cleanDelivery(delivery)
+	}
+
+	return deliveries, nil
+}
+
+const redeliverQuery = `UPDATE WebhookDelivery d SET status = 0, attempts = 0, lastError = '', nextAttemptAt = $3
+FROM WebhookEndpoint e
+WHERE d.endpointID = e.ID AND d.ID = $1 AND e.userID = $2
+RETURNING d.ID, d.endpointID, d.transactionID, d.eventType, d.payload, d.status, d.attempts, d.nextAttemptAt, d.lastError, d.createdAt`
+
+// Redeliver puts the delivery back to the queue whatever its status is
+func (w *Webhook) Redeliver(ctx context.Context, db *sqlx.DB, now time.Time, user domain.User, deliveryID int) (*domain.WebhookDelivery, error) {
+	rows, err := db.QueryxContext(ctx, redeliverQuery, deliveryID, user.ID, wr.TimeToUTC(now))
+	if err != nil {
+
+		return nil, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+
+			return nil, err
+		}
+
+		return nil, domain.ErrDeliveryNotFound
+	}
+
+	var delivery domain.WebhookDelivery
+	if err := rows.StructScan(&delivery); err != nil {
+
+		return nil, err
+	}
+	cleanDelivery(&delivery)
+
+	return &delivery, nil
+}
+
+// redeliverDeadQuery puts back at most $4 dead deliveries of the endpoint of the user, SKIP LOCKED leaves the ones
+// being redelivered one by one to their request
+const redeliverDeadQuery = `UPDATE WebhookDelivery SET status = 0, attempts = 0, lastError = '', nextAttemptAt = $3
+WHERE ID IN (
+	SELECT d.ID FROM WebhookDelivery d JOIN WebhookEndpoint e ON d.endpointID = e.ID
+	WHERE d.endpointID = $1 AND e.userID = $2 AND d.status = 2 ORDER BY d.ID LIMIT $4 FOR UPDATE OF d SKIP LOCKED
+)`
+
+// RedeliverDead puts up to limit dead deliveries of the endpoint back to the queue, it returns how many
+func (w *Webhook) RedeliverDead(ctx context.Context, db *sqlx.DB, now time.Time, user domain.User, endpointID int, limit int) (int, error) {
+	result, err := db.ExecContext(ctx, redeliverDeadQuery, endpointID, user.ID, wr.TimeToUTC(now), limit)
+	if err != nil {
+
+		return 0, err
+	}
+	redelivered, err := result.RowsAffected()
+	if err != nil {
+
+		return 0, err
+	}
+
+	return int(redelivered), nil
+}
+
+// claimDeliveriesQuery leases due deliveries until leaseUntil, so the http call does not hold any lock,
+// SKIP LOCKED lets every replica claim a different batch
+const claimDeliveriesQuery = `UPDATE WebhookDelivery d SET attempts = d.attempts + 1, nextAttemptAt = $2
+FROM WebhookEndpoint e
+WHERE d.endpointID = e.ID AND d.ID IN (
+	SELECT ID FROM WebhookDelivery WHERE status = 0 AND nextAttemptAt <= $1 ORDER BY nextAttemptAt LIMIT $3 FOR UPDATE SKIP LOCKED
+)
+RETURNING d.ID, d.endpointID, d.transactionID, d.eventType, d.payload, d.status, d.attempts, d.nextAttemptAt, d.lastError, d.createdAt, e.url, e.secret`
+
+// ClaimDeliveries leases due deliveries and counts the attempt
+func (w *Webhook) ClaimDeliveries(ctx context.Context, db *sqlx.DB, now time.Time, leaseUntil time.Time, limit int) ([]*Dispatch, error) {
+	dispatches := []*Dispatch{}
+	if err := db.SelectContext(ctx, &dispatches, claimDeliveriesQuery, wr.TimeToUTC(now), wr.TimeToUTC(leaseUntil), limit); err != nil {
+
+		return nil, err
+	}
+
+	for _, dispatch := range dispatches {
+		cleanDelivery(&dispatch.WebhookDelivery)
+	}
+
+	return dispatches, nil
+}
+
+// the pending status and attempts fence the marks to the claim they belong to
+const markDeliveredQuery = `UPDATE WebhookDelivery SET status = 1, lastError = '' WHERE ID = $1 AND attempts = $2 AND status = 0`
+
+func (w *Webhook) MarkDelivered(ctx context.Context, db *sqlx.DB, deliveryID int, attempts int) error {
+	_, err := db.ExecContext(ctx, markDeliveredQuery, deliveryID, attempts)
+
+	return err
+}
+
+const markFailedQuery = `UPDATE WebhookDelivery SET status = $3, lastError = $4, nextAttemptAt = $5
+WHERE ID = $1 AND attempts = $2 AND status = 0`
+
+// MarkFailed schedules the next attempt, or parks the delivery when status is dead
+func (w *Webhook) MarkFailed(ctx context.Context, db *sqlx.DB, deliveryID int, attempts int, lastError string, nextAttemptAt time.Time, status domain.WebhookDeliveryStatus) error {
+	_, err := db.ExecContext(ctx, markFailedQuery, deliveryID, attempts, status, lastError, wr.TimeToUTC(nextAttemptAt))
+
+	return err
+}
@@ -0,0 +1,66 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/sappy5678/cryptocom/pkg/domain"
+)
+
+type MockWebhookRepository struct {
+	CreateEndpointFunc  func(ctx context.Context, db *sqlx.DB, now time.Time, endpoint *domain.WebhookEndpoint) (*domain.WebhookEndpoint, error)
+	ListEndpointsFunc   func(ctx context.Context, db *sqlx.DB, user domain.User) ([]*domain.WebhookEndpoint, error)
+	DeleteEndpointFunc  func(ctx context.Context, db *sqlx.DB, user domain.User, endpointID int) error
+	GetDeliveriesFunc   func(ctx context.Context, db *sqlx.DB, user domain.User, endpointID int, status *domain.WebhookDeliveryStatus, IDBefore int, limit int) ([]*domain.WebhookDelivery, error)
+	RedeliverFunc       func(ctx context.Context, db *sqlx.DB, now time.Time, user domain.User, deliveryID int) (*domain.WebhookDelivery, error)
+	RedeliverDeadFunc   func(ctx context.Context, db *sqlx.DB, now time.Time, user domain.User, endpointID int, limit int) (int, error)
+	ClaimDeliveriesFunc func(ctx context.Context, db *sqlx.DB, now time.Time, leaseUntil time.Time, limit int) ([]*Dispatch, error)
+	MarkDeliveredFunc   func(ctx context.Context, db *sqlx.DB, deliveryID int, attempts int) error
+	MarkFailedFunc      func(ctx context.Context, db *sqlx.DB, deliveryID int, attempts int, lastError string, nextAttemptAt time.Time, status domain.WebhookDeliveryStatus) error
+}
+
+func (m *MockWebhookRepository) CreateEndpoint(ctx context.Context, db *sqlx.DB, now time.Time, endpoint *domain.WebhookEndpoint) (*domain.WebhookEndpoint, error) {
+
+	return m.CreateEndpointFunc(ctx, db, now, endpoint)
+}
+
+func (m *MockWebhookRepository) ListEndpoints(ctx context.Context, db *sqlx.DB, user domain.User) ([]*domain.WebhookEndpoint, error) {
+
+	return m.ListEndpointsFunc(ctx, db, user)
+}
+
+func (m *MockWebhookRepository) DeleteEndpoint(ctx context.Context, db *sqlx.DB, user domain.User, endpointID int) error {
+
+	return m.DeleteEndpointFunc(ctx, db, user, endpointID)
+}
+
+func (m *MockWebhookRepository) GetDeliveries(ctx context.Context, db *sqlx.DB, user domain.User, endpointID int, status *domain.WebhookDeliveryStatus, IDBefore int, limit int) ([]*domain.WebhookDelivery, error) {
+
+	return m.GetDeliveriesFunc(ctx, db, user, endpointID, status, IDBefore, limit)
+}
+
+func (m *MockWebhookRepository) Redeliver(ctx context.Context, db *sqlx.DB, now time.Time, user domain.User, deliveryID int) (*domain.WebhookDelivery, error) {
+
+	return m.RedeliverFunc(ctx, db, now, user, deliveryID)
+}
+
+func (m *MockWebhookRepository) RedeliverDead(ctx context.Context, db *sqlx.DB, now time.Time, user domain.User, endpointID int, limit int) (int, error) {
+
+	return m.RedeliverDeadFunc(ctx, db, now, user, endpointID, limit)
+}
+
+func (m *MockWebhookRepository) ClaimDeliveries(ctx context.Context, db *sqlx.DB, now time.Time, leaseUntil time.Time, limit int) ([]*Dispatch, error) {
+
+	return m.ClaimDeliveriesFunc(ctx, db, now, leaseUntil, limit)
+}
+
+func (m *MockWebhookRepository) MarkDelivered(ctx context.Context, db *sqlx.DB, deliveryID int, attempts int) error {
+
+	return m.MarkDeliveredFunc(ctx, db, deliveryID, attempts)
+}
+
+func (m *MockWebhookRepository) MarkFailed(ctx context.Context, db *sqlx.DB, deliveryID int, attempts int, lastError string, nextAttemptAt time.Time, status domain.WebhookDeliveryStatus) error {
+
+	return m.MarkFailedFunc(ctx, db, deliveryID, attempts, lastError, nextAttemptAt, status)
+}
@@ -0,0 +1,31 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/sappy5678/cryptocom/pkg/domain"
+)
+
+// WebhookRepository represents webhook repository interface
+type WebhookRepository interface {
+	CreateEndpoint(ctx context.Context, db *sqlx.DB, now time.Time, endpoint *domain.WebhookEndpoint) (*domain.WebhookEndpoint, error)
+	ListEndpoints(ctx context.Context, db *sqlx.DB, user domain.User) ([]*domain.WebhookEndpoint, error)
+	DeleteEndpoint(ctx context.Context, db *sqlx.DB, user domain.User, endpointID int) error
+	GetDeliveries(ctx context.Context, db *sqlx.DB, user domain.User, endpointID int, status *domain.WebhookDeliveryStatus, IDBefore int, limit int) ([]*domain.WebhookDelivery, error)
+	Redeliver(ctx context.Context, db *sqlx.DB, now time.Time, user domain.User, deliveryID int) (*domain.WebhookDelivery, error)
+	RedeliverDead(ctx context.Context, db *sqlx.DB, now time.Time, user domain.User, endpointID int, limit int) (int, error)
+	ClaimDeliveries(ctx context.Context, db *sqlx.DB, now time.Time, leaseUntil time.Time, limit int) ([]*Dispatch, error)
+	// MarkDelivered and MarkFailed record the result of the claim that counted attempts,
+	// they do nothing once the delivery was claimed again or redelivered
+	MarkDelivered(ctx context.Context, db *sqlx.DB, deliveryID int, attempts int) error
+	MarkFailed(ctx context.Context, db *sqlx.DB, deliveryID int, attempts int, lastError string, nextAttemptAt time.Time, status domain.WebhookDeliveryStatus) error
+}
+
+// Dispatch is a claimed delivery with the endpoint it goes to
+type Dispatch struct {
+	domain.WebhookDelivery
+	URL    string `db:"url"`
+	Secret string `db:"secret"`
+}
@@ -0,0 +1,46 @@
+package webhook
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/sappy5678/cryptocom/pkg/domain"
+	"github.com/sappy5678/cryptocom/pkg/service/webhook/repository"
+)
+
+// Service defines in domain
+
+// New creates new webhook application service
+func New(db *sqlx.DB, webhookRepo repository.WebhookRepository) domain.WebhookService {
+
+	return &Webhook{db: db, webhookRepo: webhookRepo, lookupIPAddr: net.DefaultResolver.LookupIPAddr}
+}
+
+// NewWithQueue creates new webhook application service which redelivers the dead deliveries of an endpoint in jobs of queue
+func NewWithQueue(db *sqlx.DB, webhookRepo repository.WebhookRepository, queue Queue) domain.WebhookService {
+
+	return &Webhook{db: db, webhookRepo: webhookRepo, queue: queue, lookupIPAddr: net.DefaultResolver.LookupIPAddr}
+}
+
+// Initialize initalizes Webhook application service with defaults
+func Initialize(db *sqlx.DB) domain.WebhookService {
+
+	return New(db, &repository.Webhook{})
+}
+
+// Webhook represents webhook application service
+type Webhook struct {
+	db          *sqlx.DB
+	webhookRepo repository.WebhookRepository
+	queue       Queue
+	// lookupIPAddr resolves the host of a registered url
+	lookupIPAddr func(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+// Queue enqueues background jobs, like job.Runner
+type Queue interface {
+	Enqueue(ctx context.Context, db sqlx.ExtContext, jobType string, payload interface{}, runAt time.Time) (*domain.Job, error)
+}
@@ -0,0 +1,62 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sappy5678/cryptocom/pkg/domain"
+)
+
+// SignatureHeader carries the timestamp and the HMAC-SHA256 of "<timestamp>.<body>", like t=1700000000,v1=<hex>
+const SignatureHeader = "X-Webhook-Signature"
+
+// Sign returns the value of SignatureHeader for the body
+func Sign(secret string, timestamp time.Time, body []byte) string {
+	ts := strconv.FormatInt(timestamp.Unix(), 10)
+
+	return fmt.Sprintf("t=%s,v1=%s", ts, signature(secret, ts, body))
+}
+
+func signature(secret string, ts string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts))
+	mac.Write([]byte("."))
+	mac.Write(body)
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks the SignatureHeader value, tolerance bounds the age of the timestamp to stop replays
+func Verify(secret string, header string, body []byte, now time.Time, tolerance time.Duration) error {
+	var ts, sign string
+	for _, part := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(part, "=")
+		switch key {
+		case "t":
+			ts = value
+		case "v1":
+			sign = value
+		}
+	}
+
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+
+		return domain.ErrInvalidWebhookSign
+	}
+	if age := now.Sub(time.Unix(unix, 0)); age > tolerance || age < -tolerance {
+
+		return domain.ErrInvalidWebhookSign
+	}
+	if !hmac.Equal([]byte(sign), []byte(signature(secret, ts, body))) {
+
+		return domain.ErrInvalidWebhookSign
+	}
+
+	return nil
+}
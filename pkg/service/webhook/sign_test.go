@@ -0,0 +1,78 @@
+package webhook_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/sappy5678/cryptocom/pkg/domain"
+	"github.com/sappy5678/cryptocom/pkg/service/webhook"
+)
+
+func TestSignVerify(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	body := []byte(`{"eventType":1}`)
+	header := webhook.Sign("secret", now, body)
+
+	tests := []struct {
+		name    string
+		secret  string
+		header  string
+		body    []byte
+		now     time.Time
+		wantErr error
+	}{
+		{
+			name:   "valid",
+			secret: "secret",
+			header: header,
+			body:   body,
+			now:    now.Add(time.Minute),
+		},
+		{
+			name:    "wrong secret",
+			secret:  "other",
+			header:  header,
+			body:    body,
+			now:     now,
+			wantErr: domain.ErrInvalidWebhookSign,
+		},
+		{
+			name:    "tampered body",
+			secret:  "secret",
+			header:  header,
+			body:    []byte(`{"eventType":2}`),
+			now:     now,
+			wantErr: domain.ErrInvalidWebhookSign,
+		},
+		{
+			name:    "too old",
+			secret:  "secret",
+			header:  header,
+			body:    body,
+			now:     now.Add(time.Hour),
+			wantErr: domain.ErrInvalidWebhookSign,
+		},
+		{
+			name:    "malformed header",
+			secret:  "secret",
+			header:  "garbage",
+			body:    body,
+			now:     now,
+			wantErr: domain.ErrInvalidWebhookSign,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := webhook.Verify(tt.secret, tt.header, tt.body, tt.now, 5*time.Minute)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
@@ -0,0 +1,214 @@
+package transport
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/sappy5678/cryptocom/pkg/domain"
+	"github.com/sappy5678/cryptocom/pkg/utl/server"
+
+	"github.com/labstack/echo"
+)
+
+// HTTP represents webhook http service
+type HTTP struct {
+	Service domain.WebhookService
+}
+
+// NewHTTP creates new webhook http service
+func NewHTTP(svc domain.WebhookService, r *echo.Group) {
+	h := HTTP{Service: svc}
+	ur := r.Group("/user/:userID/webhooks")
+
+	// Register webhook
+	// POST /v1/users/{userID}/webhooks
+	ur.POST("", h.register)
+
+	// List webhooks
+	// GET /v1/users/{userID}/webhooks
+	ur.GET("", h.list)
+
+	// Delete webhook
+	// DELETE /v1/users/{userID}/webhooks/{webhookID}
+	ur.DELETE("/:webhookID", h.delete)
+
+	// Get deliveries
+	// GET /v1/users/{userID}/webhooks/{webhookID}/deliveries
+	ur.GET("/:webhookID/deliveries", h.getDeliveries)
+
+	// Redeliver
+	// PUT /v1/users/{userID}/webhooks/deliveries/{deliveryID}/redeliver
+	ur.PUT("/deliveries/:deliveryID/redeliver", h.redeliver)
+
+	// Redeliver every dead delivery of a webhook in a background job
+	// PUT /v1/users/{userID}/webhooks/{webhookID}/redeliver
+	ur.PUT("/:webhookID/redeliver", h.redeliverDead)
+}
+
+func badRequest(c echo.Context, err error) error {
+	err = c.JSON(http.StatusBadRequest, server.ErrorRespond(c, err))
+	if err != nil {
+		c.Logger().Error(err)
+	}
+
+	return err
+}
+
+type RegisterReq struct {
+	UserID     string
+	URL        string   `json:"url" validate:"required"`
+	EventTypes []string `json:"eventTypes"`
+}
+
+func (h HTTP) register(c echo.Context) error {
+	r := RegisterReq{}
+
+	if err := c.Bind(&r); err != nil {
+
+		return badRequest(c, err)
+	}
+
+	userID := c.Param("userID")
+	if userID == "" {
+
+		return badRequest(c, domain.ErrUserIDRequired)
+	}
+
+	r.UserID = userID
+	endpoint, err := h.Service.Register(c.Request().Context(), domain.User{ID: r.UserID}, r.URL, r.EventTypes)
+	if err != nil {
+
+		return badRequest(c, err)
+	}
+
+	return c.JSON(http.StatusOK, endpoint)
+}
+
+func (h HTTP) list(c echo.Context) error {
+	userID := c.Param("userID")
+	if userID == "" {
+
+		return badRequest(c, domain.ErrUserIDRequired)
+	}
+
+	endpoints, err := h.Service.List(c.Request().Context(), domain.User{ID: userID})
+	if err != nil {
+
+		return badRequest(c, err)
+	}
+
+	return c.JSON(http.StatusOK, endpoints)
+}
+
+func (h HTTP) delete(c echo.Context) error {
+	userID := c.Param("userID")
+	if userID == "" {
+
+		return badRequest(c, domain.ErrUserIDRequired)
+	}
+
+	webhookID, err := strconv.Atoi(c.Param("webhookID"))
+	if err != nil {
+
+		return badRequest(c, err)
+	}
+
+	if err := h.Service.Delete(c.Request().Context(), domain.User{ID: userID}, webhookID); err != nil {
+
+		return badRequest(c, err)
+	}
+
+	return c.NoContent(http.StatusOK)
+}
+
+type GetDeliveriesReq struct {
+	UserID    string
+	StatusStr string `query:"status"`
+	IDBefore  int    `query:"IDBefore"`
+	Limit     int    `query:"limit"`
+}
+
+func (h HTTP) getDeliveries(c echo.Context) error {
+	r := GetDeliveriesReq{}
+
+	if err := c.Bind(&r); err != nil {
+
+		return badRequest(c, err)
+	}
+
+	userID := c.Param("userID")
+	if userID == "" {
+
+		return badRequest(c, domain.ErrUserIDRequired)
+	}
+
+	webhookID, err := strconv.Atoi(c.Param("webhookID"))
+	if err != nil {
+
+		return badRequest(c, err)
+	}
+
+	var status *domain.WebhookDeliveryStatus
+	if r.StatusStr != "" {
+		s, err := strconv.Atoi(r.StatusStr)
+		if err != nil {
+
+			return badRequest(c, err)
+		}
+		deliveryStatus := domain.WebhookDeliveryStatus(s)
+		status = &deliveryStatus
+	}
+
+	r.UserID = userID
+	deliveries, err := h.Service.GetDeliveries(c.Request().Context(), domain.User{ID: r.UserID}, webhookID, status, r.IDBefore, r.Limit)
+	if err != nil {
+
+		return badRequest(c, err)
+	}
+
+	return c.JSON(http.StatusOK, deliveries)
+}
+
+func (h HTTP) redeliver(c echo.Context) error {
+	userID := c.Param("userID")
+	if userID == "" {
+
+		return badRequest(c, domain.ErrUserIDRequired)
+	}
+
+	deliveryID, err := strconv.Atoi(c.Param("deliveryID"))
+	if err != nil {
+
+		return badRequest(c, err)
+	}
+
+	delivery, err := h.Service.Redeliver(c.Request().Context(), domain.User{ID: userID}, deliveryID)
+	if err != nil {
+
+		return badRequest(c, err)
+	}
+
+	return c.JSON(http.StatusOK, delivery)
+}
+
+func (h HTTP) redeliverDead(c echo.Context) error {
+	userID := c.Param("userID")
+	if userID == "" {
+
+		return badRequest(c, domain.ErrUserIDRequired)
+	}
+
+	webhookID, err := strconv.Atoi(c.Param("webhookID"))
+	if err != nil {
+
+		return badRequest(c, err)
+	}
+
+	job, err := h.Service.RedeliverDead(c.Request().Context(), domain.User{ID: userID}, webhookID)
+	if err != nil {
+
+		return badRequest(c, err)
+	}
+
+	return c.JSON(http.StatusAccepted, job)
+}
@@ -0,0 +1,237 @@
+package transport_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
+
+	"github.com/sappy5678/cryptocom/pkg/domain"
+	"github.com/sappy5678/cryptocom/pkg/service/webhook"
+	"github.com/sappy5678/cryptocom/pkg/service/webhook/transport"
+	"github.com/sappy5678/cryptocom/pkg/utl/server"
+)
+
+var mockWebhookService = &webhook.MockWebhookService{
+	RegisterFunc: func(ctx context.Context, user domain.User, url string, eventTypes []string) (*domain.WebhookEndpoint, error) {
+		return &domain.WebhookEndpoint{ID: 1, UserID: user.ID, URL: url, Secret: "secret", EventTypes: eventTypes}, nil
+	},
+	ListFunc: func(ctx context.Context, user domain.User) ([]*domain.WebhookEndpoint, error) {
+		return []*domain.WebhookEndpoint{{ID: 1, UserID: user.ID, URL: "https://example.com", EventTypes: []string{}}}, nil
+	},
+	DeleteFunc: func(ctx context.Context, user domain.User, endpointID int) error {
+		return nil
+	},
+	GetDeliveriesFunc: func(ctx context.Context, user domain.User, endpointID int, status *domain.WebhookDeliveryStatus, IDBefore int, limit int) ([]*domain.WebhookDelivery, error) {
+		delivery := &domain.WebhookDelivery{ID: 1, EndpointID: endpointID, Payload: json.RawMessage(`{}`)}
+		if status != nil {
+			delivery.Status = *status
+		}
+
+		return []*domain.WebhookDelivery{delivery}, nil
+	},
+	RedeliverFunc: func(ctx context.Context, user domain.User, deliveryID int) (*domain.WebhookDelivery, error) {
+		return &domain.WebhookDelivery{ID: deliveryID, Payload: json.RawMessage(`{}`)}, nil
+	},
+	RedeliverDeadFunc: func(ctx context.Context, user domain.User, endpointID int) (*domain.Job, error) {
+		return &domain.Job{ID: 7, Type: webhook.RedeliverDeadJob, Payload: json.RawMessage(`{}`)}, nil
+	},
+}
+
+var mockError = errors.New("error")
+var mockErrorWebhookService = &webhook.MockWebhookService{
+	RegisterFunc: func(ctx context.Context, user domain.User, url string, eventTypes []string) (*domain.WebhookEndpoint, error) {
+		return nil, mockError
+	},
+	ListFunc: func(ctx context.Context, user domain.User) ([]*domain.WebhookEndpoint, error) {
+		return nil, mockError
+	},
+	DeleteFunc: func(ctx context.Context, user domain.User, endpointID int) error {
+		return mockError
+	},
+	GetDeliveriesFunc: func(ctx context.Context, user domain.User, endpointID int, status *domain.WebhookDeliveryStatus, IDBefore int, limit int) ([]*domain.WebhookDelivery, error) {
+		return nil, mockError
+	},
+	RedeliverFunc: func(ctx context.Context, user domain.User, deliveryID int) (*domain.WebhookDelivery, error) {
+		return nil, mockError
+	},
+	RedeliverDeadFunc: func(ctx context.Context, user domain.User, endpointID int) (*domain.Job, error) {
+		return nil, mockError
+	},
+}
+
+func TestWebhookRoutes(t *testing.T) {
+	defer goleak.VerifyNone(t)
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		svc        domain.WebhookService
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:       "register",
+			method:     http.MethodPost,
+			path:       "/v1/user/1/webhooks",
+			body:       `{"url":"https://example.com","eventTypes":["wallet.deposited","wallet.transferred_in"]}`,
+			svc:        mockWebhookService,
+			wantStatus: http.StatusOK,
+			wantBody:   `{"ID":1,"userID":"1","url":"https://example.com","secret":"secret","eventTypes":["wallet.deposited","wallet.transferred_in"],"createdAt":"0001-01-01T00:00:00Z"}`,
+		},
+		{
+			name:       "register error",
+			method:     http.MethodPost,
+			path:       "/v1/user/1/webhooks",
+			body:       `{"url":"https://example.com"}`,
+			svc:        mockErrorWebhookService,
+			wantStatus: http.StatusBadRequest,
+			wantBody:   `{"error":"error"}`,
+		},
+		{
+			name:       "register bad body",
+			method:     http.MethodPost,
+			path:       "/v1/user/1/webhooks",
+			body:       `{"url":1}`,
+			svc:        mockWebhookService,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "list",
+			method:     http.MethodGet,
+			path:       "/v1/user/1/webhooks",
+			svc:        mockWebhookService,
+			wantStatus: http.StatusOK,
+			wantBody:   `[{"ID":1,"userID":"1","url":"https://example.com","eventTypes":[],"createdAt":"0001-01-01T00:00:00Z"}]`,
+		},
+		{
+			name:       "list error",
+			method:     http.MethodGet,
+			path:       "/v1/user/1/webhooks",
+			svc:        mockErrorWebhookService,
+			wantStatus: http.StatusBadRequest,
+			wantBody:   `{"error":"error"}`,
+		},
+		{
+			name:       "delete",
+			method:     http.MethodDelete,
+			path:       "/v1/user/1/webhooks/1",
+			svc:        mockWebhookService,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "delete invalid ID",
+			method:     http.MethodDelete,
+			path:       "/v1/user/1/webhooks/abc",
+			svc:        mockWebhookService,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "delete error",
+			method:     http.MethodDelete,
+			path:       "/v1/user/1/webhooks/1",
+			svc:        mockErrorWebhookService,
+			wantStatus: http.StatusBadRequest,
+			wantBody:   `{"error":"error"}`,
+		},
+		{
+			name:       "get deliveries with status",
+			method:     http.MethodGet,
+			path:       "/v1/user/1/webhooks/2/deliveries?status=2",
+			svc:        mockWebhookService,
+			wantStatus: http.StatusOK,
+			wantBody:   `[{"ID":1,"endpointID":2,"transactionID":"","eventType":"","payload":{},"status":2,"attempts":0,"nextAttemptAt":"0001-01-01T00:00:00Z","lastError":"","createdAt":"0001-01-01T00:00:00Z"}]`,
+		},
+		{
+			name:       "get deliveries invalid status",
+			method:     http.MethodGet,
+			path:       "/v1/user/1/webhooks/2/deliveries?status=dead",
+			svc:        mockWebhookService,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "get deliveries error",
+			method:     http.MethodGet,
+			path:       "/v1/user/1/webhooks/2/deliveries",
+			svc:        mockErrorWebhookService,
+			wantStatus: http.StatusBadRequest,
+			wantBody:   `{"error":"error"}`,
+		},
+		{
+			name:       "redeliver",
+			method:     http.MethodPut,
+			path:       "/v1/user/1/webhooks/deliveries/5/redeliver",
+			svc:        mockWebhookService,
+			wantStatus: http.StatusOK,
+			wantBody:   `{"ID":5,"endpointID":0,"transactionID":"","eventType":"","payload":{},"status":0,"attempts":0,"nextAttemptAt":"0001-01-01T00:00:00Z","lastError":"","createdAt":"0001-01-01T00:00:00Z"}`,
+		},
+		{
+			name:       "redeliver error",
+			method:     http.MethodPut,
+			path:       "/v1/user/1/webhooks/deliveries/5/redeliver",
+			svc:        mockErrorWebhookService,
+			wantStatus: http.StatusBadRequest,
+			wantBody:   `{"error":"error"}`,
+		},
+		{
+			name:       "redeliver dead",
+			method:     http.MethodPut,
+			path:       "/v1/user/1/webhooks/2/redeliver",
+			svc:        mockWebhookService,
+			wantStatus: http.StatusAccepted,
+			wantBody:   `{"ID":7,"type":"webhook.redeliver_dead","payload":{},"status":0,"attempts":0,"maxAttempts":0,"runAt":"0001-01-01T00:00:00Z","lastError":"","createdAt":"0001-01-01T00:00:00Z"}`,
+		},
+		{
+			name:       "redeliver dead invalid ID",
+			method:     http.MethodPut,
+			path:       "/v1/user/1/webhooks/abc/redeliver",
+			svc:        mockWebhookService,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "redeliver dead error",
+			method:     http.MethodPut,
+			path:       "/v1/user/1/webhooks/2/redeliver",
+			svc:        mockErrorWebhookService,
+			wantStatus: http.StatusBadRequest,
+			wantBody:   `{"error":"error"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := server.New()
+			rg := r.Group("v1")
+			transport.NewHTTP(tt.svc, rg)
+			ts := httptest.NewServer(r)
+			defer ts.Close()
+
+			req, err := http.NewRequest(tt.method, ts.URL+tt.path, bytes.NewBufferString(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Content-Type", "application/json")
+			res, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+
+			assert.Equal(t, tt.wantStatus, res.StatusCode)
+			if tt.wantBody != "" {
+				body := new(bytes.Buffer)
+				if _, err := body.ReadFrom(res.Body); err != nil {
+					t.Fatal(err)
+				}
+				assert.JSONEq(t, tt.wantBody, body.String())
+			}
+		})
+	}
+}
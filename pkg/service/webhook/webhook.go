@@ -0,0 +1,123 @@
+// Package webhook contains webhook application services
+package webhook
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/url"
+	"time"
+
+	"github.com/sappy5678/cryptocom/pkg/domain"
+)
+
+// eventTypes are the event types an endpoint may subscribe to, the outbox event types of the operations
+var eventTypes = map[string]bool{
+	domain.EventTypeDeposited:      true,
+	domain.EventTypeWithdrawn:      true,
+	domain.EventTypeTransferredIn:  true,
+	domain.EventTypeTransferredOut: true,
+}
+
+// Register registers a new webhook endpoint for the user, the secret is only returned here,
+// a url whose host is or resolves to an address that is not public is refused, the dispatcher checks it again on every send
+func (w *Webhook) Register(ctx context.Context, user domain.User, rawURL string, subscribed []string) (*domain.WebhookEndpoint, error) {
+	if user.ID == "" {
+
+		return nil, domain.ErrUserIDRequired
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+
+		return nil, domain.ErrInvalidWebhookURL
+	}
+	if err := checkHost(ctx, w.lookupIPAddr, u.Hostname()); err != nil {
+
+		return nil, err
+	}
+
+	for _, eventType := range subscribed {
+		if !eventTypes[eventType] {
+
+			return nil, domain.ErrInvalidEventType
+		}
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+
+		return nil, err
+	}
+
+	return w.webhookRepo.CreateEndpoint(ctx, w.db, time.Now(), &domain.WebhookEndpoint{
+		UserID:     user.ID,
+		URL:        u.String(),
+		Secret:     hex.EncodeToString(secret),
+		EventTypes: subscribed,
+	})
+}
+
+func (w *Webhook) List(ctx context.Context, user domain.User) ([]*domain.WebhookEndpoint, error) {
+	endpoints, err := w.webhookRepo.ListEndpoints(ctx, w.db, user)
+	if err != nil {
+
+		return nil, err
+	}
+
+	// secret is only shown on register
+	for _, endpoint := range endpoints {
+		endpoint.Secret = ""
+	}
+
+	return endpoints, nil
+}
+
+func (w *Webhook) Delete(ctx context.Context, user domain.User, endpointID int) error {
+
+	return w.webhookRepo.DeleteEndpoint(ctx, w.db, user, endpointID)
+}
+
+func (w *Webhook) GetDeliveries(ctx context.Context, user domain.User, endpointID int, status *domain.WebhookDeliveryStatus, IDBefore int, limit int) ([]*domain.WebhookDelivery, error) {
+	deliveries, err := w.webhookRepo.GetDeliveries(ctx, w.db, user, endpointID, status, IDBefore, limit)
+	if err != nil {
+
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+// Redeliver schedules the delivery again, it is mostly used for dead deliveries
+func (w *Webhook) Redeliver(ctx context.Context, user domain.User, deliveryID int) (*domain.WebhookDelivery, error) {
+	delivery, err := w.webhookRepo.Redeliver(ctx, w.db, time.Now(), user, deliveryID)
+	if err != nil {
+
+		return nil, err
+	}
+
+	return delivery, nil
+}
+
+// RedeliverDead queues a RedeliverDeadJob for the endpoint, the endpoint may have too many dead deliveries
+// to put back within a request, it fails with ErrJobQueueDisabled without the job queue
+func (w *Webhook) RedeliverDead(ctx context.Context, user domain.User, endpointID int) (*domain.Job, error) {
+	if w.queue == nil {
+
+		return nil, domain.ErrJobQueueDisabled
+	}
+
+	endpoints, err := w.webhookRepo.ListEndpoints(ctx, w.db, user)
+	if err != nil {
+
+		return nil, err
+	}
+	for _, endpoint := range endpoints {
+		if endpoint.ID == endpointID {
+
+			return w.queue.Enqueue(ctx, w.db, RedeliverDeadJob, redeliverDeadPayload{UserID: user.ID, EndpointID: endpointID}, time.Time{})
+		}
+	}
+
+	return nil, domain.ErrWebhookNotFound
+}
@@ -0,0 +1,327 @@
+package webhook_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
+
+	"github.com/sappy5678/cryptocom/pkg/domain"
+	"github.com/sappy5678/cryptocom/pkg/service/webhook"
+	"github.com/sappy5678/cryptocom/pkg/service/webhook/repository"
+)
+
+var mockWebhookRepository = &repository.MockWebhookRepository{
+	CreateEndpointFunc: func(ctx context.Context, db *sqlx.DB, now time.Time, endpoint *domain.WebhookEndpoint) (*domain.WebhookEndpoint, error) {
+		endpoint.ID = 1
+
+		return endpoint, nil
+	},
+	ListEndpointsFunc: func(ctx context.Context, db *sqlx.DB, user domain.User) ([]*domain.WebhookEndpoint, error) {
+
+		return []*domain.WebhookEndpoint{{ID: 1, UserID: user.ID, Secret: "secret"}}, nil
+	},
+	DeleteEndpointFunc: func(ctx context.Context, db *sqlx.DB, user domain.User, endpointID int) error {
+
+		return nil
+	},
+	GetDeliveriesFunc: func(ctx context.Context, db *sqlx.DB, user domain.User, endpointID int, status *domain.WebhookDeliveryStatus, IDBefore int, limit int) ([]*domain.WebhookDelivery, error) {
+
+		return []*domain.WebhookDelivery{{ID: 1, EndpointID: endpointID}}, nil
+	},
+	RedeliverFunc: func(ctx context.Context, db *sqlx.DB, now time.Time, user domain.User, deliveryID int) (*domain.WebhookDelivery, error) {
+
+		return &domain.WebhookDelivery{ID: deliveryID}, nil
+	},
+}
+
+var mockErrorWebhookRepository = &repository.MockWebhookRepository{
+	CreateEndpointFunc: func(ctx context.Context, db *sqlx.DB, now time.Time, endpoint *domain.WebhookEndpoint) (*domain.WebhookEndpoint, error) {
+
+		return nil, errors.New("error")
+	},
+	ListEndpointsFunc: func(ctx context.Context, db *sqlx.DB, user domain.User) ([]*domain.WebhookEndpoint, error) {
+
+		return nil, errors.New("error")
+	},
+	DeleteEndpointFunc: func(ctx context.Context, db *sqlx.DB, user domain.User, endpointID int) error {
+
+		return domain.ErrWebhookNotFound
+	},
+	GetDeliveriesFunc: func(ctx context.Context, db *sqlx.DB, user domain.User, endpointID int, status *domain.WebhookDeliveryStatus, IDBefore int, limit int) ([]*domain.WebhookDelivery, error) {
+
+		return nil, domain.ErrWebhookNotFound
+	},
+	RedeliverFunc: func(ctx context.Context, db *sqlx.DB, now time.Time, user domain.User, deliveryID int) (*domain.WebhookDelivery, error) {
+
+		return nil, domain.ErrDeliveryNotFound
+	},
+}
+
+func TestRegister(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	cases := []struct {
+		name       string
+		user       domain.User
+		url        string
+		eventTypes []string
+		mockRepo   repository.WebhookRepository
+		wantErr    error
+	}{
+		{
+			name:       "register success",
+			user:       domain.User{ID: "1"},
+			url:        "https://203.0.113.10/hook",
+			eventTypes: []string{domain.EventTypeDeposited},
+			mockRepo:   mockWebhookRepository,
+		},
+		{
+			name:     "register all event types",
+			user:     domain.User{ID: "1"},
+			url:      "http://203.0.113.10:8080/hook",
+			mockRepo: mockWebhookRepository,
+		},
+		{
+			name:     "userID is required",
+			url:      "https://203.0.113.10/hook",
+			mockRepo: mockWebhookRepository,
+			wantErr:  domain.ErrUserIDRequired,
+		},
+		{
+			name:     "invalid scheme",
+			user:     domain.User{ID: "1"},
+			url:      "ftp://203.0.113.10/hook",
+			mockRepo: mockWebhookRepository,
+			wantErr:  domain.ErrInvalidWebhookURL,
+		},
+		{
+			name:     "relative url",
+			user:     domain.User{ID: "1"},
+			url:      "/hook",
+			mockRepo: mockWebhookRepository,
+			wantErr:  domain.ErrInvalidWebhookURL,
+		},
+		{
+			name:     "loopback name",
+			user:     domain.User{ID: "1"},
+			url:      "http://localhost:8080/hook",
+			mockRepo: mockWebhookRepository,
+			wantErr:  domain.ErrForbiddenWebhookAddress,
+		},
+		{
+			name:     "loopback address",
+			user:     domain.User{ID: "1"},
+			url:      "http://127.0.0.1/hook",
+			mockRepo: mockWebhookRepository,
+			wantErr:  domain.ErrForbiddenWebhookAddress,
+		},
+		{
+			name:     "loopback ipv6 address",
+			user:     domain.User{ID: "1"},
+			url:      "http://[::1]:8080/hook",
+			mockRepo: mockWebhookRepository,
+			wantErr:  domain.ErrForbiddenWebhookAddress,
+		},
+		{
+			name:     "private address",
+			user:     domain.User{ID: "1"},
+			url:      "https://10.0.0.1/hook",
+			mockRepo: mockWebhookRepository,
+			wantErr:  domain.ErrForbiddenWebhookAddress,
+		},
+		{
+			name:     "link-local address",
+			user:     domain.User{ID: "1"},
+			url:      "http://169.254.169.254/latest/meta-data",
+			mockRepo: mockWebhookRepository,
+			wantErr:  domain.ErrForbiddenWebhookAddress,
+		},
+		{
+			name:     "unspecified address",
+			user:     domain.User{ID: "1"},
+			url:      "http://0.0.0.0/hook",
+			mockRepo: mockWebhookRepository,
+			wantErr:  domain.ErrForbiddenWebhookAddress,
+		},
+		{
+			name:       "invalid event type",
+			user:       domain.User{ID: "1"},
+			url:        "https://203.0.113.10/hook",
+			eventTypes: []string{domain.EventTypeWalletCreated},
+			mockRepo:   mockWebhookRepository,
+			wantErr:    domain.ErrInvalidEventType,
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := webhook.New(&sqlx.DB{}, tt.mockRepo)
+			got, err := svc.Register(context.Background(), tt.user, tt.url, tt.eventTypes)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.user.ID, got.UserID)
+			assert.Equal(t, tt.url, got.URL)
+			assert.Len(t, got.Secret, 64)
+		})
+	}
+
+	svc := webhook.New(&sqlx.DB{}, mockErrorWebhookRepository)
+	_, err := svc.Register(context.Background(), domain.User{ID: "1"}, "https://203.0.113.10/hook", nil)
+	assert.Error(t, err)
+}
+
+func TestList(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	svc := webhook.New(&sqlx.DB{}, mockWebhookRepository)
+	got, err := svc.List(context.Background(), domain.User{ID: "1"})
+	assert.NoError(t, err)
+	assert.Len(t, got, 1)
+	assert.Empty(t, got[0].Secret)
+
+	svc = webhook.New(&sqlx.DB{}, mockErrorWebhookRepository)
+	_, err = svc.List(context.Background(), domain.User{ID: "1"})
+	assert.Error(t, err)
+}
+
+func TestDelete(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	svc := webhook.New(&sqlx.DB{}, mockWebhookRepository)
+	assert.NoError(t, svc.Delete(context.Background(), domain.User{ID: "1"}, 1))
+
+	svc = webhook.New(&sqlx.DB{}, mockErrorWebhookRepository)
+	assert.ErrorIs(t, svc.Delete(context.Background(), domain.User{ID: "1"}, 1), domain.ErrWebhookNotFound)
+}
+
+func TestGetDeliveries(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	svc := webhook.New(&sqlx.DB{}, mockWebhookRepository)
+	got, err := svc.GetDeliveries(context.Background(), domain.User{ID: "1"}, 2, nil, 0, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, got[0].EndpointID)
+
+	svc = webhook.New(&sqlx.DB{}, mockErrorWebhookRepository)
+	_, err = svc.GetDeliveries(context.Background(), domain.User{ID: "1"}, 2, nil, 0, 10)
+	assert.ErrorIs(t, err, domain.ErrWebhookNotFound)
+}
+
+func TestRedeliver(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	svc := webhook.New(&sqlx.DB{}, mockWebhookRepository)
+	got, err := svc.Redeliver(context.Background(), domain.User{ID: "1"}, 3)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, got.ID)
+
+	svc = webhook.New(&sqlx.DB{}, mockErrorWebhookRepository)
+	_, err = svc.Redeliver(context.Background(), domain.User{ID: "1"}, 3)
+	assert.ErrorIs(t, err, domain.ErrDeliveryNotFound)
+}
+
+func TestRedeliverDead(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	var enqueued []byte
+	queue := &webhook.MockQueue{
+		EnqueueFunc: func(ctx context.Context, db sqlx.ExtContext, jobType string, payload interface{}, runAt time.Time) (*domain.Job, error) {
+			data, err := json.Marshal(payload)
+			enqueued = data
+
+			return &domain.Job{ID: 1, Type: jobType, Payload: data}, err
+		},
+	}
+
+	svc := webhook.NewWithQueue(&sqlx.DB{}, mockWebhookRepository, queue)
+	got, err := svc.RedeliverDead(context.Background(), domain.User{ID: "1"}, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, webhook.RedeliverDeadJob, got.Type)
+	assert.JSONEq(t, `{"userID":"1","endpointID":1}`, string(enqueued))
+
+	// another user's endpoint
+	_, err = svc.RedeliverDead(context.Background(), domain.User{ID: "1"}, 2)
+	assert.ErrorIs(t, err, domain.ErrWebhookNotFound)
+
+	svc = webhook.NewWithQueue(&sqlx.DB{}, mockErrorWebhookRepository, queue)
+	_, err = svc.RedeliverDead(context.Background(), domain.User{ID: "1"}, 1)
+	assert.Error(t, err)
+
+	svc = webhook.New(&sqlx.DB{}, mockWebhookRepository)
+	_, err = svc.RedeliverDead(context.Background(), domain.User{ID: "1"}, 1)
+	assert.ErrorIs(t, err, domain.ErrJobQueueDisabled)
+}
+
+func TestRedeliverDeadHandler(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	cases := []struct {
+		name      string
+		payload   string
+		batches   []int
+		err       error
+		wantCalls int
+		wantErr   bool
+	}{
+		{
+			name:      "until a batch is not full",
+			payload:   `{"userID":"1","endpointID":2}`,
+			batches:   []int{1000, 1000, 3},
+			wantCalls: 3,
+		},
+		{
+			name:      "nothing dead",
+			payload:   `{"userID":"1","endpointID":2}`,
+			batches:   []int{0},
+			wantCalls: 1,
+		},
+		{
+			name:      "repository error",
+			payload:   `{"userID":"1","endpointID":2}`,
+			batches:   []int{0},
+			err:       errors.New("error"),
+			wantCalls: 1,
+			wantErr:   true,
+		},
+		{
+			name:    "invalid payload",
+			payload: `[]`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			repo := &repository.MockWebhookRepository{
+				RedeliverDeadFunc: func(ctx context.Context, db *sqlx.DB, now time.Time, user domain.User, endpointID int, limit int) (int, error) {
+					assert.Equal(t, "1", user.ID)
+					assert.Equal(t, 2, endpointID)
+					n := tt.batches[calls]
+					calls++
+
+					return n, tt.err
+				},
+			}
+
+			handler := webhook.RedeliverDeadHandler(&sqlx.DB{}, repo)
+			err := handler(context.Background(), &domain.Job{Type: webhook.RedeliverDeadJob, Payload: json.RawMessage(tt.payload)})
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.wantCalls, calls)
+		})
+	}
+}
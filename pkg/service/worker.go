@@ -0,0 +1,45 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"github.com/sappy5678/cryptocom/pkg/utl/config"
+)
+
+// StartWorker runs the jobs without serving the API until ctx is done, then it waits for the running jobs,
+// any number of workers may run next to the API replicas, they share the queue and elect one leader,
+// which runs the background workers, like the webhook dispatcher, the outbox relay and the archiver
+func StartWorker(ctx context.Context, cfg *config.Configuration) error {
+	if cfg.Jobs == nil {
+
+		return errors.New("the worker requires the jobs section")
+	}
+
+	// the worker does not migrate, the API does or the migrate command
+	db, err := connectPostgres(cfg.Database)
+	if err != nil {
+
+		return err
+	}
+	defer db.Close()
+
+	log, err := newLogger(cfg.Logging)
+	if err != nil {
+
+		return err
+	}
+	defer log.Close()
+
+	// the worker serves no health checks
+	background, closeBackground, err := newBackgroundWorkers(cfg, db, log, nil)
+	if err != nil {
+
+		return err
+	}
+	defer closeBackground()
+
+	newJobRunner(cfg.Jobs, db, log, background).Run(ctx)
+
+	return nil
+}
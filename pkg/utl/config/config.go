@@ -3,29 +3,59 @@ package config
 import (
 	"fmt"
 	"io/ioutil"
+	"os"
+	"reflect"
 
 	"gopkg.in/yaml.v2"
 )
 
+// EnvPrefix prefixes the environment variables overriding the config file, like CRYPTOCOM_DATABASE_DSN
+const EnvPrefix = "CRYPTOCOM"
+
 // Load returns Configuration struct
+// the config file is overridden by the EnvPrefix environment variables, then validated
 func Load(path string) (*Configuration, error) {
 	bytes, err := ioutil.ReadFile(path)
 	if err != nil {
 
 		return nil, fmt.Errorf("error reading config file, %s", err)
 	}
-	var cfg = new(Configuration)
+	var cfg = &Configuration{
+		Features: defaultFeatures(),
+	}
 	if err := yaml.Unmarshal(bytes, cfg); err != nil {
 
 		return nil, fmt.Errorf("unable to decode into struct, %v", err)
 	}
+	// an empty features section decodes to nil
+	if cfg.Features == nil {
+		cfg.Features = defaultFeatures()
+	}
+	if err := override(reflect.ValueOf(cfg).Elem(), EnvPrefix, os.LookupEnv); err != nil {
+
+		return nil, fmt.Errorf("error reading environment, %v", err)
+	}
+	if err := cfg.Validate(); err != nil {
+
+		return nil, fmt.Errorf("invalid config, %w", err)
+	}
 
 	return cfg, nil
 }
 
 // Configuration holds data necessary for configuring application
 type Configuration struct {
-	Server *Server `yaml:"server,omitempty"`
+	Server   *Server   `yaml:"server,omitempty"`
+	Database *Database `yaml:"database,omitempty"`
+	Outbox   *Outbox   `yaml:"outbox,omitempty"`
+	Cache    *Cache    `yaml:"cache,omitempty"`
+	Archive  *Archive  `yaml:"archive,omitempty"`
+	Jobs     *Jobs     `yaml:"jobs,omitempty"`
+	Tracing  *Tracing  `yaml:"tracing,omitempty"`
+	Logging  *Logging  `yaml:"logging,omitempty"`
+	Auth     *Auth     `yaml:"auth,omitempty"`
+	Limits   *Limits   `yaml:"limits,omitempty"`
+	Features *Features `yaml:"features,omitempty"`
 }
 
 // Server holds data necessary for server configuration
@@ -34,4 +64,176 @@ type Server struct {
 	Debug        bool   `yaml:"debug,omitempty"`
 	ReadTimeout  int    `yaml:"read_timeout_seconds,omitempty"`
 	WriteTimeout int    `yaml:"write_timeout_seconds,omitempty"`
+	GRPCPort     string `yaml:"grpc_port,omitempty"`
+	// AdminPort serves /metrics apart from the API, it is served on the API port when empty
+	AdminPort string `yaml:"admin_port,omitempty"`
+	// DrainSeconds is how long readiness fails before the server stops on shutdown
+	DrainSeconds int `yaml:"drain_seconds,omitempty"`
+	// ShutdownTimeoutSeconds is how long in-flight requests and jobs may run after the drain, 10 seconds when 0
+	ShutdownTimeoutSeconds int `yaml:"shutdown_timeout_seconds,omitempty"`
+	// TLSCertFile and TLSKeyFile serve HTTPS and gRPC over TLS, they are reloaded when they change
+	TLSCertFile string `yaml:"tls_cert_file,omitempty"`
+	TLSKeyFile  string `yaml:"tls_key_file,omitempty"`
+	// TLSClientCAFile requires client certificates signed by its CAs on every request but the probes, mTLS
+	TLSClientCAFile string `yaml:"tls_client_ca_file,omitempty"`
+	// HTTP2 serves HTTP/2, over TLS or cleartext h2c without it
+	HTTP2 bool `yaml:"http2,omitempty"`
+}
+
+// Database holds data necessary for database configuration
+type Database struct {
+	// Driver is postgres, the default, sqlite, for small deployments and edge installs, or memory, which keeps
+	// the wallets in process memory for development and demos and needs no DSN, webhooks and the outbox need postgres
+	Driver string `yaml:"driver,omitempty"`
+	// DSN is the Postgres connection string, or the SQLite database file,
+	// set CRYPTOCOM_DATABASE_DSN_FILE to read it from a secret file
+	DSN string `yaml:"dsn,omitempty"`
+	// MaxOpenConns is unlimited when 0
+	MaxOpenConns int `yaml:"max_open_conns,omitempty"`
+	MaxIdleConns int `yaml:"max_idle_conns,omitempty"`
+	// ConnMaxLifetimeSeconds closes connections older than it, they are reused forever when 0
+	ConnMaxLifetimeSeconds int `yaml:"conn_max_lifetime_seconds,omitempty"`
+	ConnMaxIdleTimeSeconds int `yaml:"conn_max_idle_time_seconds,omitempty"`
+	// ConnectTimeoutSeconds retries the first connection until it elapses, the start fails on the first error when 0
+	ConnectTimeoutSeconds int `yaml:"connect_timeout_seconds,omitempty"`
+	// QueryTimeoutSeconds is the default context deadline of wallet repository calls
+	QueryTimeoutSeconds int `yaml:"query_timeout_seconds,omitempty"`
+	// StatementTimeoutSeconds is the postgres statement_timeout of every connection,
+	// with sqlite it is how long a write waits for the database lock
+	StatementTimeoutSeconds int `yaml:"statement_timeout_seconds,omitempty"`
+	// AutoMigrate applies the pending migrations on start, replicas take turns with an advisory lock
+	AutoMigrate bool `yaml:"auto_migrate,omitempty"`
+	// ReplicaDSNs are the connection strings of postgres streaming replicas, wallet and history reads go to them
+	ReplicaDSNs []string `yaml:"replica_dsns,omitempty"`
+	// MaxReplicaLagSeconds sends reads to the primary while every replica lags more, 1 second when 0
+	MaxReplicaLagSeconds int `yaml:"max_replica_lag_seconds,omitempty"`
+}
+
+// Database drivers
+const (
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
+	DriverMemory   = "memory"
+)
+
+// Postgres reports whether the database is postgres, the default driver
+func (d *Database) Postgres() bool {
+
+	return d == nil || d.Driver == "" || d.Driver == DriverPostgres
+}
+
+// Memory reports whether the wallets are kept in process memory
+func (d *Database) Memory() bool {
+
+	return d != nil && d.Driver == DriverMemory
+}
+
+// Outbox holds data necessary for outbox relay configuration
+type Outbox struct {
+	// Publisher is either stdout or nats
+	Publisher     string `yaml:"publisher,omitempty"`
+	NATSURL       string `yaml:"nats_url,omitempty"`
+	SubjectPrefix string `yaml:"subject_prefix,omitempty"`
+}
+
+// Cache holds data necessary for caching wallet reads in Redis, reads are not cached when the section is missing
+type Cache struct {
+	// RedisAddr is the host:port of the Redis server
+	RedisAddr string `yaml:"redis_addr,omitempty"`
+	// RedisPassword is empty without AUTH, set CRYPTOCOM_CACHE_REDIS_PASSWORD_FILE to read it from a secret file
+	RedisPassword string `yaml:"redis_password,omitempty"`
+	RedisDB       int    `yaml:"redis_db,omitempty"`
+	// TTLSeconds bounds how long an entry lives, 30 seconds when 0
+	TTLSeconds int `yaml:"ttl_seconds,omitempty"`
+}
+
+// Archive holds data necessary for archiving the wallet transactions of closed months to files,
+// they stay in the database when the section is missing
+type Archive struct {
+	// Dir keeps the archive files, every replica reading archived transactions needs it, like a shared volume
+	Dir string `yaml:"dir,omitempty"`
+	// AfterMonths is how many closed months stay in the database, the month after the last one is archived when 0
+	AfterMonths int `yaml:"after_months,omitempty"`
+	// IntervalSeconds is how often closed months are looked for, hourly when 0
+	IntervalSeconds int `yaml:"interval_seconds,omitempty"`
+}
+
+// Jobs holds data necessary for the background job runner, its leader runs the background workers, like the webhook
+// dispatcher, the outbox relay and the archiver, no jobs run and every API replica runs them when the section is missing
+type Jobs struct {
+	// Standalone runs the jobs and the background workers only in the worker command, the API runs them too when false
+	Standalone bool `yaml:"standalone,omitempty"`
+	// Workers is how many jobs run at once, 4 when 0
+	Workers int `yaml:"workers,omitempty"`
+	// PollIntervalSeconds is how often the queue is polled once drained, every second when 0
+	PollIntervalSeconds int `yaml:"poll_interval_seconds,omitempty"`
+	// LeaseSeconds is how long a job may run before it is canceled and claimed again, 5 minutes when 0
+	LeaseSeconds int `yaml:"lease_seconds,omitempty"`
+	// MaxAttempts is how many times a job is tried before it is dead, 10 when 0
+	MaxAttempts int `yaml:"max_attempts,omitempty"`
+	// RetentionHours is how long the finished jobs are kept, a week when 0
+	RetentionHours int `yaml:"retention_hours,omitempty"`
+}
+
+// Tracing holds data necessary for OpenTelemetry tracing configuration
+type Tracing struct {
+	ServiceName string `yaml:"service_name,omitempty"`
+	// OTLPEndpoint is the host:port of the OTLP gRPC collector
+	OTLPEndpoint string  `yaml:"otlp_endpoint,omitempty"`
+	Insecure     bool    `yaml:"insecure,omitempty"`
+	SampleRatio  float64 `yaml:"sample_ratio,omitempty"`
+}
+
+// Logging holds data necessary for logger configuration
+type Logging struct {
+	// Level is one of trace, debug, info, warn, error or disabled
+	Level string `yaml:"level,omitempty"`
+	// Format is json or console
+	Format   string       `yaml:"format,omitempty"`
+	File     *LogFile     `yaml:"file,omitempty"`
+	Sampling *LogSampling `yaml:"sampling,omitempty"`
+	// Redact lists the log params to mask, by key or dotted path like req.ID
+	Redact []string `yaml:"redact,omitempty"`
+}
+
+// LogFile holds data necessary for log file rotation
+type LogFile struct {
+	Path       string `yaml:"path,omitempty"`
+	MaxSizeMB  int    `yaml:"max_size_mb,omitempty"`
+	MaxBackups int    `yaml:"max_backups,omitempty"`
+	MaxAgeDays int    `yaml:"max_age_days,omitempty"`
+	Compress   bool   `yaml:"compress,omitempty"`
+}
+
+// LogSampling holds data necessary for sampling success logs
+type LogSampling struct {
+	Burst uint32 `yaml:"burst,omitempty"`
+	// PeriodSeconds is how often the burst starts over, 1 second when 0
+	PeriodSeconds int    `yaml:"period_seconds,omitempty"`
+	Thereafter    uint32 `yaml:"thereafter,omitempty"`
+}
+
+// Auth holds data necessary for API authentication
+type Auth struct {
+	// JWTSecret is the HS256 key of the bearer tokens, the API is not authenticated when empty
+	JWTSecret string `yaml:"jwt_secret,omitempty"`
+}
+
+// Limits holds data necessary for limiting requests
+type Limits struct {
+	// BodyLimit is the max request body size, like 4K or 1M
+	BodyLimit string `yaml:"body_limit,omitempty"`
+}
+
+// Features holds the switches of optional features, all of them are enabled by default
+type Features struct {
+	// SSE serves the wallet event stream
+	SSE bool `yaml:"sse"`
+	// Webhooks serves the webhook endpoints and runs the delivery dispatcher
+	Webhooks bool `yaml:"webhooks"`
+}
+
+func defaultFeatures() *Features {
+
+	return &Features{SSE: true, Webhooks: true}
 }
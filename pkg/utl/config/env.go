@@ -0,0 +1,144 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// fileSuffix reads the value from the file the variable points to, like CRYPTOCOM_DATABASE_DSN_FILE=/run/secrets/dsn
+const fileSuffix = "_FILE"
+
+// override sets the fields of v from the environment, the variable of a field is the upper case yaml path joined by _
+// like CRYPTOCOM_SERVER_PORT, it returns whether any field is set, so nil sections stay nil without variables
+func override(v reflect.Value, prefix string, lookup func(string) (string, bool)) error {
+	_, err := overrideStruct(v, prefix, lookup)
+
+	return err
+}
+
+func overrideStruct(v reflect.Value, prefix string, lookup func(string) (string, bool)) (bool, error) {
+	set := false
+	for i := 0; i < v.NumField(); i++ {
+		name := strings.Split(v.Type().Field(i).Tag.Get("yaml"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+		ok, err := overrideField(v.Field(i), prefix+"_"+strings.ToUpper(name), lookup)
+		if err != nil {
+
+			return false, err
+		}
+		set = set || ok
+	}
+
+	return set, nil
+}
+
+func overrideField(field reflect.Value, name string, lookup func(string) (string, bool)) (bool, error) {
+	switch {
+	case field.Kind() == reflect.Struct:
+
+		return overrideStruct(field, name, lookup)
+	case field.Kind() == reflect.Ptr && field.Type().Elem().Kind() == reflect.Struct:
+		section := reflect.New(field.Type().Elem())
+		if !field.IsNil() {
+			section.Elem().Set(field.Elem())
+		}
+		set, err := overrideStruct(section.Elem(), name, lookup)
+		if err != nil || !set {
+
+			return false, err
+		}
+		field.Set(section)
+
+		return true, nil
+	}
+
+	value, ok, err := lookupValue(name, lookup)
+	if err != nil || !ok {
+
+		return false, err
+	}
+	if err := setValue(field, value); err != nil {
+
+		return false, fmt.Errorf("%s, %v", name, err)
+	}
+
+	return true, nil
+}
+
+// lookupValue prefers the variable itself to the secret file
+func lookupValue(name string, lookup func(string) (string, bool)) (string, bool, error) {
+	if value, ok := lookup(name); ok {
+
+		return value, true, nil
+	}
+	path, ok := lookup(name + fileSuffix)
+	if !ok {
+
+		return "", false, nil
+	}
+	bytes, err := ioutil.ReadFile(path)
+	if err != nil {
+
+		return "", false, fmt.Errorf("%s, %v", name+fileSuffix, err)
+	}
+
+	// editors and secret managers end files with a newline
+	return strings.TrimSpace(string(bytes)), true, nil
+}
+
+func setValue(field reflect.Value, value string) error {
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(value, 10, field.Type().Bits())
+		if err != nil {
+
+			return err
+		}
+		field.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(value, 10, field.Type().Bits())
+		if err != nil {
+
+			return err
+		}
+		field.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(value, field.Type().Bits())
+		if err != nil {
+
+			return err
+		}
+		field.SetFloat(f)
+	case reflect.Slice:
+		if field.Type().Elem().Kind() != reflect.String {
+
+			return fmt.Errorf("unsupported type %s", field.Type())
+		}
+		values := []string{}
+		for _, v := range strings.Split(value, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				values = append(values, v)
+			}
+		}
+		field.Set(reflect.ValueOf(values))
+	default:
+
+		return fmt.Errorf("unsupported type %s", field.Type())
+	}
+
+	return nil
+}
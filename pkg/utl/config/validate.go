@@ -0,0 +1,199 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/labstack/gommon/bytes"
+)
+
+// minJWTSecretLength is the HS256 key size
+const minJWTSecretLength = 32
+
+var (
+	logLevels  = []string{"", "trace", "debug", "info", "warn", "error", "disabled"}
+	logFormats = []string{"", "json", "console"}
+	publishers = []string{"stdout", "nats"}
+	drivers    = []string{"", DriverPostgres, DriverSQLite, DriverMemory}
+)
+
+// Validate returns every invalid field joined in one error
+func (c *Configuration) Validate() error {
+	errs := []error{}
+	invalid := func(field string, format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf("%s %s", field, fmt.Sprintf(format, args...)))
+	}
+
+	if c.Server == nil || c.Server.Port == "" {
+		invalid("server.port", "is required")
+	}
+	if c.Server != nil {
+		if c.Server.ReadTimeout < 0 {
+			invalid("server.read_timeout_seconds", "must not be negative")
+		}
+		if c.Server.WriteTimeout < 0 {
+			invalid("server.write_timeout_seconds", "must not be negative")
+		}
+		if c.Server.DrainSeconds < 0 {
+			invalid("server.drain_seconds", "must not be negative")
+		}
+		if c.Server.ShutdownTimeoutSeconds < 0 {
+			invalid("server.shutdown_timeout_seconds", "must not be negative")
+		}
+		if c.Server.TLSCertFile != "" && c.Server.TLSKeyFile == "" {
+			invalid("server.tls_key_file", "is required by tls_cert_file")
+		}
+		if c.Server.TLSKeyFile != "" && c.Server.TLSCertFile == "" {
+			invalid("server.tls_cert_file", "is required by tls_key_file")
+		}
+		if c.Server.TLSClientCAFile != "" && c.Server.TLSCertFile == "" {
+			invalid("server.tls_client_ca_file", "requires tls_cert_file")
+		}
+	}
+
+	if (c.Database == nil || c.Database.DSN == "") && !c.Database.Memory() {
+		invalid("database.dsn", "is required")
+	}
+	if c.Database != nil {
+		if !contains(drivers, c.Database.Driver) {
+			invalid("database.driver", "must be one of %v, got %q", drivers[1:], c.Database.Driver)
+		}
+		if c.Database.MaxOpenConns < 0 {
+			invalid("database.max_open_conns", "must not be negative")
+		}
+		if c.Database.MaxIdleConns < 0 {
+			invalid("database.max_idle_conns", "must not be negative")
+		}
+		if c.Database.MaxOpenConns > 0 && c.Database.MaxIdleConns > c.Database.MaxOpenConns {
+			invalid("database.max_idle_conns", "must not be greater than max_open_conns %d", c.Database.MaxOpenConns)
+		}
+		if c.Database.ConnMaxLifetimeSeconds < 0 {
+			invalid("database.conn_max_lifetime_seconds", "must not be negative")
+		}
+		if c.Database.ConnMaxIdleTimeSeconds < 0 {
+			invalid("database.conn_max_idle_time_seconds", "must not be negative")
+		}
+		if c.Database.ConnectTimeoutSeconds < 0 {
+			invalid("database.connect_timeout_seconds", "must not be negative")
+		}
+		if c.Database.QueryTimeoutSeconds < 0 {
+			invalid("database.query_timeout_seconds", "must not be negative")
+		}
+		if c.Database.StatementTimeoutSeconds < 0 {
+			invalid("database.statement_timeout_seconds", "must not be negative")
+		}
+		if len(c.Database.ReplicaDSNs) > 0 && !c.Database.Postgres() {
+			invalid("database.replica_dsns", "requires the %s database driver", DriverPostgres)
+		}
+		if c.Database.MaxReplicaLagSeconds < 0 {
+			invalid("database.max_replica_lag_seconds", "must not be negative")
+		}
+	}
+
+	if c.Outbox != nil {
+		if !c.Database.Postgres() {
+			invalid("outbox", "requires the %s database driver", DriverPostgres)
+		}
+		if !contains(publishers, c.Outbox.Publisher) {
+			invalid("outbox.publisher", "must be one of %v, got %q", publishers, c.Outbox.Publisher)
+		}
+		if c.Outbox.Publisher == "nats" && c.Outbox.NATSURL == "" {
+			invalid("outbox.nats_url", "is required by the nats publisher")
+		}
+	}
+
+	if c.Cache != nil {
+		if c.Cache.RedisAddr == "" {
+			invalid("cache.redis_addr", "is required")
+		}
+		if c.Cache.RedisDB < 0 {
+			invalid("cache.redis_db", "must not be negative")
+		}
+		if c.Cache.TTLSeconds < 0 {
+			invalid("cache.ttl_seconds", "must not be negative")
+		}
+	}
+
+	if c.Archive != nil {
+		if !c.Database.Postgres() {
+			invalid("archive", "requires the %s database driver", DriverPostgres)
+		}
+		if c.Archive.Dir == "" {
+			invalid("archive.dir", "is required")
+		}
+		if c.Archive.AfterMonths < 0 {
+			invalid("archive.after_months", "must not be negative")
+		}
+		if c.Archive.IntervalSeconds < 0 {
+			invalid("archive.interval_seconds", "must not be negative")
+		}
+	}
+
+	if c.Jobs != nil {
+		if !c.Database.Postgres() {
+			invalid("jobs", "requires the %s database driver", DriverPostgres)
+		}
+		if c.Jobs.Workers < 0 {
+			invalid("jobs.workers", "must not be negative")
+		}
+		if c.Jobs.PollIntervalSeconds < 0 {
+			invalid("jobs.poll_interval_seconds", "must not be negative")
+		}
+		if c.Jobs.LeaseSeconds < 0 {
+			invalid("jobs.lease_seconds", "must not be negative")
+		}
+		if c.Jobs.MaxAttempts < 0 {
+			invalid("jobs.max_attempts", "must not be negative")
+		}
+		if c.Jobs.RetentionHours < 0 {
+			invalid("jobs.retention_hours", "must not be negative")
+		}
+	}
+
+	if c.Tracing != nil {
+		if c.Tracing.OTLPEndpoint == "" {
+			invalid("tracing.otlp_endpoint", "is required")
+		}
+		if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+			invalid("tracing.sample_ratio", "must be between 0 and 1, got %v", c.Tracing.SampleRatio)
+		}
+	}
+
+	if c.Logging != nil {
+		if !contains(logLevels, c.Logging.Level) {
+			invalid("logging.level", "must be one of %v, got %q", logLevels[1:], c.Logging.Level)
+		}
+		if !contains(logFormats, c.Logging.Format) {
+			invalid("logging.format", "must be one of %v, got %q", logFormats[1:], c.Logging.Format)
+		}
+		if c.Logging.File != nil && c.Logging.File.Path == "" {
+			invalid("logging.file.path", "is required")
+		}
+		if c.Logging.Sampling != nil && c.Logging.Sampling.PeriodSeconds < 0 {
+			invalid("logging.sampling.period_seconds", "must not be negative")
+		}
+	}
+
+	if c.Auth != nil && c.Auth.JWTSecret != "" && len(c.Auth.JWTSecret) < minJWTSecretLength {
+		invalid("auth.jwt_secret", "must be at least %d bytes", minJWTSecretLength)
+	}
+
+	if c.Limits != nil && c.Limits.BodyLimit != "" {
+		if _, err := bytes.Parse(c.Limits.BodyLimit); err != nil {
+			invalid("limits.body_limit", "must be a size like 4K or 1M, got %q", c.Limits.BodyLimit)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+
+			return true
+		}
+	}
+
+	return false
+}
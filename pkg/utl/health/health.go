@@ -0,0 +1,118 @@
+// Package health reports liveness and readiness of the service and its dependencies
+package health
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	StatusUp           = "up"
+	StatusDown         = "down"
+	StatusShuttingDown = "shutting_down"
+)
+
+// Check checks one dependency, the details are reported with the component status
+type Check func(ctx context.Context) (details map[string]interface{}, err error)
+
+// Component is the status of one dependency
+type Component struct {
+	Status  string                 `json:"status"`
+	Latency string                 `json:"latency"`
+	Error   string                 `json:"error,omitempty"`
+	Details map[string]interface{} `json:"details,omitempty"`
+}
+
+// Report is the readiness of the service, it is up only when every component is up
+type Report struct {
+	Status     string                `json:"status"`
+	Components map[string]*Component `json:"components"`
+}
+
+// New creates new checker with defaults
+func New() *Checker {
+
+	return &Checker{
+		checks:  map[string]Check{},
+		Timeout: 2 * time.Second,
+	}
+}
+
+// Checker runs the registered checks
+type Checker struct {
+	mu           sync.RWMutex
+	checks       map[string]Check
+	shuttingDown atomic.Bool
+
+	// Timeout bounds every check
+	Timeout time.Duration
+}
+
+// Register adds the check of a dependency
+func (h *Checker) Register(name string, check Check) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.checks[name] = check
+}
+
+// Shutdown makes readiness fail from now on, so load balancers drain traffic before the server stops
+func (h *Checker) Shutdown() {
+	h.shuttingDown.Store(true)
+}
+
+// Ready runs every check concurrently and reports the readiness
+func (h *Checker) Ready(ctx context.Context) *Report {
+	h.mu.RLock()
+	checks := make(map[string]Check, len(h.checks))
+	for name, check := range h.checks {
+		checks[name] = check
+	}
+	h.mu.RUnlock()
+
+	ctx, cancel := context.WithTimeout(ctx, h.Timeout)
+	defer cancel()
+
+	report := &Report{Status: StatusUp, Components: make(map[string]*Component, len(checks))}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, check := range checks {
+		wg.Add(1)
+		go func(name string, check Check) {
+			defer wg.Done()
+			component := run(ctx, check)
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.Components[name] = component
+			if component.Status != StatusUp {
+				report.Status = StatusDown
+			}
+		}(name, check)
+	}
+	wg.Wait()
+
+	if h.shuttingDown.Load() {
+		report.Status = StatusShuttingDown
+	}
+
+	return report
+}
+
+func run(ctx context.Context, check Check) *Component {
+	begin := time.Now()
+	details, err := check(ctx)
+	component := &Component{
+		Status:  StatusUp,
+		Latency: time.Since(begin).String(),
+		Details: details,
+	}
+	if err != nil {
+		component.Status = StatusDown
+		component.Error = err.Error()
+	}
+
+	return component
+}
@@ -0,0 +1,161 @@
+package health_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
+
+	"github.com/sappy5678/cryptocom/pkg/utl/health"
+	"github.com/sappy5678/cryptocom/pkg/utl/server"
+)
+
+func up(ctx context.Context) (map[string]interface{}, error) {
+
+	return map[string]interface{}{"version": 3}, nil
+}
+
+func down(ctx context.Context) (map[string]interface{}, error) {
+
+	return nil, errors.New("connection refused")
+}
+
+func slow(ctx context.Context) (map[string]interface{}, error) {
+	<-ctx.Done()
+
+	return nil, ctx.Err()
+}
+
+func TestReady(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	tests := []struct {
+		name           string
+		checks         map[string]health.Check
+		shutdown       bool
+		wantStatus     string
+		wantComponents map[string]string
+		wantErrors     map[string]string
+	}{
+		{
+			name:           "no checks",
+			checks:         map[string]health.Check{},
+			wantStatus:     health.StatusUp,
+			wantComponents: map[string]string{},
+		},
+		{
+			name:           "all up",
+			checks:         map[string]health.Check{"postgres": up, "nats": up},
+			wantStatus:     health.StatusUp,
+			wantComponents: map[string]string{"postgres": health.StatusUp, "nats": health.StatusUp},
+		},
+		{
+			name:           "one down",
+			checks:         map[string]health.Check{"postgres": up, "nats": down},
+			wantStatus:     health.StatusDown,
+			wantComponents: map[string]string{"postgres": health.StatusUp, "nats": health.StatusDown},
+			wantErrors:     map[string]string{"nats": "connection refused"},
+		},
+		{
+			name:           "timeout",
+			checks:         map[string]health.Check{"postgres": slow},
+			wantStatus:     health.StatusDown,
+			wantComponents: map[string]string{"postgres": health.StatusDown},
+			wantErrors:     map[string]string{"postgres": context.DeadlineExceeded.Error()},
+		},
+		{
+			name:           "shutting down",
+			checks:         map[string]health.Check{"postgres": up},
+			shutdown:       true,
+			wantStatus:     health.StatusShuttingDown,
+			wantComponents: map[string]string{"postgres": health.StatusUp},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checker := health.New()
+			checker.Timeout = 10 * time.Millisecond
+			for name, check := range tt.checks {
+				checker.Register(name, check)
+			}
+			if tt.shutdown {
+				checker.Shutdown()
+			}
+
+			report := checker.Ready(context.Background())
+			assert.Equal(t, tt.wantStatus, report.Status)
+			gotComponents := map[string]string{}
+			for name, component := range report.Components {
+				gotComponents[name] = component.Status
+				assert.NotEmpty(t, component.Latency)
+				assert.Equal(t, tt.wantErrors[name], component.Error)
+			}
+			assert.Equal(t, tt.wantComponents, gotComponents)
+		})
+	}
+}
+
+func TestHTTP(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	checker := health.New()
+	healthy := true
+	checker.Register("postgres", func(ctx context.Context) (map[string]interface{}, error) {
+		if !healthy {
+
+			return down(ctx)
+		}
+
+		return up(ctx)
+	})
+
+	e := server.New()
+	health.NewHTTP(checker, e)
+	ts := httptest.NewServer(e)
+	defer ts.Close()
+
+	get := func(path string) (int, *health.Report) {
+		res, err := http.Get(ts.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		report := new(health.Report)
+		assert.NoError(t, json.NewDecoder(res.Body).Decode(report))
+
+		return res.StatusCode, report
+	}
+
+	code, report := get("/readyz")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, health.StatusUp, report.Status)
+	assert.Equal(t, float64(3), report.Components["postgres"].Details["version"])
+
+	// liveness does not depend on the dependencies
+	healthy = false
+	code, report = get("/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, health.StatusDown, report.Status)
+	assert.Equal(t, "connection refused", report.Components["postgres"].Error)
+
+	code, report = get("/livez")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, health.StatusUp, report.Status)
+
+	// readiness fails during shutdown even when every dependency is up
+	healthy = true
+	checker.Shutdown()
+	code, report = get("/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, health.StatusShuttingDown, report.Status)
+
+	code, _ = get("/livez")
+	assert.Equal(t, http.StatusOK, code)
+}
@@ -0,0 +1,29 @@
+package health
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo"
+)
+
+// NewHTTP serves liveness on /livez and readiness on /readyz
+func NewHTTP(h *Checker, e *echo.Echo) {
+	// Liveness, the process is serving requests
+	// GET /livez
+	e.GET("/livez", func(c echo.Context) error {
+
+		return c.JSON(http.StatusOK, map[string]string{"status": StatusUp})
+	})
+
+	// Readiness, every dependency is up and the server is not shutting down
+	// GET /readyz
+	e.GET("/readyz", func(c echo.Context) error {
+		report := h.Ready(c.Request().Context())
+		if report.Status != StatusUp {
+
+			return c.JSON(http.StatusServiceUnavailable, report)
+		}
+
+		return c.JSON(http.StatusOK, report)
+	})
+}
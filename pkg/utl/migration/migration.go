@@ -0,0 +1,219 @@
+package migration
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database"
+	"github.com/golang-migrate/migrate/v4/database/postgres"
+	"github.com/golang-migrate/migrate/v4/database/sqlite3"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+	"github.com/jmoiron/sqlx"
+)
+
+// lockID is the advisory lock held while migrating, "migrate" in hex
+const lockID = 0x6d696772617465
+
+// Status is the migration state of a database
+type Status struct {
+	// Version is the applied version, 0 when nothing is applied
+	Version uint `json:"version"`
+	Dirty   bool `json:"dirty"`
+	// Latest is the last version of the migrations
+	Latest uint `json:"latest"`
+	// Pending lists the versions not applied yet
+	Pending []uint `json:"pending"`
+}
+
+// Migrator runs the migrations of a source folder, like deploy/db/migrations, on a postgres or sqlite database
+type Migrator struct {
+	db     *sqlx.DB
+	source fs.FS
+	sqlite bool
+}
+
+// New creates new migrator of a postgres database
+func New(db *sqlx.DB, source fs.FS) *Migrator {
+
+	return &Migrator{db: db, source: source}
+}
+
+// NewSQLite creates new migrator of a sqlite database, like deploy/db/sqlite/migrations
+func NewSQLite(db *sqlx.DB, source fs.FS) *Migrator {
+
+	return &Migrator{db: db, source: source, sqlite: true}
+}
+
+// Up applies every pending migration
+func (m *Migrator) Up(ctx context.Context) error {
+
+	return m.run(ctx, func(mig *migrate.Migrate) error {
+
+		return mig.Up()
+	})
+}
+
+// Down rolls back the last applied migration
+func (m *Migrator) Down(ctx context.Context) error {
+
+	return m.run(ctx, func(mig *migrate.Migrate) error {
+
+		return mig.Steps(-1)
+	})
+}
+
+// Goto migrates up or down to version
+func (m *Migrator) Goto(ctx context.Context, version uint) error {
+
+	return m.run(ctx, func(mig *migrate.Migrate) error {
+
+		return mig.Migrate(version)
+	})
+}
+
+// Status returns the applied version and the pending migrations
+func (m *Migrator) Status(ctx context.Context) (*Status, error) {
+	versions, err := Versions(m.source)
+	if err != nil {
+
+		return nil, err
+	}
+
+	status := &Status{Pending: []uint{}}
+	if len(versions) > 0 {
+		status.Latest = versions[len(versions)-1]
+	}
+	err = m.run(ctx, func(mig *migrate.Migrate) error {
+		version, dirty, err := mig.Version()
+		if err != nil && !errors.Is(err, migrate.ErrNilVersion) {
+
+			return err
+		}
+		status.Version, status.Dirty = version, dirty
+
+		return nil
+	})
+	if err != nil {
+
+		return nil, err
+	}
+	for _, version := range versions {
+		if version > status.Version {
+			status.Pending = append(status.Pending, version)
+		}
+	}
+
+	return status, nil
+}
+
+// run holds the advisory lock on a dedicated connection while fn migrates through it,
+// replicas migrating on start wait for the first one instead of failing on the 15 seconds lock timeout of golang-migrate
+// sqlite has no advisory lock and a single writer, each migration runs in a transaction holding the database lock
+func (m *Migrator) run(ctx context.Context, fn func(mig *migrate.Migrate) error) (err error) {
+	if m.sqlite {
+		driver, err := sqlite3.WithInstance(m.db.DB, &sqlite3.Config{})
+		if err != nil {
+
+			return err
+		}
+
+		return m.migrate(driver, "sqlite3", fn)
+	}
+
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+
+		return err
+	}
+	defer conn.Close()
+
+	// waiting for the lock and migrating may take longer than the statement_timeout of the pool
+	if _, err := conn.ExecContext(ctx, `SET statement_timeout = 0`); err != nil {
+
+		return err
+	}
+	defer conn.ExecContext(context.Background(), `RESET statement_timeout`)
+
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, lockID); err != nil {
+
+		return err
+	}
+	// the lock belongs to the session, so it must be released before the connection goes back to the pool
+	defer func() {
+		if _, unlockErr := conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, lockID); unlockErr != nil && err == nil {
+			err = unlockErr
+		}
+	}()
+
+	driver, err := postgres.WithConnection(ctx, conn, &postgres.Config{})
+	if err != nil {
+
+		return err
+	}
+
+	return m.migrate(driver, "postgres", fn)
+}
+
+// migrate runs fn with the migrations of the source on driver
+func (m *Migrator) migrate(driver database.Driver, databaseName string, fn func(mig *migrate.Migrate) error) error {
+	src, err := iofs.New(m.source, ".")
+	if err != nil {
+
+		return err
+	}
+	mig, err := migrate.NewWithInstance("iofs", src, databaseName, driver)
+	if err != nil {
+
+		return err
+	}
+	// mig is not closed, closing its driver would close conn before the unlock, or the sqlite pool
+	defer src.Close()
+
+	if err := fn(mig); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+
+		return err
+	}
+
+	return nil
+}
+
+// Versions returns the versions of the migrations in source, in order
+func Versions(source fs.FS) ([]uint, error) {
+	src, err := iofs.New(source, ".")
+	if err != nil {
+
+		return nil, err
+	}
+	defer src.Close()
+
+	versions := []uint{}
+	version, err := src.First()
+	for err == nil {
+		versions = append(versions, version)
+		version, err = src.Next(version)
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+
+		return nil, err
+	}
+
+	return versions, nil
+}
+
+// Latest returns the last version of the migrations in source
+func Latest(source fs.FS) (uint, error) {
+	versions, err := Versions(source)
+	if err != nil {
+
+		return 0, err
+	}
+	if len(versions) == 0 {
+
+		return 0, nil
+	}
+
+	return versions[len(versions)-1], nil
+}
@@ -0,0 +1,77 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+
+	"github.com/sappy5678/cryptocom/pkg/utl/health"
+)
+
+// PingCheck checks db is reachable and reports the pool usage
+func PingCheck(db *sqlx.DB) health.Check {
+
+	return func(ctx context.Context) (map[string]interface{}, error) {
+		err := db.PingContext(ctx)
+		stats := db.Stats()
+
+		return map[string]interface{}{
+			"openConnections": stats.OpenConnections,
+			"inUse":           stats.InUse,
+		}, err
+	}
+}
+
+// migrationVersionQuery reads the version table of golang-migrate
+const migrationVersionQuery = `SELECT version, dirty FROM schema_migrations LIMIT 1`
+
+// MigrationCheck checks the schema is migrated to at least version and the last migration did not fail halfway
+func MigrationCheck(db *sqlx.DB, version uint) health.Check {
+
+	return func(ctx context.Context) (map[string]interface{}, error) {
+		migration := struct {
+			Version uint `db:"version"`
+			Dirty   bool `db:"dirty"`
+		}{}
+		if err := db.GetContext(ctx, &migration, migrationVersionQuery); err != nil {
+
+			return nil, err
+		}
+
+		details := map[string]interface{}{
+			"version":  migration.Version,
+			"dirty":    migration.Dirty,
+			"required": version,
+		}
+		if migration.Dirty {
+
+			return details, fmt.Errorf("migration %d is dirty", migration.Version)
+		}
+		if migration.Version < version {
+
+			return details, fmt.Errorf("migration version %d is older than %d", migration.Version, version)
+		}
+
+		return details, nil
+	}
+}
+
+// ListenerCheck checks the LISTEN connection is up
+func ListenerCheck(listener *pq.Listener) health.Check {
+
+	return func(ctx context.Context) (map[string]interface{}, error) {
+
+		return nil, listener.Ping()
+	}
+}
+
+// ReplicaCheck reports the replicas at their last poll, it never fails, reads go to the primary without replicas
+func ReplicaCheck(replicas *Replicas) health.Check {
+
+	return func(ctx context.Context) (map[string]interface{}, error) {
+
+		return map[string]interface{}{"replicas": replicas.Status()}, nil
+	}
+}
@@ -0,0 +1,22 @@
+package postgres
+
+import (
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// NewListener creates new postgres LISTEN connection subscribed to the given channels,
+// it reconnects on its own and sends a nil notification after each reconnect
+func NewListener(psn string, channels ...string) (*pq.Listener, error) {
+	listener := pq.NewListener(psn, 10*time.Second, time.Minute, nil)
+	for _, channel := range channels {
+		if err := listener.Listen(channel); err != nil {
+			listener.Close()
+
+			return nil, err
+		}
+	}
+
+	return listener, nil
+}
@@ -1,24 +1,176 @@
 package postgres
 
 import (
+	"context"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/XSAM/otelsql"
 	"github.com/jmoiron/sqlx"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
 
 	// DB adapter
 	_ "github.com/lib/pq"
 )
 
+// driverName is the postgres driver wrapped with a span around every statement,
+// spans are created with the global tracer provider so they are noop until tracing is set up
+var driverName = registerDriver()
+
+func registerDriver() string {
+	name, err := otelsql.Register("postgres",
+		otelsql.WithAttributes(semconv.DBSystemPostgreSQL),
+		otelsql.WithSpanNameFormatter(spanName),
+		otelsql.WithSpanOptions(otelsql.SpanOptions{
+			OmitConnResetSession: true,
+			OmitRows:             true,
+		}),
+	)
+	if err != nil {
+		panic(err)
+	}
+	sqlx.BindDriver(name, sqlx.DOLLAR)
+
+	return name
+}
+
+// spanName names statement spans by the SQL command, like SELECT or UPDATE, and other calls by the method
+func spanName(ctx context.Context, method otelsql.Method, query string) string {
+	if command, _, _ := strings.Cut(strings.TrimSpace(query), " "); command != "" {
+
+		return strings.ToUpper(command)
+	}
+
+	return string(method)
+}
+
+// connect retry backoff, doubling from minRetryBackoff up to maxRetryBackoff
+const (
+	minRetryBackoff = 100 * time.Millisecond
+	maxRetryBackoff = 5 * time.Second
+)
+
+// pingTimeout bounds the single connection attempt made without ConnectTimeout
+const pingTimeout = 5 * time.Second
+
+// defaultConnectTimeoutSeconds is the connect_timeout of the dsn when it sets none,
+// lib/pq bounds the startup handshake with it only, a server that accepts and never answers would hang the connect
+const defaultConnectTimeoutSeconds = "5"
+
+// Config represents database connection specific config
+type Config struct {
+	DSN string
+	// MaxOpenConns is unlimited when 0
+	MaxOpenConns int
+	// MaxIdleConns keeps database/sql default of 2 when 0
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+	// ConnectTimeout keeps retrying the first connection with backoff until it elapses, so the service can start
+	// before the database is ready, every attempt is bounded by what is left of it and the connect_timeout of the dsn,
+	// New fails on the first error when 0, after at most pingTimeout
+	ConnectTimeout time.Duration
+	// StatementTimeout is the statement_timeout of every session, postgres cancels longer statements
+	StatementTimeout time.Duration
+}
+
 // New creates new database connection to a postgres database
 func New(psn string) (*sqlx.DB, error) {
-	db, err := sqlx.Connect("postgres", psn)
+
+	return NewWithConfig(&Config{DSN: psn})
+}
+
+// NewWithConfig creates new database connection to a postgres database with the pool and timeouts of cfg
+func NewWithConfig(cfg *Config) (*sqlx.DB, error) {
+	db, err := Open(cfg)
 	if err != nil {
 
 		return nil, err
 	}
 
-	if db.Ping() != nil {
+	budget := cfg.ConnectTimeout
+	if budget <= 0 {
+		budget = pingTimeout
+	}
+	deadline := time.Now().Add(budget)
+	for backoff := minRetryBackoff; ; backoff = min(backoff*2, maxRetryBackoff) {
+		if err = ping(db, deadline); err == nil {
+
+			return db, nil
+		}
+		if cfg.ConnectTimeout <= 0 || time.Now().Add(backoff).After(deadline) {
+			break
+		}
+		time.Sleep(backoff)
+	}
+	db.Close()
+
+	return nil, err
+}
+
+func ping(db *sqlx.DB, deadline time.Time) error {
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+
+	return db.PingContext(ctx)
+}
+
+// Open creates the pool of cfg without connecting, the first query connects, ConnectTimeout is not used,
+// for databases the service starts without, like replicas
+func Open(cfg *Config) (*sqlx.DB, error) {
+	dsn, err := withParam(cfg.DSN, "connect_timeout", defaultConnectTimeoutSeconds, false)
+	if err != nil {
+
+		return nil, err
+	}
+	if cfg.StatementTimeout > 0 {
+		ms := strconv.FormatInt(cfg.StatementTimeout.Milliseconds(), 10)
+		if dsn, err = withParam(dsn, "statement_timeout", ms, true); err != nil {
+
+			return nil, err
+		}
+	}
+	db, err := sqlx.Open(driverName, dsn)
+	if err != nil {
 
 		return nil, err
 	}
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	if cfg.MaxIdleConns > 0 {
+		db.SetMaxIdleConns(cfg.MaxIdleConns)
+	}
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
 
 	return db, nil
 }
+
+// withParam adds the parameter to the dsn, a parameter the dsn already sets is kept unless replace,
+// lib/pq sends unknown parameters, like statement_timeout, as session settings
+func withParam(dsn string, key string, value string, replace bool) (string, error) {
+	if !strings.HasPrefix(dsn, "postgres://") && !strings.HasPrefix(dsn, "postgresql://") {
+		// the last of repeated key=value parameters wins
+		if !replace && (strings.HasPrefix(dsn, key+"=") || strings.Contains(dsn, " "+key+"=")) {
+
+			return dsn, nil
+		}
+
+		return strings.TrimSpace(dsn + " " + key + "=" + value), nil
+	}
+	u, err := url.Parse(dsn)
+	if err != nil {
+
+		return "", err
+	}
+	query := u.Query()
+	if !replace && query.Has(key) {
+
+		return dsn, nil
+	}
+	query.Set(key, value)
+	u.RawQuery = query.Encode()
+
+	return u.String(), nil
+}
@@ -0,0 +1,221 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// defaultMaxReplicaLag is the max lag of NewReplicas when it is not set
+const defaultMaxReplicaLag = time.Second
+
+// Replicas routes read-only queries to streaming replicas of the primary, see Reader,
+// and issues the consistency tokens reads pass to see their own writes
+type Replicas struct {
+	primary  *sqlx.DB
+	replicas []*replica
+	maxLag   time.Duration
+	next     atomic.Uint64
+}
+
+// replica is a replica pool with its state at the last poll
+type replica struct {
+	db *sqlx.DB
+	// replayed is the WAL position replayed by the replica
+	replayed atomic.Uint64
+	// behind is how many bytes of WAL the replica had left to replay of the position of the primary
+	behind atomic.Uint64
+	// lag is the replay delay in nanoseconds
+	lag atomic.Int64
+	// ok is false until the first successful poll and after a failed one
+	ok atomic.Bool
+}
+
+// NewReplicas creates new router of reads to replicas, reads go to the primary while every replica lags more
+// than maxLag, 1 second when 0, poll the replicas with Run
+func NewReplicas(primary *sqlx.DB, replicas []*sqlx.DB, maxLag time.Duration) *Replicas {
+	if maxLag <= 0 {
+		maxLag = defaultMaxReplicaLag
+	}
+	r := &Replicas{primary: primary, maxLag: maxLag}
+	for _, db := range replicas {
+		r.replicas = append(r.replicas, &replica{db: db})
+	}
+
+	return r
+}
+
+// replicaStatusQuery reads the replayed WAL position of a replica and the time since it replayed its last transaction,
+// a server which is not in recovery reports its own position
+const replicaStatusQuery = `SELECT
+	COALESCE(CASE WHEN pg_is_in_recovery() THEN pg_last_wal_replay_lsn() ELSE pg_current_wal_lsn() END, '0/0')::TEXT AS replayed,
+	EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()) AS sincereplay`
+
+// Poll refreshes the replay position and lag of every replica, a replica failing to answer gets no reads
+//
+// The replayed position of a replica is compared with the current position of the primary read first,
+// the lag is 0 when the replica replayed all of it, so an idle primary does not make its replicas look late,
+// and the time since the replica replayed its last transaction otherwise, so a replica whose WAL receiver
+// stopped looks late even though it replayed everything it received,
+// every replica gets no reads when the position of the primary cannot be read
+func (r *Replicas) Poll(ctx context.Context) {
+	var current string
+	err := r.primary.GetContext(ctx, &current, currentLSNQuery)
+	primary, lsnErr := parseLSN(current)
+	if err != nil || lsnErr != nil {
+		for _, rep := range r.replicas {
+			rep.ok.Store(false)
+		}
+
+		return
+	}
+
+	for _, rep := range r.replicas {
+		status := struct {
+			Replayed    string          `db:"replayed"`
+			SinceReplay sql.NullFloat64 `db:"sincereplay"`
+		}{}
+		err := rep.db.GetContext(ctx, &status, replicaStatusQuery)
+		replayed, lsnErr := parseLSN(status.Replayed)
+		if err != nil || lsnErr != nil {
+			rep.ok.Store(false)
+
+			continue
+		}
+		var behind uint64
+		var lag time.Duration
+		if replayed < primary {
+			behind = primary - replayed
+			// a replica that never replayed a transaction is as late as can be
+			lag = time.Duration(math.MaxInt64)
+			if status.SinceReplay.Valid {
+				lag = time.Duration(max(status.SinceReplay.Float64, 0) * float64(time.Second))
+			}
+		}
+		rep.replayed.Store(replayed)
+		rep.behind.Store(behind)
+		rep.lag.Store(int64(lag))
+		rep.ok.Store(true)
+	}
+}
+
+// Run polls the replicas every interval until ctx is done, a poll taking longer than interval fails
+func (r *Replicas) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		pollCtx, cancel := context.WithTimeout(ctx, interval)
+		r.Poll(pollCtx)
+		cancel()
+		select {
+		case <-ctx.Done():
+
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Reader returns the next replica, round robin, within the max lag that replayed the consistency token of ctx,
+// or the primary when there is none
+func (r *Replicas) Reader(ctx context.Context) sqlx.ExtContext {
+	token, _ := ctx.Value(tokenKey{}).(uint64)
+	start := r.next.Add(1)
+	for i := range r.replicas {
+		rep := r.replicas[(start+uint64(i))%uint64(len(r.replicas))]
+		if rep.ok.Load() && time.Duration(rep.lag.Load()) <= r.maxLag && rep.replayed.Load() >= token {
+
+			return rep.db
+		}
+	}
+
+	return r.primary
+}
+
+// tokenKey is the context key of the consistency token
+type tokenKey struct{}
+
+const currentLSNQuery = `SELECT pg_current_wal_lsn()::TEXT`
+
+// Token returns the consistency token of the writes committed so far, the current WAL position of the primary
+func (r *Replicas) Token(ctx context.Context) (string, error) {
+	var lsn string
+	if err := r.primary.GetContext(ctx, &lsn, currentLSNQuery); err != nil {
+
+		return "", err
+	}
+
+	return lsn, nil
+}
+
+// WithToken returns ctx whose reads see every write committed before the token was issued,
+// an invalid token sends the reads to the primary
+func (r *Replicas) WithToken(ctx context.Context, token string) context.Context {
+	lsn, err := parseLSN(token)
+	if err != nil {
+		lsn = math.MaxUint64
+	}
+
+	return context.WithValue(ctx, tokenKey{}, lsn)
+}
+
+// HasToken reports whether ctx carries a consistency token, so its reads must see the writes of the token
+func (r *Replicas) HasToken(ctx context.Context) bool {
+	_, ok := ctx.Value(tokenKey{}).(uint64)
+
+	return ok
+}
+
+// Status returns the state of each replica at the last poll
+func (r *Replicas) Status() []map[string]interface{} {
+	status := make([]map[string]interface{}, 0, len(r.replicas))
+	for _, rep := range r.replicas {
+		status = append(status, map[string]interface{}{
+			"ok":           rep.ok.Load(),
+			"lag":          time.Duration(rep.lag.Load()).String(),
+			"behind_bytes": rep.behind.Load(),
+		})
+	}
+
+	return status
+}
+
+// Close closes the replica pools, not the primary
+func (r *Replicas) Close() error {
+	errs := []error{}
+	for _, rep := range r.replicas {
+		errs = append(errs, rep.db.Close())
+	}
+
+	return errors.Join(errs...)
+}
+
+// parseLSN parses a postgres WAL position, like 16/B374D848
+func parseLSN(lsn string) (uint64, error) {
+	high, low, ok := strings.Cut(lsn, "/")
+	if !ok {
+
+		return 0, fmt.Errorf("invalid lsn %q", lsn)
+	}
+	h, err := strconv.ParseUint(high, 16, 32)
+	if err != nil {
+
+		return 0, fmt.Errorf("invalid lsn %q", lsn)
+	}
+	l, err := strconv.ParseUint(low, 16, 32)
+	if err != nil {
+
+		return 0, fmt.Errorf("invalid lsn %q", lsn)
+	}
+
+	return h<<32 | l, nil
+}
@@ -0,0 +1,62 @@
+package publisher
+
+import (
+	"context"
+	"sync"
+
+	"github.com/sappy5678/cryptocom/pkg/domain"
+)
+
+// NewMemory creates new in-memory bus
+func NewMemory() *Memory {
+
+	return &Memory{}
+}
+
+// Memory is an in-memory bus, it records published events and fans them out to subscribers
+type Memory struct {
+	mu          sync.Mutex
+	events      []*domain.Event
+	subscribers []func(*domain.Event)
+	err         error
+}
+
+func (m *Memory) Publish(ctx context.Context, event *domain.Event) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.err != nil {
+
+		return m.err
+	}
+	m.events = append(m.events, event)
+	for _, subscriber := range m.subscribers {
+		subscriber(event)
+	}
+
+	return nil
+}
+
+// Subscribe registers fn to be called synchronously for every published event
+func (m *Memory) Subscribe(fn func(*domain.Event)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.subscribers = append(m.subscribers, fn)
+}
+
+// SetErr makes Publish fail with err without recording the event, nil restores it
+func (m *Memory) SetErr(err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.err = err
+}
+
+// Events returns the published events in order
+func (m *Memory) Events() []*domain.Event {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]*domain.Event{}, m.events...)
+}
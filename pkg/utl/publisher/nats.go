@@ -0,0 +1,82 @@
+package publisher
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/nats-io/nats.go"
+
+	"github.com/sappy5678/cryptocom/pkg/domain"
+)
+
+const (
+	// MsgIDHeader is the event ID, a JetStream stream uses it to drop redelivered events
+	MsgIDHeader = nats.MsgIdHdr
+	// AggregateIDHeader is the user ID of the wallet the event belongs to
+	AggregateIDHeader = "Aggregate-ID"
+)
+
+// NewNATS connects to the NATS server at url, events are published to subjectPrefix.<event type>
+func NewNATS(url, subjectPrefix string, opts ...nats.Option) (*NATS, error) {
+	conn, err := nats.Connect(url, opts...)
+	if err != nil {
+
+		return nil, err
+	}
+
+	return &NATS{conn: conn, subjectPrefix: subjectPrefix, FlushTimeout: 5 * time.Second}, nil
+}
+
+// NATS publishes events to NATS
+type NATS struct {
+	conn          *nats.Conn
+	subjectPrefix string
+
+	// FlushTimeout bounds the wait for the server when ctx has no deadline
+	FlushTimeout time.Duration
+}
+
+// Publish returns after the server has received the event
+func (p *NATS) Publish(ctx context.Context, event *domain.Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+
+		return err
+	}
+
+	msg := nats.NewMsg(p.Subject(event))
+	msg.Data = data
+	msg.Header.Set(MsgIDHeader, strconv.Itoa(event.ID))
+	msg.Header.Set(AggregateIDHeader, event.AggregateID)
+	if err := p.conn.PublishMsg(msg); err != nil {
+
+		return err
+	}
+
+	// the server answers the ping after it has processed the message
+	return p.Ping(ctx)
+}
+
+// Subject returns the subject of the event
+func (p *NATS) Subject(event *domain.Event) string {
+
+	return p.subjectPrefix + "." + event.Type
+}
+
+// Ping flushes the connection and waits for the server to answer
+func (p *NATS) Ping(ctx context.Context) error {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.FlushTimeout)
+		defer cancel()
+	}
+
+	return p.conn.FlushWithContext(ctx)
+}
+
+// Close closes the connection
+func (p *NATS) Close() {
+	p.conn.Close()
+}
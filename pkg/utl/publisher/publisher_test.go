@@ -0,0 +1,132 @@
+package publisher_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
+
+	"github.com/sappy5678/cryptocom/pkg/domain"
+	"github.com/sappy5678/cryptocom/pkg/utl/publisher"
+)
+
+var testEvents = []*domain.Event{
+	{
+		ID:          1,
+		AggregateID: "user-1",
+		Type:        domain.EventTypeDeposited,
+		Payload:     json.RawMessage(`{"amount":100}`),
+		CreatedAt:   time.Unix(1700000000, 0).UTC(),
+	},
+	{
+		ID:          2,
+		AggregateID: "user-1",
+		Type:        domain.EventTypeWithdrawn,
+		Payload:     json.RawMessage(`{"amount":10}`),
+		CreatedAt:   time.Unix(1700000001, 0).UTC(),
+	},
+}
+
+func TestWriter(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	buf := new(bytes.Buffer)
+	p := publisher.NewWriter(buf)
+	for _, event := range testEvents {
+		assert.NoError(t, p.Publish(context.Background(), event))
+	}
+
+	dec := json.NewDecoder(buf)
+	for _, want := range testEvents {
+		got := new(domain.Event)
+		assert.NoError(t, dec.Decode(got))
+		assert.Equal(t, want, got)
+	}
+	assert.False(t, dec.More())
+}
+
+func TestMemory(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	p := publisher.NewMemory()
+	received := []*domain.Event{}
+	p.Subscribe(func(event *domain.Event) {
+		received = append(received, event)
+	})
+
+	assert.NoError(t, p.Publish(context.Background(), testEvents[0]))
+
+	mockError := errors.New("error")
+	p.SetErr(mockError)
+	assert.ErrorIs(t, p.Publish(context.Background(), testEvents[1]), mockError)
+
+	p.SetErr(nil)
+	assert.NoError(t, p.Publish(context.Background(), testEvents[1]))
+
+	assert.Equal(t, testEvents, p.Events())
+	assert.Equal(t, testEvents, received)
+}
+
+func TestNATS(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	ns, err := server.NewServer(&server.Options{Host: "127.0.0.1", Port: server.RANDOM_PORT, NoLog: true, NoSigs: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go ns.Start()
+	defer ns.WaitForShutdown()
+	defer ns.Shutdown()
+	if !ns.ReadyForConnections(5 * time.Second) {
+		t.Fatal("nats server not ready")
+	}
+
+	sub, err := nats.Connect(ns.ClientURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Close()
+	msgs := make(chan *nats.Msg, len(testEvents))
+	subscription, err := sub.ChanSubscribe("cryptocom.wallet.>", msgs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer subscription.Unsubscribe()
+	assert.NoError(t, sub.Flush())
+
+	p, err := publisher.NewNATS(ns.ClientURL(), "cryptocom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	for _, event := range testEvents {
+		assert.NoError(t, p.Publish(context.Background(), event))
+	}
+
+	for _, want := range testEvents {
+		select {
+		case msg := <-msgs:
+			assert.Equal(t, "cryptocom."+want.Type, msg.Subject)
+			assert.Equal(t, want.AggregateID, msg.Header.Get(publisher.AggregateIDHeader))
+			got := new(domain.Event)
+			assert.NoError(t, json.Unmarshal(msg.Data, got))
+			assert.Equal(t, want, got)
+			assert.Equal(t, strconv.Itoa(want.ID), msg.Header.Get(publisher.MsgIDHeader))
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for event")
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Error(t, p.Publish(ctx, testEvents[0]))
+}
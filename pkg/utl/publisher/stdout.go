@@ -0,0 +1,37 @@
+// Package publisher contains domain.Publisher implementations
+package publisher
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/sappy5678/cryptocom/pkg/domain"
+)
+
+// NewStdout creates new publisher writing events to stdout
+func NewStdout() *Writer {
+
+	return NewWriter(os.Stdout)
+}
+
+// NewWriter creates new publisher writing events as JSON lines to w
+func NewWriter(w io.Writer) *Writer {
+
+	return &Writer{enc: json.NewEncoder(w)}
+}
+
+// Writer publishes events as JSON lines
+type Writer struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+func (p *Writer) Publish(ctx context.Context, event *domain.Event) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.enc.Encode(event)
+}
@@ -0,0 +1,54 @@
+package redis
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/sappy5678/cryptocom/pkg/utl/health"
+)
+
+// defaultTimeout is the Timeout when it is not set
+const defaultTimeout = 100 * time.Millisecond
+
+// Config holds data necessary for a Redis client
+type Config struct {
+	Addr     string
+	Password string
+	DB       int
+	// Timeout bounds dialing and every command, a cache must answer faster than the database it saves
+	Timeout time.Duration
+}
+
+// New creates new Redis client, it connects on the first command so a Redis down on start does not stop the service
+// failed commands are not retried, callers fall back to the database instead
+func New(cfg *Config) *redis.Client {
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+
+	return redis.NewClient(&redis.Options{
+		Addr:         cfg.Addr,
+		Password:     cfg.Password,
+		DB:           cfg.DB,
+		DialTimeout:  timeout,
+		ReadTimeout:  timeout,
+		WriteTimeout: timeout,
+		MaxRetries:   -1,
+	})
+}
+
+// PingCheck reports whether Redis answers, it never fails since the cache falls back to the database
+func PingCheck(client redis.UniversalClient) health.Check {
+
+	return func(ctx context.Context) (map[string]interface{}, error) {
+		details := map[string]interface{}{"reachable": true}
+		if err := client.Ping(ctx).Err(); err != nil {
+			details = map[string]interface{}{"reachable": false, "error": err.Error()}
+		}
+
+		return details, nil
+	}
+}
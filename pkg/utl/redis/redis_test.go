@@ -0,0 +1,32 @@
+package redis_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
+
+	"github.com/sappy5678/cryptocom/pkg/utl/redis"
+)
+
+func TestPingCheck(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	mr, err := miniredis.Run()
+	assert.NoError(t, err)
+	defer mr.Close()
+	client := redis.New(&redis.Config{Addr: mr.Addr()})
+	defer client.Close()
+
+	details, err := redis.PingCheck(client)(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"reachable": true}, details)
+
+	mr.Close()
+	details, err = redis.PingCheck(client)(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, false, details["reachable"])
+	assert.NotEmpty(t, details["error"])
+}
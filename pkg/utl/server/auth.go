@@ -0,0 +1,212 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/labstack/echo"
+	"github.com/labstack/echo/middleware"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// jwtContextKey stores the parsed token in echo context
+const jwtContextKey = "user"
+
+// JWT authenticates requests with a HS256 bearer token, or requests without token with the identity of their verified
+// client certificate, see ClientIdentity, the token subject or the identity must be the userID path parameter
+// so a user only reaches its own wallet, routes listed in public skip the authentication
+func JWT(secret string, public ...string) echo.MiddlewareFunc {
+	skipper := func(c echo.Context) bool {
+		for _, path := range public {
+			if c.Path() == path {
+
+				return true
+			}
+		}
+
+		return false
+	}
+	authenticate := middleware.JWTWithConfig(middleware.JWTConfig{
+		Skipper:       skipper,
+		SigningKey:    []byte(secret),
+		SigningMethod: middleware.AlgorithmHS256,
+		ContextKey:    jwtContextKey,
+	})
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		withToken := authenticate(func(c echo.Context) error {
+			if skipper(c) {
+
+				return next(c)
+			}
+			token, ok := c.Get(jwtContextKey).(*jwt.Token)
+			if !ok {
+
+				return echo.ErrUnauthorized
+			}
+			claims, ok := token.Claims.(jwt.MapClaims)
+			if !ok {
+
+				return echo.ErrUnauthorized
+			}
+			subject, _ := claims["sub"].(string)
+
+			return authorizeUser(c, subject, next)
+		})
+
+		return func(c echo.Context) error {
+			// a token wins over the client certificate, an invalid one is refused
+			if c.Request().Header.Get(echo.HeaderAuthorization) == "" && !skipper(c) {
+				if identity, ok := ClientIdentity(c); ok {
+
+					return authorizeUser(c, identity, next)
+				}
+			}
+
+			return withToken(c)
+		}
+	}
+}
+
+// authorizeUser fails when the userID path parameter is not principal
+func authorizeUser(c echo.Context, principal string, next echo.HandlerFunc) error {
+	if userID := c.Param("userID"); userID != "" && principal != userID {
+
+		return echo.NewHTTPError(http.StatusForbidden, "principal does not match userID")
+	}
+
+	return next(c)
+}
+
+// metadataAuthorization is the Authorization header in gRPC metadata, whose keys are lower case
+const metadataAuthorization = "authorization"
+
+// userRequest is a gRPC request of one user, like walletpb.GetRequest
+type userRequest interface {
+	GetUserId() string
+}
+
+// JWTUnary is JWT of gRPC, the bearer token is read from the authorization metadata, calls without one are authenticated
+// with GRPCClientIdentity, the token subject or the identity must be the user_id of the request,
+// methods listed in public skip the authentication
+func JWTUnary(secret string, public ...string) grpc.UnaryServerInterceptor {
+	auth := newGRPCAuth(secret, public)
+
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if auth.public[info.FullMethod] {
+
+			return handler(ctx, req)
+		}
+		subject, err := auth.subject(ctx)
+		if err != nil {
+
+			return nil, err
+		}
+		if err := authorize(subject, req); err != nil {
+
+			return nil, err
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// JWTStream is JWTUnary of streams, the subject must be the user_id of every message received
+func JWTStream(secret string, public ...string) grpc.StreamServerInterceptor {
+	auth := newGRPCAuth(secret, public)
+
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if auth.public[info.FullMethod] {
+
+			return handler(srv, ss)
+		}
+		subject, err := auth.subject(ss.Context())
+		if err != nil {
+
+			return err
+		}
+
+		return handler(srv, &authorizedStream{ServerStream: ss, subject: subject})
+	}
+}
+
+type grpcAuth struct {
+	secret []byte
+	public map[string]bool
+}
+
+func newGRPCAuth(secret string, public []string) *grpcAuth {
+	auth := &grpcAuth{secret: []byte(secret), public: map[string]bool{}}
+	for _, method := range public {
+		auth.public[method] = true
+	}
+
+	return auth
+}
+
+// subject returns the subject of the HS256 bearer token of the call, or else the identity of its client certificate
+func (a *grpcAuth) subject(ctx context.Context) (string, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get(metadataAuthorization)
+	if len(values) == 0 {
+		if identity, ok := GRPCClientIdentity(ctx); ok {
+
+			return identity, nil
+		}
+
+		return "", status.Error(codes.Unauthenticated, "missing bearer token")
+	}
+	raw, ok := strings.CutPrefix(values[0], middleware.DefaultJWTConfig.AuthScheme+" ")
+	if !ok {
+
+		return "", status.Error(codes.Unauthenticated, "missing bearer token")
+	}
+
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(raw, claims, func(token *jwt.Token) (interface{}, error) {
+		if token.Method.Alg() != middleware.AlgorithmHS256 {
+
+			return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+		}
+
+		return a.secret, nil
+	})
+	if err != nil {
+
+		return "", status.Error(codes.Unauthenticated, "invalid or expired jwt")
+	}
+	subject, _ := claims["sub"].(string)
+
+	return subject, nil
+}
+
+// authorize fails when req belongs to another user than subject
+func authorize(subject string, req interface{}) error {
+	if r, ok := req.(userRequest); ok && r.GetUserId() != subject {
+
+		return status.Error(codes.PermissionDenied, "principal does not match user_id")
+	}
+
+	return nil
+}
+
+// authorizedStream checks the messages received by a stream handler
+type authorizedStream struct {
+	grpc.ServerStream
+	subject string
+}
+
+func (s *authorizedStream) RecvMsg(m interface{}) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+
+		return err
+	}
+
+	return authorize(s.subject, m)
+}
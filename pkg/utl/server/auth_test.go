@@ -0,0 +1,268 @@
+package server_test
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/sappy5678/cryptocom/pkg/utl/server"
+)
+
+const testJWTSecret = "0123456789abcdef0123456789abcdef"
+
+func signToken(t *testing.T, method jwt.SigningMethod, key interface{}, subject string) string {
+	token, err := jwt.NewWithClaims(method, jwt.MapClaims{"sub": subject}).SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return token
+}
+
+// verifiedState is a connection whose client certificate with the common name identity was verified
+func verifiedState(identity string) *tls.ConnectionState {
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: identity}}
+
+	return &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+}
+
+func TestJWT(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	tests := []struct {
+		name       string
+		path       string
+		token      string
+		identity   string
+		wantStatus int
+	}{
+		{
+			name:       "own wallet",
+			path:       "/v1/user/1/wallet",
+			token:      signToken(t, jwt.SigningMethodHS256, []byte(testJWTSecret), "1"),
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "other wallet",
+			path:       "/v1/user/2/wallet",
+			token:      signToken(t, jwt.SigningMethodHS256, []byte(testJWTSecret), "1"),
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "missing token",
+			path:       "/v1/user/1/wallet",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "wrong secret",
+			path:       "/v1/user/1/wallet",
+			token:      signToken(t, jwt.SigningMethodHS256, []byte("another secret"), "1"),
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "wrong algorithm",
+			path:       "/v1/user/1/wallet",
+			token:      signToken(t, jwt.SigningMethodHS512, []byte(testJWTSecret), "1"),
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "public path",
+			path:       "/v1/health",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "client certificate of the wallet",
+			path:       "/v1/user/1/wallet",
+			identity:   "1",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "client certificate of another wallet",
+			path:       "/v1/user/2/wallet",
+			identity:   "1",
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "token wins over client certificate",
+			path:       "/v1/user/1/wallet",
+			token:      signToken(t, jwt.SigningMethodHS256, []byte("another secret"), "1"),
+			identity:   "1",
+			wantStatus: http.StatusUnauthorized,
+		},
+	}
+
+	e := server.New()
+	v1 := e.Group("/v1")
+	v1.Use(server.JWT(testJWTSecret, "/v1/health"))
+	ok := func(c echo.Context) error {
+
+		return c.NoContent(http.StatusOK)
+	}
+	v1.GET("/user/:userID/wallet", ok)
+	v1.GET("/health", ok)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.token != "" {
+				req.Header.Set(echo.HeaderAuthorization, "Bearer "+tt.token)
+			}
+			if tt.identity != "" {
+				req.TLS = verifiedState(tt.identity)
+			}
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+			assert.Equal(t, tt.wantStatus, rec.Code)
+		})
+	}
+}
+
+// userReq is a request of one user like the wallet requests
+type userReq struct {
+	userID string
+}
+
+func (r *userReq) GetUserId() string {
+
+	return r.userID
+}
+
+// recvStream receives one userReq
+type recvStream struct {
+	grpc.ServerStream
+	ctx    context.Context
+	userID string
+}
+
+func (s *recvStream) Context() context.Context {
+
+	return s.ctx
+}
+
+func (s *recvStream) RecvMsg(m interface{}) error {
+	m.(*userReq).userID = s.userID
+
+	return nil
+}
+
+func TestJWTGRPC(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	const public = "/cryptocom.wallet.v1.WalletService/CreateTransactionID"
+	tests := []struct {
+		name          string
+		method        string
+		authorization string
+		identity      string
+		userID        string
+		wantCode      codes.Code
+	}{
+		{
+			name:          "own wallet",
+			authorization: "Bearer " + signToken(t, jwt.SigningMethodHS256, []byte(testJWTSecret), "1"),
+			userID:        "1",
+			wantCode:      codes.OK,
+		},
+		{
+			name:          "other wallet",
+			authorization: "Bearer " + signToken(t, jwt.SigningMethodHS256, []byte(testJWTSecret), "1"),
+			userID:        "2",
+			wantCode:      codes.PermissionDenied,
+		},
+		{
+			name:     "missing token",
+			userID:   "1",
+			wantCode: codes.Unauthenticated,
+		},
+		{
+			name:          "not bearer",
+			authorization: signToken(t, jwt.SigningMethodHS256, []byte(testJWTSecret), "1"),
+			userID:        "1",
+			wantCode:      codes.Unauthenticated,
+		},
+		{
+			name:          "wrong secret",
+			authorization: "Bearer " + signToken(t, jwt.SigningMethodHS256, []byte("another secret"), "1"),
+			userID:        "1",
+			wantCode:      codes.Unauthenticated,
+		},
+		{
+			name:          "wrong algorithm",
+			authorization: "Bearer " + signToken(t, jwt.SigningMethodHS512, []byte(testJWTSecret), "1"),
+			userID:        "1",
+			wantCode:      codes.Unauthenticated,
+		},
+		{
+			name:     "public method",
+			method:   public,
+			wantCode: codes.OK,
+		},
+		{
+			name:     "client certificate of the wallet",
+			identity: "1",
+			userID:   "1",
+			wantCode: codes.OK,
+		},
+		{
+			name:     "client certificate of another wallet",
+			identity: "1",
+			userID:   "2",
+			wantCode: codes.PermissionDenied,
+		},
+		{
+			name:          "token wins over client certificate",
+			authorization: "Bearer " + signToken(t, jwt.SigningMethodHS256, []byte("another secret"), "1"),
+			identity:      "1",
+			userID:        "1",
+			wantCode:      codes.Unauthenticated,
+		},
+	}
+
+	unary := server.JWTUnary(testJWTSecret, public)
+	stream := server.JWTStream(testJWTSecret, public)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			method := tt.method
+			if method == "" {
+				method = "/cryptocom.wallet.v1.WalletService/Get"
+			}
+			ctx := context.Background()
+			if tt.authorization != "" {
+				ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("authorization", tt.authorization))
+			}
+			if tt.identity != "" {
+				ctx = peer.NewContext(ctx, &peer.Peer{AuthInfo: credentials.TLSInfo{State: *verifiedState(tt.identity)}})
+			}
+
+			_, err := unary(ctx, &userReq{userID: tt.userID}, &grpc.UnaryServerInfo{FullMethod: method},
+				func(ctx context.Context, req interface{}) (interface{}, error) {
+
+					return nil, nil
+				})
+			assert.Equal(t, tt.wantCode, status.Code(err))
+
+			// a stream checks the messages it receives
+			err = stream(nil, &recvStream{ctx: ctx, userID: tt.userID}, &grpc.StreamServerInfo{FullMethod: method},
+				func(srv interface{}, ss grpc.ServerStream) error {
+
+					return ss.RecvMsg(&userReq{})
+				})
+			assert.Equal(t, tt.wantCode, status.Code(err))
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package server
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/labstack/echo"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// HeaderConsistencyToken carries the consistency token, writes return it and reads send it back to see them
+const HeaderConsistencyToken = "X-Consistency-Token"
+
+// metadataConsistencyToken is HeaderConsistencyToken in gRPC metadata, whose keys are lower case
+const metadataConsistencyToken = "x-consistency-token"
+
+// ConsistencyTokens issues and accepts consistency tokens, like postgres.Replicas
+type ConsistencyTokens interface {
+	// Token returns the token of the writes committed so far
+	Token(ctx context.Context) (string, error)
+	// WithToken returns ctx whose reads see the writes of the token
+	WithToken(ctx context.Context, token string) context.Context
+}
+
+// ReadYourWrites returns the consistency token in the response of every request but GET and HEAD,
+// and reads the token of the request into its context, so reads routed to replicas see the writes of the client
+// the token is left out when it cannot be read, the client then reads without it
+func ReadYourWrites(tokens ConsistencyTokens) echo.MiddlewareFunc {
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+
+		return func(c echo.Context) error {
+			req := c.Request()
+			if token := req.Header.Get(HeaderConsistencyToken); token != "" {
+				c.SetRequest(req.WithContext(tokens.WithToken(req.Context(), token)))
+			}
+			if req.Method != http.MethodGet && req.Method != http.MethodHead {
+				// the handler wrote the response body after its write committed
+				c.Response().Before(func() {
+					if token, err := tokens.Token(c.Request().Context()); err == nil {
+						c.Response().Header().Set(HeaderConsistencyToken, token)
+					}
+				})
+			}
+
+			return next(c)
+		}
+	}
+}
+
+// ReadYourWritesUnary is ReadYourWrites of gRPC, the token is returned in the header of the write methods,
+// like walletpb.WalletService_Deposit_FullMethodName, and read from the x-consistency-token metadata of every call
+func ReadYourWritesUnary(tokens ConsistencyTokens, writes ...string) grpc.UnaryServerInterceptor {
+	isWrite := map[string]bool{}
+	for _, method := range writes {
+		isWrite[method] = true
+	}
+
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if md, ok := metadata.FromIncomingContext(ctx); ok {
+			if values := md.Get(metadataConsistencyToken); len(values) > 0 && values[0] != "" {
+				ctx = tokens.WithToken(ctx, values[0])
+			}
+		}
+
+		resp, err := handler(ctx, req)
+		if err == nil && isWrite[info.FullMethod] {
+			if token, tokenErr := tokens.Token(ctx); tokenErr == nil {
+				_ = grpc.SetHeader(ctx, metadata.Pairs(metadataConsistencyToken, token))
+			}
+		}
+
+		return resp, err
+	}
+}
@@ -0,0 +1,161 @@
+package server_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/sappy5678/cryptocom/pkg/utl/server"
+)
+
+type tokenKey struct{}
+
+// fakeTokens issues token and stores accepted tokens in the context
+type fakeTokens struct {
+	token string
+	err   error
+}
+
+func (f *fakeTokens) Token(ctx context.Context) (string, error) {
+
+	return f.token, f.err
+}
+
+func (f *fakeTokens) WithToken(ctx context.Context, token string) context.Context {
+
+	return context.WithValue(ctx, tokenKey{}, token)
+}
+
+func TestReadYourWrites(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	tests := []struct {
+		name      string
+		method    string
+		token     string
+		tokens    *fakeTokens
+		wantToken string
+		wantRead  string
+	}{
+		{
+			name:      "write returns token",
+			method:    http.MethodPut,
+			tokens:    &fakeTokens{token: "0/16B3748"},
+			wantToken: "0/16B3748",
+		},
+		{
+			name:   "write without token on error",
+			method: http.MethodPost,
+			tokens: &fakeTokens{err: errors.New("primary down")},
+		},
+		{
+			name:   "read returns no token",
+			method: http.MethodGet,
+			tokens: &fakeTokens{token: "0/16B3748"},
+		},
+		{
+			name:     "read with token",
+			method:   http.MethodGet,
+			token:    "0/16B3700",
+			tokens:   &fakeTokens{token: "0/16B3748"},
+			wantRead: "0/16B3700",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotRead string
+			e := server.New()
+			e.Use(server.ReadYourWrites(tt.tokens))
+			e.Any("/wallet", func(c echo.Context) error {
+				gotRead, _ = c.Request().Context().Value(tokenKey{}).(string)
+
+				return c.JSON(http.StatusOK, map[string]string{})
+			})
+
+			req := httptest.NewRequest(tt.method, "/wallet", nil)
+			if tt.token != "" {
+				req.Header.Set(server.HeaderConsistencyToken, tt.token)
+			}
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			assert.Equal(t, http.StatusOK, rec.Code)
+			assert.Equal(t, tt.wantToken, rec.Header().Get(server.HeaderConsistencyToken))
+			assert.Equal(t, tt.wantRead, gotRead)
+		})
+	}
+}
+
+// headerStream records the header set by a unary handler
+type headerStream struct {
+	grpc.ServerTransportStream
+	header metadata.MD
+}
+
+func (s *headerStream) SetHeader(md metadata.MD) error {
+	s.header = metadata.Join(s.header, md)
+
+	return nil
+}
+
+func TestReadYourWritesUnary(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	const write = "/cryptocom.wallet.v1.WalletService/Deposit"
+	tests := []struct {
+		name       string
+		method     string
+		token      string
+		handlerErr error
+		wantToken  []string
+		wantRead   string
+	}{
+		{
+			name:      "write returns token",
+			method:    write,
+			wantToken: []string{"0/16B3748"},
+		},
+		{
+			name:       "failed write returns no token",
+			method:     write,
+			handlerErr: errors.New("fail"),
+		},
+		{
+			name:     "read with token",
+			method:   "/cryptocom.wallet.v1.WalletService/Get",
+			token:    "0/16B3700",
+			wantRead: "0/16B3700",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			interceptor := server.ReadYourWritesUnary(&fakeTokens{token: "0/16B3748"}, write)
+
+			stream := &headerStream{}
+			ctx := grpc.NewContextWithServerTransportStream(context.Background(), stream)
+			if tt.token != "" {
+				ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("x-consistency-token", tt.token))
+			}
+			var gotRead string
+			_, err := interceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: tt.method}, func(ctx context.Context, req interface{}) (interface{}, error) {
+				gotRead, _ = ctx.Value(tokenKey{}).(string)
+
+				return nil, tt.handlerErr
+			})
+
+			assert.ErrorIs(t, err, tt.handlerErr)
+			assert.Equal(t, tt.wantToken, stream.header.Get("x-consistency-token"))
+			assert.Equal(t, tt.wantRead, gotRead)
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// NewGRPC instantiates new gRPC server with panic recovery
+func NewGRPC(opts ...grpc.ServerOption) *grpc.Server {
+	opts = append(opts,
+		grpc.ChainUnaryInterceptor(recoverUnary),
+		grpc.ChainStreamInterceptor(recoverStream),
+	)
+
+	return grpc.NewServer(opts...)
+}
+
+// StartGRPC starts the gRPC server in background, stop it with StopGRPC
+func StartGRPC(s *grpc.Server, addr string) error {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+
+		return err
+	}
+
+	go func() {
+		_ = s.Serve(lis)
+	}()
+
+	return nil
+}
+
+// StopGRPC stops s gracefully, the calls still running after timeout, like long streams, are canceled
+func StopGRPC(s *grpc.Server, timeout time.Duration) {
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		s.GracefulStop()
+	}()
+
+	select {
+	case <-stopped:
+	case <-time.After(timeout):
+		s.Stop()
+		<-stopped
+	}
+}
+
+func recoverUnary(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = status.Error(codes.Internal, fmt.Sprint(r))
+		}
+	}()
+
+	return handler(ctx, req)
+}
+
+func recoverStream(srv interface{}, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = status.Error(codes.Internal, fmt.Sprint(r))
+		}
+	}()
+
+	return handler(srv, ss)
+}
@@ -0,0 +1,79 @@
+package server
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Metrics records request count, latency and in-flight requests of the echo server,
+// requests are labeled by route template so path parameters do not blow up the cardinality
+func Metrics(reg prometheus.Registerer) echo.MiddlewareFunc {
+	requests := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "http",
+		Name:      "requests_total",
+		Help:      "Number of HTTP requests by method, route and status code.",
+	}, []string{"method", "path", "code"})
+	latency := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "http",
+		Name:      "request_duration_seconds",
+		Help:      "Latency of HTTP requests by method and route.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "path"})
+	inFlight := prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "http",
+		Name:      "requests_in_flight",
+		Help:      "Number of HTTP requests being served.",
+	})
+	reg.MustRegister(requests, latency, inFlight)
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+
+		return func(c echo.Context) (err error) {
+			inFlight.Inc()
+			defer inFlight.Dec()
+			begin := time.Now()
+
+			// let the error handler write the response so the status code is known
+			if err = next(c); err != nil {
+				c.Error(err)
+			}
+
+			method := c.Request().Method
+			path := c.Path()
+			requests.WithLabelValues(method, path, strconv.Itoa(c.Response().Status)).Inc()
+			latency.WithLabelValues(method, path).Observe(time.Since(begin).Seconds())
+
+			return
+		}
+	}
+}
+
+// MetricsHandler serves the metrics of g in prometheus exposition format
+func MetricsHandler(g prometheus.Gatherer) http.Handler {
+
+	return promhttp.HandlerFor(g, promhttp.HandlerOpts{})
+}
+
+// StartAdmin serves /metrics on addr in background, stop it with Shutdown
+func StartAdmin(addr string, g prometheus.Gatherer) (*http.Server, error) {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+
+		return nil, err
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", MetricsHandler(g))
+	s := &http.Server{Addr: lis.Addr().String(), Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		_ = s.Serve(lis)
+	}()
+
+	return s, nil
+}
@@ -0,0 +1,87 @@
+package server_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
+
+	"github.com/sappy5678/cryptocom/pkg/utl/server"
+)
+
+func TestMetrics(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	reg := prometheus.NewRegistry()
+	e := server.New()
+	e.Use(server.Metrics(reg))
+	e.GET("/user/:userID", func(c echo.Context) error {
+
+		return c.NoContent(http.StatusOK)
+	})
+	e.GET("/fail", func(c echo.Context) error {
+
+		return echo.NewHTTPError(http.StatusNotFound)
+	})
+	ts := httptest.NewServer(e)
+	defer ts.Close()
+
+	for _, path := range []string{"/user/1", "/user/2", "/fail"} {
+		res, err := http.Get(ts.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+	}
+
+	want := `
+# HELP http_requests_total Number of HTTP requests by method, route and status code.
+# TYPE http_requests_total counter
+http_requests_total{code="200",method="GET",path="/user/:userID"} 2
+http_requests_total{code="404",method="GET",path="/fail"} 1
+# HELP http_requests_in_flight Number of HTTP requests being served.
+# TYPE http_requests_in_flight gauge
+http_requests_in_flight 0
+`
+	assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(want), "http_requests_total", "http_requests_in_flight"))
+
+	count, err := testutil.GatherAndCount(reg, "http_request_duration_seconds")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+}
+
+func TestStartAdmin(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	reg := prometheus.NewRegistry()
+	counter := prometheus.NewCounter(prometheus.CounterOpts{Name: "test_total", Help: "Test counter."})
+	reg.MustRegister(counter)
+	counter.Inc()
+
+	s, err := server.StartAdmin("127.0.0.1:0", reg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Shutdown(context.Background())
+
+	res, err := http.Get("http://" + s.Addr + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Contains(t, string(body), "test_total 1")
+
+	_, err = server.StartAdmin(s.Addr, reg)
+	assert.Error(t, err)
+}
@@ -0,0 +1,98 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo"
+
+	"github.com/sappy5678/cryptocom/pkg/domain"
+	"github.com/sappy5678/cryptocom/pkg/utl/zlog"
+)
+
+// maxRequestIDLength bounds the accepted X-Request-ID, longer ones are replaced
+const maxRequestIDLength = 128
+
+// RequestID accepts the X-Request-ID of the request or generates one, echoes it in the response
+// and stores it with the userID path parameter in the request context for logging
+func RequestID() echo.MiddlewareFunc {
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+
+		return func(c echo.Context) error {
+			req := c.Request()
+			requestID := req.Header.Get(echo.HeaderXRequestID)
+			if !validRequestID(requestID) {
+				requestID = uuid.New().String()
+				// the access log reads the request header first
+				req.Header.Set(echo.HeaderXRequestID, requestID)
+			}
+			c.Response().Header().Set(echo.HeaderXRequestID, requestID)
+
+			ctx := zlog.WithRequestID(req.Context(), requestID)
+			if userID := c.Param("userID"); userID != "" {
+				ctx = zlog.WithUserID(ctx, userID)
+			}
+			c.SetRequest(req.WithContext(ctx))
+
+			return next(c)
+		}
+	}
+}
+
+// validRequestID accepts printable ASCII without spaces, so the ID is safe to log and echo
+func validRequestID(requestID string) bool {
+	if requestID == "" || len(requestID) > maxRequestIDLength {
+
+		return false
+	}
+	for i := 0; i < len(requestID); i++ {
+		if requestID[i] <= ' ' || requestID[i] > '~' {
+
+			return false
+		}
+	}
+
+	return true
+}
+
+// ErrorRespond returns the error body of err with the request ID of the response
+func ErrorRespond(c echo.Context, err error) domain.ErrorRespond {
+
+	return domain.ErrorRespond{
+		Error:     err.Error(),
+		RequestID: c.Response().Header().Get(echo.HeaderXRequestID),
+	}
+}
+
+// errorHandler is echo default error handler with the request ID in the body
+func errorHandler(e *echo.Echo) echo.HTTPErrorHandler {
+
+	return func(err error, c echo.Context) {
+		requestID := c.Response().Header().Get(echo.HeaderXRequestID)
+		if requestID == "" || c.Response().Committed {
+			e.DefaultHTTPErrorHandler(err, c)
+
+			return
+		}
+
+		code := http.StatusInternalServerError
+		msg := http.StatusText(code)
+		if he, ok := err.(*echo.HTTPError); ok {
+			code = he.Code
+			msg = fmt.Sprint(he.Message)
+		} else if e.Debug {
+			msg = err.Error()
+		}
+
+		if c.Request().Method == http.MethodHead {
+			err = c.NoContent(code)
+		} else {
+			err = c.JSON(code, echo.Map{"message": msg, "requestID": requestID})
+		}
+		if err != nil {
+			e.Logger.Error(err)
+		}
+	}
+}
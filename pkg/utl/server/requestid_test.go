@@ -0,0 +1,141 @@
+package server_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
+
+	"github.com/sappy5678/cryptocom/pkg/domain"
+	"github.com/sappy5678/cryptocom/pkg/utl/server"
+	"github.com/sappy5678/cryptocom/pkg/utl/zlog"
+)
+
+func TestRequestID(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	tests := []struct {
+		name          string
+		path          string
+		requestID     string
+		wantRequestID string
+		wantUserID    string
+		wantStatus    int
+		wantBody      string
+	}{
+		{
+			name:          "accept request ID",
+			path:          "/user/1",
+			requestID:     "test-request-id",
+			wantRequestID: "test-request-id",
+			wantUserID:    "1",
+			wantStatus:    http.StatusOK,
+		},
+		{
+			name:       "generate request ID",
+			path:       "/user/1",
+			wantUserID: "1",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "replace invalid request ID",
+			path:       "/user/1",
+			requestID:  "bad request id",
+			wantUserID: "1",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "replace too long request ID",
+			path:       "/user/1",
+			requestID:  strings.Repeat("a", 129),
+			wantUserID: "1",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:          "error respond",
+			path:          "/user/1/fail",
+			requestID:     "test-request-id",
+			wantRequestID: "test-request-id",
+			wantUserID:    "1",
+			wantStatus:    http.StatusBadRequest,
+			wantBody:      `{"error":"fail","requestID":"test-request-id"}`,
+		},
+		{
+			name:          "echo error",
+			path:          "/not-found",
+			requestID:     "test-request-id",
+			wantRequestID: "test-request-id",
+			wantStatus:    http.StatusNotFound,
+			wantBody:      `{"message":"Not Found","requestID":"test-request-id"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotRequestID, gotUserID string
+			e := server.New()
+			e.Use(server.RequestID())
+			e.GET("/user/:userID", func(c echo.Context) error {
+				gotRequestID = zlog.RequestID(c.Request().Context())
+				gotUserID = zlog.UserID(c.Request().Context())
+
+				return c.NoContent(http.StatusOK)
+			})
+			e.GET("/user/:userID/fail", func(c echo.Context) error {
+				gotRequestID = zlog.RequestID(c.Request().Context())
+				gotUserID = zlog.UserID(c.Request().Context())
+
+				return c.JSON(http.StatusBadRequest, server.ErrorRespond(c, errors.New("fail")))
+			})
+			ts := httptest.NewServer(e)
+			defer ts.Close()
+
+			req, err := http.NewRequest(http.MethodGet, ts.URL+tt.path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.requestID != "" {
+				req.Header.Set(echo.HeaderXRequestID, tt.requestID)
+			}
+			res, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+			assert.Equal(t, tt.wantStatus, res.StatusCode)
+
+			requestID := res.Header.Get(echo.HeaderXRequestID)
+			if tt.wantRequestID != "" {
+				assert.Equal(t, tt.wantRequestID, requestID)
+			} else {
+				assert.Len(t, requestID, 36)
+			}
+			if tt.wantStatus != http.StatusNotFound {
+				assert.Equal(t, requestID, gotRequestID)
+			}
+			assert.Equal(t, tt.wantUserID, gotUserID)
+
+			if tt.wantBody != "" {
+				body := map[string]interface{}{}
+				assert.NoError(t, json.NewDecoder(res.Body).Decode(&body))
+				want := map[string]interface{}{}
+				assert.NoError(t, json.Unmarshal([]byte(tt.wantBody), &want))
+				assert.Equal(t, want, body)
+			}
+		})
+	}
+}
+
+func TestErrorRespondWithoutRequestID(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	e := server.New()
+	c := e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder())
+	assert.Equal(t, domain.ErrorRespond{Error: "fail"}, server.ErrorRespond(c, errors.New("fail")))
+}
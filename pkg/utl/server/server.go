@@ -2,12 +2,16 @@ package server
 
 import (
 	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
 	"net/http"
-	"os"
-	"os/signal"
 	"time"
 
 	"github.com/labstack/echo/middleware"
+	"github.com/labstack/gommon/log"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 
 	"github.com/labstack/echo"
 )
@@ -28,17 +32,15 @@ func CORS() echo.MiddlewareFunc {
 // New instantates new Echo server
 func New() *echo.Echo {
 	e := echo.New()
+	e.HTTPErrorHandler = errorHandler(e)
 	e.Use(middleware.Logger(), middleware.Recover(),
 		CORS())
-	e.GET("/", healthCheck)
 
 	return e
 }
 
-func healthCheck(c echo.Context) error {
-
-	return c.JSON(http.StatusOK, "OK")
-}
+// defaultShutdownTimeout is how long in-flight requests may run on shutdown when not configured
+const defaultShutdownTimeout = 10 * time.Second
 
 // Config represents server specific config
 type Config struct {
@@ -46,33 +48,101 @@ type Config struct {
 	ReadTimeoutSeconds  int
 	WriteTimeoutSeconds int
 	Debug               bool
+	// OnShutdown is called when ctx is done, before the server stops accepting connections
+	OnShutdown func()
+	// DrainSeconds keeps serving after OnShutdown, so load balancers see the failing readiness and drain traffic first
+	DrainSeconds int
+	// OnDrained is called once the drain is over, as the server stops accepting connections, to end the requests
+	// which never finish by themselves, like SSE streams, the shutdown would wait for them until its timeout
+	OnDrained func()
+	// ShutdownTimeoutSeconds is how long in-flight requests may run once the server stops accepting connections,
+	// the ones left are cut, 10 when 0
+	ShutdownTimeoutSeconds int
+	// TLS serves HTTPS when set
+	TLS *CertReloader
+	// HTTP2 serves HTTP/2 next to HTTP/1.1, negotiated with ALPN over TLS, or cleartext h2c with prior knowledge
+	// without TLS, for proxies speaking HTTP/2 to the server
+	HTTP2 bool
 }
 
-// Start starts echo server
-func Start(e *echo.Echo, cfg *Config) {
+// ShutdownTimeout returns the configured shutdown timeout or its default
+func (cfg *Config) ShutdownTimeout() time.Duration {
+	if cfg.ShutdownTimeoutSeconds > 0 {
+
+		return time.Duration(cfg.ShutdownTimeoutSeconds) * time.Second
+	}
+
+	return defaultShutdownTimeout
+}
+
+// Start serves e until ctx is done, then it drains and waits for the in-flight requests,
+// it returns the error the server failed with, like a taken port, or the shutdown timed out with
+func Start(ctx context.Context, e *echo.Echo, cfg *Config) error {
 	s := &http.Server{
 		Addr:         cfg.Port,
+		Handler:      e,
 		ReadTimeout:  time.Duration(cfg.ReadTimeoutSeconds) * time.Second,
 		WriteTimeout: time.Duration(cfg.WriteTimeoutSeconds) * time.Second,
+		ErrorLog:     e.StdLogger,
 	}
 	e.Debug = cfg.Debug
+	if cfg.Debug {
+		e.Logger.SetLevel(log.DEBUG)
+	}
 
-	// Start server
-	go func() {
-		if err := e.StartServer(s); err != nil {
-			e.Logger.Info("Shutting down the server")
+	// e.Listener is set by tests to serve on a random port
+	listener := e.Listener
+	if listener == nil {
+		var err error
+		if listener, err = net.Listen("tcp", cfg.Port); err != nil {
+
+			return err
 		}
+	}
+	switch {
+	case cfg.TLS != nil && cfg.HTTP2:
+		s.TLSConfig = cfg.TLS.Config("h2", "http/1.1")
+	case cfg.TLS != nil:
+		s.TLSConfig = cfg.TLS.Config("http/1.1")
+		// an empty map disables HTTP/2
+		s.TLSNextProto = map[string]func(*http.Server, *tls.Conn, http.Handler){}
+	case cfg.HTTP2:
+		s.Handler = h2c.NewHandler(e, &http2.Server{})
+	}
+	if s.TLSConfig != nil {
+		listener = tls.NewListener(listener, s.TLSConfig)
+	}
+	if cfg.OnDrained != nil {
+		s.RegisterOnShutdown(cfg.OnDrained)
+	}
+	e.Logger.Infof("http server started on %s", listener.Addr())
+
+	served := make(chan error, 1)
+	go func() {
+		served <- s.Serve(listener)
 	}()
 
-	// Wait for interrupt signal to gracefully shutdown the server with
-	// a timeout of 10 seconds.
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, os.Interrupt)
-	<-quit
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	select {
+	case err := <-served:
+
+		return err
+	case <-ctx.Done():
+	}
+
+	e.Logger.Info("Shutting down the server")
+	if cfg.OnShutdown != nil {
+		cfg.OnShutdown()
+	}
+	time.Sleep(time.Duration(cfg.DrainSeconds) * time.Second)
+
+	// s is not e.Server, so it is shut down itself
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout())
 	defer cancel()
+	if err := s.Shutdown(shutdownCtx); err != nil {
+		s.Close()
 
-	if err := e.Shutdown(ctx); err != nil {
-		e.Logger.Fatal(err)
+		return fmt.Errorf("shutdown, %w", err)
 	}
+
+	return nil
 }
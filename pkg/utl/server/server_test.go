@@ -1,7 +1,16 @@
 package server_test
 
 import (
+	"context"
+	"io"
+	"net"
+	"net/http"
 	"testing"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
 
 	"github.com/sappy5678/cryptocom/pkg/utl/server"
 )
@@ -13,3 +22,117 @@ func TestNew(t *testing.T) {
 		t.Errorf("Server should not be nil")
 	}
 }
+
+func TestStart(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	tests := []struct {
+		name            string
+		handlerDuration time.Duration
+		closeStreams    bool
+		wantErr         bool
+		wantStatus      int
+	}{
+		{
+			name:            "in-flight request finishes",
+			handlerDuration: 200 * time.Millisecond,
+			wantStatus:      http.StatusOK,
+		},
+		{
+			name:            "stream ended once drained",
+			handlerDuration: time.Hour,
+			closeStreams:    true,
+			wantStatus:      http.StatusOK,
+		},
+		{
+			name:            "request cut after the timeout",
+			handlerDuration: 3 * time.Second,
+			wantErr:         true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			assert.NoError(t, err)
+			started, finished, streams := make(chan struct{}), make(chan struct{}), make(chan struct{})
+			e := server.New()
+			e.HideBanner, e.HidePort = true, true
+			e.Listener = listener
+			e.GET("/slow", func(c echo.Context) error {
+				close(started)
+				defer close(finished)
+				select {
+				case <-time.After(tt.handlerDuration):
+				case <-streams:
+				case <-c.Request().Context().Done():
+
+					return c.Request().Context().Err()
+				}
+
+				return c.String(http.StatusOK, "done")
+			})
+
+			ctx, cancel := context.WithCancel(context.Background())
+			shutdown := make(chan struct{})
+			cfg := &server.Config{
+				OnShutdown:             func() { close(shutdown) },
+				ShutdownTimeoutSeconds: 1,
+			}
+			if tt.closeStreams {
+				cfg.OnDrained = func() { close(streams) }
+			}
+			done := make(chan error)
+			go func() {
+				done <- server.Start(ctx, e, cfg)
+			}()
+
+			client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+			defer client.CloseIdleConnections()
+			responses := make(chan *http.Response, 1)
+			go func() {
+				resp, err := client.Get("http://" + listener.Addr().String() + "/slow")
+				if err != nil {
+					resp = nil
+				}
+				responses <- resp
+			}()
+
+			<-started
+			cancel()
+			<-shutdown
+			err = <-done
+			assert.Equal(t, tt.wantErr, err != nil)
+
+			resp := <-responses
+			<-finished
+			if tt.wantStatus == 0 {
+				assert.Nil(t, resp)
+
+				return
+			}
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			assert.Equal(t, tt.wantStatus, resp.StatusCode)
+			assert.Equal(t, "done", string(body))
+
+			// no new connection is accepted
+			_, err = client.Get("http://" + listener.Addr().String() + "/slow")
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestStartError(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer listener.Close()
+
+	// the port is taken
+	e := server.New()
+	e.HideBanner, e.HidePort = true, true
+	err = server.Start(context.Background(), e, &server.Config{Port: listener.Addr().String()})
+	assert.Error(t, err)
+}
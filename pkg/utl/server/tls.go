@@ -0,0 +1,296 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// reloadCheckInterval bounds how often a handshake checks the files for changes
+const reloadCheckInterval = time.Second
+
+// TLS holds the files of the server certificate, they are reloaded when they change, so renewed certificates
+// are served without a restart
+type TLS struct {
+	CertFile string
+	KeyFile  string
+	// ClientCAFile verifies the client certificates given against its CAs, mTLS, the handshake refuses others,
+	// RequireClientCert refuses the requests without one, clients are not asked for one when empty
+	ClientCAFile string
+	// OnReloadError is called when changed files fail to load, the previous ones are served until they load
+	OnReloadError func(error)
+}
+
+// CertReloader serves the certificate and client CAs of TLS files, loaded again on the first handshake after they change
+type CertReloader struct {
+	files *TLS
+
+	mu       sync.Mutex
+	config   *tls.Config
+	modTimes []time.Time
+	checked  time.Time
+}
+
+// NewCertReloader loads the files of cfg, it fails when they cannot be loaded
+func NewCertReloader(cfg *TLS) (*CertReloader, error) {
+	r := &CertReloader{files: cfg}
+	modTimes, err := r.stat()
+	if err != nil {
+
+		return nil, err
+	}
+	if r.config, err = r.load(); err != nil {
+
+		return nil, err
+	}
+	r.modTimes, r.checked = modTimes, time.Now()
+
+	return r, nil
+}
+
+// Config returns the server TLS config negotiating nextProtos with ALPN, like h2 and http/1.1
+func (r *CertReloader) Config(nextProtos ...string) *tls.Config {
+
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		NextProtos: nextProtos,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			config := r.current().Clone()
+			config.NextProtos = nextProtos
+
+			return config, nil
+		},
+	}
+}
+
+// current returns the loaded config, reloading it when the files changed since the last check
+func (r *CertReloader) current() *tls.Config {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if time.Since(r.checked) < reloadCheckInterval {
+
+		return r.config
+	}
+	r.checked = time.Now()
+
+	modTimes, err := r.stat()
+	if err == nil && equalTimes(modTimes, r.modTimes) {
+
+		return r.config
+	}
+	var config *tls.Config
+	if err == nil {
+		config, err = r.load()
+	}
+	if err != nil {
+		// the files may be half written, they are tried again on the next check
+		if r.files.OnReloadError != nil {
+			r.files.OnReloadError(err)
+		}
+
+		return r.config
+	}
+	r.config, r.modTimes = config, modTimes
+
+	return r.config
+}
+
+func (r *CertReloader) load() (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(r.files.CertFile, r.files.KeyFile)
+	if err != nil {
+
+		return nil, fmt.Errorf("load TLS key pair, %w", err)
+	}
+	config := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+	}
+	if r.files.ClientCAFile == "" {
+
+		return config, nil
+	}
+
+	pem, err := os.ReadFile(r.files.ClientCAFile)
+	if err != nil {
+
+		return nil, fmt.Errorf("load TLS client CA, %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+
+		return nil, fmt.Errorf("load TLS client CA, no certificate in %s", r.files.ClientCAFile)
+	}
+	config.ClientCAs = pool
+	// requests without a certificate are refused by RequireClientCert, so probes still reach the health endpoints
+	config.ClientAuth = tls.VerifyClientCertIfGiven
+
+	return config, nil
+}
+
+// stat returns the modification times of the files
+func (r *CertReloader) stat() ([]time.Time, error) {
+	modTimes := []time.Time{}
+	for _, file := range []string{r.files.CertFile, r.files.KeyFile, r.files.ClientCAFile} {
+		if file == "" {
+
+			continue
+		}
+		info, err := os.Stat(file)
+		if err != nil {
+
+			return nil, err
+		}
+		modTimes = append(modTimes, info.ModTime())
+	}
+
+	return modTimes, nil
+}
+
+func equalTimes(a, b []time.Time) bool {
+	if len(a) != len(b) {
+
+		return false
+	}
+	for i := range a {
+		if !a[i].Equal(b[i]) {
+
+			return false
+		}
+	}
+
+	return true
+}
+
+// GRPCCredentials returns the transport credentials of r for a gRPC server, which always speaks h2
+func GRPCCredentials(r *CertReloader) credentials.TransportCredentials {
+
+	return credentials.NewTLS(r.Config("h2"))
+}
+
+// RequireClientCert refuses the requests without a verified client certificate with 401,
+// the paths listed in skip, like the probes which present none, are served without one
+func RequireClientCert(skip ...string) echo.MiddlewareFunc {
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+
+		return func(c echo.Context) error {
+			for _, path := range skip {
+				if c.Request().URL.Path == path {
+
+					return next(c)
+				}
+			}
+			if state := c.Request().TLS; state == nil || !verified(*state) {
+
+				return echo.NewHTTPError(http.StatusUnauthorized, "client certificate required")
+			}
+
+			return next(c)
+		}
+	}
+}
+
+// RequireClientCertUnary is RequireClientCert of gRPC, the calls without a verified client certificate fail with
+// Unauthenticated, methods listed in skip are served without one
+func RequireClientCertUnary(skip ...string) grpc.UnaryServerInterceptor {
+
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if err := requireGRPCClientCert(ctx, info.FullMethod, skip); err != nil {
+
+			return nil, err
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// RequireClientCertStream is RequireClientCertUnary of streams
+func RequireClientCertStream(skip ...string) grpc.StreamServerInterceptor {
+
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := requireGRPCClientCert(ss.Context(), info.FullMethod, skip); err != nil {
+
+			return err
+		}
+
+		return handler(srv, ss)
+	}
+}
+
+func requireGRPCClientCert(ctx context.Context, method string, skip []string) error {
+	for _, m := range skip {
+		if m == method {
+
+			return nil
+		}
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		if info, ok := p.AuthInfo.(credentials.TLSInfo); ok && verified(info.State) {
+
+			return nil
+		}
+	}
+
+	return status.Error(codes.Unauthenticated, "client certificate required")
+}
+
+// verified tells whether the client certificate of the connection was verified
+func verified(state tls.ConnectionState) bool {
+
+	return len(state.VerifiedChains) > 0 && len(state.VerifiedChains[0]) > 0
+}
+
+// ClientIdentity returns the identity of the verified client certificate of the request, which JWT accepts
+// as the principal of requests without token, its first URI SAN, like a SPIFFE ID, or else its subject common name, it is false without mTLS
+func ClientIdentity(c echo.Context) (string, bool) {
+	state := c.Request().TLS
+	if state == nil {
+
+		return "", false
+	}
+
+	return identity(*state)
+}
+
+// GRPCClientIdentity returns the identity of the verified client certificate of a gRPC call like ClientIdentity
+func GRPCClientIdentity(ctx context.Context) (string, bool) {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+
+		return "", false
+	}
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok {
+
+		return "", false
+	}
+
+	return identity(info.State)
+}
+
+func identity(state tls.ConnectionState) (string, bool) {
+	if !verified(state) {
+
+		return "", false
+	}
+	cert := state.VerifiedChains[0][0]
+	if len(cert.URIs) > 0 {
+
+		return cert.URIs[0].String(), true
+	}
+
+	return cert.Subject.CommonName, cert.Subject.CommonName != ""
+}
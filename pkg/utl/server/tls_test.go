@@ -0,0 +1,386 @@
+package server_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
+	"golang.org/x/net/http2"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+
+	"github.com/sappy5678/cryptocom/pkg/utl/server"
+)
+
+// issue creates a certificate signed by parent, self signed when parent is nil
+func issue(t *testing.T, template *x509.Certificate, parent *tls.Certificate) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	assert.NoError(t, err)
+	template.SerialNumber = serial
+	template.NotBefore, template.NotAfter = time.Now().Add(-time.Hour), time.Now().Add(time.Hour)
+
+	signer, signerKey := template, interface{}(key)
+	if parent != nil {
+		signer, signerKey = parent.Leaf, parent.PrivateKey
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	assert.NoError(t, err)
+	leaf, err := x509.ParseCertificate(der)
+	assert.NoError(t, err)
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+func newCA(t *testing.T, name string) tls.Certificate {
+
+	return issue(t, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: name},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, nil)
+}
+
+func newServerCert(t *testing.T, ca tls.Certificate, name string) tls.Certificate {
+
+	return issue(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: name},
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, &ca)
+}
+
+func newClientCert(t *testing.T, ca tls.Certificate, name string, uri string) *tls.Certificate {
+	template := &x509.Certificate{
+		Subject:     pkix.Name{CommonName: name},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	if uri != "" {
+		u, err := url.Parse(uri)
+		assert.NoError(t, err)
+		template.URIs = []*url.URL{u}
+	}
+
+	cert := issue(t, template, &ca)
+
+	return &cert
+}
+
+// writeCert writes the PEM files of cert, dated at modTime so a reload sees the change
+func writeCert(t *testing.T, certFile string, keyFile string, cert tls.Certificate, modTime time.Time) {
+	assert.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]}), 0o600))
+	assert.NoError(t, os.Chtimes(certFile, modTime, modTime))
+	if keyFile == "" {
+
+		return
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600))
+	assert.NoError(t, os.Chtimes(keyFile, modTime, modTime))
+}
+
+// serve starts e with cfg on a random port, the returned stop shuts it down
+func serve(t *testing.T, e *echo.Echo, cfg *server.Config) (string, func()) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	e.HideBanner, e.HidePort = true, true
+	e.Listener = listener
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- server.Start(ctx, e, cfg)
+	}()
+
+	return listener.Addr().String(), func() {
+		cancel()
+		assert.NoError(t, <-done)
+	}
+}
+
+func TestStartTLS(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	dir := t.TempDir()
+	certFile, keyFile, caFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key"), filepath.Join(dir, "ca.crt")
+	serverCA, clientCA := newCA(t, "server ca"), newCA(t, "client ca")
+	writeCert(t, certFile, keyFile, newServerCert(t, serverCA, "server-1"), time.Now())
+	writeCert(t, caFile, "", clientCA, time.Now())
+	roots := x509.NewCertPool()
+	roots.AddCert(serverCA.Leaf)
+
+	tests := []struct {
+		name         string
+		clientCAFile string
+		http2        bool
+		clientCert   *tls.Certificate
+		forceCert    bool
+		path         string
+		wantErr      bool
+		wantStatus   int
+		wantProto    int
+		wantIdentity string
+	}{
+		{
+			name:      "https",
+			wantProto: 1,
+		},
+		{
+			name:      "http2",
+			http2:     true,
+			wantProto: 2,
+		},
+		{
+			name:         "mtls without client certificate",
+			clientCAFile: caFile,
+			wantStatus:   http.StatusUnauthorized,
+			wantProto:    1,
+		},
+		{
+			name:         "mtls probe without client certificate",
+			clientCAFile: caFile,
+			path:         "/livez",
+			wantProto:    1,
+		},
+		{
+			// the client sends no certificate of a CA the server does not ask for
+			name:         "mtls with a certificate of another CA",
+			clientCAFile: caFile,
+			clientCert:   newClientCert(t, serverCA, "mallory", ""),
+			wantStatus:   http.StatusUnauthorized,
+			wantProto:    1,
+		},
+		{
+			name:         "mtls forcing a certificate of another CA",
+			clientCAFile: caFile,
+			clientCert:   newClientCert(t, serverCA, "mallory", ""),
+			forceCert:    true,
+			wantErr:      true,
+		},
+		{
+			name:         "mtls common name",
+			clientCAFile: caFile,
+			http2:        true,
+			clientCert:   newClientCert(t, clientCA, "wallet-client", ""),
+			wantProto:    2,
+			wantIdentity: "wallet-client",
+		},
+		{
+			name:         "mtls URI SAN",
+			clientCAFile: caFile,
+			clientCert:   newClientCert(t, clientCA, "wallet-client", "spiffe://cryptocom/wallet-client"),
+			wantProto:    1,
+			wantIdentity: "spiffe://cryptocom/wallet-client",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reloader, err := server.NewCertReloader(&server.TLS{CertFile: certFile, KeyFile: keyFile, ClientCAFile: tt.clientCAFile})
+			assert.NoError(t, err)
+
+			e := server.New()
+			if tt.clientCAFile != "" {
+				e.Use(server.RequireClientCert("/livez"))
+			}
+			var gotIdentity string
+			e.GET("/identity", func(c echo.Context) error {
+				gotIdentity, _ = server.ClientIdentity(c)
+
+				return c.NoContent(http.StatusOK)
+			})
+			e.GET("/livez", func(c echo.Context) error {
+
+				return c.NoContent(http.StatusOK)
+			})
+			addr, stop := serve(t, e, &server.Config{TLS: reloader, HTTP2: tt.http2})
+			defer stop()
+
+			clientTLS := &tls.Config{RootCAs: roots}
+			if tt.clientCert != nil {
+				clientTLS.Certificates = []tls.Certificate{*tt.clientCert}
+			}
+			if tt.forceCert {
+				clientTLS.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+
+					return tt.clientCert, nil
+				}
+			}
+			transport := &http.Transport{TLSClientConfig: clientTLS, ForceAttemptHTTP2: true}
+			defer transport.CloseIdleConnections()
+
+			path := tt.path
+			if path == "" {
+				path = "/identity"
+			}
+			resp, err := (&http.Client{Transport: transport}).Get("https://" + addr + path)
+			assert.Equal(t, tt.wantErr, err != nil)
+			if err != nil {
+
+				return
+			}
+			resp.Body.Close()
+			wantStatus := tt.wantStatus
+			if wantStatus == 0 {
+				wantStatus = http.StatusOK
+			}
+			assert.Equal(t, wantStatus, resp.StatusCode)
+			assert.Equal(t, tt.wantProto, resp.ProtoMajor)
+			assert.Equal(t, tt.wantIdentity, gotIdentity)
+		})
+	}
+}
+
+func TestCertReload(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	ca := newCA(t, "server ca")
+	writeCert(t, certFile, keyFile, newServerCert(t, ca, "server-1"), time.Now().Add(-time.Hour))
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.Leaf)
+
+	// the reload errors are reported, the handshake calls back while the reloader is locked
+	var mu sync.Mutex
+	reloadErrs := 0
+	reloader, err := server.NewCertReloader(&server.TLS{CertFile: certFile, KeyFile: keyFile, OnReloadError: func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		reloadErrs++
+	}})
+	assert.NoError(t, err)
+	addr, stop := serve(t, server.New(), &server.Config{TLS: reloader})
+	defer stop()
+
+	served := func() string {
+		conn, err := tls.Dial("tcp", addr, &tls.Config{RootCAs: roots})
+		if !assert.NoError(t, err) {
+
+			return ""
+		}
+		defer conn.Close()
+
+		return conn.ConnectionState().PeerCertificates[0].Subject.CommonName
+	}
+	assert.Equal(t, "server-1", served())
+
+	// a renewed certificate is served after the next check without a restart
+	writeCert(t, certFile, keyFile, newServerCert(t, ca, "server-2"), time.Now())
+	assert.Eventually(t, func() bool {
+
+		return served() == "server-2"
+	}, 5*time.Second, 100*time.Millisecond)
+
+	// broken files keep the previous certificate
+	assert.NoError(t, os.WriteFile(certFile, []byte("broken"), 0o600))
+	assert.NoError(t, os.Chtimes(certFile, time.Now().Add(time.Hour), time.Now().Add(time.Hour)))
+	assert.Eventually(t, func() bool {
+		name := served()
+		mu.Lock()
+		defer mu.Unlock()
+
+		return name == "server-2" && reloadErrs > 0
+	}, 5*time.Second, 100*time.Millisecond)
+}
+
+func TestStartH2C(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	e := server.New()
+	e.GET("/", func(c echo.Context) error {
+
+		return c.NoContent(http.StatusOK)
+	})
+	addr, stop := serve(t, e, &server.Config{HTTP2: true})
+	defer stop()
+
+	// cleartext HTTP/2 with prior knowledge, like a proxy
+	transport := &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+
+			return (&net.Dialer{}).DialContext(ctx, network, addr)
+		},
+	}
+	defer transport.CloseIdleConnections()
+	resp, err := (&http.Client{Transport: transport}).Get("http://" + addr + "/")
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, 2, resp.ProtoMajor)
+}
+
+func TestGRPCTLS(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	dir := t.TempDir()
+	certFile, keyFile, caFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key"), filepath.Join(dir, "ca.crt")
+	serverCA, clientCA := newCA(t, "server ca"), newCA(t, "client ca")
+	writeCert(t, certFile, keyFile, newServerCert(t, serverCA, "server-1"), time.Now())
+	writeCert(t, caFile, "", clientCA, time.Now())
+	roots := x509.NewCertPool()
+	roots.AddCert(serverCA.Leaf)
+
+	reloader, err := server.NewCertReloader(&server.TLS{CertFile: certFile, KeyFile: keyFile, ClientCAFile: caFile})
+	assert.NoError(t, err)
+	identities := make(chan string, 1)
+	gs := server.NewGRPC(grpc.Creds(server.GRPCCredentials(reloader)), grpc.ChainUnaryInterceptor(
+		server.RequireClientCertUnary(),
+		func(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			identity, _ := server.GRPCClientIdentity(ctx)
+			identities <- identity
+
+			return handler(ctx, req)
+		}))
+	grpc_health_v1.RegisterHealthServer(gs, health.NewServer())
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	go gs.Serve(listener)
+	defer server.StopGRPC(gs, time.Second)
+
+	conn, err := grpc.NewClient(listener.Addr().String(), grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{
+		RootCAs:      roots,
+		Certificates: []tls.Certificate{*newClientCert(t, clientCA, "wallet-client", "")},
+	})))
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	_, err = grpc_health_v1.NewHealthClient(conn).Check(context.Background(), &grpc_health_v1.HealthCheckRequest{})
+	assert.NoError(t, err)
+	assert.Equal(t, "wallet-client", <-identities)
+
+	// the handshake accepts a client without certificate, its calls are refused
+	anonymous, err := grpc.NewClient(listener.Addr().String(), grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{
+		RootCAs: roots,
+	})))
+	assert.NoError(t, err)
+	defer anonymous.Close()
+
+	_, err = grpc_health_v1.NewHealthClient(anonymous).Check(context.Background(), &grpc_health_v1.HealthCheckRequest{})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
@@ -0,0 +1,111 @@
+package server_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/goleak"
+
+	"github.com/sappy5678/cryptocom/pkg/utl/server"
+	"github.com/sappy5678/cryptocom/pkg/utl/tracing"
+	"github.com/sappy5678/cryptocom/pkg/utl/tracing/tracingtest"
+)
+
+func TestTracing(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	const traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+	tests := []struct {
+		name        string
+		path        string
+		traceparent string
+		wantName    string
+		wantStatus  int
+		wantCode    codes.Code
+	}{
+		{
+			name:        "continue incoming trace",
+			path:        "/user/1",
+			traceparent: traceparent,
+			wantName:    "GET /user/:userID",
+			wantStatus:  http.StatusOK,
+			wantCode:    codes.Unset,
+		},
+		{
+			name:       "new trace",
+			path:       "/user/1",
+			wantName:   "GET /user/:userID",
+			wantStatus: http.StatusOK,
+			wantCode:   codes.Unset,
+		},
+		{
+			name:       "server error",
+			path:       "/fail",
+			wantName:   "GET /fail",
+			wantStatus: http.StatusInternalServerError,
+			wantCode:   codes.Error,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tp, exporter := tracingtest.NewInMemory()
+			defer tp.Shutdown(context.Background())
+
+			var handlerSpan trace.SpanContext
+			e := server.New()
+			e.Use(server.Tracing(tp, tracing.Propagator()))
+			e.GET("/user/:userID", func(c echo.Context) error {
+				handlerSpan = trace.SpanContextFromContext(c.Request().Context())
+
+				return c.NoContent(http.StatusOK)
+			})
+			e.GET("/fail", func(c echo.Context) error {
+
+				return echo.NewHTTPError(http.StatusInternalServerError)
+			})
+			ts := httptest.NewServer(e)
+			defer ts.Close()
+
+			req, err := http.NewRequest(http.MethodGet, ts.URL+tt.path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.traceparent != "" {
+				req.Header.Set("traceparent", tt.traceparent)
+			}
+			res, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			res.Body.Close()
+			assert.Equal(t, tt.wantStatus, res.StatusCode)
+
+			spans := exporter.GetSpans()
+			assert.Len(t, spans, 1)
+			span := spans[0]
+			assert.Equal(t, tt.wantName, span.Name)
+			assert.Equal(t, trace.SpanKindServer, span.SpanKind)
+			assert.Equal(t, tt.wantCode, span.Status.Code)
+			assert.Contains(t, span.Attributes, semconv.HTTPResponseStatusCode(tt.wantStatus))
+			if tt.traceparent != "" {
+				assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span.SpanContext.TraceID().String())
+				assert.Equal(t, "00f067aa0ba902b7", span.Parent.SpanID().String())
+				assert.True(t, span.Parent.IsRemote())
+			} else {
+				assert.False(t, span.Parent.IsValid())
+			}
+			if tt.wantStatus == http.StatusOK {
+				assert.Equal(t, span.SpanContext.SpanID(), handlerSpan.SpanID())
+			}
+		})
+	}
+}
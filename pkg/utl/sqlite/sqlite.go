@@ -0,0 +1,121 @@
+package sqlite
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/XSAM/otelsql"
+	"github.com/jmoiron/sqlx"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+
+	// DB adapter
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// driverName is the sqlite3 driver wrapped with a span around every statement, like the postgres one
+var driverName = registerDriver()
+
+func registerDriver() string {
+	name, err := otelsql.Register("sqlite3",
+		otelsql.WithAttributes(semconv.DBSystemSqlite),
+		otelsql.WithSpanNameFormatter(spanName),
+		otelsql.WithSpanOptions(otelsql.SpanOptions{
+			OmitConnResetSession: true,
+			OmitRows:             true,
+		}),
+	)
+	if err != nil {
+		panic(err)
+	}
+	sqlx.BindDriver(name, sqlx.QUESTION)
+
+	return name
+}
+
+// spanName names statement spans by the SQL command, like SELECT or UPDATE, and other calls by the method
+func spanName(ctx context.Context, method otelsql.Method, query string) string {
+	if command, _, _ := strings.Cut(strings.TrimSpace(query), " "); command != "" {
+
+		return strings.ToUpper(command)
+	}
+
+	return string(method)
+}
+
+// defaultBusyTimeout is the BusyTimeout when it is not set
+const defaultBusyTimeout = 5 * time.Second
+
+// Config represents database connection specific config
+type Config struct {
+	// DSN is the database file, like cryptocom.db or file:cryptocom.db?cache=private
+	DSN string
+	// MaxOpenConns is unlimited when 0
+	MaxOpenConns int
+	// MaxIdleConns keeps database/sql default of 2 when 0
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+	// BusyTimeout is how long a statement waits for the lock held by the writing connection, 5 seconds when 0
+	BusyTimeout time.Duration
+}
+
+// New opens the sqlite database file of cfg, creating it when missing
+//
+// Every connection runs in WAL mode, so readers do not block the writer, with foreign keys on, and begins its
+// transactions with BEGIN IMMEDIATE, so a transaction takes the write lock before its first read and two writers
+// cannot both read a balance and then fail to upgrade their lock
+func New(cfg *Config) (*sqlx.DB, error) {
+	dsn, err := withParams(cfg.DSN, cfg.BusyTimeout)
+	if err != nil {
+
+		return nil, err
+	}
+	db, err := sqlx.Open(driverName, dsn)
+	if err != nil {
+
+		return nil, err
+	}
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	if cfg.MaxIdleConns > 0 {
+		db.SetMaxIdleConns(cfg.MaxIdleConns)
+	}
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// withParams adds the connection parameters of go-sqlite3 to the dsn, parameters already in the dsn win
+func withParams(dsn string, busyTimeout time.Duration) (string, error) {
+	if busyTimeout <= 0 {
+		busyTimeout = defaultBusyTimeout
+	}
+
+	path, rawQuery, _ := strings.Cut(dsn, "?")
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+
+		return "", err
+	}
+	for key, value := range map[string]string{
+		"_journal_mode": "WAL",
+		"_foreign_keys": "on",
+		"_txlock":       "immediate",
+		"_busy_timeout": strconv.FormatInt(busyTimeout.Milliseconds(), 10),
+	} {
+		if !query.Has(key) {
+			query.Set(key, value)
+		}
+	}
+
+	return path + "?" + query.Encode(), nil
+}
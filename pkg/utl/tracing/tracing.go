@@ -0,0 +1,53 @@
+// Package tracing sets up OpenTelemetry tracing
+package tracing
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+// Config represents tracing specific config
+type Config struct {
+	ServiceName string
+	// Endpoint is the host:port of the OTLP gRPC collector
+	Endpoint string
+	Insecure bool
+	// SampleRatio is the ratio of new traces to sample, traces started by a sampled parent are always sampled
+	SampleRatio float64
+}
+
+// Propagator propagates W3C trace context and baggage
+func Propagator() propagation.TextMapPropagator {
+
+	return propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+}
+
+// New creates tracer provider exporting spans over OTLP and sets it with the W3C propagator as global,
+// call Shutdown to flush the pending spans
+func New(ctx context.Context, cfg *Config) (*sdktrace.TracerProvider, error) {
+	opts := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(cfg.Endpoint)}
+	if cfg.Insecure {
+		opts = append(opts, otlptracegrpc.WithInsecure())
+	}
+	exporter, err := otlptracegrpc.New(ctx, opts...)
+	if err != nil {
+
+		return nil, err
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName(cfg.ServiceName))),
+	)
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(Propagator())
+
+	return tp, nil
+}
@@ -0,0 +1,39 @@
+package tracing_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+
+	"github.com/sappy5678/cryptocom/pkg/utl/tracing"
+)
+
+func TestNew(t *testing.T) {
+	// New sets the globals, they are restored for the other tests
+	defer otel.SetTextMapPropagator(otel.GetTextMapPropagator())
+	defer otel.SetTracerProvider(otel.GetTracerProvider())
+
+	tp, err := tracing.New(context.Background(), &tracing.Config{
+		ServiceName: "cryptocom",
+		Endpoint:    "localhost:4317",
+		Insecure:    true,
+		// nothing is exported to the missing collector
+		SampleRatio: 0,
+	})
+	assert.NoError(t, err)
+	defer tp.Shutdown(context.Background())
+
+	assert.Equal(t, tp, otel.GetTracerProvider())
+
+	// W3C trace context is propagated
+	ctx, span := otel.Tracer("test").Start(context.Background(), "test")
+	defer span.End()
+	assert.False(t, span.SpanContext().IsSampled())
+	header := http.Header{}
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(header))
+	assert.Contains(t, header.Get("traceparent"), span.SpanContext().TraceID().String())
+}
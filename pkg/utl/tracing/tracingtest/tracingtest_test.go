@@ -0,0 +1,22 @@
+package tracingtest_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/sappy5678/cryptocom/pkg/utl/tracing/tracingtest"
+)
+
+func TestNewInMemory(t *testing.T) {
+	tp, exporter := tracingtest.NewInMemory()
+	defer tp.Shutdown(context.Background())
+
+	_, span := tp.Tracer("test").Start(context.Background(), "test")
+	span.End()
+
+	spans := exporter.GetSpans()
+	assert.Len(t, spans, 1)
+	assert.Equal(t, "test", spans[0].Name)
+}
@@ -0,0 +1,36 @@
+package zlog
+
+import "context"
+
+type contextKey int
+
+const (
+	requestIDKey contextKey = iota
+	userIDKey
+)
+
+// WithRequestID returns a copy of ctx carrying the request ID, it is added to every entry logged with ctx
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+
+	return context.WithValue(ctx, requestIDKey, requestID)
+}
+
+// RequestID returns the request ID of ctx
+func RequestID(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey).(string)
+
+	return requestID
+}
+
+// WithUserID returns a copy of ctx carrying the user ID, it is added to every entry logged with ctx
+func WithUserID(ctx context.Context, userID string) context.Context {
+
+	return context.WithValue(ctx, userIDKey, userID)
+}
+
+// UserID returns the user ID of ctx
+func UserID(ctx context.Context) string {
+	userID, _ := ctx.Value(userIDKey).(string)
+
+	return userID
+}
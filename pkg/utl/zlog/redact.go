@@ -0,0 +1,90 @@
+package zlog
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// redactedValue replaces the value of redacted params
+const redactedValue = "[REDACTED]"
+
+// redactor holds the lower-cased keys and dotted paths to redact
+type redactor map[string]struct{}
+
+func newRedactor(keys []string) redactor {
+	r := redactor{}
+	for _, key := range keys {
+		r[strings.ToLower(key)] = struct{}{}
+	}
+
+	return r
+}
+
+func (r redactor) match(key, path string) bool {
+	if _, ok := r[strings.ToLower(key)]; ok {
+
+		return true
+	}
+	_, ok := r[strings.ToLower(path)]
+
+	return ok
+}
+
+// params returns a copy of params with the matching values masked,
+// structs are converted to their JSON form so nested fields like req.ID can be masked
+func (r redactor) params(params map[string]interface{}) map[string]interface{} {
+	redacted := make(map[string]interface{}, len(params))
+	for key, value := range params {
+		if r.match(key, key) {
+			redacted[key] = redactedValue
+
+			continue
+		}
+		redacted[key] = r.value(key, value)
+	}
+
+	return redacted
+}
+
+func (r redactor) value(path string, value interface{}) interface{} {
+	switch value.(type) {
+	case nil, string, bool, int, int64, uint32, float64, time.Time, time.Duration, error:
+
+		return value
+	}
+
+	b, err := json.Marshal(value)
+	if err != nil {
+
+		return value
+	}
+	var decoded interface{}
+	if err := json.Unmarshal(b, &decoded); err != nil {
+
+		return value
+	}
+
+	return r.walk(path, decoded)
+}
+
+func (r redactor) walk(path string, value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, nested := range v {
+			nestedPath := path + "." + key
+			if r.match(key, nestedPath) {
+				v[key] = redactedValue
+
+				continue
+			}
+			v[key] = r.walk(nestedPath, nested)
+		}
+	case []interface{}:
+		for i, nested := range v {
+			v[i] = r.walk(path, nested)
+		}
+	}
+
+	return value
+}
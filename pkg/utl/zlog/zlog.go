@@ -2,26 +2,131 @@ package zlog
 
 import (
 	"context"
+	"io"
 	"os"
+	"time"
 
 	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel/trace"
+	"gopkg.in/natefinch/lumberjack.v2"
 )
 
 // Log represents zerolog logger
 type Log struct {
 	logger *zerolog.Logger
+	redact redactor
+	closer io.Closer
+}
+
+// Config represents logger specific config
+type Config struct {
+	// Level is one of trace, debug, info, warn, error or disabled, it defaults to info
+	Level string
+	// Format is json or console, it defaults to json
+	Format string
+	// File writes the log to a rotated file instead of stdout
+	File *FileConfig
+	// Sampling drops success entries over the burst, error entries are never dropped
+	Sampling *SamplingConfig
+	// Redact masks the values of these params, matched case-insensitively by key or dotted path like req.ID
+	Redact []string
+}
+
+// FileConfig represents log file rotation config
+type FileConfig struct {
+	Path       string
+	MaxSizeMB  int
+	MaxBackups int
+	MaxAgeDays int
+	Compress   bool
+}
+
+// SamplingConfig logs the first Burst success entries of every Period, then one of every Thereafter entries,
+// zero Thereafter drops the rest
+type SamplingConfig struct {
+	Burst uint32
+	// Period is one second when 0, zerolog never counts a burst without one
+	Period     time.Duration
+	Thereafter uint32
 }
 
 // New instantiates new zero logger
 func New() *Log {
-	z := zerolog.New(os.Stdout)
+
+	return NewWriter(os.Stdout)
+}
+
+// NewWriter instantiates new zero logger writing to w
+func NewWriter(w io.Writer) *Log {
+	z := zerolog.New(w)
+
+	return &Log{
+		logger: &z,
+	}
+}
+
+// NewWithConfig instantiates new zero logger from cfg, call Close to release the log file
+func NewWithConfig(cfg *Config) (*Log, error) {
+	level := zerolog.InfoLevel
+	if cfg.Level != "" {
+		var err error
+		if level, err = zerolog.ParseLevel(cfg.Level); err != nil {
+
+			return nil, err
+		}
+	}
+
+	var w io.Writer = os.Stdout
+	var closer io.Closer
+	if cfg.File != nil {
+		file := &lumberjack.Logger{
+			Filename:   cfg.File.Path,
+			MaxSize:    cfg.File.MaxSizeMB,
+			MaxBackups: cfg.File.MaxBackups,
+			MaxAge:     cfg.File.MaxAgeDays,
+			Compress:   cfg.File.Compress,
+		}
+		w, closer = file, file
+	}
+	if cfg.Format == "console" {
+		w = zerolog.ConsoleWriter{Out: w, TimeFormat: time.RFC3339, NoColor: cfg.File != nil}
+	}
+
+	z := zerolog.New(w).Level(level).With().Timestamp().Logger()
+	if cfg.Sampling != nil {
+		period := cfg.Sampling.Period
+		if period <= 0 {
+			period = time.Second
+		}
+		sampler := &zerolog.BurstSampler{
+			Burst:  cfg.Sampling.Burst,
+			Period: period,
+		}
+		// without NextSampler every entry over the burst is dropped
+		if cfg.Sampling.Thereafter > 0 {
+			sampler.NextSampler = &zerolog.BasicSampler{N: cfg.Sampling.Thereafter}
+		}
+		z = z.Sample(zerolog.LevelSampler{InfoSampler: sampler})
+	}
 
 	return &Log{
 		logger: &z,
+		redact: newRedactor(cfg.Redact),
+		closer: closer,
+	}, nil
+}
+
+// Close closes the log file
+func (z *Log) Close() error {
+	if z.closer == nil {
+
+		return nil
 	}
+
+	return z.closer.Close()
 }
 
-// Log logs using zerolog
+// Log logs using zerolog, the request ID, user ID and trace ID of ctx are added to the entry
 func (z *Log) Log(ctx context.Context, source, msg string, err error, params map[string]interface{}) {
 
 	if params == nil {
@@ -30,6 +135,22 @@ func (z *Log) Log(ctx context.Context, source, msg string, err error, params map
 
 	params["source"] = source
 
+	if ctx != nil {
+		if requestID := RequestID(ctx); requestID != "" {
+			params["requestID"] = requestID
+		}
+		if userID := UserID(ctx); userID != "" {
+			params["userID"] = userID
+		}
+		if spanContext := trace.SpanContextFromContext(ctx); spanContext.HasTraceID() {
+			params["traceID"] = spanContext.TraceID().String()
+		}
+	}
+
+	if len(z.redact) > 0 {
+		params = z.redact.params(params)
+	}
+
 	if err != nil {
 		params["error"] = err
 		z.logger.Error().Fields(params).Msg(msg)
@@ -1,10 +1,16 @@
 package zlog_test
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/sappy5678/cryptocom/pkg/utl/tracing/tracingtest"
 	"github.com/sappy5678/cryptocom/pkg/utl/zlog"
 	"github.com/stretchr/testify/assert"
 )
@@ -27,3 +33,211 @@ func TestLog(t *testing.T) {
 		log.Log(context.Background(), "test", "test", errors.New("test"), map[string]interface{}{"test": "test"})
 	})
 }
+
+func TestLogContext(t *testing.T) {
+	tp, _ := tracingtest.NewInMemory()
+	defer tp.Shutdown(context.Background())
+	tracedCtx, span := tp.Tracer("test").Start(context.Background(), "test")
+	defer span.End()
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want map[string]interface{}
+	}{
+		{
+			name: "no context values",
+			ctx:  context.Background(),
+			want: map[string]interface{}{"level": "info", "source": "test", "message": "test"},
+		},
+		{
+			name: "request ID and user ID",
+			ctx:  zlog.WithUserID(zlog.WithRequestID(context.Background(), "test-request-id"), "test-user-id"),
+			want: map[string]interface{}{
+				"level":     "info",
+				"source":    "test",
+				"message":   "test",
+				"requestID": "test-request-id",
+				"userID":    "test-user-id",
+			},
+		},
+		{
+			name: "trace ID",
+			ctx:  tracedCtx,
+			want: map[string]interface{}{
+				"level":   "info",
+				"source":  "test",
+				"message": "test",
+				"traceID": span.SpanContext().TraceID().String(),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := new(bytes.Buffer)
+			log := zlog.NewWriter(buf)
+			log.Log(tt.ctx, "test", "test", nil, nil)
+
+			got := map[string]interface{}{}
+			assert.NoError(t, json.Unmarshal(buf.Bytes(), &got))
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+// readEntries reads the JSON log entries of the file
+func readEntries(t *testing.T, path string) []map[string]interface{} {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := []map[string]interface{}{}
+	for _, line := range bytes.Split(bytes.TrimSpace(b), []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		entry := map[string]interface{}{}
+		assert.NoError(t, json.Unmarshal(line, &entry))
+		delete(entry, "time")
+		entries = append(entries, entry)
+	}
+
+	return entries
+}
+
+func TestNewWithConfig(t *testing.T) {
+	type user struct {
+		ID string `json:"ID"`
+	}
+
+	tests := []struct {
+		name        string
+		cfg         zlog.Config
+		log         func(log *zlog.Log)
+		wantErr     bool
+		wantEntries []map[string]interface{}
+	}{
+		{
+			name:    "invalid level",
+			cfg:     zlog.Config{Level: "loud"},
+			wantErr: true,
+		},
+		{
+			name: "level",
+			cfg:  zlog.Config{Level: "error"},
+			log: func(log *zlog.Log) {
+				log.Log(context.Background(), "test", "success", nil, nil)
+				log.Log(context.Background(), "test", "failure", errors.New("test"), nil)
+			},
+			wantEntries: []map[string]interface{}{
+				{"level": "error", "source": "test", "message": "failure", "error": "test"},
+			},
+		},
+		{
+			name: "sampling",
+			cfg:  zlog.Config{Sampling: &zlog.SamplingConfig{Burst: 2, Period: time.Hour}},
+			log: func(log *zlog.Log) {
+				for i := 0; i < 5; i++ {
+					log.Log(context.Background(), "test", "success", nil, map[string]interface{}{"i": i})
+				}
+				log.Log(context.Background(), "test", "failure", errors.New("test"), nil)
+			},
+			wantEntries: []map[string]interface{}{
+				{"level": "info", "source": "test", "message": "success", "i": float64(0)},
+				{"level": "info", "source": "test", "message": "success", "i": float64(1)},
+				{"level": "error", "source": "test", "message": "failure", "error": "test"},
+			},
+		},
+		{
+			name: "sampling default period",
+			cfg:  zlog.Config{Sampling: &zlog.SamplingConfig{Burst: 2}},
+			log: func(log *zlog.Log) {
+				for i := 0; i < 5; i++ {
+					log.Log(context.Background(), "test", "success", nil, map[string]interface{}{"i": i})
+				}
+			},
+			wantEntries: []map[string]interface{}{
+				{"level": "info", "source": "test", "message": "success", "i": float64(0)},
+				{"level": "info", "source": "test", "message": "success", "i": float64(1)},
+			},
+		},
+		{
+			name: "sampling thereafter",
+			cfg:  zlog.Config{Sampling: &zlog.SamplingConfig{Burst: 1, Period: time.Hour, Thereafter: 2}},
+			log: func(log *zlog.Log) {
+				for i := 0; i < 4; i++ {
+					log.Log(context.Background(), "test", "success", nil, map[string]interface{}{"i": i})
+				}
+			},
+			wantEntries: []map[string]interface{}{
+				{"level": "info", "source": "test", "message": "success", "i": float64(0)},
+				{"level": "info", "source": "test", "message": "success", "i": float64(1)},
+				{"level": "info", "source": "test", "message": "success", "i": float64(3)},
+			},
+		},
+		{
+			name: "redact",
+			cfg:  zlog.Config{Redact: []string{"userID", "req.ID", "address"}},
+			log: func(log *zlog.Log) {
+				ctx := zlog.WithUserID(zlog.WithRequestID(context.Background(), "test-request-id"), "test-user-id")
+				log.Log(ctx, "test", "test", nil, map[string]interface{}{
+					"req":     user{ID: "test-user-id"},
+					"other":   user{ID: "kept"},
+					"Address": "1 Main St",
+					"amount":  100,
+				})
+			},
+			wantEntries: []map[string]interface{}{
+				{
+					"level":     "info",
+					"source":    "test",
+					"message":   "test",
+					"requestID": "test-request-id",
+					"userID":    "[REDACTED]",
+					"req":       map[string]interface{}{"ID": "[REDACTED]"},
+					"other":     map[string]interface{}{"ID": "kept"},
+					"Address":   "[REDACTED]",
+					"amount":    float64(100),
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "cryptocom.log")
+			tt.cfg.File = &zlog.FileConfig{Path: path, MaxSizeMB: 1}
+			log, err := zlog.NewWithConfig(&tt.cfg)
+			if tt.wantErr {
+				assert.Error(t, err)
+
+				return
+			}
+			assert.NoError(t, err)
+
+			tt.log(log)
+			assert.NoError(t, log.Close())
+			assert.Equal(t, tt.wantEntries, readEntries(t, path))
+		})
+	}
+}
+
+func TestNewWithConfigConsole(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cryptocom.log")
+	log, err := zlog.NewWithConfig(&zlog.Config{Format: "console", File: &zlog.FileConfig{Path: path}})
+	assert.NoError(t, err)
+
+	log.Log(context.Background(), "test", "hello", nil, map[string]interface{}{"amount": 100})
+	assert.NoError(t, log.Close())
+
+	b, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Contains(t, string(b), "INF hello amount=100 source=test")
+}
+
+func TestNewWithConfigStdout(t *testing.T) {
+	log, err := zlog.NewWithConfig(&zlog.Config{})
+	assert.NoError(t, err)
+	assert.NoError(t, log.Close())
+}